@@ -0,0 +1,577 @@
+// Package libclient is a client for the web app's JSON API.
+//
+// It is written from the OpenAPI document that webcmd serves at
+// /openapi.json, and covers the versioned routes under /api/v1.
+package libclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+	"github.com/topher200/forty-thieves/libsolver"
+)
+
+// APIPrefix is the path the API's routes are under
+const APIPrefix = "/api/v1"
+
+// Error codes the API sends in Error.Code
+const (
+	CodeNotFound         = "not_found"
+	CodeInvalidRequest   = "invalid_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeIllegalMove      = "illegal_move"
+	CodeConflict         = "conflict"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeInternal         = "internal"
+)
+
+// GameState is a game state as the API sends it: with the ids of the states
+// that have been reached from it, and whether it can still be won
+type GameState struct {
+	GameID            int64
+	GameStateID       uuid.UUID
+	PreviousGameState uuid.NullUUID
+	MoveNum           int64
+	Stock             deck.Deck
+	Foundations       []deck.Deck
+	Tableaus          []deck.Deck
+	Waste             deck.Deck
+	Score             int
+	ChildGameStates   []uuid.UUID
+	Status            libgame.GameStatus
+	Lost              bool   // true if the game provably can't be won from here
+	LostReason        string // why the game can't be won, if Lost
+}
+
+// Hint is a suggested next move, from a short search
+type Hint struct {
+	Move      *libgame.MoveRequest // nil if the search found nothing better than the current state
+	Solved    bool                 // true if the search found a solution
+	Moves     []libgame.MoveRequest
+	BestScore int
+}
+
+// User is a user of the web app
+type User struct {
+	ID          int64
+	Email       string
+	DisplayName string // what other users see them as
+}
+
+// UserStats sums up the games a user has dealt. The *ToWin fields are nil until
+// they've won a game
+type UserStats struct {
+	GamesPlayed         int64
+	GamesWon            int64
+	BestMovesToWin      *int64
+	AverageMovesToWin   *float64
+	BestSecondsToWin    *float64
+	AverageSecondsToWin *float64
+	Hints               int64
+	Undos               int64
+}
+
+// LeaderboardEntry is a user's place on the leaderboard
+type LeaderboardEntry struct {
+	Rank             int
+	Name             string
+	GamesPlayed      int64
+	GamesWon         int64
+	BestMovesToWin   int64
+	BestSecondsToWin float64
+}
+
+// DailyAttempt is a user's attempt at a day's deal. The result fields are nil
+// until it's submitted
+type DailyAttempt struct {
+	Date             string // like "2006-01-02"
+	GameID           int64
+	FirstGameStateID uuid.UUID
+	Submitted        bool
+	Score            *int64
+	Moves            *int64
+	Seconds          *float64
+	Rank             *int64
+}
+
+// DailyResult is a submitted result, ranked among the day's others
+type DailyResult struct {
+	Rank    int64
+	Name    string
+	Score   int64
+	Moves   int64
+	Seconds float64
+}
+
+// DailyDeal is a day's deal, with its results so far, best first
+type DailyDeal struct {
+	Date    string
+	Results []DailyResult
+}
+
+// GameTreeCounts sums up a game state and its descendants in a GameTree
+type GameTreeCounts struct {
+	States      int64
+	Unprocessed int64
+	Claimed     int64
+	Processed   int64
+	BestScore   int
+}
+
+// GameTreeNode is a game state in a GameTree, with its children in the tree,
+// lowest score first
+type GameTreeNode struct {
+	GameStateID uuid.UUID
+	MoveNum     int64
+	Depth       int
+	Score       int
+	Status      string               // UNPROCESSED, CLAIMED or PROCESSED
+	Move        *libgame.MoveRequest // the move from the parent. nil for the root
+	ChildCount  int64                // including children deeper than the tree goes
+	Counts      GameTreeCounts
+	Children    []*GameTreeNode
+}
+
+// GameTree is the subtree of game states reached from its root
+type GameTree struct {
+	Root      *GameTreeNode
+	Depth     int
+	Truncated bool // true if the tree was cut short by the limit
+}
+
+// APIToken is a token that a user can authenticate with instead of logging in
+type APIToken struct {
+	ID      int64
+	Name    string
+	Token   string // only returned by CreateAPIToken
+	Created time.Time
+}
+
+// Error is a request that the API failed
+type Error struct {
+	StatusCode int
+	Code       string // one of the Code* constants
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Client makes requests to the API at BaseURL
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client // keeps the session cookie once logged in
+
+	// ShareToken is sent with moves, to play a game that someone else owns
+	ShareToken string
+	// APIToken, if set, is sent with every request to authenticate as its user
+	APIToken string
+}
+
+// NewClient is the constructor for Client. baseURL is the web app's address,
+// like "http://localhost:8888"
+func NewClient(baseURL string) *Client {
+	jar, _ := cookiejar.New(nil) // never fails
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Jar: jar},
+	}
+}
+
+// Signup creates a user and logs in as them.
+//
+// Returns an Error with CodeConflict if the email is taken.
+func (c *Client) Signup(email string, password string) (*User, error) {
+	var user User
+	credentials := map[string]string{"Email": email, "Password": password}
+	err := c.do("POST", "/users", credentials, http.StatusCreated, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Login logs in as the user.
+//
+// Returns an Error with CodeUnauthorized if the email or password is wrong.
+func (c *Client) Login(email string, password string) (*User, error) {
+	var user User
+	credentials := map[string]string{"Email": email, "Password": password}
+	err := c.do("POST", "/login", credentials, http.StatusOK, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Logout logs the user out
+func (c *Client) Logout() error {
+	return c.do("POST", "/logout", nil, http.StatusNoContent, nil)
+}
+
+// Me returns the logged in user.
+//
+// Returns an Error with CodeUnauthorized if nobody is logged in.
+func (c *Client) Me() (*User, error) {
+	var user User
+	err := c.do("GET", "/users/me", nil, http.StatusOK, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Stats sums up the games the user has dealt
+func (c *Client) Stats() (*UserStats, error) {
+	var stats UserStats
+	err := c.do("GET", "/users/me/stats", nil, http.StatusOK, &stats)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Leaderboard returns the users who have won the most games, best first. A
+// limit of 0 gets the API's default number of users
+func (c *Client) Leaderboard(limit int) ([]LeaderboardEntry, error) {
+	path := "/leaderboard"
+	if limit != 0 {
+		path += fmt.Sprintf("?limit=%d", limit)
+	}
+	var entries []LeaderboardEntry
+	err := c.do("GET", path, nil, http.StatusOK, &entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// StartDaily starts the user's attempt at today's deal, and returns its first
+// game state.
+//
+// Returns an Error with CodeConflict if the user has already attempted it.
+func (c *Client) StartDaily() (*GameState, error) {
+	var gameState GameState
+	err := c.do("POST", "/daily/attempts", nil, http.StatusCreated, &gameState)
+	if err != nil {
+		return nil, err
+	}
+	return &gameState, nil
+}
+
+// SubmitDaily submits the result of the user's attempt at the date's deal,
+// taken from the game state, and returns the attempt. The date is like
+// "2006-01-02", or "today".
+//
+// Returns an Error with CodeConflict if the result has already been submitted.
+func (c *Client) SubmitDaily(date string, gameStateID uuid.UUID) (*DailyAttempt, error) {
+	var attempt DailyAttempt
+	submission := map[string]uuid.UUID{"GameStateID": gameStateID}
+	err := c.do("POST", "/daily/attempts/"+url.PathEscape(date)+"/result", submission,
+		http.StatusOK, &attempt)
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// DailyHistory returns the user's attempts at daily deals, newest first
+func (c *Client) DailyHistory() ([]DailyAttempt, error) {
+	var attempts []DailyAttempt
+	err := c.do("GET", "/daily/attempts", nil, http.StatusOK, &attempts)
+	if err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// Daily returns the date's deal, with its results so far. The date is like
+// "2006-01-02", or "today"
+func (c *Client) Daily(date string) (*DailyDeal, error) {
+	var deal DailyDeal
+	err := c.do("GET", "/daily/"+url.PathEscape(date), nil, http.StatusOK, &deal)
+	if err != nil {
+		return nil, err
+	}
+	return &deal, nil
+}
+
+// Share returns the token that lets others play the game state's game. Only
+// the game's owner can share it
+func (c *Client) Share(gameStateID uuid.UUID) (string, error) {
+	var share struct {
+		ShareToken string
+	}
+	err := c.do("GET", statePath(gameStateID, "/share"), nil, http.StatusOK, &share)
+	if err != nil {
+		return "", err
+	}
+	return share.ShareToken, nil
+}
+
+// SetDisplayName changes the name other users see the user as, on the
+// leaderboard and in the daily results
+func (c *Client) SetDisplayName(name string) (*User, error) {
+	var user User
+	err := c.do("PUT", "/users/me/name", map[string]string{"DisplayName": name}, http.StatusOK, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CreateAPIToken creates an API token for the user, named for what it's for.
+// The returned APIToken's Token is the only time the token is sent
+func (c *Client) CreateAPIToken(name string) (*APIToken, error) {
+	var token APIToken
+	err := c.do("POST", "/tokens", map[string]string{"Name": name}, http.StatusCreated, &token)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// APITokens returns the user's API tokens, without their Tokens
+func (c *Client) APITokens() ([]APIToken, error) {
+	var tokens []APIToken
+	err := c.do("GET", "/tokens", nil, http.StatusOK, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// DeleteAPIToken deletes one of the user's API tokens
+func (c *Client) DeleteAPIToken(id int64) error {
+	return c.do("DELETE", fmt.Sprintf("/tokens/%d", id), nil, http.StatusNoContent, nil)
+}
+
+// NewGame deals a new game and returns its first game state
+func (c *Client) NewGame() (*GameState, error) {
+	var gameState GameState
+	err := c.do("POST", "/games", nil, http.StatusCreated, &gameState)
+	if err != nil {
+		return nil, err
+	}
+	return &gameState, nil
+}
+
+// LatestState returns the first game state of the latest game
+func (c *Client) LatestState() (*GameState, error) {
+	var gameState GameState
+	err := c.do("GET", "/states/latest", nil, http.StatusOK, &gameState)
+	if err != nil {
+		return nil, err
+	}
+	return &gameState, nil
+}
+
+// State returns the game state
+func (c *Client) State(gameStateID uuid.UUID) (*GameState, error) {
+	var gameState GameState
+	err := c.do("GET", statePath(gameStateID, ""), nil, http.StatusOK, &gameState)
+	if err != nil {
+		return nil, err
+	}
+	return &gameState, nil
+}
+
+// Move makes the move from the game state and returns the new game state. The
+// move may be libsolver.FlipStockMove.
+//
+// Returns an Error with CodeIllegalMove if the game doesn't allow the move, with
+// CodeConflict if the game has already reached the state the move leads to, or
+// with CodeForbidden if the game belongs to someone else and ShareToken isn't
+// its token.
+func (c *Client) Move(gameStateID uuid.UUID, move libgame.MoveRequest) (*GameState, error) {
+	var gameState GameState
+	err := c.do("POST", c.withShare(statePath(gameStateID, "/moves")), &move,
+		http.StatusCreated, &gameState)
+	if err != nil {
+		return nil, err
+	}
+	return &gameState, nil
+}
+
+// FoundationCard moves a card from the game state onto a foundation and
+// returns the new game state.
+//
+// Returns an Error with CodeIllegalMove if no card can be moved.
+func (c *Client) FoundationCard(gameStateID uuid.UUID) (*GameState, error) {
+	var gameState GameState
+	err := c.do("POST", c.withShare(statePath(gameStateID, "/foundationcard")), nil,
+		http.StatusCreated, &gameState)
+	if err != nil {
+		return nil, err
+	}
+	return &gameState, nil
+}
+
+// Hint suggests the next move from the game state. The hint counts towards the
+// game's stats if the user can move in it
+func (c *Client) Hint(gameStateID uuid.UUID) (*Hint, error) {
+	var hint Hint
+	err := c.do("GET", c.withShare(statePath(gameStateID, "/hint")), nil, http.StatusOK, &hint)
+	if err != nil {
+		return nil, err
+	}
+	return &hint, nil
+}
+
+// Difficulty gets how hard the game state's game was rated. Fails with
+// CodeNotFound if the game hasn't been rated yet
+func (c *Client) Difficulty(gameStateID uuid.UUID) (*libsolver.Difficulty, error) {
+	var difficulty libsolver.Difficulty
+	err := c.do("GET", statePath(gameStateID, "/difficulty"), nil, http.StatusOK, &difficulty)
+	if err != nil {
+		return nil, err
+	}
+	return &difficulty, nil
+}
+
+// RateDifficulty rates how hard the game state's game is, if it hasn't been
+// rated yet. Only admins can rate games
+func (c *Client) RateDifficulty(gameStateID uuid.UUID) (*libsolver.Difficulty, error) {
+	var difficulty libsolver.Difficulty
+	err := c.do("POST", statePath(gameStateID, "/difficulty"), nil, http.StatusOK, &difficulty)
+	if err != nil {
+		return nil, err
+	}
+	return &difficulty, nil
+}
+
+// BoardSVG draws the game state's piles as an SVG picture
+func (c *Client) BoardSVG(gameStateID uuid.UUID) ([]byte, error) {
+	var svg []byte
+	err := c.do("GET", statePath(gameStateID, "/board.svg"), nil, http.StatusOK, &svg)
+	if err != nil {
+		return nil, err
+	}
+	return svg, nil
+}
+
+// BoardPNG draws the game state's piles as a PNG picture
+func (c *Client) BoardPNG(gameStateID uuid.UUID) ([]byte, error) {
+	var png []byte
+	err := c.do("GET", statePath(gameStateID, "/board.png"), nil, http.StatusOK, &png)
+	if err != nil {
+		return nil, err
+	}
+	return png, nil
+}
+
+// StateTree returns the tree of game states reached from the game state,
+// depth moves deep and with at most limit game states. A limit of 0 gets the
+// API's default limit
+func (c *Client) StateTree(gameStateID uuid.UUID, depth int, limit int) (*GameTree, error) {
+	return c.gameTree(statePath(gameStateID, "/tree"), depth, limit)
+}
+
+// GameTree returns the tree of game states reached from the game's first game
+// state, like StateTree
+func (c *Client) GameTree(gameID int64, depth int, limit int) (*GameTree, error) {
+	return c.gameTree(fmt.Sprintf("/games/%d/tree", gameID), depth, limit)
+}
+
+func (c *Client) gameTree(path string, depth int, limit int) (*GameTree, error) {
+	path += fmt.Sprintf("?depth=%d", depth)
+	if limit != 0 {
+		path += fmt.Sprintf("&limit=%d", limit)
+	}
+	var tree GameTree
+	err := c.do("GET", path, nil, http.StatusOK, &tree)
+	if err != nil {
+		return nil, err
+	}
+	return &tree, nil
+}
+
+func statePath(gameStateID uuid.UUID, action string) string {
+	return fmt.Sprintf("/states/%s%s", gameStateID, action)
+}
+
+// withShare adds the ShareToken to the path of a request that moves
+func (c *Client) withShare(path string) string {
+	if c.ShareToken == "" {
+		return path
+	}
+	return path + "?share=" + url.QueryEscape(c.ShareToken)
+}
+
+// do sends the request, with body as JSON if it isn't nil, and decodes the
+// response into result, unless it's nil. Results that are *[]byte get the
+// response as it was sent.
+//
+// Returns an *Error if the API responded with an error, or error if the
+// response wasn't the status we expected.
+func (c *Client) do(
+	method string, path string, body interface{}, status int, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("Error encoding request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.BaseURL+APIPrefix+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if method != "GET" {
+		// the API only takes changes sent as JSON, even without a body
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIToken)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Error reading response to %s %s: %v", method, path, err)
+	}
+
+	if resp.StatusCode != status {
+		var errorResponse struct {
+			Error *Error
+		}
+		if json.Unmarshal(data, &errorResponse) == nil && errorResponse.Error != nil {
+			errorResponse.Error.StatusCode = resp.StatusCode
+			return errorResponse.Error
+		}
+		return fmt.Errorf("Unexpected response to %s %s: %s: %s",
+			method, path, resp.Status, data)
+	}
+	if result == nil {
+		return nil
+	}
+	if raw, ok := result.(*[]byte); ok {
+		*raw = data
+		return nil
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("Error decoding response to %s %s: %v", method, path, err)
+	}
+	return nil
+}
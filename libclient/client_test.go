@@ -0,0 +1,90 @@
+package libclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/forty-thieves/libgame"
+	"github.com/topher200/forty-thieves/libsolver"
+)
+
+func TestMoveSendsJSON(t *testing.T) {
+	gameStateID := uuid.NewV4()
+	newGameStateID := uuid.NewV4()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/api/v1/states/"+gameStateID.String()+"/moves", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var move libgame.MoveRequest
+		err := json.NewDecoder(r.Body).Decode(&move)
+		assert.Nil(t, err)
+		assert.Equal(t, libsolver.FlipStockMove, move)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&GameState{GameStateID: newGameStateID})
+	}))
+	defer server.Close()
+
+	gameState, err := NewClient(server.URL+"/").Move(gameStateID, libsolver.FlipStockMove)
+	assert.Nil(t, err)
+	assert.Equal(t, newGameStateID, gameState.GameStateID)
+}
+
+func TestErrorsAreDecoded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"Error":{"Code":"not_found","Message":"Game state id not found"}}`))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL).State(uuid.NewV4())
+	assert.Equal(t, &Error{404, CodeNotFound, "Game state id not found"}, err)
+}
+
+func TestUnexpectedResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL).LatestState()
+	assert.NotNil(t, err)
+	_, ok := err.(*Error)
+	assert.False(t, ok)
+	assert.Contains(t, err.Error(), "bad gateway")
+}
+
+func TestAPITokenIsSent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ID":1,"Email":"someone@example.com","DisplayName":"player-1"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.APIToken = "secret"
+	user, err := client.Me()
+	assert.Nil(t, err)
+	assert.Equal(t, &User{1, "someone@example.com", "player-1"}, user)
+}
+
+func TestBoardImageIsRaw(t *testing.T) {
+	gameStateID := uuid.NewV4()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/states/"+gameStateID.String()+"/board.svg", r.URL.Path)
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write([]byte("<svg/>"))
+	}))
+	defer server.Close()
+
+	svg, err := NewClient(server.URL).BoardSVG(gameStateID)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("<svg/>"), svg)
+}
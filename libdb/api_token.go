@@ -0,0 +1,147 @@
+package libdb
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/jmoiron/sqlx"
+)
+
+type APITokenDB struct {
+	Base
+}
+
+type APITokenRow struct {
+	ID        int64     `db:"id"`
+	UserID    int64     `db:"user_id"`
+	Name      string    `db:"name"`
+	TokenHash string    `db:"token_hash"`
+	Created   time.Time `db:"created"`
+}
+
+func NewAPITokenDB(db *sqlx.DB) *APITokenDB {
+	a := &APITokenDB{}
+	a.db = db
+	a.table = "api_tokens"
+	a.hasID = true
+
+	return a
+}
+
+// hashAPIToken is what we store instead of the token. Tokens are random, unlike
+// passwords, so a fast hash is enough, and lets us look tokens up by it
+func hashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateAPIToken creates a new API token for the user, saves its hash to the
+// database, and returns the token along with its row. The token itself can't
+// be gotten again.
+func (db *APITokenDB) CreateAPIToken(
+	tx *sqlx.Tx, userID int64, name string) (string, *APITokenRow, error) {
+	if name == "" {
+		return "", nil, errors.New("Name cannot be blank.")
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", nil, fmt.Errorf("Error creating API token: %v", err)
+	}
+	token := hex.EncodeToString(tokenBytes)
+	dataMap := map[string]interface{}{
+		"user_id":    userID,
+		"name":       name,
+		"token_hash": hashAPIToken(token),
+	}
+	insertResult, err := db.InsertIntoTable(tx, dataMap)
+	if err != nil {
+		logrus.Warning("error saving API token: ", err)
+		return "", nil, err
+	}
+
+	id, err := insertResult.LastInsertId()
+	if err != nil {
+		return "", nil, err
+	}
+	logrus.WithFields(logrus.Fields{
+		"id":     id,
+		"userID": userID,
+	}).Info("saved new API token to db")
+	row, err := db.getAPIToken(tx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, row, nil
+}
+
+func (db *APITokenDB) getAPIToken(tx *sqlx.Tx, id int64) (*APITokenRow, error) {
+	var row APITokenRow
+	query := fmt.Sprintf("SELECT * FROM %s WHERE id=$1", db.table)
+	var err error
+	if tx != nil {
+		err = tx.Get(&row, query, id)
+	} else {
+		err = db.db.Get(&row, query, id)
+	}
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError{"API token"}
+	} else if err != nil {
+		return nil, fmt.Errorf("Error on query: %v", err)
+	}
+	return &row, nil
+}
+
+// GetUserByAPIToken returns the user the API token belongs to
+//
+// Returns NotFoundError if there is no such token
+func (db *APITokenDB) GetUserByAPIToken(token string) (*UserRow, error) {
+	var user UserRow
+	query := fmt.Sprintf(
+		"SELECT users.* FROM users JOIN %s ON users.id = %s.user_id WHERE token_hash=$1",
+		db.table, db.table)
+	err := db.db.Get(&user, query, hashAPIToken(token))
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError{"API token"}
+	} else if err != nil {
+		return nil, fmt.Errorf("Error on query: %v", err)
+	}
+	return &user, nil
+}
+
+// GetAPITokens returns the user's API tokens, oldest first
+func (db *APITokenDB) GetAPITokens(userID int64) ([]APITokenRow, error) {
+	var rows []APITokenRow
+	query := fmt.Sprintf("SELECT * FROM %s WHERE user_id=$1 ORDER BY id", db.table)
+	err := db.db.Select(&rows, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Error on query: %v", err)
+	}
+	return rows, nil
+}
+
+// DeleteAPIToken deletes one of the user's API tokens
+//
+// Returns NotFoundError if the user has no token with the id
+func (db *APITokenDB) DeleteAPIToken(tx *sqlx.Tx, userID int64, id int64) error {
+	queryWhereStatement := fmt.Sprintf("id=%d AND user_id=%d", id, userID)
+	res, err := db.DeleteFromTable(tx, queryWhereStatement)
+	if err != nil {
+		logrus.Warning("Error deleting API token: ", err)
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return NotFoundError{"API token"}
+	}
+	return nil
+}
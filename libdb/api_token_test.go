@@ -0,0 +1,39 @@
+package libdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIToken(t *testing.T) {
+	userDB := newUserDBForTest(t)
+	user, err := userDB.Signup(nil, newEmailForTest(), "correct horse")
+	assert.Nil(t, err)
+	defer userDB.DeleteUser(nil, user.ID)
+
+	apiTokenDB := NewAPITokenDB(userDB.db)
+	token, row, err := apiTokenDB.CreateAPIToken(nil, user.ID, "laptop")
+	assert.Nil(t, err)
+	assert.Len(t, token, 64)
+	assert.Equal(t, user.ID, row.UserID)
+	assert.Equal(t, "laptop", row.Name)
+	assert.NotEqual(t, token, row.TokenHash)
+
+	retrieved, err := apiTokenDB.GetUserByAPIToken(token)
+	assert.Nil(t, err)
+	assert.Equal(t, *user, *retrieved)
+	_, err = apiTokenDB.GetUserByAPIToken(row.TokenHash)
+	assert.IsType(t, NotFoundError{}, err)
+
+	rows, err := apiTokenDB.GetAPITokens(user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []APITokenRow{*row}, rows)
+
+	// only the token's user can delete it
+	err = apiTokenDB.DeleteAPIToken(nil, user.ID+1, row.ID)
+	assert.IsType(t, NotFoundError{}, err)
+	assert.Nil(t, apiTokenDB.DeleteAPIToken(nil, user.ID, row.ID))
+	_, err = apiTokenDB.GetUserByAPIToken(token)
+	assert.IsType(t, NotFoundError{}, err)
+}
@@ -25,6 +25,15 @@ func (ir *InsertResult) RowsAffected() (int64, error) {
 	return ir.rowsAffected, nil
 }
 
+// NotFoundError is returned when a query for a single row finds nothing
+type NotFoundError struct {
+	what string
+}
+
+func (n NotFoundError) Error() string {
+	return fmt.Sprintf("%s not found", n.what)
+}
+
 func newDbForTest(t *testing.T) *sqlx.DB {
 	var err error
 
@@ -93,6 +102,21 @@ func (b *Base) newTransactionIfNeeded(tx *sqlx.Tx) (*sqlx.Tx, bool, error) {
 	return tx, wrapInSingleTransaction, nil
 }
 
+// exec runs the query in the transaction, or on its own if tx is nil
+func (b *Base) exec(tx *sqlx.Tx, query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	var err error
+	if tx != nil {
+		result, err = tx.Exec(query, args...)
+	} else {
+		result, err = b.db.Exec(query, args...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error on query: %v", err)
+	}
+	return result, nil
+}
+
 func (b *Base) InsertIntoTable(tx *sqlx.Tx, data map[string]interface{}) (sql.Result, error) {
 	if b.table == "" {
 		return nil, errors.New("Table must not be empty.")
@@ -0,0 +1,241 @@
+package libdb
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// DailyDateFormat is how the date of a daily deal is written
+const DailyDateFormat = "2006-01-02"
+
+type DailyDB struct {
+	Base
+}
+
+// DailyAttemptRow is a user's attempt at a day's deal. Score and Moves are
+// only valid once they've submitted their result
+type DailyAttemptRow struct {
+	ID             int64         `db:"id"`
+	Date           time.Time     `db:"date"`
+	UserID         int64         `db:"user_id"`
+	GameID         int64         `db:"game_id"`
+	FirstGameState uuid.UUID     `db:"first_game_state"`
+	Started        time.Time     `db:"started"`
+	Submitted      pq.NullTime   `db:"submitted"`
+	Score          sql.NullInt64 `db:"score"`
+	Moves          sql.NullInt64 `db:"moves"`
+}
+
+// DailyHistoryRow is an attempt, with its rank among the day's submitted
+// results. Rank and Seconds are only valid once the result is submitted
+type DailyHistoryRow struct {
+	DailyAttemptRow
+	Rank    sql.NullInt64   `db:"rank"`
+	Seconds sql.NullFloat64 `db:"seconds"`
+}
+
+// DailyResultRow is a submitted result, ranked among the day's others
+type DailyResultRow struct {
+	Rank        int64          `db:"rank"`
+	UserID      int64          `db:"user_id"`
+	DisplayName sql.NullString `db:"display_name"`
+	Score       int64          `db:"score"`
+	Moves       int64          `db:"moves"`
+	Seconds     float64        `db:"seconds"`
+}
+
+func NewDailyDB(db *sqlx.DB) *DailyDB {
+	d := &DailyDB{}
+	d.db = db
+	d.table = "daily_attempts"
+	d.hasID = true
+
+	return d
+}
+
+type DuplicateDailyAttemptError struct {
+	err error
+}
+
+func (d DuplicateDailyAttemptError) Error() string {
+	return "duplicate daily attempt error"
+}
+
+type AlreadySubmittedError struct{}
+
+func (a AlreadySubmittedError) Error() string {
+	return "daily result already submitted"
+}
+
+const (
+	// attemptSeconds is how long an attempt took, from when it started until
+	// its result was submitted
+	attemptSeconds = "EXTRACT(EPOCH FROM submitted - started)"
+	// attemptRank ranks submitted results among the day's others: the lowest
+	// score first, then the fewest moves, then the quickest
+	attemptRank = "rank() OVER (PARTITION BY date, submitted IS NULL ORDER BY score, moves, " +
+		attemptSeconds + ")"
+)
+
+// StartAttempt saves the user's attempt at the date's deal, with the game and
+// first game state they're playing it in
+//
+// Returns DuplicateDailyAttemptError if the user has already attempted the deal.
+func (db *DailyDB) StartAttempt(
+	tx *sqlx.Tx, date time.Time, userID int64, gameState libgame.GameState) (*DailyAttemptRow, error) {
+	dataMap := map[string]interface{}{
+		"date":             date.Format(DailyDateFormat),
+		"user_id":          userID,
+		"game_id":          gameState.GameID,
+		"first_game_state": gameState.GameStateID,
+	}
+	insertResult, err := db.InsertIntoTable(tx, dataMap)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return nil, DuplicateDailyAttemptError{err}
+	} else if err != nil {
+		logrus.Warning("error saving daily attempt: ", err)
+		return nil, err
+	}
+
+	id, err := insertResult.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{
+		"id":     id,
+		"date":   date.Format(DailyDateFormat),
+		"userID": userID,
+	}).Info("saved new daily attempt to db")
+	return db.getAttempt(tx, "id=$1", id)
+}
+
+// GetAttempt returns the user's attempt at the date's deal
+//
+// Returns NotFoundError if they haven't attempted it
+func (db *DailyDB) GetAttempt(date time.Time, userID int64) (*DailyAttemptRow, error) {
+	return db.getAttempt(nil, "date=$1 AND user_id=$2", date.Format(DailyDateFormat), userID)
+}
+
+// GetAttemptForGame returns the attempt that's played in the game
+//
+// Returns NotFoundError if the game isn't a daily attempt
+func (db *DailyDB) GetAttemptForGame(game libgame.Game) (*DailyAttemptRow, error) {
+	return db.getAttempt(nil, "game_id=$1", game.ID)
+}
+
+// LockAttemptForGame is GetAttemptForGame, and locks the attempt until the
+// transaction ends, so that moves in its game can wait for each other
+func (db *DailyDB) LockAttemptForGame(tx *sqlx.Tx, game libgame.Game) (*DailyAttemptRow, error) {
+	return db.getAttempt(tx, "game_id=$1 FOR UPDATE", game.ID)
+}
+
+func (db *DailyDB) getAttempt(
+	tx *sqlx.Tx, where string, args ...interface{}) (*DailyAttemptRow, error) {
+	var attempt DailyAttemptRow
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s", db.table, where)
+	var err error
+	if tx != nil {
+		err = tx.Get(&attempt, query, args...)
+	} else {
+		err = db.db.Get(&attempt, query, args...)
+	}
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError{"daily attempt"}
+	} else if err != nil {
+		return nil, fmt.Errorf("Error on query: %v", err)
+	}
+	return &attempt, nil
+}
+
+// SubmitResult saves the attempt's result, from the game state it finished on
+//
+// Returns AlreadySubmittedError if the attempt's result has already been submitted.
+func (db *DailyDB) SubmitResult(
+	tx *sqlx.Tx, attempt DailyAttemptRow, gameState libgame.GameState) error {
+	query := fmt.Sprintf(
+		"UPDATE %s SET submitted = now(), score = $2, moves = $3 WHERE id=$1 AND submitted IS NULL",
+		db.table)
+	res, err := db.exec(tx, query, attempt.ID, gameState.Score, gameState.MoveNum)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return AlreadySubmittedError{}
+	}
+	return nil
+}
+
+// GetResults returns the submitted results for the date's deal, best first
+func (db *DailyDB) GetResults(date time.Time) ([]DailyResultRow, error) {
+	var rows []DailyResultRow
+	query := fmt.Sprintf(`
+		SELECT
+			%s AS rank,
+			users.id AS user_id,
+			users.display_name AS display_name,
+			score,
+			moves,
+			%s AS seconds
+		FROM %s JOIN users ON users.id = %s.user_id
+		WHERE date=$1 AND submitted IS NOT NULL
+		ORDER BY rank, users.id`,
+		attemptRank, attemptSeconds, db.table, db.table)
+	err := db.db.Select(&rows, query, date.Format(DailyDateFormat))
+	if err != nil {
+		return nil, fmt.Errorf("Error on query: %v", err)
+	}
+	return rows, nil
+}
+
+// GetHistory returns the user's attempts, up to limit of them, newest first
+func (db *DailyDB) GetHistory(userID int64, limit int) ([]DailyHistoryRow, error) {
+	return db.getRankedAttempts("WHERE user_id=$1 ORDER BY date DESC LIMIT $2", userID, limit)
+}
+
+// GetRankedAttempt returns the user's attempt at the date's deal, with its rank
+//
+// Returns NotFoundError if they haven't attempted it
+func (db *DailyDB) GetRankedAttempt(date time.Time, userID int64) (*DailyHistoryRow, error) {
+	rows, err := db.getRankedAttempts(
+		"WHERE date=$1 AND user_id=$2", date.Format(DailyDateFormat), userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, NotFoundError{"daily attempt"}
+	}
+	return &rows[0], nil
+}
+
+// getRankedAttempts returns the attempts that the rest of the query picks out
+// of all of the ranked attempts. The ranks are among everyone's results, so
+// they're found before the attempts are picked
+func (db *DailyDB) getRankedAttempts(rest string, args ...interface{}) ([]DailyHistoryRow, error) {
+	var rows []DailyHistoryRow
+	query := fmt.Sprintf(`
+		SELECT * FROM (
+			SELECT
+				%s.*,
+				CASE WHEN submitted IS NULL THEN NULL ELSE %s END AS rank,
+				%s AS seconds
+			FROM %s
+		) AS ranked
+		%s`,
+		db.table, attemptRank, attemptSeconds, db.table, rest)
+	err := db.db.Select(&rows, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Error on query: %v", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,111 @@
+package libdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// startAttemptForTest starts an attempt by a new user at the date's deal,
+// returning the user and the attempt's first game state
+func startAttemptForTest(t *testing.T, date time.Time) (*UserRow, libgame.GameState) {
+	user, err := newUserDBForTest(t).Signup(nil, newEmailForTest(), "correct horse")
+	assert.Nil(t, err)
+	game, err := newGameDBForTest(t).CreateOwnedGame(nil, user.ID)
+	assert.Nil(t, err)
+	gameState := libgame.DealSeededGame(*game, 1)
+	assert.Nil(t, NewGameStateDB(newDbForTest(t)).SaveGameState(nil, gameState))
+	_, err = NewDailyDB(newDbForTest(t)).StartAttempt(nil, date, user.ID, gameState)
+	assert.Nil(t, err)
+	return user, gameState
+}
+
+func TestDailyAttempt(t *testing.T) {
+	userDB := newUserDBForTest(t)
+	dailyDB := NewDailyDB(newDbForTest(t))
+	date := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	user, gameState := startAttemptForTest(t, date)
+	defer userDB.DeleteUser(nil, user.ID)
+
+	// one attempt per user per day
+	_, err := dailyDB.StartAttempt(nil, date, user.ID, gameState)
+	assert.IsType(t, DuplicateDailyAttemptError{}, err)
+
+	attempt, err := dailyDB.GetAttempt(date, user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, date, attempt.Date.UTC())
+	assert.Equal(t, gameState.GameID, attempt.GameID)
+	assert.Equal(t, gameState.GameStateID, attempt.FirstGameState)
+	assert.False(t, attempt.Submitted.Valid)
+	_, err = dailyDB.GetAttempt(date.AddDate(0, 0, 1), user.ID)
+	assert.IsType(t, NotFoundError{}, err)
+	byGame, err := dailyDB.GetAttemptForGame(libgame.Game{ID: gameState.GameID})
+	assert.Nil(t, err)
+	assert.Equal(t, attempt, byGame)
+	_, err = dailyDB.GetAttemptForGame(libgame.Game{ID: -1})
+	assert.IsType(t, NotFoundError{}, err)
+
+	ranked, err := dailyDB.GetRankedAttempt(date, user.ID)
+	assert.Nil(t, err)
+	assert.False(t, ranked.Rank.Valid)
+
+	assert.Nil(t, dailyDB.SubmitResult(nil, *attempt, gameState))
+	assert.IsType(t, AlreadySubmittedError{}, dailyDB.SubmitResult(nil, *attempt, gameState))
+	ranked, err = dailyDB.GetRankedAttempt(date, user.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, gameState.Score, ranked.Score.Int64)
+	assert.EqualValues(t, 0, ranked.Moves.Int64)
+	assert.True(t, ranked.Rank.Valid)
+	assert.True(t, ranked.Seconds.Float64 >= 0)
+
+	history, err := dailyDB.GetHistory(user.ID, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []DailyHistoryRow{*ranked}, history)
+}
+
+func TestDailyResults(t *testing.T) {
+	userDB := newUserDBForTest(t)
+	dailyDB := NewDailyDB(newDbForTest(t))
+	date := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)
+
+	// a lower score beats fewer moves
+	submit := func(moves int64, score int) *UserRow {
+		user, gameState := startAttemptForTest(t, date)
+		attempt, err := dailyDB.GetAttempt(date, user.ID)
+		assert.Nil(t, err)
+		gameState.MoveNum = moves
+		gameState.Score = score
+		assert.Nil(t, dailyDB.SubmitResult(nil, *attempt, gameState))
+		return user
+	}
+	first := submit(90, 0)
+	defer userDB.DeleteUser(nil, first.ID)
+	second := submit(10, 5)
+	defer userDB.DeleteUser(nil, second.ID)
+	third := submit(20, 5)
+	defer userDB.DeleteUser(nil, third.ID)
+	unsubmitted, _ := startAttemptForTest(t, date)
+	defer userDB.DeleteUser(nil, unsubmitted.ID)
+
+	// other tests' users may have results for the date too
+	rows, err := dailyDB.GetResults(date)
+	assert.Nil(t, err)
+	var ours []DailyResultRow
+	for _, row := range rows {
+		switch row.UserID {
+		case first.ID, second.ID, third.ID, unsubmitted.ID:
+			ours = append(ours, row)
+		}
+	}
+	if assert.Len(t, ours, 3) {
+		assert.Equal(t, first.ID, ours[0].UserID)
+		assert.False(t, ours[0].DisplayName.Valid)
+		assert.EqualValues(t, 90, ours[0].Moves)
+		assert.Equal(t, second.ID, ours[1].UserID)
+		assert.Equal(t, third.ID, ours[2].UserID)
+		assert.True(t, ours[0].Rank < ours[1].Rank)
+		assert.True(t, ours[1].Rank < ours[2].Rank)
+	}
+}
@@ -1,11 +1,17 @@
 package libdb
 
 import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/jmoiron/sqlx"
+	types "github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
 	"github.com/topher200/forty-thieves/libgame"
 )
 
@@ -14,7 +20,31 @@ type GameDB struct {
 }
 
 type GameRow struct {
-	ID int64 `db:"id"`
+	ID                int64              `db:"id"`
+	Difficulty        sql.NullFloat64    `db:"difficulty"`
+	DifficultyRating  sql.NullString     `db:"difficulty_rating"`
+	DifficultyDetails types.NullJSONText `db:"difficulty_details"`
+	UserID            sql.NullInt64      `db:"user_id"`
+	ShareToken        sql.NullString     `db:"share_token"`
+	Created           time.Time          `db:"created"`
+	Won               pq.NullTime        `db:"won"`
+	WonMoves          sql.NullInt64      `db:"won_moves"`
+	Hints             int64              `db:"hints"`
+	Undos             int64              `db:"undos"`
+}
+
+// Difficulty is a game's difficulty rating, as the solver measured it
+type Difficulty struct {
+	Score   float64
+	Rating  string
+	Details types.JSONText // the measurements behind the score
+}
+
+// GameOwner is the user that a game belongs to, and the token that lets
+// anyone else they share it with play it too
+type GameOwner struct {
+	UserID     int64
+	ShareToken string
 }
 
 func NewGameDB(db *sqlx.DB) *GameDB {
@@ -28,13 +58,15 @@ func NewGameDB(db *sqlx.DB) *GameDB {
 
 // GetLatestGame gets the most recent game (by id)
 //
-// Returns error if there are no games
+// Returns NotFoundError if there are no games
 func (db *GameDB) GetLatestGame() (*libgame.Game, error) {
 	var gameRow GameRow
 	query := fmt.Sprintf(
 		"SELECT * FROM %s ORDER BY id DESC LIMIT 1", db.table)
 	err := db.db.Get(&gameRow, query)
-	if err != nil {
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError{"game"}
+	} else if err != nil {
 		return nil, fmt.Errorf("Error on query: %v", err)
 	}
 
@@ -45,7 +77,23 @@ func (db *GameDB) GetLatestGame() (*libgame.Game, error) {
 
 // CreateNewGame creates a new game, saves it to the database, and returns it
 func (db *GameDB) CreateNewGame(tx *sqlx.Tx) (*libgame.Game, error) {
-	dataMap := make(map[string]interface{})
+	return db.createGame(tx, make(map[string]interface{}))
+}
+
+// CreateOwnedGame creates a new game that belongs to the user, with a new
+// share token, saves it to the database, and returns it
+func (db *GameDB) CreateOwnedGame(tx *sqlx.Tx, userID int64) (*libgame.Game, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("Error creating share token: %v", err)
+	}
+	return db.createGame(tx, map[string]interface{}{
+		"user_id":     userID,
+		"share_token": hex.EncodeToString(token),
+	})
+}
+
+func (db *GameDB) createGame(tx *sqlx.Tx, dataMap map[string]interface{}) (*libgame.Game, error) {
 	insertResult, err := db.InsertIntoTable(tx, dataMap)
 	if err != nil {
 		logrus.Warning("error saving game: ", err)
@@ -67,6 +115,24 @@ func (db *GameDB) CreateNewGame(tx *sqlx.Tx) (*libgame.Game, error) {
 	return &game, nil
 }
 
+// GetOwner returns the user the game belongs to.
+//
+// Returns nil if the game has no owner, or NotFoundError if the game doesn't exist.
+func (db *GameDB) GetOwner(game libgame.Game) (*GameOwner, error) {
+	var gameRow GameRow
+	query := fmt.Sprintf("SELECT * FROM %s WHERE id=$1", db.table)
+	err := db.db.Get(&gameRow, query, game.ID)
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError{"game"}
+	} else if err != nil {
+		return nil, fmt.Errorf("Error on query: %v", err)
+	}
+	if !gameRow.UserID.Valid {
+		return nil, nil
+	}
+	return &GameOwner{gameRow.UserID.Int64, gameRow.ShareToken.String}, nil
+}
+
 // DeleteGame deletes the given libgame.Game
 func (db *GameDB) DeleteGame(tx *sqlx.Tx, game libgame.Game) error {
 	queryWhereStatement := fmt.Sprintf("id=%d", game.ID)
@@ -82,3 +148,44 @@ func (db *GameDB) DeleteGame(tx *sqlx.Tx, game libgame.Game) error {
 	}
 	return nil
 }
+
+// SaveDifficulty stores the game's difficulty rating on its row
+func (db *GameDB) SaveDifficulty(tx *sqlx.Tx, game libgame.Game, difficulty Difficulty) error {
+	dataMap := map[string]interface{}{
+		"difficulty":         difficulty.Score,
+		"difficulty_rating":  difficulty.Rating,
+		"difficulty_details": difficulty.Details,
+	}
+	res, err := db.UpdateById(tx, dataMap, game.ID)
+	if err != nil {
+		return fmt.Errorf("Error saving difficulty: %v", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil || rowsAffected != 1 {
+		return fmt.Errorf("expected to change 1 row, changed %d", rowsAffected)
+	}
+	return nil
+}
+
+// GetDifficulty returns the game's difficulty rating.
+//
+// Returns nil if the game hasn't been rated yet, or NotFoundError if the game
+// doesn't exist.
+func (db *GameDB) GetDifficulty(game libgame.Game) (*Difficulty, error) {
+	var gameRow GameRow
+	query := fmt.Sprintf("SELECT * FROM %s WHERE id=$1", db.table)
+	err := db.db.Get(&gameRow, query, game.ID)
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError{"game"}
+	} else if err != nil {
+		return nil, fmt.Errorf("Error on query: %v", err)
+	}
+	if !gameRow.DifficultyDetails.Valid {
+		return nil, nil
+	}
+	return &Difficulty{
+		Score:   gameRow.Difficulty.Float64,
+		Rating:  gameRow.DifficultyRating.String,
+		Details: gameRow.DifficultyDetails.JSONText,
+	}, nil
+}
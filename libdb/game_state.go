@@ -1,6 +1,7 @@
 package libdb
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"strconv"
@@ -38,11 +39,13 @@ func NewGameStateDB(db *sqlx.DB) *GameStateDB {
 
 // GetGameStateById returns the game state for the given id
 //
-// Returns error if there are no game states for the given game
+// Returns NotFoundError if there is no game state with the id
 func (db *GameStateDB) GetGameStateById(gameStateID uuid.UUID) (*libgame.GameState, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE game_state_id=$1 LIMIT 1", db.table)
 	gameState, err := db.getSingleGameState(query, gameStateID.String())
-	if err != nil {
+	if _, ok := err.(NotFoundError); ok {
+		return nil, err
+	} else if err != nil {
 		return nil, fmt.Errorf("Error getting gamestate by id: %v", err)
 	}
 	return gameState, nil
@@ -50,12 +53,14 @@ func (db *GameStateDB) GetGameStateById(gameStateID uuid.UUID) (*libgame.GameSta
 
 // GetFirstGameState returns the first gamestate for the given game
 //
-// Returns error if there are no game states for the given game
+// Returns NotFoundError if there are no game states for the given game
 func (db *GameStateDB) GetFirstGameState(game libgame.Game) (*libgame.GameState, error) {
 	query := fmt.Sprintf(
 		"SELECT * FROM %s WHERE game_id=$1 and move_num=0 LIMIT 1", db.table)
 	gameState, err := db.getSingleGameState(query, strconv.FormatInt(game.ID, 10))
-	if err != nil {
+	if _, ok := err.(NotFoundError); ok {
+		return nil, err
+	} else if err != nil {
 		return nil, fmt.Errorf("Error getting first gamestate: %v", err)
 	}
 	return gameState, nil
@@ -99,7 +104,9 @@ func (db *GameStateDB) GetNextToAnalyze(game libgame.Game) ([]*libgame.GameState
 func (db *GameStateDB) getSingleGameState(query string, arg string) (*libgame.GameState, error) {
 	var gameStateRow GameStateRow
 	err := db.db.Get(&gameStateRow, query, arg)
-	if err != nil {
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError{"game state"}
+	} else if err != nil {
 		return nil, fmt.Errorf("Error on query: %v", err)
 	}
 	gameState, err := UnmarshalGameState(gameStateRow)
@@ -130,8 +137,17 @@ func (d DuplicateGameStateError) Error() string {
 }
 
 // SaveGameState saves the given gamestate to the db given the game and the gamestate
+//
+// Returns error without saving if the gamestate is invalid.
 func (db *GameStateDB) SaveGameState(tx *sqlx.Tx, gameState libgame.GameState) error {
+	err := gameState.Validate()
+	if err != nil {
+		return fmt.Errorf("Refusing to save gamestate: %v", err)
+	}
 	gameStateRow, err := MarshalGameState(gameState)
+	if err != nil {
+		return err
+	}
 
 	dataMap := make(map[string]interface{})
 	dataMap["game_id"] = gameStateRow.GameID
@@ -17,6 +17,8 @@ type decksJSONStruct struct {
 }
 
 // UnmarshalGameState unmarshalls a GameStateRow into a GameState.
+//
+// Returns error if the unmarshalled GameState is invalid.
 func UnmarshalGameState(gameStateRow GameStateRow) (*libgame.GameState, error) {
 	var gameState libgame.GameState
 	gameState.GameID = gameStateRow.GameID
@@ -36,6 +38,11 @@ func UnmarshalGameState(gameStateRow GameStateRow) (*libgame.GameState, error) {
 	gameState.Tableaus = deckData.Tableaus
 	gameState.Waste = deckData.Waste
 
+	err = gameState.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("Error validating gameStateRow: %v", err)
+	}
+
 	return &gameState, nil
 }
 
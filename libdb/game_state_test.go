@@ -50,3 +50,19 @@ func TestSaveAndGetGameState(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, originalGameState, *retrievedGameState)
 }
+
+func TestSaveInvalidGameState(t *testing.T) {
+	gameStateDB := newGameStateDBForTest(t)
+	gameDB := newGameDBForTest(t)
+	game := setupNewGameForTest(t, *gameDB)
+	defer gameDB.DeleteGame(nil, *game)
+
+	// Drop a card from the game, which should make us refuse to save it
+	gameState := libgame.DealNewGame(*game)
+	gameState.Stock.Cards = gameState.Stock.Cards[1:]
+	err := gameStateDB.SaveGameState(nil, gameState)
+	assert.NotNil(t, err)
+
+	_, err = gameStateDB.GetGameStateById(gameState.GameStateID)
+	assert.IsType(t, NotFoundError{}, err)
+}
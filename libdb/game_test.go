@@ -3,6 +3,7 @@ package libdb
 import (
 	"testing"
 
+	types "github.com/jmoiron/sqlx/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/topher200/forty-thieves/libgame"
 )
@@ -41,3 +42,33 @@ func TestGetNewlyCreatedGame(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, *originalGame, *retrievedGame)
 }
+
+func TestSaveAndGetDifficulty(t *testing.T) {
+	gameDB := newGameDBForTest(t)
+	game, err := gameDB.CreateNewGame(nil)
+	assert.Nil(t, err)
+	defer gameDB.DeleteGame(nil, *game)
+
+	// new games haven't been rated
+	difficulty, err := gameDB.GetDifficulty(*game)
+	assert.Nil(t, err)
+	assert.Nil(t, difficulty)
+
+	saved := Difficulty{
+		Score:   72.5,
+		Rating:  "hard",
+		Details: types.JSONText(`{"BestScore":40,"Expanded":1000}`),
+	}
+	err = gameDB.SaveDifficulty(nil, *game, saved)
+	assert.Nil(t, err)
+	difficulty, err = gameDB.GetDifficulty(*game)
+	assert.Nil(t, err)
+	if assert.NotNil(t, difficulty) {
+		assert.Equal(t, saved.Score, difficulty.Score)
+		assert.Equal(t, saved.Rating, difficulty.Rating)
+		assert.JSONEq(t, string(saved.Details), string(difficulty.Details))
+	}
+
+	_, err = gameDB.GetDifficulty(libgame.Game{ID: -1})
+	assert.IsType(t, NotFoundError{}, err)
+}
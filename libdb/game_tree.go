@@ -0,0 +1,60 @@
+package libdb
+
+import (
+	"fmt"
+
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// Statuses of game states. The solver claims unprocessed game states, then
+// marks them as processed once it has saved their children
+const (
+	StatusUnprocessed = "UNPROCESSED"
+	StatusClaimed     = "CLAIMED"
+	StatusProcessed   = "PROCESSED"
+)
+
+// GameTreeRow is a game state in a subtree, with how many moves below the
+// subtree's root it is
+type GameTreeRow struct {
+	GameStateRow
+	Depth int `db:"depth"`
+	// ChildCount counts the game state's children, including any that are
+	// deeper than the subtree goes
+	ChildCount int64 `db:"child_count"`
+}
+
+// GetGameTree returns the game states in the subtree under root, down to depth
+// moves below it. Parents come before their children.
+//
+// Returns at most limit rows, keeping the ones closest to root. truncated is
+// true if the subtree had more.
+func (db *GameStateDB) GetGameTree(
+	root libgame.GameState, depth int, limit int) (rows []GameTreeRow, truncated bool, err error) {
+	// postgres doesn't promise to return the rows of a recursive query in the
+	// order it finds them, so we sort by depth to keep parents first and to
+	// keep the rows closest to root. we ask for one more than the limit to
+	// know if we stopped early
+	query := fmt.Sprintf(`
+		WITH RECURSIVE tree AS (
+			SELECT *, 0 AS depth FROM %s WHERE game_id=$1 AND game_state_id=$2
+			UNION ALL
+			SELECT child.*, tree.depth + 1 FROM %s child
+			JOIN tree ON child.game_id=$1 AND child.previous_game_state=tree.game_state_id
+			WHERE tree.depth < $3
+		)
+		SELECT tree.*, (
+			SELECT count(*) FROM %s child
+			WHERE child.game_id=$1 AND child.previous_game_state=tree.game_state_id
+		) AS child_count
+		FROM tree ORDER BY depth, game_state_id LIMIT $4`,
+		db.table, db.table, db.table)
+	err = db.db.Select(&rows, query, root.GameID, root.GameStateID, depth, limit+1)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error on query: %v", err)
+	}
+	if len(rows) > limit {
+		return rows[:limit], true, nil
+	}
+	return rows, false, nil
+}
@@ -0,0 +1,61 @@
+package libdb
+
+import (
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+func TestGetGameTree(t *testing.T) {
+	gameStateDB := newGameStateDBForTest(t)
+	gameDB := newGameDBForTest(t)
+	game := setupNewGameForTest(t, *gameDB)
+	defer gameDB.DeleteGame(nil, *game)
+
+	// the root has one child, flipped from the stock, which has a child of its own
+	save := func(gameState libgame.GameState) {
+		assert.Nil(t, gameStateDB.SaveGameState(nil, gameState))
+	}
+	root := libgame.DealNewGame(*game)
+	save(root)
+	defer gameStateDB.DeleteGameState(nil, root)
+	child := root.Copy()
+	assert.Nil(t, child.FlipStock())
+	save(child)
+	defer gameStateDB.DeleteGameState(nil, child)
+	grandchild := child.Copy()
+	assert.Nil(t, grandchild.FlipStock())
+	save(grandchild)
+	defer gameStateDB.DeleteGameState(nil, grandchild)
+	assert.Nil(t, gameStateDB.MarkAsProcessed(nil, root))
+
+	rows, truncated, err := gameStateDB.GetGameTree(root, 5, 10)
+	assert.Nil(t, err)
+	assert.False(t, truncated)
+	if assert.Len(t, rows, 3) {
+		ids := []uuid.UUID{rows[0].GameStateID, rows[1].GameStateID, rows[2].GameStateID}
+		assert.Equal(t,
+			[]uuid.UUID{root.GameStateID, child.GameStateID, grandchild.GameStateID}, ids)
+		assert.Equal(t, []int{0, 1, 2}, []int{rows[0].Depth, rows[1].Depth, rows[2].Depth})
+		assert.Equal(t, []int64{1, 1, 0},
+			[]int64{rows[0].ChildCount, rows[1].ChildCount, rows[2].ChildCount})
+		assert.Equal(t, StatusProcessed, rows[0].Status)
+		assert.Equal(t, StatusUnprocessed, rows[1].Status)
+	}
+
+	// children deeper than the tree goes are still counted
+	rows, truncated, err = gameStateDB.GetGameTree(child, 0, 10)
+	assert.Nil(t, err)
+	assert.False(t, truncated)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, child.GameStateID, rows[0].GameStateID)
+		assert.EqualValues(t, 1, rows[0].ChildCount)
+	}
+
+	rows, truncated, err = gameStateDB.GetGameTree(root, 5, 2)
+	assert.Nil(t, err)
+	assert.True(t, truncated)
+	assert.Len(t, rows, 2)
+}
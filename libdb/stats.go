@@ -0,0 +1,107 @@
+package libdb
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// UserStats sums up the games a user owns. The *ToWin fields are only valid
+// if the user has won a game
+type UserStats struct {
+	GamesPlayed         int64           `db:"games_played"`
+	GamesWon            int64           `db:"games_won"`
+	BestMovesToWin      sql.NullInt64   `db:"best_moves_to_win"`
+	AverageMovesToWin   sql.NullFloat64 `db:"average_moves_to_win"`
+	BestSecondsToWin    sql.NullFloat64 `db:"best_seconds_to_win"`
+	AverageSecondsToWin sql.NullFloat64 `db:"average_seconds_to_win"`
+	Hints               int64           `db:"hints"`
+	Undos               int64           `db:"undos"`
+}
+
+// LeaderboardRow is a user's place on the leaderboard
+type LeaderboardRow struct {
+	UserID           int64          `db:"user_id"`
+	DisplayName      sql.NullString `db:"display_name"`
+	GamesPlayed      int64          `db:"games_played"`
+	GamesWon         int64          `db:"games_won"`
+	BestMovesToWin   int64          `db:"best_moves_to_win"`
+	BestSecondsToWin float64        `db:"best_seconds_to_win"`
+}
+
+// secondsToWin is how long a won game took, from when it was dealt
+const secondsToWin = "EXTRACT(EPOCH FROM won - created)"
+
+// RecordWin saves that the game was won in the number of moves. Only the
+// first win of a game is kept
+func (db *GameDB) RecordWin(tx *sqlx.Tx, game libgame.Game, moves int64) error {
+	query := fmt.Sprintf(
+		"UPDATE %s SET won = now(), won_moves = $2 WHERE id=$1 AND won IS NULL", db.table)
+	_, err := db.exec(tx, query, game.ID, moves)
+	return err
+}
+
+// RecordHint counts a hint asked for in the game
+func (db *GameDB) RecordHint(tx *sqlx.Tx, game libgame.Game) error {
+	query := fmt.Sprintf("UPDATE %s SET hints = hints + 1 WHERE id=$1", db.table)
+	_, err := db.exec(tx, query, game.ID)
+	return err
+}
+
+// RecordUndo counts a move made in the game from a game state that had already
+// been moved from
+func (db *GameDB) RecordUndo(tx *sqlx.Tx, game libgame.Game) error {
+	query := fmt.Sprintf("UPDATE %s SET undos = undos + 1 WHERE id=$1", db.table)
+	_, err := db.exec(tx, query, game.ID)
+	return err
+}
+
+// GetUserStats sums up the games the user owns
+func (db *GameDB) GetUserStats(userID int64) (*UserStats, error) {
+	var stats UserStats
+	query := fmt.Sprintf(`
+		SELECT
+			count(*) AS games_played,
+			count(won) AS games_won,
+			min(won_moves) AS best_moves_to_win,
+			avg(won_moves) AS average_moves_to_win,
+			min(%s) AS best_seconds_to_win,
+			avg(%s) AS average_seconds_to_win,
+			coalesce(sum(hints), 0) AS hints,
+			coalesce(sum(undos), 0) AS undos
+		FROM %s WHERE user_id=$1`,
+		secondsToWin, secondsToWin, db.table)
+	err := db.db.Get(&stats, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Error on query: %v", err)
+	}
+	return &stats, nil
+}
+
+// GetLeaderboard returns the users who have won the most games, best first, up
+// to limit of them. Users who have won as many games are ranked by their
+// fewest moves to win, then by their quickest win
+func (db *GameDB) GetLeaderboard(limit int) ([]LeaderboardRow, error) {
+	var rows []LeaderboardRow
+	query := fmt.Sprintf(`
+		SELECT
+			users.id AS user_id,
+			users.display_name AS display_name,
+			count(*) AS games_played,
+			count(won) AS games_won,
+			min(won_moves) AS best_moves_to_win,
+			min(%s) AS best_seconds_to_win
+		FROM users JOIN %s ON %s.user_id = users.id
+		GROUP BY users.id
+		HAVING count(won) > 0
+		ORDER BY games_won DESC, best_moves_to_win, best_seconds_to_win, users.id
+		LIMIT $1`,
+		secondsToWin, db.table, db.table)
+	err := db.db.Select(&rows, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Error on query: %v", err)
+	}
+	return rows, nil
+}
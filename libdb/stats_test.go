@@ -0,0 +1,98 @@
+package libdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newUserWithWinsForTest creates a user who has won a game in each of the
+// numbers of moves, and lost one more game
+func newUserWithWinsForTest(t *testing.T, moves ...int64) *UserRow {
+	user, err := newUserDBForTest(t).Signup(nil, newEmailForTest(), "correct horse")
+	assert.Nil(t, err)
+	gameDB := newGameDBForTest(t)
+	for _, m := range append(moves, 0) {
+		game, err := gameDB.CreateOwnedGame(nil, user.ID)
+		assert.Nil(t, err)
+		if m != 0 {
+			assert.Nil(t, gameDB.RecordWin(nil, *game, m))
+		}
+	}
+	return user
+}
+
+func TestUserStats(t *testing.T) {
+	userDB := newUserDBForTest(t)
+	gameDB := newGameDBForTest(t)
+	user := newUserWithWinsForTest(t, 100, 80)
+	defer userDB.DeleteUser(nil, user.ID)
+
+	game, err := gameDB.CreateOwnedGame(nil, user.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, gameDB.RecordHint(nil, *game))
+	assert.Nil(t, gameDB.RecordHint(nil, *game))
+	assert.Nil(t, gameDB.RecordUndo(nil, *game))
+	// only the first win of a game counts
+	assert.Nil(t, gameDB.RecordWin(nil, *game, 50))
+	assert.Nil(t, gameDB.RecordWin(nil, *game, 10))
+
+	stats, err := gameDB.GetUserStats(user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), stats.GamesPlayed)
+	assert.Equal(t, int64(3), stats.GamesWon)
+	assert.Equal(t, int64(50), stats.BestMovesToWin.Int64)
+	assert.InDelta(t, 230.0/3, stats.AverageMovesToWin.Float64, 0.001)
+	assert.True(t, stats.BestSecondsToWin.Valid)
+	assert.True(t, stats.AverageSecondsToWin.Float64 >= 0)
+	assert.Equal(t, int64(2), stats.Hints)
+	assert.Equal(t, int64(1), stats.Undos)
+}
+
+func TestUserStatsWithoutGames(t *testing.T) {
+	userDB := newUserDBForTest(t)
+	user, err := userDB.Signup(nil, newEmailForTest(), "correct horse")
+	assert.Nil(t, err)
+	defer userDB.DeleteUser(nil, user.ID)
+
+	stats, err := newGameDBForTest(t).GetUserStats(user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, UserStats{}, *stats)
+}
+
+func TestLeaderboard(t *testing.T) {
+	userDB := newUserDBForTest(t)
+	// more wins beat fewer moves, and fewer moves break ties
+	first := newUserWithWinsForTest(t, 5000, 5000, 5000)
+	defer userDB.DeleteUser(nil, first.ID)
+	second := newUserWithWinsForTest(t, 4000, 4000)
+	defer userDB.DeleteUser(nil, second.ID)
+	third := newUserWithWinsForTest(t, 4500, 4500)
+	defer userDB.DeleteUser(nil, third.ID)
+	noWins := newUserWithWinsForTest(t)
+	defer userDB.DeleteUser(nil, noWins.ID)
+
+	// other tests' users may be on the leaderboard too
+	rows, err := newGameDBForTest(t).GetLeaderboard(1000000)
+	assert.Nil(t, err)
+	var ours []LeaderboardRow
+	for _, row := range rows {
+		switch row.UserID {
+		case first.ID, second.ID, third.ID, noWins.ID:
+			ours = append(ours, row)
+		}
+	}
+	if assert.Len(t, ours, 3) {
+		assert.Equal(t, first.ID, ours[0].UserID)
+		assert.False(t, ours[0].DisplayName.Valid)
+		assert.Equal(t, int64(4), ours[0].GamesPlayed)
+		assert.Equal(t, int64(3), ours[0].GamesWon)
+		assert.Equal(t, second.ID, ours[1].UserID)
+		assert.Equal(t, int64(4000), ours[1].BestMovesToWin)
+		assert.Equal(t, third.ID, ours[2].UserID)
+	}
+
+	rows, err = newGameDBForTest(t).GetLeaderboard(1)
+	assert.Nil(t, err)
+	assert.Len(t, rows, 1)
+}
@@ -0,0 +1,182 @@
+package libdb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserDB struct {
+	Base
+}
+
+type UserRow struct {
+	ID          int64          `db:"id"`
+	Email       string         `db:"email"`
+	Password    string         `db:"password"` // bcrypt hash
+	Admin       bool           `db:"admin"`
+	DisplayName sql.NullString `db:"display_name"` // null until the user chooses one
+}
+
+func NewUserDB(db *sqlx.DB) *UserDB {
+	u := &UserDB{}
+	u.db = db
+	u.table = "users"
+	u.hasID = true
+
+	return u
+}
+
+type DuplicateUserError struct {
+	err error
+}
+
+func (d DuplicateUserError) Error() string {
+	return "duplicate user error"
+}
+
+// DuplicateDisplayNameError is returned when a user chooses a display name
+// that another user has, ignoring case
+type DuplicateDisplayNameError struct {
+	err error
+}
+
+func (d DuplicateDisplayNameError) Error() string {
+	return "duplicate display name error"
+}
+
+// ErrWrongPassword is returned when a user logs in with the wrong password
+var ErrWrongPassword = errors.New("wrong password")
+
+// normalizeEmail makes the same address typed differently name the same user
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Signup creates a user with the email and password, saves it to the database,
+// and returns it. Only a bcrypt hash of the password is saved.
+//
+// Returns DuplicateUserError if there's already a user with the email.
+func (db *UserDB) Signup(tx *sqlx.Tx, email, password string) (*UserRow, error) {
+	email = normalizeEmail(email)
+	if email == "" {
+		return nil, errors.New("Email cannot be blank.")
+	}
+	if password == "" {
+		return nil, errors.New("Password cannot be blank.")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("Error hashing password: %v", err)
+	}
+	dataMap := map[string]interface{}{
+		"email":    email,
+		"password": string(hashedPassword),
+	}
+	insertResult, err := db.InsertIntoTable(tx, dataMap)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return nil, DuplicateUserError{err}
+	} else if err != nil {
+		logrus.Warning("error saving user: ", err)
+		return nil, err
+	}
+
+	id, err := insertResult.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{
+		"id": id,
+	}).Info("saved new user to db")
+	return &UserRow{ID: id, Email: email, Password: string(hashedPassword)}, nil
+}
+
+// GetUserById returns the user with the id
+//
+// Returns NotFoundError if there is no user with the id
+func (db *UserDB) GetUserById(id int64) (*UserRow, error) {
+	var user UserRow
+	query := fmt.Sprintf("SELECT * FROM %s WHERE id=$1", db.table)
+	err := db.db.Get(&user, query, id)
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError{"user"}
+	} else if err != nil {
+		return nil, fmt.Errorf("Error on query: %v", err)
+	}
+	return &user, nil
+}
+
+// GetUserByEmailAndPassword returns the user with the email, if the password
+// is theirs
+//
+// Returns NotFoundError if there is no user with the email, or
+// ErrWrongPassword if the password doesn't match.
+func (db *UserDB) GetUserByEmailAndPassword(email, password string) (*UserRow, error) {
+	var user UserRow
+	query := fmt.Sprintf("SELECT * FROM %s WHERE email=$1", db.table)
+	err := db.db.Get(&user, query, normalizeEmail(email))
+	if err == sql.ErrNoRows {
+		return nil, NotFoundError{"user"}
+	} else if err != nil {
+		return nil, fmt.Errorf("Error on query: %v", err)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return nil, ErrWrongPassword
+	} else if err != nil {
+		return nil, fmt.Errorf("Error checking password: %v", err)
+	}
+	return &user, nil
+}
+
+// SetAdmin makes the user an admin, or stops them being one
+func (db *UserDB) SetAdmin(tx *sqlx.Tx, id int64, admin bool) error {
+	res, err := db.UpdateById(tx, map[string]interface{}{"admin": admin}, id)
+	if err != nil {
+		return fmt.Errorf("Error saving admin: %v", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil || rowsAffected != 1 {
+		return fmt.Errorf("expected to change 1 row, changed %d", rowsAffected)
+	}
+	return nil
+}
+
+// SetDisplayName sets the name other users see the user as
+//
+// Returns DuplicateDisplayNameError if another user has the name.
+func (db *UserDB) SetDisplayName(tx *sqlx.Tx, id int64, displayName string) error {
+	res, err := db.UpdateById(tx, map[string]interface{}{"display_name": displayName}, id)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return DuplicateDisplayNameError{err}
+	} else if err != nil {
+		return fmt.Errorf("Error saving display name: %v", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil || rowsAffected != 1 {
+		return fmt.Errorf("expected to change 1 row, changed %d", rowsAffected)
+	}
+	return nil
+}
+
+// DeleteUser deletes the user, and the games and API tokens they own
+func (db *UserDB) DeleteUser(tx *sqlx.Tx, id int64) error {
+	res, err := db.DeleteById(tx, id)
+	if err != nil {
+		logrus.Warning("Error deleting user: ", err)
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil || rowsAffected != 1 {
+		return fmt.Errorf("expected to change 1 row, changed %d", rowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package libdb
+
+import (
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newUserDBForTest(t *testing.T) *UserDB {
+	return NewUserDB(newDbForTest(t))
+}
+
+// newEmailForTest makes an email that no other test uses
+func newEmailForTest() string {
+	return uuid.NewV4().String() + "@example.com"
+}
+
+func TestSignupAndLogin(t *testing.T) {
+	userDB := newUserDBForTest(t)
+	email := newEmailForTest()
+	user, err := userDB.Signup(nil, email, "correct horse")
+	assert.Nil(t, err)
+	defer userDB.DeleteUser(nil, user.ID)
+	assert.NotEqual(t, "correct horse", user.Password)
+
+	loggedIn, err := userDB.GetUserByEmailAndPassword(" "+email, "correct horse")
+	assert.Nil(t, err)
+	assert.Equal(t, *user, *loggedIn)
+
+	_, err = userDB.GetUserByEmailAndPassword(email, "battery staple")
+	assert.Equal(t, ErrWrongPassword, err)
+	_, err = userDB.GetUserByEmailAndPassword(newEmailForTest(), "correct horse")
+	assert.IsType(t, NotFoundError{}, err)
+
+	retrieved, err := userDB.GetUserById(user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, *user, *retrieved)
+}
+
+func TestSignupTwice(t *testing.T) {
+	userDB := newUserDBForTest(t)
+	email := newEmailForTest()
+	user, err := userDB.Signup(nil, email, "correct horse")
+	assert.Nil(t, err)
+	defer userDB.DeleteUser(nil, user.ID)
+
+	_, err = userDB.Signup(nil, email, "battery staple")
+	assert.IsType(t, DuplicateUserError{}, err)
+}
+
+func TestSetAdmin(t *testing.T) {
+	userDB := newUserDBForTest(t)
+	user, err := userDB.Signup(nil, newEmailForTest(), "correct horse")
+	assert.Nil(t, err)
+	defer userDB.DeleteUser(nil, user.ID)
+	assert.False(t, user.Admin)
+
+	assert.Nil(t, userDB.SetAdmin(nil, user.ID, true))
+	retrieved, err := userDB.GetUserById(user.ID)
+	assert.Nil(t, err)
+	assert.True(t, retrieved.Admin)
+}
+
+func TestSetDisplayName(t *testing.T) {
+	userDB := newUserDBForTest(t)
+	user, err := userDB.Signup(nil, newEmailForTest(), "correct horse")
+	assert.Nil(t, err)
+	defer userDB.DeleteUser(nil, user.ID)
+	other, err := userDB.Signup(nil, newEmailForTest(), "correct horse")
+	assert.Nil(t, err)
+	defer userDB.DeleteUser(nil, other.ID)
+	assert.False(t, user.DisplayName.Valid)
+
+	name := "Thief " + uuid.NewV4().String()[:8]
+	assert.Nil(t, userDB.SetDisplayName(nil, user.ID, name))
+	retrieved, err := userDB.GetUserById(user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, name, retrieved.DisplayName.String)
+
+	// names are unique, ignoring case
+	err = userDB.SetDisplayName(nil, other.ID, strings.ToUpper(name))
+	assert.IsType(t, DuplicateDisplayNameError{}, err)
+}
+
+func TestOwnedGame(t *testing.T) {
+	userDB := newUserDBForTest(t)
+	user, err := userDB.Signup(nil, newEmailForTest(), "correct horse")
+	assert.Nil(t, err)
+	defer userDB.DeleteUser(nil, user.ID)
+
+	gameDB := newGameDBForTest(t)
+	game, err := gameDB.CreateOwnedGame(nil, user.ID)
+	assert.Nil(t, err)
+	owner, err := gameDB.GetOwner(*game)
+	assert.Nil(t, err)
+	assert.Equal(t, user.ID, owner.UserID)
+	assert.Len(t, owner.ShareToken, 32)
+
+	// games dealt without an account have no owner
+	unowned := CreateNewGameForTest(t)
+	defer gameDB.DeleteGame(nil, *unowned)
+	owner, err = gameDB.GetOwner(*unowned)
+	assert.Nil(t, err)
+	assert.Nil(t, owner)
+}
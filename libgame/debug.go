@@ -0,0 +1,10 @@
+//go:build debug
+// +build debug
+
+package libgame
+
+// validateAfterMoves makes every move re-validate the GameState it produced,
+// and log what's wrong with it.
+//
+// Enabled by building with '-tags debug'. Too slow for solver runs.
+const validateAfterMoves = true
@@ -3,7 +3,9 @@ package libgame
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 
+	"github.com/Sirupsen/logrus"
 	uuid "github.com/satori/go.uuid"
 	"github.com/topher200/baseutil"
 	"github.com/topher200/deck"
@@ -22,7 +24,7 @@ type GameState struct {
 	Foundations       []deck.Deck
 	Tableaus          []deck.Deck
 	Waste             deck.Deck
-	Score             int // Must be updated after any modifications to the Decks above
+	Score             int // Must be updated after any modifications to the Decks above. See Validate
 }
 
 // MoveRequest is a request describing which pile to take a card from and which pile to put it on
@@ -234,15 +236,39 @@ func (state *GameState) FlipStock() error {
 
 // DealNewGame takes a game and randomly deals a starting gamestate for that game
 func DealNewGame(game Game) (state GameState) {
-	state.GameStateID = uuid.NewV4()
-	state.GameID = game.ID
-	state.MoveNum = 0
+	newDeck := newGameDeck()
+	newDeck.Shuffle()
+	return dealFromDeck(game, newDeck)
+}
 
-	// Combine two decks to make our game deck
+// DealSeededGame takes a game and deals a starting gamestate for it that only
+// depends on the seed. Every game dealt with the same seed starts with the
+// same cards
+func DealSeededGame(game Game, seed int64) (state GameState) {
+	newDeck := newGameDeck()
+	// a Fisher-Yates shuffle with our own source, so that the deal doesn't
+	// depend on how the deck package shuffles
+	rng := rand.New(rand.NewSource(seed))
+	for i := len(newDeck.Cards) - 1; i > 0; i-- {
+		j := rng.Intn(i + 1)
+		newDeck.Cards[i], newDeck.Cards[j] = newDeck.Cards[j], newDeck.Cards[i]
+	}
+	return dealFromDeck(game, newDeck)
+}
+
+// newGameDeck combines two decks to make our game deck, unshuffled
+func newGameDeck() deck.Deck {
 	newDeck := deck.NewDeck(false)
 	newDeck2 := deck.NewDeck(false)
 	newDeck.Cards = append(newDeck.Cards, newDeck2.Cards...)
-	newDeck.Shuffle()
+	return newDeck
+}
+
+// dealFromDeck deals a starting gamestate for the game from the top of the deck
+func dealFromDeck(game Game, newDeck deck.Deck) (state GameState) {
+	state.GameStateID = uuid.NewV4()
+	state.GameID = game.ID
+	state.MoveNum = 0
 
 	// All cards start in the stock, and our foundations start empty
 	state.Stock.Cards = newDeck.Cards
@@ -269,19 +295,24 @@ func DealNewGame(game Game) (state GameState) {
 //
 // This function must be called after any function that manipulates the Decks.
 func (state *GameState) updateScore() {
-	// update score
+	state.Score = state.computeScore()
+}
+
+// computeScore counts the cards not in foundations, without updating Score
+func (state *GameState) computeScore() int {
 	score := 0
 	score += len(state.Stock.Cards)
 	for i := range state.Tableaus {
 		score += len(state.Tableaus[i].Cards)
 	}
 	score += len(state.Waste.Cards)
-	state.Score = score
+	return score
 }
 
 // moveCreatesNewGameState should be called on a game state after a move has been made
 //
-// We increment the important fields, assign a new ID to this new game state, and update the score
+// We increment the important fields, assign a new ID to this new game state, and update the score.
+// In debug builds, we also panic if the move left the game state invalid.
 func (state *GameState) moveCreatesNewGameState() {
 	// increment the state IDs
 	state.MoveNum = state.MoveNum + 1
@@ -289,4 +320,12 @@ func (state *GameState) moveCreatesNewGameState() {
 	state.GameStateID = uuid.NewV4()
 
 	state.updateScore()
+
+	if validateAfterMoves {
+		// logged rather than panicking, so that tests can still move in the
+		// partial game states they build
+		if err := state.Validate(); err != nil {
+			logrus.Warning("move created invalid game state: ", err)
+		}
+	}
 }
@@ -24,6 +24,18 @@ func TestDealNewGame(t *testing.T) {
 	assert.EqualValues(t, 0, state.MoveNum)
 }
 
+func TestDealSeededGame(t *testing.T) {
+	state := DealSeededGame(Game{1}, 20261019)
+	same := DealSeededGame(Game{2}, 20261019)
+	other := DealSeededGame(Game{1}, 20261020)
+	assert.Nil(t, state.Validate())
+	assert.Equal(t, state.Stock, same.Stock)
+	assert.Equal(t, state.Tableaus, same.Tableaus)
+	assert.NotEqual(t, state.GameStateID, same.GameStateID)
+	assert.EqualValues(t, 2, same.GameID)
+	assert.NotEqual(t, state.Tableaus, other.Tableaus)
+}
+
 func TestPopFromStock(t *testing.T) {
 	game := Game{0}
 	state := DealNewGame(game)
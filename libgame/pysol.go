@@ -0,0 +1,255 @@
+package libgame
+
+import (
+	"fmt"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/topher200/deck"
+)
+
+// PysolMaxMSDealNumber is the largest deal number that PySolFC deals with its
+// Microsoft-compatible LCRandom31 generator. Larger numbers use its Mersenne
+// Twister generator instead.
+const PysolMaxMSDealNumber = 32000
+
+// pysolSuits and pysolFaces are the orders PySolFC creates its cards in.
+//
+// PySolFC builds each deck suit by suit (clubs, spades, hearts, diamonds) and
+// each suit from ace to king. The shuffle depends on this starting order.
+var (
+	pysolSuits = []deck.Suit{deck.CLUB, deck.SPADE, deck.HEART, deck.DIAMOND}
+	pysolFaces = []deck.Face{
+		deck.ACE, deck.TWO, deck.THREE, deck.FOUR, deck.FIVE, deck.SIX, deck.SEVEN,
+		deck.EIGHT, deck.NINE, deck.TEN, deck.JACK, deck.QUEEN, deck.KING,
+	}
+)
+
+// DealPysolGame deals the starting gamestate that PySolFC deals for the given
+// Forty Thieves deal number.
+//
+// PySolFC shuffles its talon with its own RNGs, deals rows off the top of the
+// talon and then turns one card onto the waste. We reproduce all of it so that
+// deal numbers can be compared against PySolFC and other solvers that use its
+// numbering.
+func DealPysolGame(game Game, dealNumber int64) (state GameState, err error) {
+	if dealNumber < 0 {
+		return state, fmt.Errorf("Invalid PySolFC deal number %d", dealNumber)
+	}
+
+	var rng pysolRandom
+	if dealNumber <= PysolMaxMSDealNumber {
+		rng = newLCRandom31(dealNumber)
+	} else {
+		rng = newMTRandom(dealNumber)
+	}
+
+	// Create the cards in PySolFC's order, then shuffle them the way it does
+	cards := make([]deck.Card, 0, 2*len(pysolSuits)*len(pysolFaces))
+	for i := 0; i < 2; i++ {
+		for _, suit := range pysolSuits {
+			for _, face := range pysolFaces {
+				cards = append(cards, deck.Card{Face: face, Suit: suit})
+			}
+		}
+	}
+	if dealNumber <= PysolMaxMSDealNumber {
+		cards = pysolMSOrder(cards)
+	}
+	pysolShuffle(rng, cards)
+
+	// PySolFC's talon deals from the end of its list, but our stock is
+	// popped from the front. Reverse to keep the same dealing order
+	for i, j := 0, len(cards)-1; i < j; i, j = i+1, j-1 {
+		cards[i], cards[j] = cards[j], cards[i]
+	}
+
+	state.GameStateID = uuid.NewV4()
+	state.GameID = game.ID
+	state.MoveNum = 0
+	state.Stock.Cards = cards
+	state.Foundations = make([]deck.Deck, NumFoundations)
+
+	// Unlike DealNewGame, PySolFC deals a card to each tableau before
+	// starting the next row
+	state.Tableaus = make([]deck.Deck, NumTableaus)
+	for j := 0; j < numStartingCardsPerTableau; j++ {
+		for i := range state.Tableaus {
+			card, err := state.popFromStock()
+			if err != nil {
+				return state, err
+			}
+			state.Tableaus[i].Cards = append(state.Tableaus[i].Cards, card)
+		}
+	}
+
+	// FortyThieves.startGame finishes with talon.dealCards(), which turns the
+	// first stock card onto the waste
+	card, err := state.popFromStock()
+	if err != nil {
+		return state, err
+	}
+	state.Waste.Cards = append(state.Waste.Cards, card)
+
+	// not calling moveCreatesNewGameState because we are a new state
+	state.updateScore()
+	return state, nil
+}
+
+// pysolMSOrder returns the cards in the order PySolFC puts them in before an
+// LCRandom31 shuffle, so that its deals match Microsoft FreeCell's.
+//
+// Cards are ordered by face, then by suit (clubs, diamonds, hearts, spades),
+// then by deck. This matches Game.shuffle's "FreeCell mode".
+func pysolMSOrder(cards []deck.Card) []deck.Card {
+	suitSize := len(pysolFaces)
+	deckSize := len(pysolSuits) * suitSize
+	ordered := make([]deck.Card, 0, len(cards))
+	for i := 0; i < suitSize; i++ {
+		// Offsets of clubs, diamonds, hearts and spades in pysolSuits
+		for _, j := range []int{0, 3 * suitSize, 2 * suitSize, suitSize} {
+			for k := 0; k < len(cards); k += deckSize {
+				ordered = append(ordered, cards[i+j+k])
+			}
+		}
+	}
+	return ordered
+}
+
+// pysolRandom is the part of PySolFC's random generators used by its shuffle
+type pysolRandom interface {
+	// randint returns an integer in [a, b], including both ends
+	randint(a, b int) int
+}
+
+// pysolShuffle shuffles the cards in place, using the same algorithm as PySolFC
+func pysolShuffle(rng pysolRandom, cards []deck.Card) {
+	for n := len(cards) - 1; n > 0; n-- {
+		j := rng.randint(0, n)
+		cards[n], cards[j] = cards[j], cards[n]
+	}
+}
+
+// lcRandom31 is the Microsoft C runtime rand(), as implemented by PySolFC
+type lcRandom31 struct {
+	seed uint64
+}
+
+func newLCRandom31(seed int64) *lcRandom31 {
+	return &lcRandom31{seed: uint64(seed)}
+}
+
+func (r *lcRandom31) next() int {
+	r.seed = (r.seed*214013 + 2531011) & 0x7fffffff
+	return int(r.seed >> 16)
+}
+
+func (r *lcRandom31) randint(a, b int) int {
+	return a + r.next()%(b+1-a)
+}
+
+// mtRandom is Python 2's random.Random (a Mersenne Twister), which is what
+// PySolFC uses for deals numbered above PysolMaxMSDealNumber
+type mtRandom struct {
+	state [mtN]uint32
+	index int
+}
+
+const (
+	mtN         = 624
+	mtM         = 397
+	mtMatrixA   = 0x9908b0df
+	mtUpperMask = 0x80000000
+	mtLowerMask = 0x7fffffff
+)
+
+// newMTRandom seeds a generator the same way Python's random.seed(int) does
+func newMTRandom(seed int64) *mtRandom {
+	// Python seeds with the 32-bit words of abs(seed), least significant first
+	if seed < 0 {
+		seed = -seed
+	}
+	key := make([]uint32, 0, 2)
+	for s := uint64(seed); s > 0; s >>= 32 {
+		key = append(key, uint32(s))
+	}
+	if len(key) == 0 {
+		key = append(key, 0)
+	}
+
+	r := &mtRandom{}
+	r.initByArray(key)
+	return r
+}
+
+func (r *mtRandom) initGenrand(s uint32) {
+	r.state[0] = s
+	for i := 1; i < mtN; i++ {
+		r.state[i] = 1812433253*(r.state[i-1]^(r.state[i-1]>>30)) + uint32(i)
+	}
+	r.index = mtN
+}
+
+func (r *mtRandom) initByArray(key []uint32) {
+	r.initGenrand(19650218)
+	i, j := 1, 0
+	k := mtN
+	if len(key) > k {
+		k = len(key)
+	}
+	for ; k > 0; k-- {
+		r.state[i] = (r.state[i] ^ ((r.state[i-1] ^ (r.state[i-1] >> 30)) * 1664525)) +
+			key[j] + uint32(j)
+		i++
+		j++
+		if i >= mtN {
+			r.state[0] = r.state[mtN-1]
+			i = 1
+		}
+		if j >= len(key) {
+			j = 0
+		}
+	}
+	for k = mtN - 1; k > 0; k-- {
+		r.state[i] = (r.state[i] ^ ((r.state[i-1] ^ (r.state[i-1] >> 30)) * 1566083941)) -
+			uint32(i)
+		i++
+		if i >= mtN {
+			r.state[0] = r.state[mtN-1]
+			i = 1
+		}
+	}
+	r.state[0] = 0x80000000
+}
+
+func (r *mtRandom) genrandUint32() uint32 {
+	if r.index >= mtN {
+		for i := 0; i < mtN; i++ {
+			y := (r.state[i] & mtUpperMask) | (r.state[(i+1)%mtN] & mtLowerMask)
+			next := r.state[(i+mtM)%mtN] ^ (y >> 1)
+			if y&1 != 0 {
+				next ^= mtMatrixA
+			}
+			r.state[i] = next
+		}
+		r.index = 0
+	}
+
+	y := r.state[r.index]
+	r.index++
+	y ^= y >> 11
+	y ^= (y << 7) & 0x9d2c5680
+	y ^= (y << 15) & 0xefc60000
+	y ^= y >> 18
+	return y
+}
+
+// random returns a float in [0, 1) with 53 bits of randomness, like Python's
+func (r *mtRandom) random() float64 {
+	a := r.genrandUint32() >> 5
+	b := r.genrandUint32() >> 6
+	return (float64(a)*67108864.0 + float64(b)) * (1.0 / 9007199254740992.0)
+}
+
+func (r *mtRandom) randint(a, b int) int {
+	return a + int(r.random()*float64(b+1-a))
+}
@@ -0,0 +1,130 @@
+package libgame
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/deck"
+)
+
+func TestLCRandom31MatchesMicrosoftRand(t *testing.T) {
+	// The first values of the MS C runtime's rand() after srand(1)
+	rng := newLCRandom31(1)
+	for _, expected := range []int{41, 18467, 6334, 26500, 19169} {
+		assert.Equal(t, expected, rng.next())
+	}
+}
+
+func TestMTRandomMatchesPython(t *testing.T) {
+	// random.Random(0).random() and random.Random(42).random() in Python
+	assert.Equal(t, 0.8444218515250481, newMTRandom(0).random())
+	assert.Equal(t, 0.6394267984578837, newMTRandom(42).random())
+}
+
+// parseCards parses cards written like "JD 2D 9H", as in FreeCell layouts
+func parseCards(t *testing.T, layout string) []deck.Card {
+	faces := map[byte]deck.Face{
+		'A': deck.ACE, '2': deck.TWO, '3': deck.THREE, '4': deck.FOUR, '5': deck.FIVE,
+		'6': deck.SIX, '7': deck.SEVEN, '8': deck.EIGHT, '9': deck.NINE, 'T': deck.TEN,
+		'J': deck.JACK, 'Q': deck.QUEEN, 'K': deck.KING,
+	}
+	suits := map[byte]deck.Suit{
+		'C': deck.CLUB, 'D': deck.DIAMOND, 'H': deck.HEART, 'S': deck.SPADE,
+	}
+	var cards []deck.Card
+	for _, word := range strings.Fields(layout) {
+		face, ok := faces[word[0]]
+		assert.True(t, ok, "bad face in %s", word)
+		suit, ok := suits[word[1]]
+		assert.True(t, ok, "bad suit in %s", word)
+		cards = append(cards, deck.Card{Face: face, Suit: suit})
+	}
+	return cards
+}
+
+func TestPysolMSOrderMatchesMicrosoftFreeCell(t *testing.T) {
+	// Microsoft FreeCell's published deals #1 and #617, in dealing order (the
+	// same layouts are on Rosetta Code's "Deal cards for FreeCell" page).
+	// PySolFC's LCRandom31 deals are built to reproduce these, so dealing one
+	// deck through pysolMSOrder and pysolShuffle must give the same cards
+	testCases := []struct {
+		dealNumber int64
+		layout     string
+	}{
+		{1, `JD 2D 9H JC 5D 7H 7C 5H KD KC 9S 5S AD QC KH 3H
+			2S KS 9D QD JS AS AH 3C 4C 5C TS QH 4H AC 4D 7S
+			3S TD 4S TH 8H 2C JH 7D 6D 8S 8D QS 6C 3D 8C TC
+			6S 9C 2H 6H`},
+		{617, `7D AD 5C 3S 5S 8C 2D AH TD 7S QD AC 6D 8H AS KH
+			TH QC 3H 9D 6S 8D 3D TC KD 5H 9S 3C 8S 7H 4D JS
+			4C QS 9C 9H 7C 6H 2C 2S 4S TS 2H 5D JC 6C JH QH
+			JD KS KC 4H`},
+	}
+
+	for _, testCase := range testCases {
+		cards := make([]deck.Card, 0, 52)
+		for _, suit := range pysolSuits {
+			for _, face := range pysolFaces {
+				cards = append(cards, deck.Card{Face: face, Suit: suit})
+			}
+		}
+		cards = pysolMSOrder(cards)
+		pysolShuffle(newLCRandom31(testCase.dealNumber), cards)
+
+		// Cards are dealt from the end of the list
+		dealt := make([]deck.Card, 0, len(cards))
+		for i := len(cards) - 1; i >= 0; i-- {
+			dealt = append(dealt, cards[i])
+		}
+		assert.Equal(t, parseCards(t, testCase.layout), dealt, "deal %d", testCase.dealNumber)
+	}
+}
+
+func TestDealPysolGameLayout(t *testing.T) {
+	// These layouts follow PySolFC's Game.shuffle and FortyThieves.startGame:
+	// the LCRandom31 shuffle checked above for deals up to
+	// PysolMaxMSDealNumber, and Python's random.Random(dealNumber).random()
+	// for deal 100000. They were not taken from a running copy of PySolFC
+	testCases := []struct {
+		dealNumber int64
+		topCards   string
+		waste      string
+		firstStock string
+	}{
+		{1, "6H TC JH 5H QS 6C 4S 5D AS 2S", "9D", "8H"},
+		{617, "QH QC 8C 2S 4C 3S 7C 7H 8D KS", "TS", "QD"},
+		{100000, "4C 5D 8S 7D 6H TS 7C 4S 4D 8C", "3S", "5H"},
+	}
+
+	for _, testCase := range testCases {
+		state, err := DealPysolGame(Game{0}, testCase.dealNumber)
+		assert.Nil(t, err)
+		topCards := parseCards(t, testCase.topCards)
+		for i, tableau := range state.Tableaus {
+			assert.Len(t, tableau.Cards, 4)
+			assert.Equal(t, topCards[i], tableau.Cards[len(tableau.Cards)-1],
+				"deal %d, tableau %d", testCase.dealNumber, i)
+		}
+		assert.Equal(t, parseCards(t, testCase.waste), state.Waste.Cards, "deal %d", testCase.dealNumber)
+		assert.Equal(t, parseCards(t, testCase.firstStock)[0], state.Stock.Cards[0], "deal %d", testCase.dealNumber)
+		assert.Len(t, state.Stock.Cards, 63)
+		assert.Equal(t, 104, state.Score)
+	}
+}
+
+func TestDealPysolGameIsDeterministic(t *testing.T) {
+	state1, err := DealPysolGame(Game{0}, 12345)
+	assert.Nil(t, err)
+	state2, err := DealPysolGame(Game{0}, 12345)
+	assert.Nil(t, err)
+	assert.Equal(t, state1.Tableaus, state2.Tableaus)
+	assert.Equal(t, state1.Stock, state2.Stock)
+	assert.Equal(t, state1.Waste, state2.Waste)
+	assert.NotEqual(t, state1.GameStateID, state2.GameStateID)
+}
+
+func TestDealPysolGameRejectsNegativeDealNumbers(t *testing.T) {
+	_, err := DealPysolGame(Game{0}, -1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,7 @@
+//go:build !debug
+// +build !debug
+
+package libgame
+
+// validateAfterMoves is only enabled in debug builds. See debug.go
+const validateAfterMoves = false
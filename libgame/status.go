@@ -0,0 +1,53 @@
+package libgame
+
+// GameStatus says whether a game can still be played
+type GameStatus string
+
+const (
+	// InProgress games have a legal move or a stock flip left to make
+	InProgress GameStatus = "in-progress"
+	// Won games have every card on a foundation
+	Won GameStatus = "won"
+	// Stuck games have no legal moves left and an empty stock
+	Stuck GameStatus = "stuck"
+)
+
+// Status reports whether the game state is won, stuck or still in progress
+func (state *GameState) Status() GameStatus {
+	if state.Score == 0 {
+		return Won
+	}
+	if len(state.Stock.Cards) > 0 || state.HasLegalMove() {
+		return InProgress
+	}
+	return Stuck
+}
+
+// HasLegalMove returns true if any card can be moved. Flipping the stock
+// doesn't count
+func (state *GameState) HasLegalMove() bool {
+	type pile struct {
+		location PileLocation
+		index    int
+	}
+	piles := []pile{pile{WASTE, 0}}
+	for i := range state.Foundations {
+		piles = append(piles, pile{FOUNDATION, i})
+	}
+	for i := range state.Tableaus {
+		piles = append(piles, pile{TABLEAU, i})
+	}
+
+	for _, from := range piles {
+		for _, to := range piles {
+			if from == to {
+				continue
+			}
+			move := MoveRequest{from.location, from.index, to.location, to.index}
+			if state.IsMoveRequestLegal(move) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
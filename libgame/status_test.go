@@ -0,0 +1,73 @@
+package libgame
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/deck"
+)
+
+// createStuckGameState returns a valid state where every tableau is topped by a
+// club whose next higher club is buried, so that no card can move
+func createStuckGameState() GameState {
+	state := DealNewGame(Game{0})
+	state.Stock.Cards = nil
+	suits := []deck.Suit{deck.SPADE, deck.HEART, deck.DIAMOND, deck.CLUB}
+	for i := range state.Foundations {
+		suit := suits[i/2]
+		state.Foundations[i].Cards = nil
+		for face := deck.ACE; ; face, _ = deck.Increment(face) {
+			state.Foundations[i].Cards = append(
+				state.Foundations[i].Cards, deck.Card{Face: face, Suit: suit})
+			if face == deck.KING || (suit == deck.CLUB && face == deck.THREE) {
+				break
+			}
+		}
+	}
+	clubs := func(faces ...deck.Face) []deck.Card {
+		cards := make([]deck.Card, len(faces))
+		for i, face := range faces {
+			cards[i] = deck.Card{Face: face, Suit: deck.CLUB}
+		}
+		return cards
+	}
+	state.Tableaus[0].Cards = clubs(deck.FOUR, deck.FOUR, deck.FIVE)
+	state.Tableaus[1].Cards = clubs(deck.QUEEN, deck.KING)
+	state.Tableaus[2].Cards = clubs(deck.QUEEN, deck.KING)
+	state.Tableaus[3].Cards = clubs(deck.TEN, deck.JACK)
+	state.Tableaus[4].Cards = clubs(deck.TEN, deck.JACK)
+	state.Tableaus[5].Cards = clubs(deck.EIGHT, deck.NINE)
+	state.Tableaus[6].Cards = clubs(deck.EIGHT, deck.NINE)
+	state.Tableaus[7].Cards = clubs(deck.SIX, deck.SEVEN)
+	state.Tableaus[8].Cards = clubs(deck.SIX, deck.SEVEN)
+	state.Tableaus[9].Cards = clubs(deck.FIVE)
+	state.updateScore()
+	return state
+}
+
+func TestStatusInProgress(t *testing.T) {
+	state := DealNewGame(Game{0})
+	assert.Equal(t, InProgress, state.Status())
+
+	// with an empty stock, we still have moves onto the empty tableau
+	state = createStuckGameState()
+	state.Waste.Cards = state.Tableaus[9].Cards
+	state.Tableaus[9].Cards = nil
+	assert.Nil(t, state.Validate())
+	assert.True(t, state.HasLegalMove())
+	assert.Equal(t, InProgress, state.Status())
+}
+
+func TestStatusStuck(t *testing.T) {
+	state := createStuckGameState()
+	assert.Nil(t, state.Validate())
+	assert.False(t, state.HasLegalMove())
+	assert.Equal(t, Stuck, state.Status())
+}
+
+func TestStatusWon(t *testing.T) {
+	state := createStuckGameState()
+	state.Tableaus = make([]deck.Deck, NumTableaus)
+	state.updateScore()
+	assert.Equal(t, Won, state.Status())
+}
@@ -0,0 +1,96 @@
+package libgame
+
+import (
+	"fmt"
+
+	"github.com/topher200/deck"
+)
+
+// numCopiesOfEachCard is the number of decks that are combined into a game deck
+const numCopiesOfEachCard = 2
+
+// Validate checks that the GameState obeys the invariants of the game.
+//
+// We check that the game has the right number of piles, that every card is
+// present exactly twice, that each foundation is a run of a single suit
+// starting from ACE, and that Score matches the cards.
+//
+// Returns an error describing the first problem found.
+func (state *GameState) Validate() error {
+	if len(state.Foundations) != NumFoundations {
+		return fmt.Errorf("Invalid game state - expected %d foundations, found %d",
+			NumFoundations, len(state.Foundations))
+	}
+	if len(state.Tableaus) != NumTableaus {
+		return fmt.Errorf("Invalid game state - expected %d tableaus, found %d",
+			NumTableaus, len(state.Tableaus))
+	}
+
+	if err := state.validateCardCounts(); err != nil {
+		return err
+	}
+
+	for i := range state.Foundations {
+		if err := validateFoundation(state.Foundations[i]); err != nil {
+			return fmt.Errorf("Invalid game state - foundation %d: %v", i, err)
+		}
+	}
+
+	if score := state.computeScore(); score != state.Score {
+		return fmt.Errorf("Invalid game state - score is %d, but cards give %d",
+			state.Score, score)
+	}
+	return nil
+}
+
+// validateCardCounts checks that each card in the game deck appears exactly
+// numCopiesOfEachCard times across all the piles.
+func (state *GameState) validateCardCounts() error {
+	counts := make(map[deck.Card]int)
+	countDeck := func(d deck.Deck) {
+		for _, card := range d.Cards {
+			counts[card]++
+		}
+	}
+	countDeck(state.Stock)
+	countDeck(state.Waste)
+	for i := range state.Foundations {
+		countDeck(state.Foundations[i])
+	}
+	for i := range state.Tableaus {
+		countDeck(state.Tableaus[i])
+	}
+
+	for _, card := range deck.NewDeck(false).Cards {
+		if counts[card] != numCopiesOfEachCard {
+			return fmt.Errorf("Invalid game state - expected %d of '%s', found %d",
+				numCopiesOfEachCard, card, counts[card])
+		}
+		delete(counts, card)
+	}
+	for card := range counts {
+		return fmt.Errorf("Invalid game state - unknown card '%s'", card)
+	}
+	return nil
+}
+
+// validateFoundation checks that a foundation is built up in suit from ACE
+func validateFoundation(foundation deck.Deck) error {
+	for i, card := range foundation.Cards {
+		if i == 0 {
+			if card.Face != deck.ACE {
+				return fmt.Errorf("must start with ACE, not '%s'", card)
+			}
+			continue
+		}
+		previous := foundation.Cards[i-1]
+		if card.Suit != previous.Suit {
+			return fmt.Errorf("suits must match ('%s' on '%s')", card, previous)
+		}
+		incremented, err := deck.Increment(previous.Face)
+		if err != nil || incremented != card.Face {
+			return fmt.Errorf("cards must increase ('%s' on '%s')", card, previous)
+		}
+	}
+	return nil
+}
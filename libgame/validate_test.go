@@ -0,0 +1,93 @@
+package libgame
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/deck"
+)
+
+func TestValidateNewGame(t *testing.T) {
+	state := DealNewGame(Game{0})
+	assert.Nil(t, state.Validate())
+
+	state.FlipStock()
+	assert.Nil(t, state.Validate())
+}
+
+func TestValidateWrongNumberOfPiles(t *testing.T) {
+	state := DealNewGame(Game{0})
+	state.Tableaus = state.Tableaus[:NumTableaus-1]
+	assert.Error(t, state.Validate())
+
+	state = DealNewGame(Game{0})
+	state.Foundations = append(state.Foundations, deck.Deck{})
+	assert.Error(t, state.Validate())
+}
+
+func TestValidateMissingCard(t *testing.T) {
+	state := DealNewGame(Game{0})
+	state.Stock.Cards = state.Stock.Cards[1:]
+	state.updateScore()
+	assert.Error(t, state.Validate())
+}
+
+func TestValidateDuplicatedCard(t *testing.T) {
+	state := DealNewGame(Game{0})
+	state.Stock.Cards = append(state.Stock.Cards, state.Tableaus[0].Cards[0])
+	state.updateScore()
+	assert.Error(t, state.Validate())
+}
+
+func TestValidateFoundations(t *testing.T) {
+	moveToFoundation := func(state *GameState, foundation int, cards ...deck.Card) {
+		// pull each card out of wherever it is so that the counts still add up
+		removeCard := func(card deck.Card) {
+			piles := []*deck.Deck{&state.Stock}
+			for i := range state.Tableaus {
+				piles = append(piles, &state.Tableaus[i])
+			}
+			for _, pile := range piles {
+				for i := range pile.Cards {
+					if pile.Cards[i] == card {
+						pile.Cards = append(pile.Cards[:i], pile.Cards[i+1:]...)
+						return
+					}
+				}
+			}
+		}
+		for _, card := range cards {
+			removeCard(card)
+			state.Foundations[foundation].Cards = append(state.Foundations[foundation].Cards, card)
+		}
+		state.updateScore()
+	}
+
+	state := DealNewGame(Game{0})
+	moveToFoundation(&state, 0,
+		deck.Card{Face: deck.ACE, Suit: deck.CLUB},
+		deck.Card{Face: deck.TWO, Suit: deck.CLUB})
+	assert.Nil(t, state.Validate(), "ace/two of clubs is a valid foundation")
+
+	state = DealNewGame(Game{0})
+	moveToFoundation(&state, 0, deck.Card{Face: deck.TWO, Suit: deck.CLUB})
+	assert.Error(t, state.Validate(), "foundations must start with an ace")
+
+	state = DealNewGame(Game{0})
+	moveToFoundation(&state, 0,
+		deck.Card{Face: deck.ACE, Suit: deck.CLUB},
+		deck.Card{Face: deck.TWO, Suit: deck.HEART})
+	assert.Error(t, state.Validate(), "foundations must be a single suit")
+
+	state = DealNewGame(Game{0})
+	moveToFoundation(&state, 0,
+		deck.Card{Face: deck.ACE, Suit: deck.CLUB},
+		deck.Card{Face: deck.THREE, Suit: deck.CLUB})
+	assert.Error(t, state.Validate(), "foundations must increase by one")
+}
+
+func TestValidateScore(t *testing.T) {
+	state := DealNewGame(Game{0})
+	state.Score = 103
+	assert.Error(t, state.Validate())
+}
@@ -0,0 +1,30 @@
+package librender
+
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// glyphs are the characters PNG labels can use: the faces, the digits for the
+// stock's count and the suits. Each row is glyphWidth pixels, '#' for drawn
+var glyphs = map[rune][glyphHeight]string{
+	'A': {".###.", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'T': {"#####", "..#..", "..#..", "..#..", "..#..", "..#..", "..#.."},
+	'J': {"..###", "...#.", "...#.", "...#.", "...#.", "#..#.", ".##.."},
+	'Q': {".###.", "#...#", "#...#", "#...#", "#.#.#", "#..#.", ".##.#"},
+	'K': {"#...#", "#..#.", "#.#..", "##...", "#.#..", "#..#.", "#...#"},
+	'0': {".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	'1': {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2': {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3': {"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	'4': {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5': {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6': {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8': {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9': {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+	'♣': {".###.", ".###.", "##.##", "#####", "##.##", "..#..", ".###."},
+	'♦': {"..#..", ".###.", "#####", "#####", ".###.", "..#..", "....."},
+	'♥': {".....", ".#.#.", "#####", "#####", ".###.", "..#..", "....."},
+	'♠': {"..#..", ".###.", "#####", "#####", "#.#.#", "..#..", ".###."},
+}
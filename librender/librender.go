@@ -0,0 +1,142 @@
+// Package librender draws pictures of game states, as SVG or PNG.
+//
+// Both formats are drawn from the same layout: the foundations, the waste and
+// the stock (face down, with how many cards are left) along the top, and the
+// tableaus fanned out below them.
+package librender
+
+import (
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// Sizes of the picture, in pixels
+const (
+	CardWidth     = 50
+	CardHeight    = 70
+	margin        = 10
+	tableauOffset = 20 // how much of each covered tableau card shows
+	labelScale    = 2  // PNG glyphs are drawn at twice their size
+	labelInset    = 4  // space between a card's corner and its label
+	cornerRadius  = 4
+)
+
+// Colors shared by both formats, as "#rrggbb"
+const (
+	tableColor  = "#2e7d32"
+	spotColor   = "#66bb6a"
+	cardColor   = "#ffffff"
+	borderColor = "#9e9e9e"
+	backColor   = "#1565c0"
+	redColor    = "#c62828"
+	blackColor  = "#212121"
+)
+
+type spotKind int
+
+const (
+	faceUp   spotKind = iota
+	faceDown          // the stock, labelled with its number of cards
+	empty             // a pile without cards
+)
+
+// spot is somewhere a card, or an empty pile, is drawn
+type spot struct {
+	x, y  int
+	kind  spotKind
+	card  deck.Card // for faceUp spots
+	count int       // for faceDown spots
+}
+
+// layout is where everything goes in a picture of a game state
+type layout struct {
+	width, height int
+	spots         []spot // in drawing order, so later spots cover earlier ones
+}
+
+// columnX is the left edge of the column's piles
+func columnX(column int) int {
+	return margin + column*(CardWidth+margin)
+}
+
+// topSpot is the spot for the pile's top card, or an empty spot
+func topSpot(x, y int, pile deck.Deck) spot {
+	if len(pile.Cards) == 0 {
+		return spot{x: x, y: y, kind: empty}
+	}
+	return spot{x: x, y: y, kind: faceUp, card: pile.Cards[len(pile.Cards)-1]}
+}
+
+// layoutState places the game state's piles
+func layoutState(state libgame.GameState) layout {
+	var l layout
+	columns := len(state.Foundations) + 2
+	if len(state.Tableaus) > columns {
+		columns = len(state.Tableaus)
+	}
+
+	// foundations, then the waste and the stock
+	y := margin
+	for i, foundation := range state.Foundations {
+		l.spots = append(l.spots, topSpot(columnX(i), y, foundation))
+	}
+	wasteX := columnX(len(state.Foundations))
+	l.spots = append(l.spots, topSpot(wasteX, y, state.Waste))
+	stockX := columnX(len(state.Foundations) + 1)
+	if len(state.Stock.Cards) == 0 {
+		l.spots = append(l.spots, spot{x: stockX, y: y, kind: empty})
+	} else {
+		l.spots = append(l.spots,
+			spot{x: stockX, y: y, kind: faceDown, count: len(state.Stock.Cards)})
+	}
+
+	// tableaus, with each card covering all but the top of the one before it
+	tableauY := y + CardHeight + 2*margin
+	bottom := tableauY + CardHeight
+	for i, tableau := range state.Tableaus {
+		x := columnX(i)
+		if len(tableau.Cards) == 0 {
+			l.spots = append(l.spots, spot{x: x, y: tableauY, kind: empty})
+			continue
+		}
+		for j, card := range tableau.Cards {
+			cardY := tableauY + j*tableauOffset
+			l.spots = append(l.spots, spot{x: x, y: cardY, kind: faceUp, card: card})
+			if cardY+CardHeight > bottom {
+				bottom = cardY + CardHeight
+			}
+		}
+	}
+
+	l.width = columnX(columns)
+	l.height = bottom + margin
+	return l
+}
+
+// suitSymbol is the suit's character, as drawn in card labels
+func suitSymbol(suit deck.Suit) string {
+	switch suit {
+	case deck.CLUB:
+		return "♣"
+	case deck.DIAMOND:
+		return "♦"
+	case deck.HEART:
+		return "♥"
+	case deck.SPADE:
+		return "♠"
+	}
+	return "?"
+}
+
+// label is what's written in the card's corner, like "Q♥"
+func label(card deck.Card) string {
+	return string(card.Face) + suitSymbol(card.Suit)
+}
+
+// labelColor is red for hearts and diamonds, and black otherwise
+func labelColor(card deck.Card) string {
+	if card.Suit == deck.HEART || card.Suit == deck.DIAMOND {
+		return redColor
+	}
+	return blackColor
+}
@@ -0,0 +1,118 @@
+package librender
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// dealtState is a new game with a card flipped to the waste and an ace on the
+// first foundation
+func dealtState() libgame.GameState {
+	state := libgame.DealSeededGame(libgame.Game{ID: 1}, 20261019)
+	state.FlipStock()
+	state.Foundations[0].Cards = []deck.Card{{Face: deck.ACE, Suit: deck.HEART}}
+	return state
+}
+
+func TestLayoutState(t *testing.T) {
+	state := dealtState()
+	l := layoutState(state)
+	// a spot for each foundation, the waste, the stock and each tableau card
+	assert.Len(t, l.spots, libgame.NumFoundations+2+libgame.NumTableaus*4)
+	assert.Equal(t, columnX(libgame.NumTableaus), l.width)
+	assert.Equal(t, margin+CardHeight+2*margin+3*tableauOffset+CardHeight+margin, l.height)
+
+	assert.Equal(t, spot{x: margin, y: margin, kind: faceUp, card: state.Foundations[0].Cards[0]},
+		l.spots[0])
+	assert.Equal(t, empty, l.spots[1].kind)
+	waste := l.spots[libgame.NumFoundations]
+	assert.Equal(t, faceUp, waste.kind)
+	assert.Equal(t, state.Waste.Cards[0], waste.card)
+	stock := l.spots[libgame.NumFoundations+1]
+	assert.Equal(t, faceDown, stock.kind)
+	assert.Equal(t, len(state.Stock.Cards), stock.count)
+
+	state.Stock.Cards = nil
+	state.Tableaus[0].Cards = nil
+	l = layoutState(state)
+	assert.Equal(t, empty, l.spots[libgame.NumFoundations+1].kind)
+	assert.Equal(t, spot{x: margin, y: margin + CardHeight + 2*margin, kind: empty},
+		l.spots[libgame.NumFoundations+2])
+}
+
+func TestWriteSVG(t *testing.T) {
+	state := dealtState()
+	var buf bytes.Buffer
+	assert.Nil(t, WriteSVG(&buf, state))
+
+	// the document is well formed, and labels every face up card
+	decoder := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	texts := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if !assert.Nil(t, err) {
+			break
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "text" {
+			texts++
+		}
+	}
+	// the foundation's ace, the waste, the stock's count and the tableaus
+	assert.Equal(t, 1+1+1+libgame.NumTableaus*4, texts)
+	assert.Contains(t, buf.String(), ">A♥</text>")
+}
+
+func TestWritePNG(t *testing.T) {
+	state := dealtState()
+	var buf bytes.Buffer
+	assert.Nil(t, WritePNG(&buf, state))
+	img, err := png.Decode(&buf)
+	if !assert.Nil(t, err) {
+		return
+	}
+	l := layoutState(state)
+	assert.Equal(t, l.width, img.Bounds().Dx())
+	assert.Equal(t, l.height, img.Bounds().Dy())
+
+	assertColor := func(hex string, x int, y int) {
+		r, g, b, _ := img.At(x, y).RGBA()
+		expected := rgb(hex)
+		assert.Equal(t, []uint8{expected.R, expected.G, expected.B},
+			[]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)}, "%s at %d, %d", hex, x, y)
+	}
+	centerY := margin + CardHeight/2
+	assertColor(cardColor, columnX(0)+CardWidth/2, centerY)
+	assertColor(tableColor, columnX(1)+CardWidth/2, centerY)
+	assertColor(spotColor, columnX(1), margin)
+	// the ace's label starts with the top of the A
+	assertColor(redColor, columnX(0)+labelInset+labelScale, margin+labelInset)
+	assertColor(cardColor, columnX(0)+labelInset, margin+labelInset)
+}
+
+func TestGlyphs(t *testing.T) {
+	for r, glyph := range glyphs {
+		for _, row := range glyph {
+			assert.Len(t, row, glyphWidth, string(r))
+		}
+	}
+	for _, face := range []deck.Face{deck.ACE, deck.TWO, deck.TEN, deck.JACK, deck.QUEEN, deck.KING} {
+		for _, r := range string(face) {
+			assert.Contains(t, glyphs, r)
+		}
+	}
+	for _, suit := range []deck.Suit{deck.CLUB, deck.DIAMOND, deck.HEART, deck.SPADE} {
+		for _, r := range suitSymbol(suit) {
+			assert.Contains(t, glyphs, r)
+		}
+	}
+}
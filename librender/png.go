@@ -0,0 +1,104 @@
+package librender
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strconv"
+
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// PNGContentType is the content type of WritePNG's pictures
+const PNGContentType = "image/png"
+
+// WritePNG writes a picture of the game state as a PNG image
+func WritePNG(w io.Writer, state libgame.GameState) error {
+	return png.Encode(w, Image(state))
+}
+
+// Image draws a picture of the game state.
+//
+// Drawn without any fonts or image libraries outside of the standard library,
+// so labels use our own glyphs (see glyphs.go).
+func Image(state libgame.GameState) *image.RGBA {
+	l := layoutState(state)
+	img := image.NewRGBA(image.Rect(0, 0, l.width, l.height))
+	fill(img, img.Bounds(), rgb(tableColor))
+	for _, s := range l.spots {
+		drawSpot(img, s)
+	}
+	return img
+}
+
+// drawSpot draws the spot's card, or its outline if it's empty
+func drawSpot(img *image.RGBA, s spot) {
+	bounds := image.Rect(s.x, s.y, s.x+CardWidth, s.y+CardHeight)
+	switch s.kind {
+	case empty:
+		outline(img, bounds, rgb(spotColor))
+	case faceDown:
+		fill(img, bounds, rgb(backColor))
+		outline(img, bounds, rgb(borderColor))
+		count := strconv.Itoa(s.count)
+		x := s.x + (CardWidth-textWidth(count))/2
+		y := s.y + (CardHeight-glyphHeight*labelScale)/2
+		drawText(img, x, y, count, rgb(cardColor))
+	case faceUp:
+		fill(img, bounds, rgb(cardColor))
+		outline(img, bounds, rgb(borderColor))
+		drawText(img, s.x+labelInset, s.y+labelInset, label(s.card), rgb(labelColor(s.card)))
+	}
+}
+
+func fill(img *image.RGBA, r image.Rectangle, c color.Color) {
+	draw.Draw(img, r, &image.Uniform{c}, image.ZP, draw.Src)
+}
+
+// outline draws a one pixel border just inside the rectangle
+func outline(img *image.RGBA, r image.Rectangle, c color.Color) {
+	fill(img, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+1), c)
+	fill(img, image.Rect(r.Min.X, r.Max.Y-1, r.Max.X, r.Max.Y), c)
+	fill(img, image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Max.Y), c)
+	fill(img, image.Rect(r.Max.X-1, r.Min.Y, r.Max.X, r.Max.Y), c)
+}
+
+// textWidth is how wide drawText draws the text
+func textWidth(text string) int {
+	runes := len([]rune(text))
+	if runes == 0 {
+		return 0
+	}
+	return (runes*(glyphWidth+1) - 1) * labelScale
+}
+
+// drawText draws the text with its top left corner at x, y. Characters without
+// a glyph are left blank
+func drawText(img *image.RGBA, x int, y int, text string, c color.Color) {
+	for _, r := range text {
+		glyph := glyphs[r]
+		for row, line := range glyph {
+			for column, pixel := range line {
+				if pixel != '#' {
+					continue
+				}
+				px := x + column*labelScale
+				py := y + row*labelScale
+				fill(img, image.Rect(px, py, px+labelScale, py+labelScale), c)
+			}
+		}
+		x += (glyphWidth + 1) * labelScale
+	}
+}
+
+// rgb parses one of our "#rrggbb" colors
+func rgb(hex string) color.RGBA {
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(hex, "#%02x%02x%02x", &r, &g, &b); err != nil {
+		panic(fmt.Errorf("Invalid color '%s': %v", hex, err))
+	}
+	return color.RGBA{r, g, b, 0xff}
+}
@@ -0,0 +1,51 @@
+package librender
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// SVGContentType is the content type of WriteSVG's pictures
+const SVGContentType = "image/svg+xml"
+
+// WriteSVG writes a picture of the game state as an SVG document
+func WriteSVG(w io.Writer, state libgame.GameState) error {
+	l := layoutState(state)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		l.width, l.height, l.width, l.height)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", tableColor)
+	for _, s := range l.spots {
+		writeSVGSpot(&buf, s)
+	}
+	buf.WriteString("</svg>\n")
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// writeSVGSpot draws the spot's card, or its outline if it's empty
+func writeSVGSpot(buf *bytes.Buffer, s spot) {
+	rect := func(fill string, stroke string, extra string) {
+		fmt.Fprintf(buf,
+			`<rect x="%d" y="%d" width="%d" height="%d" rx="%d" fill="%s" stroke="%s"%s/>`+"\n",
+			s.x, s.y, CardWidth, CardHeight, cornerRadius, fill, stroke, extra)
+	}
+	switch s.kind {
+	case empty:
+		rect("none", spotColor, ` stroke-dasharray="4 2"`)
+	case faceDown:
+		rect(backColor, borderColor, "")
+		fmt.Fprintf(buf,
+			`<text x="%d" y="%d" text-anchor="middle" font-family="sans-serif" font-size="14" fill="%s">%d</text>`+"\n",
+			s.x+CardWidth/2, s.y+CardHeight/2+5, cardColor, s.count)
+	case faceUp:
+		rect(cardColor, borderColor, "")
+		fmt.Fprintf(buf,
+			`<text x="%d" y="%d" font-family="sans-serif" font-size="14" fill="%s">%s</text>`+"\n",
+			s.x+labelInset, s.y+labelInset+12, labelColor(s.card), label(s.card))
+	}
+}
@@ -0,0 +1,363 @@
+package libsolver
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// Heuristic estimates how far a state is from being won. Lower is more promising
+type Heuristic struct {
+	Name        string
+	Description string
+	Estimate    func(state *libgame.GameState) int
+}
+
+// heuristics is the registry of all the heuristics a beam search can use
+var heuristics = []Heuristic{
+	{
+		Name:        "score",
+		Description: "number of cards not on a foundation",
+		Estimate: func(state *libgame.GameState) int {
+			return state.Score
+		},
+	},
+	{
+		Name:        "moves-left",
+		Description: "fewest moves that could win: every card not on a foundation, plus flipping the stock",
+		Estimate:    heuristic,
+	},
+	{
+		Name:        "blockers",
+		Description: "moves-left, plus two for every tableau card above a lower card of its suit",
+		Estimate: func(state *libgame.GameState) int {
+			return heuristic(state) + 2*countBlockers(state)
+		},
+	},
+}
+
+// DefaultHeuristic is the heuristic used when none is given
+const DefaultHeuristic = "moves-left"
+
+// Heuristics returns every registered heuristic, sorted by name
+func Heuristics() []Heuristic {
+	registered := make([]Heuristic, len(heuristics))
+	copy(registered, heuristics)
+	sort.Slice(registered, func(i, j int) bool { return registered[i].Name < registered[j].Name })
+	return registered
+}
+
+// LookupHeuristic returns the registered heuristic with the given name. The
+// empty string means DefaultHeuristic
+func LookupHeuristic(name string) (Heuristic, error) {
+	if name == "" {
+		name = DefaultHeuristic
+	}
+	for _, h := range heuristics {
+		if h.Name == name {
+			return h, nil
+		}
+	}
+	return Heuristic{}, fmt.Errorf("Unknown heuristic '%s'", name)
+}
+
+// countBlockers counts the tableau cards sitting above a lower ranked card of
+// the same suit. Each of them has to move somewhere other than a foundation
+// before the card under it can be played.
+func countBlockers(state *libgame.GameState) int {
+	blockers := 0
+	for i := range state.Tableaus {
+		// lowest rank seen so far for each suit, from the bottom of the pile up
+		var lowest [numSuits]int
+		for suit := range lowest {
+			lowest[suit] = numRanks
+		}
+		for _, card := range state.Tableaus[i].Cards {
+			suit, ok := suitIndexes[card.Suit]
+			if !ok {
+				continue
+			}
+			rank := faceRanks[card.Face]
+			if rank > lowest[suit] {
+				blockers++
+			} else {
+				lowest[suit] = rank
+			}
+		}
+	}
+	return blockers
+}
+
+// BeamOptions configures SolveBeam
+type BeamOptions struct {
+	SearchOptions
+
+	// Width is the number of states kept at each depth. Defaults to DefaultBeamWidth
+	Width int
+
+	// Heuristic is the name of the heuristic used to rank states. Defaults to
+	// DefaultHeuristic
+	Heuristic string
+
+	// MaxDepth stops the search after this many moves. 0 for no limit
+	MaxDepth int
+}
+
+// DefaultBeamWidth is the beam width used when none is given
+const DefaultBeamWidth = 100
+
+// SolveBeam runs a beam search for a solution to the game.
+//
+// The search goes breadth first, but only keeps the Width most promising states
+// at each depth according to the heuristic. It's fast, but a solution it finds
+// isn't necessarily the shortest, and failing to find one doesn't mean the
+// game can't be won.
+//
+// Returns error if the heuristic doesn't exist.
+func SolveBeam(start libgame.GameState, options BeamOptions) (SearchResult, error) {
+	search, err := newBeamSearch(start, options)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	root := &searchNode{state: start.Copy()}
+	root.estimate = search.heuristic.Estimate(&root.state)
+	search.best = root
+	search.visited[HashGameState(&root.state)] = true
+	search.layer = []*searchNode{root}
+	return search.run()
+}
+
+// ResumeBeam carries on with the beam search saved in options.Checkpoint.
+//
+// Like ResumeDisk, the search must be resumed with the same heuristic, pruning
+// rules, move ordering and PruneLost as it was started with, and the same
+// Width. MaxExpanded counts the states expanded before the checkpoint. A
+// resumed search finds the same result as one that was never stopped.
+//
+// Returns error if the checkpoint can't be read or the options don't match.
+func ResumeBeam(options BeamOptions) (SearchResult, error) {
+	h, err := LookupHeuristic(options.Heuristic)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	visited := make(map[uint64]bool)
+	header, _, file, err := readSearchCheckpoint(options.Checkpoint, "beam",
+		newCheckpointRules(h.Name, options.SearchOptions), func(hash uint64) { visited[hash] = true })
+	if err != nil {
+		return SearchResult{}, err
+	}
+	defer file.Close()
+	search, err := newBeamSearch(header.Start, options)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	if header.Width != search.width {
+		return SearchResult{}, fmt.Errorf("Checkpoint was made with Width '%d', not '%d'",
+			header.Width, search.width)
+	}
+
+	nodes, err := restoreNodes(header.Start, header.Nodes, h)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	best, err := pickNodes(nodes, []int{header.Best})
+	if err != nil {
+		return SearchResult{}, err
+	}
+	search.best = best[0]
+	if header.Done {
+		result, err := resultFromCheckpoint(header, search.best.path())
+		search.progress.done(&result)
+		return result, err
+	}
+	if search.layer, err = pickNodes(nodes, header.Frontier); err != nil {
+		return SearchResult{}, err
+	}
+	if search.children, err = pickNodes(nodes, header.Children); err != nil {
+		return SearchResult{}, err
+	}
+	search.visited = visited
+	search.depth = header.Depth
+	search.result.Expanded, search.result.Generated = header.Expanded, header.Generated
+	search.checkpointer = newCheckpointer(options.SearchOptions, header.Expanded)
+	search.resuming = true
+	return search.run()
+}
+
+type beamSearch struct {
+	options      BeamOptions
+	heuristic    Heuristic
+	width        int
+	start        libgame.GameState
+	expander     *expander
+	progress     *progressReporter
+	checkpointer checkpointer
+
+	visited  map[uint64]bool
+	best     *searchNode
+	depth    int
+	layer    []*searchNode // states at depth still to be expanded
+	children []*searchNode // children of the states at depth expanded so far
+	resuming bool          // true if the layer was part way through when the search was saved
+	result   SearchResult
+}
+
+func newBeamSearch(start libgame.GameState, options BeamOptions) (*beamSearch, error) {
+	h, err := LookupHeuristic(options.Heuristic)
+	if err != nil {
+		return nil, err
+	}
+	width := options.Width
+	if width <= 0 {
+		width = DefaultBeamWidth
+	}
+	return &beamSearch{
+		options:      options,
+		heuristic:    h,
+		width:        width,
+		start:        start.Copy(),
+		expander:     newExpander(options.SearchOptions),
+		progress:     newProgressReporter(options.SearchOptions),
+		checkpointer: newCheckpointer(options.SearchOptions, 0),
+		visited:      make(map[uint64]bool),
+	}, nil
+}
+
+// run searches until the beam is solved, empty or too deep, or hits
+// MaxExpanded or is cancelled
+func (s *beamSearch) run() (SearchResult, error) {
+	done, err := s.expandLayers()
+	if err != nil {
+		return SearchResult{}, err
+	}
+	if s.checkpointer.path != "" {
+		if err := s.checkpoint(done); err != nil {
+			return SearchResult{}, err
+		}
+	}
+
+	s.result.BestPath = s.best.path()
+	if s.result.Solved {
+		s.result.Solution = s.result.BestPath
+	}
+	err = s.result.finish(s.start)
+	s.progress.done(&s.result)
+	return s.result, err
+}
+
+// expandLayers expands the layers one depth at a time. Returns true if the
+// search is over, or false if it stopped at MaxExpanded or was cancelled
+func (s *beamSearch) expandLayers() (bool, error) {
+	var moves []libgame.MoveRequest
+	for ; len(s.layer) > 0; s.depth++ {
+		// a resumed layer was already checked before it was saved
+		if !s.resuming {
+			if s.options.MaxDepth > 0 && s.depth >= s.options.MaxDepth {
+				return true, nil
+			}
+			s.children = make([]*searchNode, 0, len(s.layer))
+		}
+		s.resuming = false
+
+		for len(s.layer) > 0 {
+			if s.options.stopped(s.result.Expanded) {
+				return false, nil
+			}
+			if s.checkpointer.due(s.result.Expanded) {
+				if err := s.checkpoint(false); err != nil {
+					return false, err
+				}
+			}
+			node := s.layer[0]
+			s.layer = s.layer[1:]
+			s.result.Expanded++
+			if s.progress.due(s.result.Expanded) {
+				s.progress.report(Progress{
+					Expanded:  s.result.Expanded,
+					Generated: s.result.Generated,
+					BestScore: s.best.state.Score,
+					Depth:     s.depth,
+					Frontier:  int64(len(s.layer) + len(s.children)),
+				})
+			}
+
+			var lastMove *libgame.MoveRequest
+			if node.parent != nil {
+				lastMove = &node.move
+			}
+			moves = s.expander.appendMoves(moves[:0], &node.state, lastMove)
+			s.result.Generated += int64(len(moves))
+			for _, move := range moves {
+				child := newSearchState(node.state)
+				child.do(move)
+				hash := HashGameState(&child.state)
+				if s.visited[hash] {
+					continue
+				}
+				s.visited[hash] = true
+				if s.options.PruneLost {
+					if lost, _ := ProvablyLost(&child.state); lost {
+						continue
+					}
+				}
+
+				childNode := &searchNode{
+					state:    child.state,
+					parent:   node,
+					move:     move,
+					depth:    node.depth + 1,
+					estimate: s.heuristic.Estimate(&child.state),
+				}
+				if childNode.state.Score < s.best.state.Score {
+					s.best = childNode
+				}
+				if childNode.state.Score == 0 {
+					s.result.Solved = true
+					return true, nil
+				}
+				s.children = append(s.children, childNode)
+			}
+		}
+
+		sort.SliceStable(s.children, func(i, j int) bool {
+			return s.children[i].estimate < s.children[j].estimate
+		})
+		if len(s.children) > s.width {
+			s.children = s.children[:s.width]
+		}
+		s.layer = s.children
+	}
+	return true, nil
+}
+
+// checkpoint saves the search to options.Checkpoint. done is true once the
+// search is over
+func (s *beamSearch) checkpoint(done bool) error {
+	saver := newNodeSaver()
+	header := &searchCheckpoint{
+		Search:          "beam",
+		Start:           s.start,
+		checkpointRules: newCheckpointRules(s.heuristic.Name, s.options.SearchOptions),
+		Expanded:        s.result.Expanded,
+		Generated:       s.result.Generated,
+		Done:            done,
+		Solved:          s.result.Solved,
+		Best:            saver.save(s.best),
+		Depth:           s.depth,
+		Width:           s.width,
+	}
+	var hashes func(func(uint64))
+	if !done {
+		header.Frontier = saver.saveAll(s.layer)
+		header.Children = saver.saveAll(s.children)
+		header.VisitedHashes = int64(len(s.visited))
+		hashes = func(f func(uint64)) {
+			for hash := range s.visited {
+				f(hash)
+			}
+		}
+	}
+	header.Nodes = saver.nodes
+	return s.checkpointer.write(header, hashes, nil)
+}
@@ -0,0 +1,82 @@
+package libsolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+func TestHeuristicsAreSortedAndDocumented(t *testing.T) {
+	registered := Heuristics()
+	assert.Len(t, registered, len(heuristics))
+	for i := range registered {
+		assert.NotEmpty(t, registered[i].Description)
+		if i > 0 {
+			assert.True(t, registered[i-1].Name < registered[i].Name)
+		}
+	}
+}
+
+func TestLookupHeuristic(t *testing.T) {
+	h, err := LookupHeuristic("")
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultHeuristic, h.Name)
+
+	_, err = LookupHeuristic("not-a-heuristic")
+	assert.Error(t, err)
+}
+
+func TestCountBlockers(t *testing.T) {
+	state := createEmptyGameState()
+	state.Tableaus[0].Cards = []deck.Card{
+		deck.Card{Face: deck.TWO, Suit: deck.CLUB},
+		deck.Card{Face: deck.KING, Suit: deck.HEART},
+		deck.Card{Face: deck.FIVE, Suit: deck.CLUB},
+		deck.Card{Face: deck.ACE, Suit: deck.CLUB}}
+	state.Tableaus[1].Cards = []deck.Card{
+		deck.Card{Face: deck.SIX, Suit: deck.SPADE},
+		deck.Card{Face: deck.FIVE, Suit: deck.SPADE}}
+	// only the five of clubs is above a lower club
+	assert.Equal(t, 1, countBlockers(&state))
+}
+
+func TestSolveBeam(t *testing.T) {
+	start := createNearlyWonGameState()
+	for _, h := range Heuristics() {
+		result, err := SolveBeam(start, BeamOptions{Heuristic: h.Name})
+		assert.Nil(t, err)
+		assertSolves(t, start, result)
+		assert.Len(t, result.Solution, nearlyWonSolutionLength, h.Name)
+	}
+}
+
+func TestSolveBeamUnknownHeuristic(t *testing.T) {
+	_, err := SolveBeam(createNearlyWonGameState(), BeamOptions{Heuristic: "not-a-heuristic"})
+	assert.Error(t, err)
+}
+
+func TestSolveBeamStopsAtMaxExpanded(t *testing.T) {
+	start := libgame.DealNewGame(libgame.Game{ID: 0})
+	result, err := SolveBeam(start, BeamOptions{
+		SearchOptions: SearchOptions{MaxExpanded: 500},
+		Width:         10,
+	})
+	assert.Nil(t, err)
+	assert.False(t, result.Solved)
+	assert.EqualValues(t, 500, result.Expanded)
+
+	// the beam goes deep quickly, and the best state is reachable from the start
+	best, err := ApplyMoves(start, result.BestPath)
+	assert.Nil(t, err)
+	assert.Equal(t, best.Score, result.BestState.Score)
+	assert.True(t, result.BestState.Score < start.Score)
+}
+
+func TestSolveBeamStopsAtMaxDepth(t *testing.T) {
+	start := libgame.DealNewGame(libgame.Game{ID: 0})
+	result, err := SolveBeam(start, BeamOptions{MaxDepth: 3})
+	assert.Nil(t, err)
+	assert.True(t, len(result.BestPath) <= 3)
+}
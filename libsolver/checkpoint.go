@@ -0,0 +1,454 @@
+package libsolver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// DefaultCheckpointEvery is how many states a search expands between
+// checkpoints, when not given
+const DefaultCheckpointEvery = 1000000
+
+// checkpointVersion changes whenever the checkpoint format does
+const checkpointVersion = 2
+
+// checkpointHeader is a disk search's checkpoint file. The run files and node
+// log it names are kept in the checkpoint's files directory.
+//
+// Run files never change once they're written, so each checkpoint only copies
+// in the runs written since the last one and the nodes logged since then. The
+// frontier's runs are partly read, so we save where each one's head is.
+type checkpointHeader struct {
+	Version int
+	Start   libgame.GameState
+	checkpointRules
+
+	Expanded  int64
+	Generated int64
+	BestScore int
+	BestIndex int64
+	BestMove  *libgame.MoveRequest
+	Solved    bool
+
+	FrontierStates  int64
+	FrontierPushed  int64
+	FrontierNextRun int
+	FrontierRuns    []savedFrontierRun
+	VisitedHashes   int64
+	VisitedNextRun  int
+	VisitedRuns     []string
+	Nodes           int64
+}
+
+// savedFrontierRun is a frontier run file in a checkpoint, and the offset of
+// the first entry that hasn't been popped
+type savedFrontierRun struct {
+	File   string
+	Offset int64
+}
+
+// checkpointNodeLog is the name of the node log in a checkpoint's files
+const checkpointNodeLog = "nodes.log"
+
+// checkpointFiles is the directory a disk search keeps its checkpoint's run
+// files and node log in, next to the checkpoint
+func checkpointFiles(checkpoint string) string {
+	return checkpoint + ".files"
+}
+
+// ResumeDisk carries on with the disk search saved in options.Checkpoint.
+//
+// The search must be resumed with the same heuristic, pruning rules, move
+// ordering and PruneLost as it was started with. The other options may change;
+// in particular MaxExpanded counts the states expanded before the checkpoint,
+// so it should be raised to let the search go further. A resumed search finds
+// the same result as one that was never stopped.
+//
+// Returns error if the checkpoint can't be read or the rules don't match.
+func ResumeDisk(options DiskOptions) (SearchResult, error) {
+	file, err := os.Open(options.Checkpoint)
+	if err != nil {
+		return SearchResult{}, fmt.Errorf("Error opening checkpoint: %v", err)
+	}
+	header, err := readCheckpointHeader(bufio.NewReader(file))
+	file.Close()
+	if err != nil {
+		return SearchResult{}, err
+	}
+	search, err := newDiskSearch(options)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	defer search.close()
+	if err := header.check(search.rules()); err != nil {
+		return SearchResult{}, err
+	}
+
+	search.start = header.Start
+	search.expanded, search.generated = header.Expanded, header.Generated
+	search.bestScore, search.bestIndex, search.bestMove = header.BestScore, header.BestIndex, header.BestMove
+	search.solved = header.Solved
+	if err := search.restore(&header); err != nil {
+		return SearchResult{}, err
+	}
+	return search.solve()
+}
+
+// restore loads the checkpoint's runs and node log into the empty search
+func (s *diskSearch) restore(header *checkpointHeader) error {
+	files := checkpointFiles(s.options.Checkpoint)
+
+	// the search removes runs as it goes, so it gets its own links to them
+	for _, saved := range header.FrontierRuns {
+		path := filepath.Join(s.dir, saved.File)
+		if err := linkOrCopyFile(filepath.Join(files, saved.File), path); err != nil {
+			return err
+		}
+		run, err := s.frontier.openRun(path, saved.Offset)
+		if err != nil {
+			return err
+		}
+		s.frontier.runs = append(s.frontier.runs, run)
+		s.savedFiles[saved.File] = true
+	}
+	s.frontier.length, s.frontier.pushed = header.FrontierStates, header.FrontierPushed
+	s.frontier.nextRun = header.FrontierNextRun
+
+	for _, saved := range header.VisitedRuns {
+		path := filepath.Join(s.dir, saved)
+		if err := linkOrCopyFile(filepath.Join(files, saved), path); err != nil {
+			return err
+		}
+		run, err := s.visited.openRun(path)
+		if err != nil {
+			return err
+		}
+		s.visited.runs = append(s.visited.runs, run)
+		s.savedFiles[saved] = true
+	}
+	s.visited.length, s.visited.nextRun = header.VisitedHashes, header.VisitedNextRun
+
+	// the log may have nodes from a checkpoint that didn't finish, after the
+	// ones this checkpoint has
+	nodes, err := os.Open(filepath.Join(files, checkpointNodeLog))
+	if err != nil {
+		return fmt.Errorf("Error opening checkpoint: %v", err)
+	}
+	defer nodes.Close()
+	if _, err := io.CopyN(s.nodes.w, nodes, header.Nodes*nodeLogRecord); err != nil {
+		return fmt.Errorf("Error reading checkpoint: %v", err)
+	}
+	s.nodes.count, s.savedNodes = header.Nodes, header.Nodes
+	return nil
+}
+
+// checkpoint saves the search to options.Checkpoint, copying in the runs and
+// nodes that the last checkpoint doesn't have
+func (s *diskSearch) checkpoint() error {
+	files := checkpointFiles(s.options.Checkpoint)
+	if err := os.MkdirAll(files, 0755); err != nil {
+		return fmt.Errorf("Error creating checkpoint: %v", err)
+	}
+	if err := s.frontier.sealMemory(); err != nil {
+		return err
+	}
+	if err := s.visited.sealMemory(); err != nil {
+		return err
+	}
+
+	header := checkpointHeader{
+		Version:         checkpointVersion,
+		Start:           s.start,
+		checkpointRules: s.rules(),
+		Expanded:        s.expanded,
+		Generated:       s.generated,
+		BestScore:       s.bestScore,
+		BestIndex:       s.bestIndex,
+		BestMove:        s.bestMove,
+		Solved:          s.solved,
+		FrontierStates:  s.frontier.Len(),
+		FrontierPushed:  s.frontier.pushed,
+		FrontierNextRun: s.frontier.nextRun,
+		FrontierRuns:    []savedFrontierRun{},
+		VisitedHashes:   s.visited.Len(),
+		VisitedNextRun:  s.visited.nextRun,
+		VisitedRuns:     []string{},
+		Nodes:           s.nodes.count,
+	}
+	used := map[string]bool{checkpointNodeLog: true}
+	for _, run := range s.frontier.runs {
+		name, err := s.saveRun(files, run.path)
+		if err != nil {
+			return err
+		}
+		header.FrontierRuns = append(header.FrontierRuns, savedFrontierRun{File: name, Offset: run.offset})
+		used[name] = true
+	}
+	for _, run := range s.visited.runs {
+		name, err := s.saveRun(files, run.path)
+		if err != nil {
+			return err
+		}
+		header.VisitedRuns = append(header.VisitedRuns, name)
+		used[name] = true
+	}
+	if err := s.saveNodes(files); err != nil {
+		return err
+	}
+
+	err := writeCheckpointFile(s.options.Checkpoint, func(w io.Writer) error {
+		return writeCheckpointHeader(w, header)
+	})
+	if err != nil {
+		return err
+	}
+
+	// now that the new checkpoint is in place, the runs that have since been
+	// merged or emptied can go, along with any left by an older search
+	infos, err := ioutil.ReadDir(files)
+	if err != nil {
+		return fmt.Errorf("Error reading checkpoint: %v", err)
+	}
+	for _, info := range infos {
+		if !used[info.Name()] {
+			if err := os.Remove(filepath.Join(files, info.Name())); err != nil {
+				return fmt.Errorf("Error removing old checkpoint run: %v", err)
+			}
+			delete(s.savedFiles, info.Name())
+		}
+	}
+	return nil
+}
+
+// saveRun puts the run file in the checkpoint's files, unless it's already
+// there. Returns its name there
+func (s *diskSearch) saveRun(files string, path string) (string, error) {
+	name := filepath.Base(path)
+	if s.savedFiles[name] {
+		return name, nil
+	}
+	if err := linkOrCopyFile(path, filepath.Join(files, name)); err != nil {
+		return "", err
+	}
+	s.savedFiles[name] = true
+	return name, nil
+}
+
+// saveNodes adds the nodes logged since the last checkpoint to the
+// checkpoint's node log
+func (s *diskSearch) saveNodes(files string) error {
+	if err := s.nodes.w.Flush(); err != nil {
+		return fmt.Errorf("Error writing node log: %v", err)
+	}
+	file, err := os.OpenFile(filepath.Join(files, checkpointNodeLog), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("Error creating checkpoint: %v", err)
+	}
+	defer file.Close()
+
+	// anything past the saved nodes is left from a checkpoint that didn't
+	// finish, so we write over it
+	start := s.savedNodes * nodeLogRecord
+	end := s.nodes.count * nodeLogRecord
+	if _, err := file.Seek(start, io.SeekStart); err == nil {
+		_, err = io.Copy(file, io.NewSectionReader(s.nodes.file, start, end-start))
+	}
+	if err == nil {
+		err = file.Truncate(end)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("Error writing checkpoint: %v", err)
+	}
+	s.savedNodes = s.nodes.count
+	return nil
+}
+
+// writeCheckpointFile saves a checkpoint to path with the write function.
+//
+// The checkpoint is written next to the old one and renamed over it, so the
+// old checkpoint survives if we die part way through.
+func writeCheckpointFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return fmt.Errorf("Error creating checkpoint: %v", err)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return fmt.Errorf("Error writing checkpoint: %v", err)
+	}
+	file.Close()
+	return os.Rename(path+".tmp", path)
+}
+
+// rules returns the options the search was run with that a resumed search must match
+func (s *diskSearch) rules() checkpointRules {
+	return newCheckpointRules(s.heuristic.Name, s.options.SearchOptions)
+}
+
+// checkpointRules are the options that change what a search finds. A search
+// must be resumed with the same rules it was started with
+type checkpointRules struct {
+	Heuristic    string
+	PruningRules []string
+	MoveOrdering *MoveOrderingWeights
+	PruneLost    bool
+}
+
+func newCheckpointRules(heuristic string, options SearchOptions) checkpointRules {
+	rules := checkpointRules{
+		Heuristic:    heuristic,
+		PruningRules: []string{},
+		MoveOrdering: options.MoveOrdering,
+		PruneLost:    options.PruneLost,
+	}
+	if options.Pruner != nil {
+		rules.PruningRules = options.Pruner.RuleNames()
+	}
+	return rules
+}
+
+// check returns an error if the given rules don't match the checkpoint's
+func (r *checkpointRules) check(given checkpointRules) error {
+	mismatch := func(what string, saved, given interface{}) error {
+		return fmt.Errorf("Checkpoint was made with %s '%v', not '%v'", what, saved, given)
+	}
+	if r.Heuristic != given.Heuristic {
+		return mismatch("heuristic", r.Heuristic, given.Heuristic)
+	}
+	saved, givenRules := strings.Join(r.PruningRules, ","), strings.Join(given.PruningRules, ",")
+	if saved != givenRules {
+		return mismatch("pruning rules", saved, givenRules)
+	}
+	if (r.MoveOrdering == nil) != (given.MoveOrdering == nil) ||
+		(r.MoveOrdering != nil && *r.MoveOrdering != *given.MoveOrdering) {
+		return mismatch("move ordering", r.MoveOrdering, given.MoveOrdering)
+	}
+	if r.PruneLost != given.PruneLost {
+		return mismatch("PruneLost", r.PruneLost, given.PruneLost)
+	}
+	return nil
+}
+
+// writeCheckpointHeader writes the header as JSON, after its length
+func writeCheckpointHeader(w io.Writer, header interface{}) error {
+	encoded, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(encoded))); err != nil {
+		return err
+	}
+	_, err = w.Write(encoded)
+	return err
+}
+
+// readCheckpointJSON reads a header written by writeCheckpointHeader into header
+func readCheckpointJSON(r io.Reader, header interface{}) error {
+	var length uint32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return fmt.Errorf("Error reading checkpoint: %v", err)
+	}
+	encoded := make([]byte, length)
+	if _, err := io.ReadFull(r, encoded); err != nil {
+		return fmt.Errorf("Error reading checkpoint: %v", err)
+	}
+	if err := json.Unmarshal(encoded, header); err != nil {
+		return fmt.Errorf("Error parsing checkpoint: %v", err)
+	}
+	return nil
+}
+
+func readCheckpointHeader(r io.Reader) (checkpointHeader, error) {
+	var header checkpointHeader
+	if err := readCheckpointJSON(r, &header); err != nil {
+		return header, err
+	}
+	if header.Version != checkpointVersion {
+		return header, fmt.Errorf(
+			"Checkpoint is version %d, but we can only read version %d", header.Version, checkpointVersion)
+	}
+	return header, nil
+}
+
+// sealMemory writes the entries in memory out to a run, so that every entry
+// is in a run file
+func (f *DiskFrontier) sealMemory() error {
+	if len(f.memory) == 0 {
+		return nil
+	}
+	return f.spill()
+}
+
+// sealMemory writes the hashes in memory out to a run, so that every hash is
+// in a run file
+func (v *DiskVisitedSet) sealMemory() error {
+	if len(v.memory) == 0 {
+		return nil
+	}
+	return v.spill()
+}
+
+// linkOrCopyFile makes dst a hard link to src, or a copy of it if they can't
+// be linked, like when they're on different filesystems. Either way, dst is
+// synced to disk
+func linkOrCopyFile(src string, dst string) error {
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Error replacing %s: %v", dst, err)
+	}
+	if os.Link(src, dst) == nil {
+		return syncFile(dst)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("Error copying %s: %v", src, err)
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("Error copying %s: %v", src, err)
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("Error copying %s: %v", src, err)
+	}
+	return nil
+}
+
+// syncFile makes sure the file's contents are on disk
+func syncFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("Error syncing %s: %v", path, err)
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("Error syncing %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package libsolver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+func TestResumeDiskMatchesUninterrupted(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	start := createPysolGameState(t, 1)
+	pruner, err := NewPruner(DefaultPruningRules)
+	assert.Nil(t, err)
+	options := DiskOptions{
+		SearchOptions:    SearchOptions{Pruner: pruner, MaxExpanded: 1500},
+		MemoryStates:     200,
+		MemoryHashes:     200,
+		BloomBitsPerHash: 4,
+	}
+	uninterrupted, err := SolveDisk(start, options)
+	assert.Nil(t, err)
+
+	// stop part way through, after a couple of periodic checkpoints
+	options.Checkpoint = filepath.Join(dir, "search.checkpoint")
+	options.CheckpointEvery = 250
+	options.MaxExpanded = 600
+	stopped, err := SolveDisk(start, options)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 600, stopped.Expanded)
+
+	options.MaxExpanded = 1500
+	resumed, err := ResumeDisk(options)
+	assert.Nil(t, err)
+	assert.Equal(t, uninterrupted.Expanded, resumed.Expanded)
+	assert.Equal(t, uninterrupted.Generated, resumed.Generated)
+	assert.Equal(t, uninterrupted.BestPath, resumed.BestPath)
+	assert.Equal(t, HashGameState(&uninterrupted.BestState), HashGameState(&resumed.BestState))
+}
+
+func TestDiskCheckpointOnlySavesNewRuns(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	checkpoint := filepath.Join(dir, "search.checkpoint")
+	search, err := newDiskSearch(DiskOptions{
+		SearchOptions: SearchOptions{Checkpoint: checkpoint},
+		Dir:           dir,
+		MemoryHashes:  10,
+	})
+	assert.Nil(t, err)
+	defer search.close()
+	addHashes := func(from, to uint64) {
+		for i := from; i < to; i++ {
+			_, err := search.visited.Add(i * 0x9E3779B97F4A7C15)
+			assert.Nil(t, err)
+		}
+	}
+
+	addHashes(0, 10)
+	_, err = search.nodes.append(-1, libgame.MoveRequest{})
+	assert.Nil(t, err)
+	assert.Nil(t, search.checkpoint())
+	assert.Len(t, search.visited.runs, 1)
+
+	// the search's own copy of the saved run isn't needed again, so the next
+	// checkpoint works without it
+	assert.Nil(t, os.Remove(search.visited.runs[0].path))
+	addHashes(10, 25)
+	_, err = search.nodes.append(0, libgame.MoveRequest{})
+	assert.Nil(t, err)
+	assert.Nil(t, search.checkpoint())
+
+	files, err := ioutil.ReadDir(checkpointFiles(checkpoint))
+	assert.Nil(t, err)
+	assert.Len(t, files, len(search.visited.runs)+1)
+	for _, file := range files {
+		if file.Name() == checkpointNodeLog {
+			assert.EqualValues(t, 2*nodeLogRecord, file.Size())
+		}
+	}
+}
+
+func TestResumeDiskSolves(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	start := createNearlyWonGameState()
+	options := DiskOptions{SearchOptions: SearchOptions{
+		MaxExpanded: 2,
+		Checkpoint:  filepath.Join(dir, "search.checkpoint"),
+	}}
+	stopped, err := SolveDisk(start, options)
+	assert.Nil(t, err)
+	assert.False(t, stopped.Solved)
+
+	options.MaxExpanded = 0
+	resumed, err := ResumeDisk(options)
+	assert.Nil(t, err)
+	assertSolves(t, start, resumed)
+
+	// resuming a finished search gives the same result
+	again, err := ResumeDisk(options)
+	assert.Nil(t, err)
+	assert.Equal(t, resumed.Solution, again.Solution)
+	assert.Equal(t, resumed.Expanded, again.Expanded)
+}
+
+func TestResumeDiskChecksRules(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	options := DiskOptions{SearchOptions: SearchOptions{
+		MaxExpanded: 2,
+		Checkpoint:  filepath.Join(dir, "search.checkpoint"),
+	}}
+	_, err := SolveDisk(createPysolGameState(t, 1), options)
+	assert.Nil(t, err)
+
+	changed := options
+	changed.Heuristic = "blockers"
+	_, err = ResumeDisk(changed)
+	assert.Error(t, err)
+
+	changed = options
+	changed.Pruner, err = NewPruner(DefaultPruningRules)
+	assert.Nil(t, err)
+	_, err = ResumeDisk(changed)
+	assert.Error(t, err)
+
+	changed = options
+	changed.PruneLost = true
+	_, err = ResumeDisk(changed)
+	assert.Error(t, err)
+
+	changed = options
+	changed.Checkpoint = filepath.Join(dir, "missing.checkpoint")
+	_, err = ResumeDisk(changed)
+	assert.Error(t, err)
+}
+
+// resumableSearch is one of the in-memory searches, started and resumed with
+// the given options
+type resumableSearch struct {
+	name   string
+	solve  func(libgame.GameState, SearchOptions) (SearchResult, error)
+	resume func(SearchOptions) (SearchResult, error)
+}
+
+var resumableSearches = []resumableSearch{
+	{
+		"idastar",
+		func(start libgame.GameState, options SearchOptions) (SearchResult, error) {
+			return SolveIDAStar(start, IDAStarOptions{SearchOptions: options, TranspositionTableSize: 1 << 12})
+		},
+		func(options SearchOptions) (SearchResult, error) {
+			return ResumeIDAStar(IDAStarOptions{SearchOptions: options, TranspositionTableSize: 1 << 12})
+		},
+	},
+	{
+		"beam",
+		func(start libgame.GameState, options SearchOptions) (SearchResult, error) {
+			return SolveBeam(start, BeamOptions{SearchOptions: options, Width: 20})
+		},
+		func(options SearchOptions) (SearchResult, error) {
+			return ResumeBeam(BeamOptions{SearchOptions: options, Width: 20})
+		},
+	},
+	{
+		"parallel",
+		func(start libgame.GameState, options SearchOptions) (SearchResult, error) {
+			return SolveParallel(start, ParallelOptions{SearchOptions: options, Workers: 1})
+		},
+		func(options SearchOptions) (SearchResult, error) {
+			return ResumeParallel(ParallelOptions{SearchOptions: options, Workers: 1})
+		},
+	},
+}
+
+func TestResumeSearchesMatchUninterrupted(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	start := createPysolGameState(t, 1)
+	pruner, err := NewPruner(DefaultPruningRules)
+	assert.Nil(t, err)
+	for _, search := range resumableSearches {
+		options := SearchOptions{Pruner: pruner, MaxExpanded: 1500}
+		uninterrupted, err := search.solve(start, options)
+		assert.Nil(t, err, search.name)
+
+		// stop part way through, after a couple of periodic checkpoints
+		options.Checkpoint = filepath.Join(dir, search.name+".checkpoint")
+		options.CheckpointEvery = 250
+		options.MaxExpanded = 600
+		stopped, err := search.solve(start, options)
+		assert.Nil(t, err, search.name)
+		assert.EqualValues(t, 600, stopped.Expanded, search.name)
+
+		options.MaxExpanded = 1500
+		resumed, err := search.resume(options)
+		assert.Nil(t, err, search.name)
+		assert.Equal(t, uninterrupted.Expanded, resumed.Expanded, search.name)
+		assert.Equal(t, uninterrupted.Generated, resumed.Generated, search.name)
+		assert.Equal(t, uninterrupted.BestPath, resumed.BestPath, search.name)
+		assert.Equal(t, HashGameState(&uninterrupted.BestState), HashGameState(&resumed.BestState),
+			search.name)
+	}
+}
+
+func TestResumeSearchesSolve(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	start := createNearlyWonGameState()
+	for _, search := range resumableSearches {
+		options := SearchOptions{
+			MaxExpanded: 1,
+			Checkpoint:  filepath.Join(dir, search.name+".checkpoint"),
+		}
+		stopped, err := search.solve(start, options)
+		assert.Nil(t, err, search.name)
+		assert.False(t, stopped.Solved, search.name)
+
+		options.MaxExpanded = 0
+		resumed, err := search.resume(options)
+		assert.Nil(t, err, search.name)
+		assertSolves(t, start, resumed)
+
+		// resuming a finished search gives the same result
+		again, err := search.resume(options)
+		assert.Nil(t, err, search.name)
+		assert.Equal(t, resumed.Solution, again.Solution, search.name)
+		assert.Equal(t, resumed.Expanded, again.Expanded, search.name)
+	}
+}
+
+func TestResumeSearchesCheckRules(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	for i, search := range resumableSearches {
+		options := SearchOptions{
+			MaxExpanded: 2,
+			Checkpoint:  filepath.Join(dir, search.name+".checkpoint"),
+		}
+		_, err := search.solve(createPysolGameState(t, 1), options)
+		assert.Nil(t, err, search.name)
+
+		changed := options
+		changed.Pruner, err = NewPruner(DefaultPruningRules)
+		assert.Nil(t, err)
+		_, err = search.resume(changed)
+		assert.Error(t, err, search.name)
+
+		changed = options
+		changed.PruneLost = true
+		_, err = search.resume(changed)
+		assert.Error(t, err, search.name)
+
+		changed = options
+		changed.Checkpoint = filepath.Join(dir, "missing.checkpoint")
+		_, err = search.resume(changed)
+		assert.Error(t, err, search.name)
+
+		// another search's checkpoint
+		other := resumableSearches[(i+1)%len(resumableSearches)]
+		_, err = other.resume(options)
+		assert.Error(t, err, search.name)
+	}
+}
+
+func TestResumeBeamChecksWidth(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	options := BeamOptions{
+		SearchOptions: SearchOptions{MaxExpanded: 2, Checkpoint: filepath.Join(dir, "beam.checkpoint")},
+		Width:         20,
+	}
+	_, err := SolveBeam(createPysolGameState(t, 1), options)
+	assert.Nil(t, err)
+
+	options.Width = 30
+	_, err = ResumeBeam(options)
+	assert.Error(t, err)
+}
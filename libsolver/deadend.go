@@ -0,0 +1,190 @@
+package libsolver
+
+import (
+	"fmt"
+
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// ProvablyLost returns true if the game can't be won from the state, along with
+// a card that can never reach a foundation.
+//
+// We work out everything that could ever happen in the game while ignoring the
+// order that it has to happen in, so a state that ProvablyLost passes may still
+// be lost. A state it fails is always lost. For example, a card sitting on both
+// copies of the card it needs under it can only get out of the way onto the
+// next higher card or an empty tableau. If neither can ever be reached, the
+// game is lost.
+func ProvablyLost(state *libgame.GameState) (bool, deck.Card) {
+	a := newLostAnalysis(state)
+	a.run()
+	for i, c := range a.cards {
+		if c.suit >= 0 && !a.reaches[i] {
+			return true, c.card
+		}
+	}
+	return false, deck.Card{}
+}
+
+// DescribeLostCard explains why a card returned by ProvablyLost makes the game lost
+func DescribeLostCard(card deck.Card) string {
+	return fmt.Sprintf("%v can never reach a foundation", card)
+}
+
+// lostCard is a card that isn't on a foundation yet
+type lostCard struct {
+	card  deck.Card
+	suit  int
+	rank  int
+	pile  int // index into lostAnalysis.piles, or -1 for stock cards
+	depth int // position in the pile, 0 at the bottom
+}
+
+// lostAnalysis finds the least fixed point of what could ever happen to each
+// card. Everything starts out impossible, and we keep marking things possible
+// until nothing changes. Each rule only asks for things that must have happened
+// first in any real game, so anything left impossible is truly impossible.
+type lostAnalysis struct {
+	cards []lostCard
+	// piles are the tableaus and then the waste. Cards only leave from the top
+	piles        [][]int // indexes into cards, bottom first
+	numEmpty     int     // tableaus that are already empty
+	onFoundation [numSuits][numRanks + 1]bool
+	copies       [numSuits][numRanks + 2][]int // indexes into cards
+
+	movable []bool // the card could leave its pile
+	reaches []bool // the card could reach a foundation
+}
+
+func newLostAnalysis(state *libgame.GameState) *lostAnalysis {
+	a := &lostAnalysis{}
+	add := func(card deck.Card, pile int, depth int) int {
+		suit, suitOk := suitIndexes[card.Suit]
+		rank, rankOk := faceRanks[card.Face]
+		if !suitOk || !rankOk {
+			suit, rank = -1, 0
+		}
+		a.cards = append(a.cards, lostCard{card, suit, rank, pile, depth})
+		i := len(a.cards) - 1
+		if suit >= 0 {
+			a.copies[suit][rank] = append(a.copies[suit][rank], i)
+		}
+		return i
+	}
+	addPile := func(cards []deck.Card) {
+		pile := len(a.piles)
+		indexes := make([]int, len(cards))
+		for depth, card := range cards {
+			indexes[depth] = add(card, pile, depth)
+		}
+		a.piles = append(a.piles, indexes)
+	}
+
+	for i := range state.Tableaus {
+		if len(state.Tableaus[i].Cards) == 0 {
+			a.numEmpty++
+		}
+		addPile(state.Tableaus[i].Cards)
+	}
+	addPile(state.Waste.Cards)
+	for depth, card := range state.Stock.Cards {
+		add(card, -1, depth)
+	}
+	for i := range state.Foundations {
+		for _, card := range state.Foundations[i].Cards {
+			suit, suitOk := suitIndexes[card.Suit]
+			rank, rankOk := faceRanks[card.Face]
+			if suitOk && rankOk {
+				a.onFoundation[suit][rank] = true
+			}
+		}
+	}
+
+	a.movable = make([]bool, len(a.cards))
+	a.reaches = make([]bool, len(a.cards))
+	return a
+}
+
+func (a *lostAnalysis) run() {
+	for changed := true; changed; {
+		changed = false
+		canEmpty := a.canEmptyTableau()
+		for i, c := range a.cards {
+			if c.suit < 0 || !a.canUncover(i) {
+				continue
+			}
+			if !a.reaches[i] && (c.rank == 1 || a.predecessorReaches(c)) {
+				a.reaches[i] = true
+				changed = true
+			}
+			if !a.movable[i] && (a.reaches[i] || canEmpty || a.canBeTableauTop(c.suit, c.rank+1)) {
+				a.movable[i] = true
+				changed = true
+			}
+		}
+	}
+}
+
+// canUncover returns true if every card on top of the card could move away.
+// The stock is flipped one card at a time, so every stock card is uncovered
+func (a *lostAnalysis) canUncover(i int) bool {
+	c := a.cards[i]
+	if c.pile < 0 {
+		return true
+	}
+	pile := a.piles[c.pile]
+	for _, above := range pile[c.depth+1:] {
+		if !a.movable[above] {
+			return false
+		}
+	}
+	return true
+}
+
+// canEmptyTableau returns true if a tableau is empty, or could be emptied
+func (a *lostAnalysis) canEmptyTableau() bool {
+	if a.numEmpty > 0 {
+		return true
+	}
+	for _, pile := range a.piles[:len(a.piles)-1] {
+		if len(pile) > 0 && a.movable[pile[0]] {
+			return true
+		}
+	}
+	return false
+}
+
+// predecessorReaches returns true if the card the card goes on in a foundation
+// is, or could get, there
+func (a *lostAnalysis) predecessorReaches(c lostCard) bool {
+	if a.onFoundation[c.suit][c.rank-1] {
+		return true
+	}
+	for _, i := range a.copies[c.suit][c.rank-1] {
+		if a.reaches[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// canBeTableauTop returns true if a card of the suit and rank could ever be on
+// top of a tableau, for another card to be moved onto
+func (a *lostAnalysis) canBeTableauTop(suit int, rank int) bool {
+	if rank > numRanks {
+		return false
+	}
+	// foundation cards can come back down
+	if a.onFoundation[suit][rank] {
+		return true
+	}
+	for _, i := range a.copies[suit][rank] {
+		c := a.cards[i]
+		isTableau := c.pile >= 0 && c.pile < len(a.piles)-1
+		if a.movable[i] || (isTableau && a.canUncover(i)) {
+			return true
+		}
+	}
+	return false
+}
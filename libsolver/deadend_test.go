@@ -0,0 +1,108 @@
+package libsolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// createLostGameState returns a valid state where the five of clubs sits on both
+// fours of clubs, and every tableau is topped by a club whose next higher club
+// is buried. The king of spades on the last tableau can still go back up.
+func createLostGameState() libgame.GameState {
+	state := createEmptyGameState()
+	suits := []deck.Suit{deck.SPADE, deck.HEART, deck.DIAMOND, deck.CLUB}
+	for i := range state.Foundations {
+		suit := suits[i/2]
+		for face := deck.ACE; ; face, _ = deck.Increment(face) {
+			state.Foundations[i].Cards = append(
+				state.Foundations[i].Cards, deck.Card{Face: face, Suit: suit})
+			if face == deck.KING || (suit == deck.CLUB && face == deck.THREE) {
+				break
+			}
+		}
+	}
+	clubs := func(faces ...deck.Face) []deck.Card {
+		cards := make([]deck.Card, len(faces))
+		for i, face := range faces {
+			cards[i] = deck.Card{Face: face, Suit: deck.CLUB}
+		}
+		return cards
+	}
+	state.Tableaus[0].Cards = clubs(deck.FOUR, deck.FOUR, deck.FIVE)
+	state.Tableaus[1].Cards = clubs(deck.QUEEN, deck.KING)
+	state.Tableaus[2].Cards = clubs(deck.QUEEN, deck.KING)
+	state.Tableaus[3].Cards = clubs(deck.TEN, deck.JACK)
+	state.Tableaus[4].Cards = clubs(deck.TEN, deck.JACK)
+	state.Tableaus[5].Cards = clubs(deck.EIGHT, deck.NINE)
+	state.Tableaus[6].Cards = clubs(deck.EIGHT, deck.NINE)
+	state.Tableaus[7].Cards = clubs(deck.SIX, deck.SEVEN)
+	state.Tableaus[8].Cards = clubs(deck.SIX, deck.SEVEN)
+	state.Tableaus[9].Cards = append(clubs(deck.FIVE), deck.Card{Face: deck.KING, Suit: deck.SPADE})
+	state.Foundations[0].Cards = state.Foundations[0].Cards[:12]
+	state.Score = 21
+	return state
+}
+
+func TestLostGameStateIsValid(t *testing.T) {
+	state := createLostGameState()
+	assert.Nil(t, state.Validate())
+	assert.Equal(t, libgame.InProgress, state.Status(), "the king of spades can still move")
+}
+
+func TestProvablyLost(t *testing.T) {
+	state := createLostGameState()
+	lost, card := ProvablyLost(&state)
+	assert.True(t, lost)
+	assert.Equal(t, deck.Card{Face: deck.FOUR, Suit: deck.CLUB}, card)
+	assert.Contains(t, DescribeLostCard(card), "never reach a foundation")
+}
+
+func TestProvablyLostWithEmptyTableau(t *testing.T) {
+	// with somewhere to put the five of clubs, the fours can get out
+	state := createLostGameState()
+	state.Waste.Cards = state.Tableaus[9].Cards[:1]
+	state.Tableaus[9].Cards = state.Tableaus[9].Cards[1:]
+	lost, _ := ProvablyLost(&state)
+	assert.False(t, lost)
+}
+
+func TestProvablyLostWithReachableSix(t *testing.T) {
+	// the five of clubs can go onto a six, uncovering the fours
+	state := createLostGameState()
+	state.Tableaus[7].Cards = []deck.Card{
+		deck.Card{Face: deck.SEVEN, Suit: deck.CLUB},
+		deck.Card{Face: deck.SIX, Suit: deck.CLUB}}
+	lost, _ := ProvablyLost(&state)
+	assert.False(t, lost)
+}
+
+func TestProvablyLostNewGames(t *testing.T) {
+	for _, state := range []libgame.GameState{
+		libgame.DealNewGame(libgame.Game{ID: 0}),
+		createNearlyWonGameState(),
+	} {
+		lost, _ := ProvablyLost(&state)
+		assert.False(t, lost)
+	}
+}
+
+func TestSearchPrunesLostStates(t *testing.T) {
+	state := createLostGameState()
+	result, err := SolveIDAStar(state, IDAStarOptions{})
+	assert.Nil(t, err)
+	assert.False(t, result.Solved)
+	assert.True(t, result.Expanded > 0)
+
+	result, err = SolveIDAStar(state, IDAStarOptions{SearchOptions: SearchOptions{PruneLost: true}})
+	assert.Nil(t, err)
+	assert.False(t, result.Solved)
+	assert.EqualValues(t, 0, result.Expanded)
+
+	result, err = SolveBeam(state, BeamOptions{SearchOptions: SearchOptions{PruneLost: true}})
+	assert.Nil(t, err)
+	assert.False(t, result.Solved)
+	assert.EqualValues(t, 1, result.Expanded, "only the starting state is expanded")
+}
@@ -0,0 +1,132 @@
+package libsolver
+
+import (
+	"math"
+
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// DifficultyRating buckets difficulty scores for players
+type DifficultyRating string
+
+const (
+	Easy   DifficultyRating = "easy"
+	Medium DifficultyRating = "medium"
+	Hard   DifficultyRating = "hard"
+)
+
+// Difficulty scores above these are rated Medium and Hard
+const (
+	mediumDifficulty = 33
+	hardDifficulty   = 66
+)
+
+// DifficultyOptions configures RateDifficulty
+type DifficultyOptions struct {
+	// Search is the beam search used to look for a solution. MaxExpanded
+	// defaults to DefaultDifficultyMaxExpanded, to keep rating quick
+	Search BeamOptions
+
+	// Playouts are played to estimate the win rate. Playouts defaults to
+	// DefaultDifficultyPlayouts
+	Playouts PlayoutOptions
+}
+
+const (
+	// DefaultDifficultyMaxExpanded is the search budget used when none is given
+	DefaultDifficultyMaxExpanded = 50000
+	// DefaultDifficultyPlayouts is the number of playouts used when none is given
+	DefaultDifficultyPlayouts = 200
+)
+
+// Difficulty is how hard the solver found a deal, and the measurements behind it
+type Difficulty struct {
+	Score  float64 // from 0 for the easiest deals to 100 for the hardest
+	Rating DifficultyRating
+
+	Solved          bool
+	SolutionLength  int     // moves in the solution found, if Solved
+	BestScore       int     // lowest score the search reached
+	Expanded        int64   // states the search expanded
+	BranchingFactor float64 // average children of each expanded state
+	PlayoutWinRate  float64
+}
+
+// RateDifficulty measures how hard the solver finds a deal.
+//
+// We run a budgeted beam search and a set of playouts from the state, then
+// combine how often the playouts won, how much of the budget the search used
+// and how long its solution was, and how many moves there were to choose from.
+// Deals the search couldn't solve count as having used the whole budget.
+//
+// Returns error if the options name a heuristic or policy that doesn't exist.
+func RateDifficulty(start libgame.GameState, options DifficultyOptions) (Difficulty, error) {
+	if options.Search.MaxExpanded <= 0 {
+		options.Search.MaxExpanded = DefaultDifficultyMaxExpanded
+	}
+	if options.Playouts.Playouts <= 0 {
+		options.Playouts.Playouts = DefaultDifficultyPlayouts
+	}
+
+	search, err := SolveBeam(start, options.Search)
+	if err != nil {
+		return Difficulty{}, err
+	}
+	playouts, err := RunPlayouts(start, options.Playouts)
+	if err != nil {
+		return Difficulty{}, err
+	}
+
+	d := Difficulty{
+		Solved:          search.Solved,
+		SolutionLength:  len(search.Solution),
+		BestScore:       search.BestState.Score,
+		Expanded:        search.Expanded,
+		BranchingFactor: search.BranchingFactor(),
+		PlayoutWinRate:  playouts.WinRate,
+	}
+	d.Score = difficultyScore(d, options.Search.MaxExpanded)
+	d.Rating = ratingForScore(d.Score)
+	return d, nil
+}
+
+// difficultyScore combines the measurements into a single score out of 100.
+//
+// Each measurement is scaled to between 0 and 1, where 1 is hardest.
+func difficultyScore(d Difficulty, maxExpanded int64) float64 {
+	// searches grow exponentially, so we compare effort on a log scale
+	effort, length := 1.0, 1.0
+	if d.Solved {
+		effort = math.Log(float64(d.Expanded)+1) / math.Log(float64(maxExpanded)+1)
+		length = float64(d.SolutionLength) / maxSolutionLength
+	}
+	// fewer choices at each move leaves fewer ways to get out of trouble
+	branching := 1 - d.BranchingFactor/maxBranchingFactor
+
+	score := 40*(1-d.PlayoutWinRate) + 30*clamp(effort) + 20*clamp(length) + 10*clamp(branching)
+	return math.Round(score*10) / 10
+}
+
+const (
+	// maxSolutionLength is about as long as a solution gets: every card moves
+	// at least once and the stock is flipped once
+	maxSolutionLength = 200
+	// maxBranchingFactor is a generous number of moves to have in a position
+	maxBranchingFactor = 20
+)
+
+func clamp(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
+}
+
+// ratingForScore buckets a difficulty score
+func ratingForScore(score float64) DifficultyRating {
+	switch {
+	case score > hardDifficulty:
+		return Hard
+	case score > mediumDifficulty:
+		return Medium
+	default:
+		return Easy
+	}
+}
@@ -0,0 +1,66 @@
+package libsolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+func TestRateDifficultyNearlyWon(t *testing.T) {
+	d, err := RateDifficulty(createNearlyWonGameState(), DifficultyOptions{})
+	assert.Nil(t, err)
+	assert.True(t, d.Solved)
+	assert.Equal(t, nearlyWonSolutionLength, d.SolutionLength)
+	assert.Equal(t, 0, d.BestScore)
+	assert.Equal(t, 1.0, d.PlayoutWinRate)
+	assert.True(t, d.BranchingFactor > 0)
+	assert.Equal(t, Easy, d.Rating)
+}
+
+func TestRateDifficultyUnsolved(t *testing.T) {
+	start, err := libgame.DealPysolGame(libgame.Game{ID: 0}, 1)
+	assert.Nil(t, err)
+	d, err := RateDifficulty(start, DifficultyOptions{
+		Search:   BeamOptions{SearchOptions: SearchOptions{MaxExpanded: 100}},
+		Playouts: PlayoutOptions{Playouts: 5, Seed: 1},
+	})
+	assert.Nil(t, err)
+	assert.False(t, d.Solved)
+	assert.EqualValues(t, 100, d.Expanded)
+	assert.Equal(t, 102, d.BestScore)
+	assert.Equal(t, 0.0, d.PlayoutWinRate)
+	assert.InDelta(t, 7.36, d.BranchingFactor, 0.001)
+	assert.InDelta(t, 96.3, d.Score, 0.001)
+	assert.Equal(t, Hard, d.Rating)
+}
+
+func TestRateDifficultyBadOptions(t *testing.T) {
+	_, err := RateDifficulty(createNearlyWonGameState(), DifficultyOptions{
+		Search: BeamOptions{Heuristic: "not-a-heuristic"}})
+	assert.Error(t, err)
+	_, err = RateDifficulty(createNearlyWonGameState(), DifficultyOptions{
+		Playouts: PlayoutOptions{Policy: "not-a-policy"}})
+	assert.Error(t, err)
+}
+
+func TestDifficultyScore(t *testing.T) {
+	easiest := Difficulty{Solved: true, Expanded: 0, PlayoutWinRate: 1, BranchingFactor: 20}
+	assert.Equal(t, 0.0, difficultyScore(easiest, 1000))
+	hardest := Difficulty{Solved: false, PlayoutWinRate: 0, BranchingFactor: 0}
+	assert.Equal(t, 100.0, difficultyScore(hardest, 1000))
+
+	// the more work the search does, the harder the deal
+	quick := Difficulty{Solved: true, Expanded: 10, SolutionLength: 120, BranchingFactor: 8}
+	slow := quick
+	slow.Expanded = 900
+	assert.True(t, difficultyScore(quick, 1000) < difficultyScore(slow, 1000))
+}
+
+func TestRatingForScore(t *testing.T) {
+	assert.Equal(t, Easy, ratingForScore(0))
+	assert.Equal(t, Easy, ratingForScore(mediumDifficulty))
+	assert.Equal(t, Medium, ratingForScore(50))
+	assert.Equal(t, Hard, ratingForScore(hardDifficulty+0.1))
+	assert.Equal(t, Hard, ratingForScore(100))
+}
@@ -0,0 +1,252 @@
+package libsolver
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// DiskOptions configures SolveDisk
+type DiskOptions struct {
+	SearchOptions
+
+	// Heuristic is the name of the heuristic that picks the next state to
+	// expand. Defaults to DefaultHeuristic
+	Heuristic string
+
+	// Dir is where the search keeps its files, in a new directory that is
+	// removed once the search is over. Defaults to the system's temporary
+	// directory
+	Dir string
+
+	// MemoryStates is the number of frontier states kept in memory. Defaults
+	// to DefaultDiskMemoryStates
+	MemoryStates int
+
+	// MemoryHashes is the number of visited hashes kept in memory. Defaults to
+	// DefaultDiskMemoryHashes
+	MemoryHashes int
+
+	// BloomBitsPerHash sizes the bloom filters of the visited set's runs, as
+	// this many bits for each hash in them. Defaults to DefaultBloomBitsPerHash
+	BloomBitsPerHash int
+}
+
+// SolveDisk runs a best first search for a solution to the game, keeping the
+// frontier and visited states on disk once they outgrow memory.
+//
+// Like SolveParallel, it expands the most promising states first, but it can
+// search far more states than fit in memory without needing a database.
+// Each state is kept encoded in a few dozen bytes, and the path to it is kept
+// in a log of expanded states.
+//
+// Checkpoints keep their run files and node log in a directory next to
+// Checkpoint, named like it with ".files" on the end.
+//
+// Returns error if the heuristic doesn't exist, or on any disk error.
+func SolveDisk(start libgame.GameState, options DiskOptions) (SearchResult, error) {
+	search, err := newDiskSearch(options)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	defer search.close()
+
+	search.start = start.Copy()
+	search.bestScore = start.Score
+	if _, err := search.visited.Add(HashGameState(&start)); err != nil {
+		return SearchResult{}, err
+	}
+	err = search.frontier.Push(frontierEntry{
+		estimate: search.heuristic.Estimate(&start),
+		parent:   -1,
+		state:    appendState(nil, &start),
+	})
+	if err != nil {
+		return SearchResult{}, err
+	}
+	return search.solve()
+}
+
+type diskSearch struct {
+	options   DiskOptions
+	heuristic Heuristic
+	start     libgame.GameState
+	dir       string
+	expander  *expander
+	progress  *progressReporter
+	frontier  *DiskFrontier
+	visited   *DiskVisitedSet
+	nodes     *nodeLog
+
+	expanded  int64
+	generated int64
+
+	// the best state seen is the child of the node at bestIndex by bestMove,
+	// or the starting state if bestMove is nil
+	bestScore int
+	bestIndex int64
+	bestMove  *libgame.MoveRequest
+	solved    bool
+
+	// the files already in the checkpoint, and how many nodes it has
+	savedFiles map[string]bool
+	savedNodes int64
+}
+
+// newDiskSearch creates an empty search, with its files in a new directory
+func newDiskSearch(options DiskOptions) (*diskSearch, error) {
+	h, err := LookupHeuristic(options.Heuristic)
+	if err != nil {
+		return nil, err
+	}
+	if options.CheckpointEvery <= 0 {
+		options.CheckpointEvery = DefaultCheckpointEvery
+	}
+	dir, err := ioutil.TempDir(options.Dir, "forty-thieves-search-")
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := newNodeLog(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &diskSearch{
+		options:   options,
+		heuristic: h,
+		dir:       dir,
+		expander:  newExpander(options.SearchOptions),
+		progress:  newProgressReporter(options.SearchOptions),
+		frontier:  NewDiskFrontier(dir, options.MemoryStates),
+		visited:   NewDiskVisitedSet(dir, options.MemoryHashes, options.BloomBitsPerHash),
+		nodes:     nodes,
+		bestIndex: -1,
+
+		savedFiles: make(map[string]bool),
+	}, nil
+}
+
+// close removes the search's files
+func (s *diskSearch) close() {
+	s.frontier.Close()
+	s.visited.Close()
+	s.nodes.remove()
+	os.RemoveAll(s.dir)
+}
+
+// solve runs the search and builds its result, saving a checkpoint at the end
+func (s *diskSearch) solve() (SearchResult, error) {
+	if err := s.run(); err != nil {
+		return SearchResult{}, err
+	}
+	if s.options.Checkpoint != "" {
+		if err := s.checkpoint(); err != nil {
+			return SearchResult{}, err
+		}
+	}
+
+	result := SearchResult{
+		Solved:    s.solved,
+		Expanded:  s.expanded,
+		Generated: s.generated,
+	}
+	var err error
+	result.BestPath, err = s.nodes.path(s.bestIndex, s.bestMove)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	if result.Solved {
+		result.Solution = result.BestPath
+	}
+	err = result.finish(s.start)
+	s.progress.done(&result)
+	return result, err
+}
+
+// run expands states until the search is solved, runs out of states, hits
+// MaxExpanded or is cancelled
+func (s *diskSearch) run() error {
+	var moves []libgame.MoveRequest
+	for !s.solved {
+		if s.options.stopped(s.expanded) {
+			return nil
+		}
+		entry, ok, err := s.frontier.Pop()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		state, err := decodeState(entry.state)
+		if err != nil {
+			return err
+		}
+		index, err := s.nodes.append(entry.parent, entry.move)
+		if err != nil {
+			return err
+		}
+		s.expanded++
+
+		var lastMove *libgame.MoveRequest
+		if entry.depth > 0 {
+			lastMove = &entry.move
+		}
+		moves = s.expander.appendMoves(moves[:0], &state, lastMove)
+		s.generated += int64(len(moves))
+		if s.progress.due(s.expanded) {
+			s.progress.report(Progress{
+				Expanded:  s.expanded,
+				Generated: s.generated,
+				BestScore: s.bestScore,
+				Depth:     entry.depth,
+				Frontier:  s.frontier.Len(),
+			})
+		}
+		parent := &searchState{state: state, stock: state.Stock.Cards}
+		for _, move := range moves {
+			parent.do(move)
+			err := s.visit(&parent.state, entry.depth+1, index, move)
+			parent.undo(move)
+			if err != nil || s.solved {
+				return err
+			}
+		}
+
+		if s.options.Checkpoint != "" && s.expanded%s.options.CheckpointEvery == 0 {
+			if err := s.checkpoint(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// visit adds a child to the frontier, unless it has been seen before
+func (s *diskSearch) visit(
+	child *libgame.GameState, depth int, parent int64, move libgame.MoveRequest) error {
+	isNew, err := s.visited.Add(HashGameState(child))
+	if err != nil || !isNew {
+		return err
+	}
+	if s.options.PruneLost {
+		if lost, _ := ProvablyLost(child); lost {
+			return nil
+		}
+	}
+	if child.Score < s.bestScore {
+		s.bestScore, s.bestIndex, s.bestMove = child.Score, parent, &move
+	}
+	if child.Score == 0 {
+		s.solved = true
+		return nil
+	}
+	return s.frontier.Push(frontierEntry{
+		estimate: s.heuristic.Estimate(child),
+		depth:    depth,
+		parent:   parent,
+		move:     move,
+		state:    appendState(nil, child),
+	})
+}
@@ -0,0 +1,146 @@
+package libsolver
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+func createTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "libsolver-test-")
+	assert.Nil(t, err)
+	return dir
+}
+
+func TestDiskVisitedSet(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	// a small memory and small bloom filters, so that we spill, merge and hit
+	// false positives
+	visited := NewDiskVisitedSet(dir, 100, 2)
+	defer visited.Close()
+
+	hashOf := func(i uint64) uint64 { return i * 0x9E3779B97F4A7C15 }
+	for i := uint64(0); i < 5000; i++ {
+		added, err := visited.Add(hashOf(i))
+		assert.Nil(t, err)
+		assert.True(t, added)
+	}
+	assert.EqualValues(t, 5000, visited.Len())
+	assert.True(t, len(visited.runs) <= maxHashRuns)
+
+	// each run's bloom filter grows with the run
+	for _, run := range visited.runs {
+		assert.True(t, run.bloom.size >= 2*uint64(run.count))
+	}
+
+	for i := uint64(0); i < 5000; i++ {
+		added, err := visited.Add(hashOf(i))
+		assert.Nil(t, err)
+		assert.False(t, added, "hash %d was already added", i)
+	}
+	for i := uint64(5000); i < 5100; i++ {
+		found, err := visited.Contains(hashOf(i))
+		assert.Nil(t, err)
+		assert.False(t, found)
+	}
+	assert.EqualValues(t, 5000, visited.Len())
+}
+
+func TestDiskFrontierPopsInOrder(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	frontier := NewDiskFrontier(dir, 10)
+	defer frontier.Close()
+
+	rng := rand.New(rand.NewSource(1))
+	push := func(n int) {
+		for i := 0; i < n; i++ {
+			err := frontier.Push(frontierEntry{
+				estimate: rng.Intn(50),
+				depth:    rng.Intn(5),
+				move:     FlipStockMove,
+				state:    []byte{byte(i)},
+			})
+			assert.Nil(t, err)
+		}
+	}
+	pop := func(n int) []frontierEntry {
+		var popped []frontierEntry
+		for i := 0; i < n; i++ {
+			entry, ok, err := frontier.Pop()
+			assert.Nil(t, err)
+			if !ok {
+				break
+			}
+			assert.Equal(t, FlipStockMove, entry.move)
+			popped = append(popped, entry)
+		}
+		return popped
+	}
+
+	// pushing between pops puts new entries ahead of spilled ones
+	push(1000)
+	first := pop(100)
+	push(1000)
+	rest := pop(5000)
+	assert.Equal(t, 1900, len(rest))
+	assert.EqualValues(t, 0, frontier.Len())
+	for _, popped := range [][]frontierEntry{first, rest} {
+		for i := 1; i < len(popped); i++ {
+			assert.False(t, popped[i].less(&popped[i-1]), "entry %d popped out of order", i)
+		}
+	}
+}
+
+func createPysolGameState(t *testing.T, dealNumber int64) libgame.GameState {
+	state, err := libgame.DealPysolGame(libgame.Game{}, dealNumber)
+	assert.Nil(t, err)
+	return state
+}
+
+func TestEncodeState(t *testing.T) {
+	for _, state := range []libgame.GameState{
+		createPysolGameState(t, 1),
+		createNearlyWonGameState(),
+	} {
+		decoded, err := decodeState(appendState(nil, &state))
+		assert.Nil(t, err)
+		assert.Equal(t, HashGameState(&state), HashGameState(&decoded))
+		assert.Equal(t, state.Score, decoded.Score)
+	}
+	_, err := decodeState([]byte{8, 10, 3})
+	assert.Error(t, err)
+}
+
+func TestSolveDisk(t *testing.T) {
+	start := createNearlyWonGameState()
+	result, err := SolveDisk(start, DiskOptions{MemoryStates: 2, MemoryHashes: 2, BloomBitsPerHash: 1})
+	assert.Nil(t, err)
+	assertSolves(t, start, result)
+}
+
+func TestSolveDiskSameWithLessMemory(t *testing.T) {
+	start := createPysolGameState(t, 1)
+	options := DiskOptions{SearchOptions: SearchOptions{MaxExpanded: 1000}}
+	inMemory, err := SolveDisk(start, options)
+	assert.Nil(t, err)
+
+	options.MemoryStates, options.MemoryHashes, options.BloomBitsPerHash = 50, 50, 4
+	spilled, err := SolveDisk(start, options)
+	assert.Nil(t, err)
+
+	assert.EqualValues(t, 1000, spilled.Expanded)
+	assert.Equal(t, inMemory.Generated, spilled.Generated)
+	assert.Equal(t, inMemory.BestPath, spilled.BestPath)
+	assert.True(t, spilled.BestState.Score < start.Score)
+}
+
+func TestSolveDiskUnknownHeuristic(t *testing.T) {
+	_, err := SolveDisk(createNearlyWonGameState(), DiskOptions{Heuristic: "not-a-heuristic"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,514 @@
+package libsolver
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+const (
+	// DefaultDiskMemoryStates is the number of states a DiskFrontier keeps in
+	// memory before writing them to disk, when none is given
+	DefaultDiskMemoryStates = 1 << 20
+
+	// maxFrontierRuns is the number of run files we allow before merging them
+	// all into one, to limit the number of open files
+	maxFrontierRuns = 64
+)
+
+// frontierEntry is a state waiting to be expanded by a disk search.
+//
+// The state is stored encoded, and instead of a pointer to its parent it has
+// the parent's index in the search's node log. seq is the order it was pushed
+// in, so that ties always pop in the same order whether or not they spilled.
+type frontierEntry struct {
+	estimate int
+	depth    int
+	seq      int64
+	parent   int64
+	move     libgame.MoveRequest
+	state    []byte
+}
+
+// less orders entries by estimate, then depth, then first pushed
+func (e *frontierEntry) less(other *frontierEntry) bool {
+	if e.estimate != other.estimate {
+		return e.estimate < other.estimate
+	}
+	if e.depth != other.depth {
+		return e.depth < other.depth
+	}
+	return e.seq < other.seq
+}
+
+// DiskFrontier is a priority queue of states too large to keep in memory.
+//
+// New states are kept in a heap in memory until there are too many, then
+// written out as a sorted run file. Pop takes the best of the heap and the
+// head of each run. Not safe for concurrent use.
+type DiskFrontier struct {
+	dir          string
+	memoryStates int
+
+	memory  entryHeap
+	runs    []*entryRun
+	nextRun int
+	length  int64
+	pushed  int64
+}
+
+// NewDiskFrontier returns an empty frontier that writes its runs to dir.
+// Keeps up to memoryStates in memory, defaulting to DefaultDiskMemoryStates
+func NewDiskFrontier(dir string, memoryStates int) *DiskFrontier {
+	if memoryStates <= 0 {
+		memoryStates = DefaultDiskMemoryStates
+	}
+	return &DiskFrontier{dir: dir, memoryStates: memoryStates}
+}
+
+// Push adds an entry to the frontier
+func (f *DiskFrontier) Push(entry frontierEntry) error {
+	entry.seq = f.pushed
+	f.pushed++
+	heap.Push(&f.memory, &entry)
+	f.length++
+	if len(f.memory) >= f.memoryStates {
+		return f.spill()
+	}
+	return nil
+}
+
+// Pop removes and returns the best entry. Returns false if the frontier is empty
+func (f *DiskFrontier) Pop() (frontierEntry, bool, error) {
+	best := -1 // index into runs, or len(runs) for memory
+	var bestEntry *frontierEntry
+	for i, run := range f.runs {
+		if !run.done && (bestEntry == nil || run.head.less(bestEntry)) {
+			best, bestEntry = i, &run.head
+		}
+	}
+	if len(f.memory) > 0 && (bestEntry == nil || f.memory[0].less(bestEntry)) {
+		best, bestEntry = len(f.runs), f.memory[0]
+	}
+	if bestEntry == nil {
+		return frontierEntry{}, false, nil
+	}
+
+	f.length--
+	if best == len(f.runs) {
+		return *heap.Pop(&f.memory).(*frontierEntry), true, nil
+	}
+	run := f.runs[best]
+	entry := run.head
+	if err := run.next(); err != nil {
+		return entry, true, err
+	}
+	if run.done {
+		f.runs = append(f.runs[:best], f.runs[best+1:]...)
+		if err := run.remove(); err != nil {
+			return entry, true, err
+		}
+	}
+	return entry, true, nil
+}
+
+// Len returns the number of entries in the frontier
+func (f *DiskFrontier) Len() int64 {
+	return f.length
+}
+
+// Close closes and removes the frontier's run files
+func (f *DiskFrontier) Close() error {
+	var firstErr error
+	for _, run := range f.runs {
+		if err := run.remove(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	f.runs = nil
+	return firstErr
+}
+
+// spill writes the entries in memory out to a new run, merging the runs if
+// there are too many
+func (f *DiskFrontier) spill() error {
+	entries := []*frontierEntry(f.memory)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].less(entries[j]) })
+	run, err := f.writeRun(func(write func(*frontierEntry) error) error {
+		for _, entry := range entries {
+			if err := write(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f.runs = append(f.runs, run)
+	f.memory = nil
+
+	if len(f.runs) > maxFrontierRuns {
+		return f.merge()
+	}
+	return nil
+}
+
+// merge merges every run into one
+func (f *DiskFrontier) merge() error {
+	runs := f.runs
+	merged, err := f.writeRun(func(write func(*frontierEntry) error) error {
+		for {
+			smallest := -1
+			for i, run := range runs {
+				if !run.done && (smallest < 0 || run.head.less(&runs[smallest].head)) {
+					smallest = i
+				}
+			}
+			if smallest < 0 {
+				return nil
+			}
+			if err := write(&runs[smallest].head); err != nil {
+				return err
+			}
+			if err := runs[smallest].next(); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		if err := run.remove(); err != nil {
+			return err
+		}
+	}
+	f.runs = []*entryRun{merged}
+	return nil
+}
+
+// writeRun creates a new run file from the sorted entries passed to write, and
+// opens it for reading
+func (f *DiskFrontier) writeRun(fill func(write func(*frontierEntry) error) error) (*entryRun, error) {
+	path := filepath.Join(f.dir, fmt.Sprintf("frontier-%06d.run", f.nextRun))
+	f.nextRun++
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating frontier run: %v", err)
+	}
+	run := &entryRun{path: path, file: file}
+	w := bufio.NewWriter(file)
+	var buf []byte
+	err = fill(func(entry *frontierEntry) error {
+		buf = appendFrontierEntry(buf[:0], entry)
+		_, err := w.Write(buf)
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		run.remove()
+		return nil, fmt.Errorf("Error writing frontier run: %v", err)
+	}
+	run.r = bufio.NewReader(file)
+	if err := run.next(); err != nil {
+		run.remove()
+		return nil, err
+	}
+	return run, nil
+}
+
+// openRun opens a run file written by writeRun, with head at offset
+func (f *DiskFrontier) openRun(path string, offset int64) (*entryRun, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening frontier run: %v", err)
+	}
+	run := &entryRun{path: path, file: file, read: offset}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		run.remove()
+		return nil, fmt.Errorf("Error opening frontier run: %v", err)
+	}
+	run.r = bufio.NewReader(file)
+	if err := run.next(); err != nil {
+		run.remove()
+		return nil, err
+	}
+	return run, nil
+}
+
+// entryRun is a file of sorted entries, read from the front. The file itself
+// never changes, so a checkpoint only needs the offset of its head
+type entryRun struct {
+	path   string
+	file   *os.File
+	r      *bufio.Reader
+	head   frontierEntry
+	offset int64 // where head starts in the file
+	read   int64 // where the entry after head starts
+	done   bool
+}
+
+// next reads the next entry into head, setting done at the end of the run
+func (r *entryRun) next() error {
+	r.offset = r.read
+	entry, err := readFrontierEntry(r.r)
+	if err == io.EOF {
+		r.done = true
+		return nil
+	}
+	if err != nil {
+		r.done = true
+		return fmt.Errorf("Error reading frontier run: %v", err)
+	}
+	r.head = entry
+	r.read += int64(frontierEntryHeader + len(entry.state))
+	return nil
+}
+
+func (r *entryRun) remove() error {
+	r.file.Close()
+	return os.Remove(r.path)
+}
+
+// entryHeap is a heap of entries ordered by frontierEntry.less
+type entryHeap []*frontierEntry
+
+func (h entryHeap) Len() int            { return len(h) }
+func (h entryHeap) Less(i, j int) bool  { return h[i].less(h[j]) }
+func (h entryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *entryHeap) Push(x interface{}) { *h = append(*h, x.(*frontierEntry)) }
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// frontierEntryHeader is the size of an encoded entry before its state:
+// estimate, depth, seq, parent, move and state length
+const frontierEntryHeader = 4 + 4 + 8 + 8 + moveSize + 2
+
+// appendFrontierEntry appends the encoded entry to buf
+func appendFrontierEntry(buf []byte, entry *frontierEntry) []byte {
+	var header [frontierEntryHeader]byte
+	binary.LittleEndian.PutUint32(header[0:], uint32(entry.estimate))
+	binary.LittleEndian.PutUint32(header[4:], uint32(entry.depth))
+	binary.LittleEndian.PutUint64(header[8:], uint64(entry.seq))
+	binary.LittleEndian.PutUint64(header[16:], uint64(entry.parent))
+	putMove(header[24:], entry.move)
+	binary.LittleEndian.PutUint16(header[24+moveSize:], uint16(len(entry.state)))
+	buf = append(buf, header[:]...)
+	return append(buf, entry.state...)
+}
+
+// readFrontierEntry reads an entry written by appendFrontierEntry
+func readFrontierEntry(r io.Reader) (frontierEntry, error) {
+	var header [frontierEntryHeader]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return frontierEntry{}, err
+	}
+	entry := frontierEntry{
+		estimate: int(int32(binary.LittleEndian.Uint32(header[0:]))),
+		depth:    int(int32(binary.LittleEndian.Uint32(header[4:]))),
+		seq:      int64(binary.LittleEndian.Uint64(header[8:])),
+		parent:   int64(binary.LittleEndian.Uint64(header[16:])),
+		move:     getMove(header[24:]),
+		state:    make([]byte, binary.LittleEndian.Uint16(header[24+moveSize:])),
+	}
+	if _, err := io.ReadFull(r, entry.state); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return frontierEntry{}, err
+	}
+	return entry, nil
+}
+
+// moveSize is the size of an encoded move: a pile and index for each end
+const moveSize = 4
+
+// pileCodes numbers the pile locations for encoding moves
+var pileCodes = []libgame.PileLocation{
+	libgame.STOCK, libgame.FOUNDATION, libgame.TABLEAU, libgame.WASTE,
+}
+
+func putMove(buf []byte, move libgame.MoveRequest) {
+	buf[0] = pileCode(move.FromPile)
+	buf[1] = byte(move.FromIndex)
+	buf[2] = pileCode(move.ToPile)
+	buf[3] = byte(move.ToIndex)
+}
+
+func getMove(buf []byte) libgame.MoveRequest {
+	return libgame.MoveRequest{
+		FromPile:  pileCodes[buf[0]%byte(len(pileCodes))],
+		FromIndex: int(buf[1]),
+		ToPile:    pileCodes[buf[2]%byte(len(pileCodes))],
+		ToIndex:   int(buf[3]),
+	}
+}
+
+func pileCode(location libgame.PileLocation) byte {
+	for i, l := range pileCodes {
+		if l == location {
+			return byte(i)
+		}
+	}
+	return 0
+}
+
+// cardSuits and cardFaces undo cardByte
+var (
+	cardSuits = [numSuits]deck.Suit{deck.CLUB, deck.DIAMOND, deck.HEART, deck.SPADE}
+	cardFaces = [numRanks + 1]deck.Face{"", deck.ACE, deck.TWO, deck.THREE, deck.FOUR,
+		deck.FIVE, deck.SIX, deck.SEVEN, deck.EIGHT, deck.NINE, deck.TEN, deck.JACK,
+		deck.QUEEN, deck.KING}
+)
+
+// appendState appends the cards in each pile of the state to buf, a byte per
+// card. Like HashGameState, it leaves out the state's IDs and move number
+func appendState(buf []byte, state *libgame.GameState) []byte {
+	buf = append(buf, byte(len(state.Foundations)), byte(len(state.Tableaus)))
+	appendDeck := func(d *deck.Deck) {
+		buf = append(buf, byte(len(d.Cards)))
+		for _, card := range d.Cards {
+			buf = append(buf, cardByte(card))
+		}
+	}
+	appendDeck(&state.Stock)
+	appendDeck(&state.Waste)
+	for i := range state.Foundations {
+		appendDeck(&state.Foundations[i])
+	}
+	for i := range state.Tableaus {
+		appendDeck(&state.Tableaus[i])
+	}
+	return buf
+}
+
+// decodeState rebuilds a state written by appendState, working out its score
+func decodeState(buf []byte) (libgame.GameState, error) {
+	var state libgame.GameState
+	if len(buf) < 2 {
+		return state, fmt.Errorf("Encoded state is too short")
+	}
+	state.Foundations = make([]deck.Deck, buf[0])
+	state.Tableaus = make([]deck.Deck, buf[1])
+	buf = buf[2:]
+
+	total := 0
+	readDeck := func(d *deck.Deck) error {
+		if len(buf) < 1 || len(buf) < 1+int(buf[0]) {
+			return fmt.Errorf("Encoded state is too short")
+		}
+		n := int(buf[0])
+		d.Cards = make([]deck.Card, n)
+		for i, b := range buf[1 : 1+n] {
+			suit, rank := b>>4, b&0xf
+			if int(suit) >= numSuits || rank == 0 || int(rank) > numRanks {
+				return fmt.Errorf("Encoded state has a bad card %#x", b)
+			}
+			d.Cards[i] = deck.Card{Face: cardFaces[rank], Suit: cardSuits[suit]}
+		}
+		buf = buf[1+n:]
+		total += n
+		return nil
+	}
+	if err := readDeck(&state.Stock); err != nil {
+		return state, err
+	}
+	if err := readDeck(&state.Waste); err != nil {
+		return state, err
+	}
+	onFoundations := total
+	for i := range state.Foundations {
+		if err := readDeck(&state.Foundations[i]); err != nil {
+			return state, err
+		}
+	}
+	onFoundations = total - onFoundations
+	for i := range state.Tableaus {
+		if err := readDeck(&state.Tableaus[i]); err != nil {
+			return state, err
+		}
+	}
+	state.Score = total - onFoundations
+	return state, nil
+}
+
+// nodeLog records every state a disk search expands, as its parent's index
+// and the move from the parent, so that paths can be rebuilt from disk
+type nodeLog struct {
+	file  *os.File
+	w     *bufio.Writer
+	count int64
+}
+
+// nodeLogRecord is the size of a node log record: parent and move
+const nodeLogRecord = 8 + moveSize
+
+func newNodeLog(dir string) (*nodeLog, error) {
+	file, err := os.Create(filepath.Join(dir, "nodes.log"))
+	if err != nil {
+		return nil, fmt.Errorf("Error creating node log: %v", err)
+	}
+	return &nodeLog{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// append records a node. Returns its index
+func (l *nodeLog) append(parent int64, move libgame.MoveRequest) (int64, error) {
+	var buf [nodeLogRecord]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(parent))
+	putMove(buf[8:], move)
+	if _, err := l.w.Write(buf[:]); err != nil {
+		return 0, fmt.Errorf("Error writing node log: %v", err)
+	}
+	l.count++
+	return l.count - 1, nil
+}
+
+// path returns the moves from the root to the node at index, followed by move.
+// index is -1 for the root's parent
+func (l *nodeLog) path(index int64, move *libgame.MoveRequest) ([]libgame.MoveRequest, error) {
+	if err := l.w.Flush(); err != nil {
+		return nil, fmt.Errorf("Error writing node log: %v", err)
+	}
+	var path []libgame.MoveRequest
+	if move != nil {
+		path = append(path, *move)
+	}
+	var buf [nodeLogRecord]byte
+	for index >= 0 {
+		if _, err := l.file.ReadAt(buf[:], index*nodeLogRecord); err != nil {
+			return nil, fmt.Errorf("Error reading node log: %v", err)
+		}
+		index = int64(binary.LittleEndian.Uint64(buf[:]))
+		if index >= 0 {
+			path = append(path, getMove(buf[8:]))
+		}
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, nil
+}
+
+func (l *nodeLog) remove() error {
+	l.file.Close()
+	return os.Remove(l.file.Name())
+}
@@ -0,0 +1,360 @@
+package libsolver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// DefaultDiskMemoryHashes is the number of hashes a DiskVisitedSet keeps in
+	// memory before writing them to disk, when none is given
+	DefaultDiskMemoryHashes = 1 << 22
+	// DefaultBloomBitsPerHash sizes the bloom filter of each of a
+	// DiskVisitedSet's runs when no size is given. With 16 bits for each hash
+	// about one lookup in 400 reads a run that doesn't have the hash
+	DefaultBloomBitsPerHash = 16
+
+	// hashRunBlock is the number of hashes in each block of a run file. Runs
+	// keep the first hash of each block in memory, so a lookup reads one block
+	hashRunBlock = 512
+	// maxHashRuns is the number of run files we allow before merging them all
+	// into one, to keep lookups quick
+	maxHashRuns = 8
+)
+
+// DiskVisitedSet is a set of state hashes too large to keep in memory.
+//
+// New hashes are kept in memory until there are too many, then written out as
+// a sorted run file. Each run has a bloom filter sized for the hashes in it, so
+// the filters grow with the set and most new hashes skip reading the disk at
+// all. Not safe for concurrent use.
+type DiskVisitedSet struct {
+	dir              string
+	memoryHashes     int
+	bloomBitsPerHash int
+
+	memory  map[uint64]struct{}
+	runs    []*hashRun
+	nextRun int
+	length  int64
+}
+
+// NewDiskVisitedSet returns an empty set that writes its runs to dir. Keeps
+// up to memoryHashes in memory, defaulting to DefaultDiskMemoryHashes, and
+// gives each run a bloom filter of bloomBitsPerHash bits for each of its
+// hashes, defaulting to DefaultBloomBitsPerHash
+func NewDiskVisitedSet(dir string, memoryHashes int, bloomBitsPerHash int) *DiskVisitedSet {
+	if memoryHashes <= 0 {
+		memoryHashes = DefaultDiskMemoryHashes
+	}
+	if bloomBitsPerHash <= 0 {
+		bloomBitsPerHash = DefaultBloomBitsPerHash
+	}
+	return &DiskVisitedSet{
+		dir:              dir,
+		memoryHashes:     memoryHashes,
+		bloomBitsPerHash: bloomBitsPerHash,
+		memory:           make(map[uint64]struct{}),
+	}
+}
+
+// Add adds the hash to the set. Returns true if it wasn't already there
+func (v *DiskVisitedSet) Add(hash uint64) (bool, error) {
+	found, err := v.Contains(hash)
+	if err != nil || found {
+		return false, err
+	}
+	v.memory[hash] = struct{}{}
+	v.length++
+	if len(v.memory) >= v.memoryHashes {
+		if err := v.spill(); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// Contains returns true if the hash is in the set
+func (v *DiskVisitedSet) Contains(hash uint64) (bool, error) {
+	if _, ok := v.memory[hash]; ok {
+		return true, nil
+	}
+	for _, run := range v.runs {
+		if !run.bloom.mayContain(hash) {
+			continue
+		}
+		found, err := run.contains(hash)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// Len returns the number of hashes in the set
+func (v *DiskVisitedSet) Len() int64 {
+	return v.length
+}
+
+// Close closes and removes the set's run files
+func (v *DiskVisitedSet) Close() error {
+	var firstErr error
+	for _, run := range v.runs {
+		if err := run.remove(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	v.runs = nil
+	return firstErr
+}
+
+// spill writes the hashes in memory out to a new run, merging the runs if
+// there are too many
+func (v *DiskVisitedSet) spill() error {
+	hashes := make([]uint64, 0, len(v.memory))
+	for hash := range v.memory {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+
+	run, err := v.writeRun(int64(len(hashes)), func(write func(uint64) error) error {
+		for _, hash := range hashes {
+			if err := write(hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	v.runs = append(v.runs, run)
+	v.memory = make(map[uint64]struct{})
+
+	if len(v.runs) > maxHashRuns {
+		return v.merge()
+	}
+	return nil
+}
+
+// merge merges every run into one
+func (v *DiskVisitedSet) merge() error {
+	readers := make([]*hashRunReader, len(v.runs))
+	var count int64
+	for i, run := range v.runs {
+		readers[i] = newHashRunReader(run)
+		count += run.count
+	}
+	merged, err := v.writeRun(count, func(write func(uint64) error) error {
+		for {
+			// runs never share hashes, so we can just take the smallest head
+			smallest := -1
+			for i, r := range readers {
+				if !r.done && (smallest < 0 || r.head < readers[smallest].head) {
+					smallest = i
+				}
+			}
+			if smallest < 0 {
+				return nil
+			}
+			if err := write(readers[smallest].head); err != nil {
+				return err
+			}
+			if err := readers[smallest].next(); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, run := range v.runs {
+		if err := run.remove(); err != nil {
+			return err
+		}
+	}
+	v.runs = []*hashRun{merged}
+	return nil
+}
+
+// writeRun creates a new run file from the sorted hashes passed to write.
+// count is how many hashes there will be, to size the run's bloom filter
+func (v *DiskVisitedSet) writeRun(
+	count int64, fill func(write func(uint64) error) error) (*hashRun, error) {
+	path := filepath.Join(v.dir, fmt.Sprintf("visited-%06d.run", v.nextRun))
+	v.nextRun++
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating visited run: %v", err)
+	}
+	run := &hashRun{
+		path:  path,
+		file:  file,
+		bloom: newBloomFilter(uint64(v.bloomBitsPerHash) * uint64(count)),
+	}
+	w := bufio.NewWriter(file)
+	var buf [8]byte
+	err = fill(func(hash uint64) error {
+		if run.count%hashRunBlock == 0 {
+			run.index = append(run.index, hash)
+		}
+		run.count++
+		run.bloom.add(hash)
+		binary.LittleEndian.PutUint64(buf[:], hash)
+		_, err := w.Write(buf[:])
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		run.remove()
+		return nil, fmt.Errorf("Error writing visited run: %v", err)
+	}
+	return run, nil
+}
+
+// openRun opens a run file written by writeRun, reading it through to rebuild
+// its index and bloom filter
+func (v *DiskVisitedSet) openRun(path string) (*hashRun, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening visited run: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Error opening visited run: %v", err)
+	}
+	count := info.Size() / 8
+	run := &hashRun{
+		path:  path,
+		file:  file,
+		count: count,
+		bloom: newBloomFilter(uint64(v.bloomBitsPerHash) * uint64(count)),
+	}
+	reader := newHashRunReader(run)
+	for i := int64(0); !reader.done; i++ {
+		if i%hashRunBlock == 0 {
+			run.index = append(run.index, reader.head)
+		}
+		run.bloom.add(reader.head)
+		if err := reader.next(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return run, nil
+}
+
+// hashRun is a file of sorted hashes, with the first hash of each block and a
+// bloom filter of all of them
+type hashRun struct {
+	path  string
+	file  *os.File
+	count int64
+	index []uint64
+	bloom bloomFilter
+}
+
+// contains looks for the hash in the one block that could hold it
+func (r *hashRun) contains(hash uint64) (bool, error) {
+	block := sort.Search(len(r.index), func(i int) bool { return r.index[i] > hash }) - 1
+	if block < 0 {
+		return false, nil
+	}
+	start := int64(block) * hashRunBlock
+	n := r.count - start
+	if n > hashRunBlock {
+		n = hashRunBlock
+	}
+	buf := make([]byte, 8*n)
+	if _, err := r.file.ReadAt(buf, 8*start); err != nil {
+		return false, fmt.Errorf("Error reading visited run: %v", err)
+	}
+	i := sort.Search(int(n), func(i int) bool {
+		return binary.LittleEndian.Uint64(buf[8*i:]) >= hash
+	})
+	return i < int(n) && binary.LittleEndian.Uint64(buf[8*i:]) == hash, nil
+}
+
+func (r *hashRun) remove() error {
+	r.file.Close()
+	return os.Remove(r.path)
+}
+
+// hashRunReader reads a run's hashes in order
+type hashRunReader struct {
+	r    *bufio.Reader
+	head uint64
+	done bool
+}
+
+func newHashRunReader(run *hashRun) *hashRunReader {
+	reader := &hashRunReader{r: bufio.NewReader(io.NewSectionReader(run.file, 0, 8*run.count))}
+	reader.next()
+	return reader
+}
+
+// next moves on to the next hash, setting done at the end of the run
+func (r *hashRunReader) next() error {
+	var buf [8]byte
+	_, err := io.ReadFull(r.r, buf[:])
+	if err == io.EOF {
+		r.done = true
+		return nil
+	}
+	if err != nil {
+		r.done = true
+		return fmt.Errorf("Error reading visited run: %v", err)
+	}
+	r.head = binary.LittleEndian.Uint64(buf[:])
+	return nil
+}
+
+// bloomFilter says whether a hash might have been added to it. It has no
+// false negatives, so a hash it hasn't seen is certainly new
+type bloomFilter struct {
+	bits []uint64
+	size uint64
+}
+
+// bloomHashes is the number of bits set for each hash
+const bloomHashes = 4
+
+func newBloomFilter(size uint64) bloomFilter {
+	if size < 64 {
+		size = 64
+	}
+	return bloomFilter{bits: make([]uint64, (size+63)/64), size: size}
+}
+
+// positions calls f with each of the hash's bits. The hashes we store are
+// already well mixed, so we derive the bits from its two halves
+func (b *bloomFilter) positions(hash uint64, f func(bit uint64)) {
+	h1, h2 := hash&0xffffffff, hash>>32|1
+	for i := uint64(0); i < bloomHashes; i++ {
+		f((h1 + i*h2) % b.size)
+	}
+}
+
+func (b *bloomFilter) add(hash uint64) {
+	b.positions(hash, func(bit uint64) {
+		b.bits[bit/64] |= 1 << (bit % 64)
+	})
+}
+
+func (b *bloomFilter) mayContain(hash uint64) bool {
+	found := true
+	b.positions(hash, func(bit uint64) {
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			found = false
+		}
+	})
+	return found
+}
@@ -0,0 +1,431 @@
+package libsolver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// IDAStarOptions configures SolveIDAStar
+type IDAStarOptions struct {
+	SearchOptions
+
+	// TranspositionTableSize is the number of states remembered across
+	// branches of the search. The table never grows past this size. 0 disables
+	// the table, so that memory use only grows with the depth of the search
+	TranspositionTableSize int
+}
+
+// idaStarInfinity is the bound returned by a branch with no way forward
+const idaStarInfinity = math.MaxInt32
+
+// SolveIDAStar searches for the shortest solution to the game using
+// iterative-deepening A*.
+//
+// Each iteration is a depth first search that cuts off branches once the
+// number of moves taken plus a lower bound on the number of moves left passes
+// the iteration's bound. Only the current path is kept in memory, plus the
+// optional fixed size transposition table.
+//
+// The solution is the shortest one allowed by the options' Pruner. Without
+// MaxExpanded, the search will run until it finds a solution or proves there
+// isn't one, which can take a very long time for a full game.
+func SolveIDAStar(start libgame.GameState, options IDAStarOptions) (SearchResult, error) {
+	search := newIDAStar(start, options)
+	return search.run(heuristic(&search.state.state), false)
+}
+
+// ResumeIDAStar carries on with the IDA* search saved in options.Checkpoint.
+//
+// Like ResumeDisk, the search must be resumed with the same pruning rules,
+// move ordering and PruneLost as it was started with, and the same
+// TranspositionTableSize. MaxExpanded counts the states expanded before the
+// checkpoint. A resumed search finds the same result as one that was never
+// stopped.
+//
+// Returns error if the checkpoint can't be read or the options don't match.
+func ResumeIDAStar(options IDAStarOptions) (SearchResult, error) {
+	header, r, file, err := readSearchCheckpoint(options.Checkpoint, "idastar",
+		newCheckpointRules("", options.SearchOptions), func(uint64) {})
+	if err != nil {
+		return SearchResult{}, err
+	}
+	defer file.Close()
+	if header.TranspositionTableSize != options.TranspositionTableSize {
+		return SearchResult{}, fmt.Errorf("Checkpoint was made with TranspositionTableSize '%d', not '%d'",
+			header.TranspositionTableSize, options.TranspositionTableSize)
+	}
+
+	search := newIDAStar(header.Start, options)
+	search.result.Expanded, search.result.Generated = header.Expanded, header.Generated
+	search.bestScore, search.result.BestPath = header.BestScore, header.BestPath
+	search.checkpointer = newCheckpointer(options.SearchOptions, header.Expanded)
+	if header.Done {
+		result, err := resultFromCheckpoint(header, header.BestPath)
+		search.progress.done(&result)
+		return result, err
+	}
+	if search.table != nil {
+		if err := search.table.readFrom(r, header.TableEntries, header.Iteration); err != nil {
+			return SearchResult{}, err
+		}
+	}
+	search.iteration = header.Iteration
+	search.resumeFrames, search.resumePath = header.Frames, header.Path
+	return search.run(header.Bound, true)
+}
+
+type idaStar struct {
+	options      IDAStarOptions
+	start        libgame.GameState
+	state        *searchState
+	expander     *expander
+	table        *transpositionTable
+	progress     *progressReporter
+	checkpointer checkpointer
+
+	path         []libgame.MoveRequest
+	onPath       map[uint64]bool // hashes of the states on path, to avoid cycles
+	movesByDepth [][]libgame.MoveRequest
+	frames       []idaStarFrame // where we are in movesByDepth at each depth of path
+
+	// a resumed search follows these down to where it was saved
+	resumeFrames []idaStarFrame
+	resumePath   []libgame.MoveRequest
+
+	iteration int
+	bound     int
+	aborted   bool
+	err       error
+	bestScore int
+	result    SearchResult
+}
+
+// idaStarFrame is where an IDA* search is in the moves from a state on its path
+type idaStarFrame struct {
+	Move int // index of the move being searched
+	Next int // smallest estimate over the bound found from the moves before it
+}
+
+func newIDAStar(start libgame.GameState, options IDAStarOptions) *idaStar {
+	search := &idaStar{
+		options:      options,
+		start:        start.Copy(),
+		state:        newSearchState(start),
+		expander:     newExpander(options.SearchOptions),
+		progress:     newProgressReporter(options.SearchOptions),
+		checkpointer: newCheckpointer(options.SearchOptions, 0),
+		onPath:       make(map[uint64]bool),
+		bestScore:    start.Score,
+	}
+	if options.TranspositionTableSize > 0 {
+		search.table = newTranspositionTable(options.TranspositionTableSize)
+	}
+	search.onPath[HashGameState(&search.state.state)] = true
+	return search
+}
+
+// run deepens the search from the bound until it's over. If resuming, the
+// first iteration carries on from resumeFrames
+func (s *idaStar) run(bound int, resuming bool) (SearchResult, error) {
+	for {
+		var next int
+		var found bool
+		s.bound = bound
+		if resuming {
+			next, found = s.resume(0, bound)
+			resuming = false
+		} else {
+			s.iteration++
+			next, found = s.search(0, bound)
+		}
+		if s.err != nil {
+			return SearchResult{}, s.err
+		}
+		if found || s.aborted || next == idaStarInfinity {
+			break
+		}
+		bound = next
+	}
+	if s.checkpointer.path != "" && !s.aborted {
+		if err := s.checkpoint(0, true); err != nil {
+			return SearchResult{}, err
+		}
+	}
+
+	err := s.result.finish(s.start)
+	s.progress.done(&s.result)
+	return s.result, err
+}
+
+// search is the depth first search of a single iteration.
+//
+// Returns whether a solution was found and, if not, the smallest estimated
+// solution length that was over the bound.
+func (s *idaStar) search(depth int, bound int) (int, bool) {
+	state := &s.state.state
+	estimate := depth + heuristic(state)
+	if estimate > bound {
+		return estimate, false
+	}
+
+	if state.Score < s.bestScore || s.result.BestPath == nil {
+		s.bestScore = state.Score
+		s.result.BestPath = append(make([]libgame.MoveRequest, 0, len(s.path)), s.path...)
+	}
+	if state.Score == 0 {
+		s.result.Solved = true
+		s.result.Solution = s.result.BestPath
+		return estimate, true
+	}
+
+	if s.options.PruneLost {
+		if lost, _ := ProvablyLost(state); lost {
+			return idaStarInfinity, false
+		}
+	}
+
+	// a resumed search carries on from here, so this is where we save
+	// checkpoints
+	if s.options.stopped(s.result.Expanded) {
+		s.aborted = true
+		if s.checkpointer.path != "" {
+			s.err = s.checkpoint(depth, false)
+		}
+		return idaStarInfinity, false
+	}
+	if s.checkpointer.due(s.result.Expanded) {
+		if s.err = s.checkpoint(depth, false); s.err != nil {
+			s.aborted = true
+			return idaStarInfinity, false
+		}
+	}
+	s.result.Expanded++
+
+	moves := s.movesAt(depth)
+	s.result.Generated += int64(len(moves))
+	if s.progress.due(s.result.Expanded) {
+		s.progress.report(Progress{
+			Expanded:  s.result.Expanded,
+			Generated: s.result.Generated,
+			BestScore: s.bestScore,
+			Depth:     depth,
+		})
+	}
+	return s.searchMoves(depth, bound, moves, 0, idaStarInfinity)
+}
+
+// resume follows the saved frames from depth back down to where the search
+// was saved, then carries on searching from there
+func (s *idaStar) resume(depth int, bound int) (int, bool) {
+	if depth == len(s.resumeFrames) {
+		s.resumeFrames, s.resumePath = nil, nil
+		return s.search(depth, bound)
+	}
+	frame := s.resumeFrames[depth]
+	moves := s.movesAt(depth)
+	if frame.Move >= len(moves) || depth >= len(s.resumePath) || moves[frame.Move] != s.resumePath[depth] {
+		s.err = fmt.Errorf("Checkpoint's path doesn't match the moves at depth %d", depth)
+		s.aborted = true
+		return idaStarInfinity, false
+	}
+	return s.searchMoves(depth, bound, moves, frame.Move, frame.Next)
+}
+
+// movesAt generates the moves from the state at depth of the path
+func (s *idaStar) movesAt(depth int) []libgame.MoveRequest {
+	var lastMove *libgame.MoveRequest
+	if len(s.path) > 0 {
+		lastMove = &s.path[len(s.path)-1]
+	}
+	if len(s.movesByDepth) <= depth {
+		s.movesByDepth = append(s.movesByDepth, nil)
+		s.frames = append(s.frames, idaStarFrame{})
+	}
+	moves := s.expander.appendMoves(s.movesByDepth[depth][:0], &s.state.state, lastMove)
+	s.movesByDepth[depth] = moves
+	return moves
+}
+
+// searchMoves searches the children made by moves[from:], where next is the
+// smallest estimate over the bound found from the moves before them
+func (s *idaStar) searchMoves(
+	depth int, bound int, moves []libgame.MoveRequest, from int, next int) (int, bool) {
+	for i := from; i < len(moves); i++ {
+		move := moves[i]
+		s.frames[depth] = idaStarFrame{Move: i, Next: next}
+		s.state.do(move)
+		var childNext int
+		var found bool
+		if s.resumeFrames != nil {
+			// the first move of a resumed frame leads back to where we were
+			childNext, found = s.enterChild(move, depth+1, bound, s.resume)
+		} else {
+			childNext, found = s.searchChild(move, depth+1, bound)
+		}
+		s.state.undo(move)
+		if found {
+			return childNext, true
+		}
+		if childNext < next {
+			next = childNext
+		}
+		if s.aborted {
+			return idaStarInfinity, false
+		}
+	}
+	return next, false
+}
+
+// searchChild searches the state that the move just created, unless it is
+// already on our path or the transposition table says it has been searched
+func (s *idaStar) searchChild(move libgame.MoveRequest, depth int, bound int) (int, bool) {
+	hash := HashGameState(&s.state.state)
+	if s.onPath[hash] {
+		return idaStarInfinity, false
+	}
+	if s.table != nil {
+		if entry, ok := s.table.lookup(hash, s.iteration); ok && int(entry.depth) <= depth {
+			// we got here sooner before, and found nothing within the bound
+			if entry.next == idaStarInfinity {
+				return idaStarInfinity, false
+			}
+			return int(entry.next) + depth - int(entry.depth), false
+		}
+	}
+	return s.enterChild(move, depth, bound, s.search)
+}
+
+// enterChild adds the state that the move just created to the path, and
+// searches it with the search function
+func (s *idaStar) enterChild(
+	move libgame.MoveRequest, depth int, bound int,
+	search func(depth int, bound int) (int, bool)) (int, bool) {
+	hash := HashGameState(&s.state.state)
+	s.onPath[hash] = true
+	s.path = append(s.path, move)
+	next, found := search(depth, bound)
+	s.path = s.path[:len(s.path)-1]
+	delete(s.onPath, hash)
+
+	if s.table != nil && !found && !s.aborted {
+		s.table.store(hash, s.iteration, depth, next)
+	}
+	return next, found
+}
+
+// checkpoint saves the search to options.Checkpoint, as it stands before
+// expanding the state at depth. done is true once the search is over
+func (s *idaStar) checkpoint(depth int, done bool) error {
+	header := &searchCheckpoint{
+		Search:                 "idastar",
+		Start:                  s.start,
+		checkpointRules:        newCheckpointRules("", s.options.SearchOptions),
+		Expanded:               s.result.Expanded,
+		Generated:              s.result.Generated,
+		Done:                   done,
+		Solved:                 s.result.Solved,
+		TranspositionTableSize: s.options.TranspositionTableSize,
+		Iteration:              s.iteration,
+		Bound:                  s.bound,
+		Path:                   append([]libgame.MoveRequest{}, s.path...),
+		Frames:                 append([]idaStarFrame{}, s.frames[:depth]...),
+		BestScore:              s.bestScore,
+		BestPath:               s.result.BestPath,
+	}
+	var writeTable func(io.Writer) error
+	if s.table != nil && !done {
+		header.TableEntries = s.table.count(s.iteration)
+		writeTable = func(w io.Writer) error {
+			return s.table.writeTo(w, s.iteration)
+		}
+	}
+	return s.checkpointer.write(header, nil, writeTable)
+}
+
+// transpositionTable is a fixed size, direct mapped table of searched states.
+//
+// Each state hashes to a single slot, and newer states replace older ones.
+type transpositionTable struct {
+	entries []transpositionEntry
+}
+
+type transpositionEntry struct {
+	hash      uint64
+	iteration int32
+	depth     int32 // number of moves from the start when the state was searched
+	next      int32 // smallest estimate over the bound found under the state
+}
+
+func newTranspositionTable(size int) *transpositionTable {
+	return &transpositionTable{entries: make([]transpositionEntry, size)}
+}
+
+// lookup returns the entry for the state, if it was stored during this iteration
+func (t *transpositionTable) lookup(hash uint64, iteration int) (transpositionEntry, bool) {
+	entry := t.entries[hash%uint64(len(t.entries))]
+	if entry.hash != hash || int(entry.iteration) != iteration {
+		return transpositionEntry{}, false
+	}
+	return entry, true
+}
+
+// store records a searched state, replacing whatever was in its slot
+func (t *transpositionTable) store(hash uint64, iteration int, depth int, next int) {
+	t.entries[hash%uint64(len(t.entries))] = transpositionEntry{
+		hash:      hash,
+		iteration: int32(iteration),
+		depth:     int32(depth),
+		next:      int32(next),
+	}
+}
+
+// count returns the number of entries stored during the iteration
+func (t *transpositionTable) count(iteration int) int64 {
+	count := int64(0)
+	for i := range t.entries {
+		if int(t.entries[i].iteration) == iteration {
+			count++
+		}
+	}
+	return count
+}
+
+// transpositionRecord is the size of an entry written by writeTo
+const transpositionRecord = 16
+
+// writeTo writes the entries stored during the iteration to w. Entries from
+// earlier iterations are never looked up, so they're left out
+func (t *transpositionTable) writeTo(w io.Writer, iteration int) error {
+	var buf [transpositionRecord]byte
+	for i := range t.entries {
+		entry := &t.entries[i]
+		if int(entry.iteration) != iteration {
+			continue
+		}
+		binary.LittleEndian.PutUint64(buf[0:], entry.hash)
+		binary.LittleEndian.PutUint32(buf[8:], uint32(entry.depth))
+		binary.LittleEndian.PutUint32(buf[12:], uint32(entry.next))
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFrom reads n entries written by writeTo into the empty table
+func (t *transpositionTable) readFrom(r io.Reader, n int64, iteration int) error {
+	var buf [transpositionRecord]byte
+	for i := int64(0); i < n; i++ {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return fmt.Errorf("Error reading checkpoint: %v", err)
+		}
+		t.store(binary.LittleEndian.Uint64(buf[0:]), iteration,
+			int(int32(binary.LittleEndian.Uint32(buf[8:]))),
+			int(int32(binary.LittleEndian.Uint32(buf[12:]))))
+	}
+	return nil
+}
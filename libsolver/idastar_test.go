@@ -0,0 +1,68 @@
+package libsolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+func assertSolves(t *testing.T, start libgame.GameState, result SearchResult) {
+	assert.True(t, result.Solved)
+	won, err := ApplyMoves(start, result.Solution)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, won.Score)
+	assert.Equal(t, 0, result.BestState.Score)
+}
+
+func TestSolveIDAStarFindsShortestSolution(t *testing.T) {
+	start := createNearlyWonGameState()
+	result, err := SolveIDAStar(start, IDAStarOptions{})
+	assert.Nil(t, err)
+	assertSolves(t, start, result)
+	assert.Len(t, result.Solution, nearlyWonSolutionLength)
+}
+
+func TestSolveIDAStarWithTranspositionTable(t *testing.T) {
+	start := createNearlyWonGameState()
+	withoutTable, err := SolveIDAStar(start, IDAStarOptions{})
+	assert.Nil(t, err)
+
+	result, err := SolveIDAStar(start, IDAStarOptions{TranspositionTableSize: 1024})
+	assert.Nil(t, err)
+	assertSolves(t, start, result)
+	assert.Len(t, result.Solution, nearlyWonSolutionLength)
+	assert.True(t, result.Expanded <= withoutTable.Expanded)
+}
+
+func TestSolveIDAStarWithPruningAndOrdering(t *testing.T) {
+	start := createNearlyWonGameState()
+	pruner, err := NewPruner(DefaultPruningRules)
+	assert.Nil(t, err)
+	result, err := SolveIDAStar(start, IDAStarOptions{
+		SearchOptions: SearchOptions{
+			Pruner:       pruner,
+			MoveOrdering: &DefaultMoveOrderingWeights,
+		},
+	})
+	assert.Nil(t, err)
+	assertSolves(t, start, result)
+	assert.Len(t, result.Solution, nearlyWonSolutionLength)
+}
+
+func TestSolveIDAStarStopsAtMaxExpanded(t *testing.T) {
+	start := libgame.DealNewGame(libgame.Game{ID: 0})
+	result, err := SolveIDAStar(start, IDAStarOptions{
+		SearchOptions:          SearchOptions{MaxExpanded: 1000},
+		TranspositionTableSize: 1 << 12,
+	})
+	assert.Nil(t, err)
+	assert.False(t, result.Solved)
+	assert.EqualValues(t, 1000, result.Expanded)
+
+	// the best state we found is reachable from the start
+	best, err := ApplyMoves(start, result.BestPath)
+	assert.Nil(t, err)
+	assert.Equal(t, best.Score, result.BestState.Score)
+	assert.True(t, result.BestState.Score <= start.Score)
+}
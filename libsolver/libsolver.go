@@ -24,7 +24,19 @@ func allPiles() []pile {
 	return piles
 }
 
+// GetPossibleMoves returns all the legal moves for the given state.
+//
+// Uses a new MoveGenerator for each call. Callers generating moves in a loop
+// should keep their own MoveGenerator instead.
 func GetPossibleMoves(state *libgame.GameState) []libgame.MoveRequest {
+	return NewMoveGenerator().PossibleMoves(state)
+}
+
+// getPossibleMovesBruteForce checks every pair of piles for a legal move.
+//
+// Much slower than MoveGenerator. Kept as a reference implementation for
+// tests and benchmarks.
+func getPossibleMovesBruteForce(state *libgame.GameState) []libgame.MoveRequest {
 	possibleMoves := make([]libgame.MoveRequest, 0)
 	piles := allPiles()
 	for i, _ := range piles {
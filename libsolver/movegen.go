@@ -0,0 +1,154 @@
+package libsolver
+
+import (
+	"math/bits"
+
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+const (
+	numSuits = 4
+	numRanks = 13
+)
+
+// suitIndexes and faceRanks map cards onto small integers for indexing
+var (
+	suitIndexes = map[deck.Suit]int{
+		deck.CLUB: 0, deck.DIAMOND: 1, deck.HEART: 2, deck.SPADE: 3,
+	}
+	faceRanks = map[deck.Face]int{
+		deck.ACE: 1, deck.TWO: 2, deck.THREE: 3, deck.FOUR: 4, deck.FIVE: 5,
+		deck.SIX: 6, deck.SEVEN: 7, deck.EIGHT: 8, deck.NINE: 9, deck.TEN: 10,
+		deck.JACK: 11, deck.QUEEN: 12, deck.KING: 13,
+	}
+)
+
+// MoveGenerator generates the legal moves for GameStates.
+//
+// Rather than checking every pair of piles for legality, we index the top
+// card of each tableau and foundation by suit and rank. Each card that can be
+// moved then looks up the piles it can go onto directly.
+//
+// A MoveGenerator reuses its buffers between calls and is not safe for
+// concurrent use. Each worker should have its own.
+type MoveGenerator struct {
+	moves []libgame.MoveRequest
+
+	// bitmasks of pile indexes, by the suit and rank of the pile's top card
+	tableauTops    [numSuits][numRanks + 2]uint16
+	foundationTops [numSuits][numRanks + 2]uint16
+
+	// bitmasks of the empty pile indexes
+	emptyTableaus    uint16
+	emptyFoundations uint16
+}
+
+// NewMoveGenerator returns a MoveGenerator ready for use
+func NewMoveGenerator() *MoveGenerator {
+	return &MoveGenerator{
+		moves: make([]libgame.MoveRequest, 0, 64),
+	}
+}
+
+// PossibleMoves returns all the legal moves for the given state.
+//
+// Moves are returned in the same order as GetPossibleMoves. The returned slice
+// is only valid until the next call to PossibleMoves.
+func (g *MoveGenerator) PossibleMoves(state *libgame.GameState) []libgame.MoveRequest {
+	g.moves = g.moves[:0]
+	g.index(state)
+
+	for i := range state.Tableaus {
+		g.addMovesFrom(libgame.TABLEAU, i, &state.Tableaus[i])
+	}
+	g.addMovesFrom(libgame.WASTE, 0, &state.Waste)
+	// cards can never be moved from the stock
+	for i := range state.Foundations {
+		g.addMovesFrom(libgame.FOUNDATION, i, &state.Foundations[i])
+	}
+	return g.moves
+}
+
+// index records the top card of each tableau and foundation
+func (g *MoveGenerator) index(state *libgame.GameState) {
+	g.tableauTops = [numSuits][numRanks + 2]uint16{}
+	g.foundationTops = [numSuits][numRanks + 2]uint16{}
+	g.emptyTableaus = 0
+	g.emptyFoundations = 0
+
+	for i := range state.Tableaus {
+		suit, rank, ok := topCard(&state.Tableaus[i])
+		if !ok {
+			g.emptyTableaus |= 1 << uint(i)
+		} else if suit >= 0 {
+			g.tableauTops[suit][rank] |= 1 << uint(i)
+		}
+	}
+	for i := range state.Foundations {
+		suit, rank, ok := topCard(&state.Foundations[i])
+		if !ok {
+			g.emptyFoundations |= 1 << uint(i)
+		} else if suit >= 0 {
+			g.foundationTops[suit][rank] |= 1 << uint(i)
+		}
+	}
+}
+
+// addMovesFrom adds every legal move of the top card of the given pile
+func (g *MoveGenerator) addMovesFrom(
+	fromPile libgame.PileLocation, fromIndex int, fromDeck *deck.Deck) {
+	suit, rank, ok := topCard(fromDeck)
+	if !ok {
+		return
+	}
+
+	// Tableaus take the next card down in the same suit, and any card when empty
+	tableaus := g.emptyTableaus
+	if suit >= 0 && rank < numRanks {
+		tableaus |= g.tableauTops[suit][rank+1]
+	}
+	// Foundations take the next card up in the same suit, and aces when empty
+	var foundations uint16
+	if suit >= 0 {
+		if rank == 1 {
+			foundations = g.emptyFoundations
+		} else {
+			foundations = g.foundationTops[suit][rank-1]
+		}
+	}
+
+	for ; tableaus != 0; tableaus &= tableaus - 1 {
+		g.moves = append(g.moves, libgame.MoveRequest{
+			FromPile:  fromPile,
+			FromIndex: fromIndex,
+			ToPile:    libgame.TABLEAU,
+			ToIndex:   bits.TrailingZeros16(tableaus),
+		})
+	}
+	for ; foundations != 0; foundations &= foundations - 1 {
+		g.moves = append(g.moves, libgame.MoveRequest{
+			FromPile:  fromPile,
+			FromIndex: fromIndex,
+			ToPile:    libgame.FOUNDATION,
+			ToIndex:   bits.TrailingZeros16(foundations),
+		})
+	}
+}
+
+// topCard returns the suit index and rank of the deck's top card.
+//
+// ok is false if the deck is empty. suit is -1 for cards we don't recognize,
+// which can only be moved onto empty tableaus.
+func topCard(d *deck.Deck) (suit int, rank int, ok bool) {
+	if len(d.Cards) == 0 {
+		return 0, 0, false
+	}
+	card := d.Cards[len(d.Cards)-1]
+	suit, suitOk := suitIndexes[card.Suit]
+	rank, rankOk := faceRanks[card.Face]
+	if !suitOk || !rankOk {
+		return -1, 0, true
+	}
+	return suit, rank, true
+}
@@ -0,0 +1,78 @@
+package libsolver
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// randomGameStates plays random games and returns every state seen along the way
+func randomGameStates(numGames int, maxMoves int) []libgame.GameState {
+	r := rand.New(rand.NewSource(1))
+	states := make([]libgame.GameState, 0)
+	for i := 0; i < numGames; i++ {
+		state := libgame.DealNewGame(libgame.Game{ID: int64(i)})
+		for j := 0; j < maxMoves; j++ {
+			states = append(states, state.Copy())
+			moves := getPossibleMovesBruteForce(&state)
+			// flip the stock sometimes, and whenever we're out of moves
+			if len(moves) == 0 || r.Intn(4) == 0 {
+				if state.FlipStock() != nil {
+					break
+				}
+				continue
+			}
+			if err := state.MoveCard(moves[r.Intn(len(moves))]); err != nil {
+				panic(err)
+			}
+		}
+	}
+	return states
+}
+
+func TestMoveGeneratorMatchesBruteForce(t *testing.T) {
+	moveGenerator := NewMoveGenerator()
+	for _, state := range randomGameStates(20, 200) {
+		expected := getPossibleMovesBruteForce(&state)
+		actual := moveGenerator.PossibleMoves(&state)
+		if len(expected) == 0 {
+			assert.Empty(t, actual)
+		} else {
+			assert.Equal(t, expected, actual, state.String())
+		}
+	}
+}
+
+func TestMoveGeneratorDoesNotAllocate(t *testing.T) {
+	states := randomGameStates(1, 50)
+	moveGenerator := NewMoveGenerator()
+	for i := range states {
+		moveGenerator.PossibleMoves(&states[i])
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		for i := range states {
+			moveGenerator.PossibleMoves(&states[i])
+		}
+	})
+	assert.Zero(t, allocs)
+}
+
+func BenchmarkGetPossibleMovesBruteForce(b *testing.B) {
+	states := randomGameStates(10, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		getPossibleMovesBruteForce(&states[i%len(states)])
+	}
+}
+
+func BenchmarkMoveGenerator(b *testing.B) {
+	states := randomGameStates(10, 100)
+	moveGenerator := NewMoveGenerator()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		moveGenerator.PossibleMoves(&states[i%len(states)])
+	}
+}
@@ -0,0 +1,178 @@
+package libsolver
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// MoveOrderingWeights configures how a MoveOrderer ranks moves.
+//
+// Each move's priority is the sum of the weights of the features it has.
+// Higher priority moves are expanded first. Negative weights push moves with
+// that feature towards the end.
+type MoveOrderingWeights struct {
+	ToFoundation   int // moves a card onto a foundation
+	UncoversNeeded int // exposes a tableau card that can go straight to a foundation
+	EmptiesTableau int // takes the last card off a tableau
+	FromWaste      int // moves the top card of the waste
+	ToEmptyTableau int // moves a card onto an empty tableau
+	FromFoundation int // takes a card back off a foundation
+}
+
+// DefaultMoveOrderingWeights expands foundation moves first and moves into
+// empty tableaus or out of foundations last.
+var DefaultMoveOrderingWeights = MoveOrderingWeights{
+	ToFoundation:   100,
+	UncoversNeeded: 50,
+	EmptiesTableau: 20,
+	FromWaste:      10,
+	ToEmptyTableau: -50,
+	FromFoundation: -100,
+}
+
+// ParseMoveOrderingWeights parses weights as given on the command line: a
+// comma separated list of name=weight, like "to-foundation=80,from-waste=5".
+// The names are the MoveOrderingWeights fields in lower case, with dashes
+// between words. Weights that aren't given keep their DefaultMoveOrderingWeights
+// value, so the empty string gives the defaults.
+//
+// Returns error if a name doesn't exist or a weight isn't a number.
+func ParseMoveOrderingWeights(list string) (MoveOrderingWeights, error) {
+	weights := DefaultMoveOrderingWeights
+	fields := map[string]*int{
+		"to-foundation":    &weights.ToFoundation,
+		"uncovers-needed":  &weights.UncoversNeeded,
+		"empties-tableau":  &weights.EmptiesTableau,
+		"from-waste":       &weights.FromWaste,
+		"to-empty-tableau": &weights.ToEmptyTableau,
+		"from-foundation":  &weights.FromFoundation,
+	}
+	for _, pair := range strings.Split(list, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		field, ok := fields[strings.TrimSpace(parts[0])]
+		if !ok {
+			return weights, fmt.Errorf("Unknown move ordering weight '%s'", parts[0])
+		}
+		if len(parts) != 2 {
+			return weights, fmt.Errorf("Move ordering weight '%s' needs a value", parts[0])
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return weights, fmt.Errorf("Error parsing move ordering weight '%s': %v", pair, err)
+		}
+		*field = weight
+	}
+	return weights, nil
+}
+
+// MoveOrderer sorts moves so that the most promising ones come first.
+//
+// A MoveOrderer reuses its buffers between calls and is not safe for
+// concurrent use.
+type MoveOrderer struct {
+	weights MoveOrderingWeights
+	sorter  moveSorter
+
+	// nextNeeded[suit][rank] is true if a card of that suit and rank can be
+	// put on a foundation right now
+	nextNeeded [numSuits][numRanks + 2]bool
+}
+
+// NewMoveOrderer returns a MoveOrderer using the given weights
+func NewMoveOrderer(weights MoveOrderingWeights) *MoveOrderer {
+	return &MoveOrderer{weights: weights}
+}
+
+// Order sorts the moves in place, highest priority first.
+//
+// Moves with equal priority keep their original order.
+func (o *MoveOrderer) Order(state *libgame.GameState, moves []libgame.MoveRequest) {
+	o.indexFoundations(state)
+	o.sorter.moves = moves
+	o.sorter.priorities = o.sorter.priorities[:0]
+	for _, move := range moves {
+		o.sorter.priorities = append(o.sorter.priorities, o.priority(state, move))
+	}
+	sort.Stable(&o.sorter)
+	o.sorter.moves = nil
+}
+
+// Priority returns the priority of a single move. Higher is better.
+func (o *MoveOrderer) Priority(state *libgame.GameState, move libgame.MoveRequest) int {
+	o.indexFoundations(state)
+	return o.priority(state, move)
+}
+
+// priority scores a move. Expects indexFoundations to have been called
+func (o *MoveOrderer) priority(state *libgame.GameState, move libgame.MoveRequest) int {
+	priority := 0
+
+	switch move.FromPile {
+	case libgame.WASTE:
+		priority += o.weights.FromWaste
+	case libgame.FOUNDATION:
+		priority += o.weights.FromFoundation
+	case libgame.TABLEAU:
+		tableau := state.Tableaus[move.FromIndex].Cards
+		if len(tableau) == 1 {
+			priority += o.weights.EmptiesTableau
+		} else if len(tableau) > 1 && o.isNeeded(tableau[len(tableau)-2]) {
+			priority += o.weights.UncoversNeeded
+		}
+	}
+
+	switch move.ToPile {
+	case libgame.FOUNDATION:
+		if move.FromPile != libgame.FOUNDATION {
+			priority += o.weights.ToFoundation
+		}
+	case libgame.TABLEAU:
+		if len(state.Tableaus[move.ToIndex].Cards) == 0 {
+			priority += o.weights.ToEmptyTableau
+		}
+	}
+	return priority
+}
+
+// indexFoundations records which cards the foundations are ready for
+func (o *MoveOrderer) indexFoundations(state *libgame.GameState) {
+	o.nextNeeded = [numSuits][numRanks + 2]bool{}
+	for suit := 0; suit < numSuits; suit++ {
+		o.nextNeeded[suit][1] = true // aces can always start a foundation
+	}
+	for i := range state.Foundations {
+		suit, rank, ok := topCard(&state.Foundations[i])
+		if ok && suit >= 0 {
+			o.nextNeeded[suit][rank+1] = true
+		}
+	}
+}
+
+// isNeeded returns true if the card could be moved onto a foundation
+func (o *MoveOrderer) isNeeded(card deck.Card) bool {
+	suit, suitOk := suitIndexes[card.Suit]
+	rank, rankOk := faceRanks[card.Face]
+	return suitOk && rankOk && o.nextNeeded[suit][rank]
+}
+
+// moveSorter sorts moves by descending priority
+type moveSorter struct {
+	moves      []libgame.MoveRequest
+	priorities []int
+}
+
+func (s *moveSorter) Len() int           { return len(s.moves) }
+func (s *moveSorter) Less(i, j int) bool { return s.priorities[i] > s.priorities[j] }
+func (s *moveSorter) Swap(i, j int) {
+	s.moves[i], s.moves[j] = s.moves[j], s.moves[i]
+	s.priorities[i], s.priorities[j] = s.priorities[j], s.priorities[i]
+}
@@ -0,0 +1,156 @@
+package libsolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// createEmptyGameState returns a state with every pile empty, for crafting positions
+func createEmptyGameState() libgame.GameState {
+	var state libgame.GameState
+	state.Foundations = make([]deck.Deck, libgame.NumFoundations)
+	state.Tableaus = make([]deck.Deck, libgame.NumTableaus)
+	return state
+}
+
+// fillEmptyTableaus puts a king on each empty tableau so they don't get in our way
+func fillEmptyTableaus(state *libgame.GameState) {
+	for i := range state.Tableaus {
+		if len(state.Tableaus[i].Cards) == 0 {
+			state.Tableaus[i].Cards = []deck.Card{deck.Card{Face: deck.KING, Suit: deck.SPADE}}
+		}
+	}
+}
+
+func indexOfMove(moves []libgame.MoveRequest, move libgame.MoveRequest) int {
+	for i := range moves {
+		if moves[i] == move {
+			return i
+		}
+	}
+	return -1
+}
+
+func orderedMoves(state *libgame.GameState, weights MoveOrderingWeights) []libgame.MoveRequest {
+	moves := GetPossibleMoves(state)
+	NewMoveOrderer(weights).Order(state, moves)
+	return moves
+}
+
+func TestMoveOrderingFoundationMovesFirst(t *testing.T) {
+	state := createEmptyGameState()
+	state.Tableaus[0].Cards = []deck.Card{deck.Card{Face: deck.TWO, Suit: deck.CLUB}}
+	state.Tableaus[1].Cards = []deck.Card{deck.Card{Face: deck.FIVE, Suit: deck.HEART}}
+	state.Tableaus[2].Cards = []deck.Card{deck.Card{Face: deck.SIX, Suit: deck.HEART}}
+	state.Foundations[0].Cards = []deck.Card{deck.Card{Face: deck.ACE, Suit: deck.CLUB}}
+	fillEmptyTableaus(&state)
+
+	moves := orderedMoves(&state, DefaultMoveOrderingWeights)
+	assert.Equal(t, libgame.MoveRequest{libgame.TABLEAU, 0, libgame.FOUNDATION, 0}, moves[0])
+	assert.Equal(t, libgame.MoveRequest{libgame.TABLEAU, 1, libgame.TABLEAU, 2}, moves[1])
+	// the rest shift the ace between foundations
+	for _, move := range moves[2:] {
+		assert.Equal(t, libgame.PileLocation(libgame.FOUNDATION), move.FromPile)
+	}
+}
+
+func TestMoveOrderingUncoveringNeededCards(t *testing.T) {
+	state := createEmptyGameState()
+	// moving the four of hearts uncovers a king, which doesn't help
+	state.Tableaus[0].Cards = []deck.Card{
+		deck.Card{Face: deck.KING, Suit: deck.CLUB},
+		deck.Card{Face: deck.FOUR, Suit: deck.HEART}}
+	state.Tableaus[1].Cards = []deck.Card{deck.Card{Face: deck.FIVE, Suit: deck.HEART}}
+	// moving the nine of diamonds uncovers an ace, which can go up right away
+	state.Tableaus[2].Cards = []deck.Card{
+		deck.Card{Face: deck.ACE, Suit: deck.SPADE},
+		deck.Card{Face: deck.NINE, Suit: deck.DIAMOND}}
+	state.Tableaus[3].Cards = []deck.Card{deck.Card{Face: deck.TEN, Suit: deck.DIAMOND}}
+	fillEmptyTableaus(&state)
+
+	moves := orderedMoves(&state, DefaultMoveOrderingWeights)
+	assert.Len(t, moves, 2)
+	assert.Equal(t, libgame.MoveRequest{libgame.TABLEAU, 2, libgame.TABLEAU, 3}, moves[0])
+	assert.Equal(t, libgame.MoveRequest{libgame.TABLEAU, 0, libgame.TABLEAU, 1}, moves[1])
+}
+
+func TestMoveOrderingEmptyTableausLast(t *testing.T) {
+	state := createEmptyGameState()
+	state.Tableaus[0].Cards = []deck.Card{
+		deck.Card{Face: deck.KING, Suit: deck.CLUB},
+		deck.Card{Face: deck.THREE, Suit: deck.DIAMOND}}
+	state.Tableaus[2].Cards = []deck.Card{deck.Card{Face: deck.FOUR, Suit: deck.DIAMOND}}
+	fillEmptyTableaus(&state)
+	state.Tableaus[1].Cards = nil
+
+	moves := orderedMoves(&state, DefaultMoveOrderingWeights)
+	toEmpty := indexOfMove(moves, libgame.MoveRequest{libgame.TABLEAU, 0, libgame.TABLEAU, 1})
+	toFour := indexOfMove(moves, libgame.MoveRequest{libgame.TABLEAU, 0, libgame.TABLEAU, 2})
+	assert.NotEqual(t, -1, toEmpty)
+	assert.NotEqual(t, -1, toFour)
+	assert.True(t, toFour < toEmpty)
+	assert.Equal(t, libgame.MoveRequest{libgame.TABLEAU, 0, libgame.TABLEAU, 2}, moves[0])
+}
+
+func TestMoveOrderingFromFoundationLast(t *testing.T) {
+	state := createEmptyGameState()
+	state.Foundations[0].Cards = []deck.Card{
+		deck.Card{Face: deck.ACE, Suit: deck.CLUB},
+		deck.Card{Face: deck.TWO, Suit: deck.CLUB}}
+	state.Tableaus[0].Cards = []deck.Card{deck.Card{Face: deck.THREE, Suit: deck.CLUB}}
+	state.Waste.Cards = []deck.Card{deck.Card{Face: deck.EIGHT, Suit: deck.HEART}}
+	state.Tableaus[1].Cards = []deck.Card{deck.Card{Face: deck.NINE, Suit: deck.HEART}}
+	fillEmptyTableaus(&state)
+
+	moves := orderedMoves(&state, DefaultMoveOrderingWeights)
+	assert.Len(t, moves, 3)
+	assert.Equal(t, libgame.MoveRequest{libgame.TABLEAU, 0, libgame.FOUNDATION, 0}, moves[0])
+	assert.Equal(t, libgame.MoveRequest{libgame.WASTE, 0, libgame.TABLEAU, 1}, moves[1])
+	assert.Equal(t, libgame.MoveRequest{libgame.FOUNDATION, 0, libgame.TABLEAU, 0}, moves[2])
+}
+
+func TestMoveOrderingZeroWeightsKeepsOrder(t *testing.T) {
+	state := libgame.DealNewGame(libgame.Game{ID: 0})
+	expected := GetPossibleMoves(&state)
+	moves := orderedMoves(&state, MoveOrderingWeights{})
+	assert.Equal(t, expected, moves)
+}
+
+func TestMoveOrderingCustomWeights(t *testing.T) {
+	state := createEmptyGameState()
+	state.Tableaus[0].Cards = []deck.Card{deck.Card{Face: deck.TWO, Suit: deck.CLUB}}
+	state.Tableaus[1].Cards = []deck.Card{deck.Card{Face: deck.FIVE, Suit: deck.HEART}}
+	state.Tableaus[2].Cards = []deck.Card{deck.Card{Face: deck.SIX, Suit: deck.HEART}}
+	state.Foundations[0].Cards = []deck.Card{deck.Card{Face: deck.ACE, Suit: deck.CLUB}}
+	fillEmptyTableaus(&state)
+
+	// with foundation moves penalized, the tableau move goes first
+	moves := orderedMoves(&state, MoveOrderingWeights{ToFoundation: -1})
+	assert.Equal(t, libgame.MoveRequest{libgame.TABLEAU, 1, libgame.TABLEAU, 2}, moves[0])
+
+	orderer := NewMoveOrderer(DefaultMoveOrderingWeights)
+	assert.Equal(t,
+		DefaultMoveOrderingWeights.ToFoundation+DefaultMoveOrderingWeights.EmptiesTableau,
+		orderer.Priority(
+			&state, libgame.MoveRequest{libgame.TABLEAU, 0, libgame.FOUNDATION, 0}))
+}
+
+func TestParseMoveOrderingWeights(t *testing.T) {
+	weights, err := ParseMoveOrderingWeights("")
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultMoveOrderingWeights, weights)
+
+	weights, err = ParseMoveOrderingWeights("to-foundation=80, from-foundation=-5")
+	assert.Nil(t, err)
+	expected := DefaultMoveOrderingWeights
+	expected.ToFoundation, expected.FromFoundation = 80, -5
+	assert.Equal(t, expected, weights)
+
+	for _, bad := range []string{"not-a-weight=1", "from-waste", "from-waste=lots"} {
+		_, err = ParseMoveOrderingWeights(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,541 @@
+package libsolver
+
+import (
+	"container/heap"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// ParallelOptions configures SolveParallel
+type ParallelOptions struct {
+	SearchOptions
+
+	// Workers is the number of goroutines expanding states. Defaults to
+	// runtime.NumCPU()
+	Workers int
+
+	// Heuristic is the name of the heuristic that picks the next states to
+	// expand. Defaults to DefaultHeuristic
+	Heuristic string
+
+	// VisitedShards is the number of locks the visited set is split over.
+	// Defaults to DefaultVisitedShards
+	VisitedShards int
+}
+
+// parallelBatchSize is the number of states a worker takes off the frontier at
+// once, so that workers spend less time waiting on the frontier's lock
+const parallelBatchSize = 16
+
+// SolveParallel runs a best first search for a solution to the game, with
+// many workers sharing one frontier and one visited set.
+//
+// Each worker repeatedly takes the most promising states off the frontier by
+// the heuristic (fewest moves from the start breaking ties), and puts back any
+// children that haven't been visited. The solution is the first one found,
+// which isn't necessarily the shortest.
+//
+// Returns error if the heuristic doesn't exist.
+func SolveParallel(start libgame.GameState, options ParallelOptions) (SearchResult, error) {
+	search, err := newParallelSearch(start, options)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	root := &searchNode{state: start.Copy()}
+	root.estimate = search.heuristic.Estimate(&root.state)
+	search.best = root
+	search.bestScore = int64(root.state.Score)
+	search.visited.Add(HashGameState(&root.state))
+	search.frontier.push([]*searchNode{root})
+	return search.run()
+}
+
+// ResumeParallel carries on with the parallel search saved in
+// options.Checkpoint.
+//
+// Like ResumeDisk, the search must be resumed with the same heuristic, pruning
+// rules, move ordering and PruneLost as it was started with, and MaxExpanded
+// counts the states expanded before the checkpoint. The number of workers may
+// change. With one worker, a resumed search finds the same result as one that
+// was never stopped.
+//
+// Returns error if the checkpoint can't be read or the options don't match.
+func ResumeParallel(options ParallelOptions) (SearchResult, error) {
+	h, err := LookupHeuristic(options.Heuristic)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	visited := NewVisitedSet(options.VisitedShards)
+	header, _, file, err := readSearchCheckpoint(options.Checkpoint, "parallel",
+		newCheckpointRules(h.Name, options.SearchOptions), func(hash uint64) { visited.Add(hash) })
+	if err != nil {
+		return SearchResult{}, err
+	}
+	defer file.Close()
+	search, err := newParallelSearch(header.Start, options)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	nodes, err := restoreNodes(header.Start, header.Nodes, h)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	best, err := pickNodes(nodes, []int{header.Best})
+	if err != nil {
+		return SearchResult{}, err
+	}
+	search.best = best[0]
+	search.bestScore = int64(search.best.state.Score)
+	if header.Done {
+		result, err := resultFromCheckpoint(header, search.best.path())
+		search.progress.done(&result)
+		return result, err
+	}
+
+	// the frontier was saved in heap order, so it's still a heap
+	frontier, err := pickNodes(nodes, header.Frontier)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	search.frontier.nodes = nodeHeap(frontier)
+	for _, saved := range header.Batches {
+		batch := pendingBatch{}
+		if batch.nodes, err = pickNodes(nodes, saved.Nodes); err != nil {
+			return SearchResult{}, err
+		}
+		if batch.children, err = pickNodes(nodes, saved.Children); err != nil {
+			return SearchResult{}, err
+		}
+		search.frontier.pending = append(search.frontier.pending, batch)
+	}
+	// the workers that take the pending batches are busy from the start
+	search.frontier.busy = len(search.frontier.pending)
+	search.visited = visited
+	search.expanded, search.generated = header.Expanded, header.Generated
+	search.nextCheckpoint = header.Expanded + search.checkpointEvery
+	return search.run()
+}
+
+type parallelSearch struct {
+	options   ParallelOptions
+	heuristic Heuristic
+	start     libgame.GameState
+	visited   *VisitedSet
+	frontier  parallelFrontier
+	progress  *progressReporter
+
+	expanded  int64 // updated atomically
+	generated int64 // updated atomically
+
+	// bestScore is best's score, so that workers can check children against
+	// it without taking the lock. Updated atomically, with mu held
+	bestScore int64
+
+	// a checkpoint is taken once expanded reaches nextCheckpoint. Updated
+	// atomically
+	nextCheckpoint  int64
+	checkpointEvery int64
+
+	mu       sync.Mutex // guards the fields below
+	best     *searchNode
+	solution *searchNode
+	stopped  []pendingBatch // batches that were cut short by MaxExpanded or Cancel
+	err      error
+}
+
+// pendingBatch is a batch that a worker stopped part way through: the states
+// it had left, and the children of the ones it had expanded
+type pendingBatch struct {
+	nodes    []*searchNode
+	children []*searchNode
+}
+
+func newParallelSearch(start libgame.GameState, options ParallelOptions) (*parallelSearch, error) {
+	h, err := LookupHeuristic(options.Heuristic)
+	if err != nil {
+		return nil, err
+	}
+	if options.Workers <= 0 {
+		options.Workers = runtime.NumCPU()
+	}
+	every := options.CheckpointEvery
+	if every <= 0 {
+		every = DefaultCheckpointEvery
+	}
+	search := &parallelSearch{
+		options:         options,
+		heuristic:       h,
+		start:           start.Copy(),
+		visited:         NewVisitedSet(options.VisitedShards),
+		progress:        newProgressReporter(options.SearchOptions),
+		nextCheckpoint:  every,
+		checkpointEvery: every,
+	}
+	search.frontier.cond = sync.NewCond(&search.frontier.mu)
+	if options.Checkpoint != "" {
+		search.frontier.onCheckpoint = search.checkpointLocked
+	}
+	return search, nil
+}
+
+// run starts the workers and waits for them to finish the search
+func (s *parallelSearch) run() (SearchResult, error) {
+	var wg sync.WaitGroup
+	for i := 0; i < s.options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work()
+		}()
+	}
+	wg.Wait()
+	if s.err != nil {
+		return SearchResult{}, s.err
+	}
+
+	result := SearchResult{
+		Solved:    s.solution != nil,
+		BestPath:  s.best.path(),
+		Expanded:  atomic.LoadInt64(&s.expanded),
+		Generated: atomic.LoadInt64(&s.generated),
+	}
+	if result.Expanded > s.options.MaxExpanded && s.options.MaxExpanded > 0 {
+		result.Expanded = s.options.MaxExpanded
+	}
+	if result.Solved {
+		result.BestPath = s.solution.path()
+		result.Solution = result.BestPath
+	}
+	if s.options.Checkpoint != "" {
+		s.frontier.mu.Lock()
+		stopped := s.hitMaxExpanded() || s.options.cancelled()
+		err := s.checkpoint(result.Expanded, !stopped || result.Solved)
+		s.frontier.mu.Unlock()
+		if err != nil {
+			return SearchResult{}, err
+		}
+	}
+	err := result.finish(s.start)
+	s.progress.done(&result)
+	return result, err
+}
+
+// hitMaxExpanded returns true if the search stopped because it used up
+// MaxExpanded, rather than because it was over
+func (s *parallelSearch) hitMaxExpanded() bool {
+	return s.options.MaxExpanded > 0 && atomic.LoadInt64(&s.expanded) >= s.options.MaxExpanded
+}
+
+// work expands states from the frontier until the search is over.
+//
+// Workers share as little as they can: they take a batch of states at a time,
+// count what they expand and generate once per batch, and only lock the best
+// node when a child beats it.
+func (s *parallelSearch) work() {
+	expander := newExpander(s.options.SearchOptions)
+	var moves []libgame.MoveRequest
+	batch, children := s.frontier.next(nil, parallelBatchSize)
+	for batch != nil {
+		if s.options.cancelled() {
+			s.frontier.stop()
+			s.stop(batch, children)
+			return
+		}
+
+		// claim the expansions for the whole batch, keeping within the budget
+		n := int64(len(batch))
+		first := atomic.AddInt64(&s.expanded, n) - n
+		var rest []*searchNode
+		if s.options.MaxExpanded > 0 && first+n >= s.options.MaxExpanded {
+			s.frontier.stop()
+			keep := s.options.MaxExpanded - first
+			if keep < 0 {
+				keep = 0
+			}
+			if keep < n {
+				// what's left is saved for a resumed search, instead of being expanded
+				rest = batch[keep:]
+				batch = batch[:keep]
+			}
+		}
+		if first+n >= atomic.LoadInt64(&s.nextCheckpoint) && s.frontier.onCheckpoint != nil {
+			s.frontier.requestCheckpoint()
+		}
+
+		var generated int64
+	expand:
+		for i, node := range batch {
+			var lastMove *libgame.MoveRequest
+			if node.parent != nil {
+				lastMove = &node.move
+			}
+			moves = expander.appendMoves(moves[:0], &node.state, lastMove)
+			generated += int64(len(moves))
+			if expanded := first + int64(i) + 1; s.progress.due(expanded) {
+				s.progress.report(Progress{
+					Expanded:  expanded,
+					Generated: atomic.LoadInt64(&s.generated) + generated,
+					BestScore: int(atomic.LoadInt64(&s.bestScore)),
+					Depth:     node.depth,
+					Frontier:  s.frontier.size(),
+				})
+			}
+			parent := newSearchState(node.state)
+			for _, move := range moves {
+				// only copy the children we haven't seen before
+				parent.do(move)
+				isNew := s.visited.Add(HashGameState(&parent.state))
+				var childState libgame.GameState
+				if isNew {
+					childState = parent.state.Copy()
+				}
+				parent.undo(move)
+				if !isNew {
+					continue
+				}
+				if s.options.PruneLost {
+					if lost, _ := ProvablyLost(&childState); lost {
+						continue
+					}
+				}
+				childNode := &searchNode{
+					state:    childState,
+					parent:   node,
+					move:     move,
+					depth:    node.depth + 1,
+					estimate: s.heuristic.Estimate(&childState),
+				}
+				if s.record(childNode) {
+					s.frontier.stop()
+					break expand
+				}
+				children = append(children, childNode)
+			}
+		}
+		atomic.AddInt64(&s.generated, generated)
+		if rest != nil {
+			s.stop(rest, children)
+			return
+		}
+		batch, children = s.frontier.next(children, parallelBatchSize)
+	}
+}
+
+// stop keeps the rest of a batch cut short by MaxExpanded or Cancel, and the children
+// of the part that was expanded, for the checkpoint
+func (s *parallelSearch) stop(rest []*searchNode, children []*searchNode) {
+	s.mu.Lock()
+	s.stopped = append(s.stopped, pendingBatch{nodes: rest, children: children})
+	s.mu.Unlock()
+	s.frontier.finish()
+}
+
+// record keeps track of the best node seen. Returns true if the node is a win
+func (s *parallelSearch) record(node *searchNode) bool {
+	score := int64(node.state.Score)
+	if score >= atomic.LoadInt64(&s.bestScore) && score != 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if node.state.Score < s.best.state.Score {
+		s.best = node
+		atomic.StoreInt64(&s.bestScore, score)
+	}
+	if node.state.Score == 0 && s.solution == nil {
+		s.solution = node
+		return true
+	}
+	return false
+}
+
+// checkpointLocked is the frontier's onCheckpoint. It saves a periodic
+// checkpoint, while every worker waits on the frontier's lock
+func (s *parallelSearch) checkpointLocked() {
+	expanded := atomic.LoadInt64(&s.expanded)
+	atomic.StoreInt64(&s.nextCheckpoint, expanded+s.checkpointEvery)
+	if err := s.checkpoint(expanded, false); err != nil {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		s.frontier.stopped = true
+	}
+}
+
+// checkpoint saves the search to options.Checkpoint. The frontier's lock must
+// be held, with no workers part way through a batch. done is true once the
+// search is over
+func (s *parallelSearch) checkpoint(expanded int64, done bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saver := newNodeSaver()
+	best := s.best
+	if s.solution != nil {
+		best = s.solution
+	}
+	header := &searchCheckpoint{
+		Search:          "parallel",
+		Start:           s.start,
+		checkpointRules: newCheckpointRules(s.heuristic.Name, s.options.SearchOptions),
+		Expanded:        expanded,
+		Generated:       atomic.LoadInt64(&s.generated),
+		Done:            done,
+		Solved:          s.solution != nil,
+		Best:            saver.save(best),
+	}
+	var hashes func(func(uint64))
+	if !done {
+		header.Frontier = saver.saveAll(s.frontier.nodes)
+		for _, batch := range append(s.frontier.pending, s.stopped...) {
+			header.Batches = append(header.Batches, savedBatch{
+				Nodes:    saver.saveAll(batch.nodes),
+				Children: saver.saveAll(batch.children),
+			})
+		}
+		header.VisitedHashes = int64(s.visited.Len())
+		hashes = s.visited.each
+	}
+	header.Nodes = saver.nodes
+	checkpointer := checkpointer{path: s.options.Checkpoint}
+	return checkpointer.write(header, hashes, nil)
+}
+
+// parallelFrontier is a priority queue of states to expand, shared by workers.
+//
+// Workers wait on it while it's empty but other workers might still add to it.
+// The search is over once it's empty with no workers busy, or it's stopped.
+type parallelFrontier struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	nodes   nodeHeap
+	busy    int // workers with a batch that they haven't finished
+	stopped bool
+
+	// pending are batches from a resumed search, which workers take before
+	// anything else. They count as busy until they're done
+	pending []pendingBatch
+
+	// onCheckpoint, if set, is called with the lock held once
+	// requestCheckpoint has been called and no workers are busy
+	onCheckpoint  func()
+	checkpointDue bool
+}
+
+// next adds the children of the worker's last batch to the frontier, then
+// takes up to n of the most promising states, under one lock. Workers pass nil
+// children before their first batch.
+//
+// Returns the batch, and the slice to collect its children in. Returns a nil
+// batch once the search is over
+func (f *parallelFrontier) next(children []*searchNode, n int) ([]*searchNode, []*searchNode) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if children != nil {
+		for _, child := range children {
+			heap.Push(&f.nodes, child)
+		}
+		f.busy--
+		if len(children) > 0 || f.busy == 0 {
+			f.cond.Broadcast()
+		}
+	} else {
+		children = make([]*searchNode, 0, 8*parallelBatchSize)
+	}
+	if len(f.pending) > 0 && !f.stopped {
+		batch := f.pending[0]
+		f.pending = f.pending[1:]
+		return batch.nodes, append(children[:0], batch.children...)
+	}
+
+	// checkpoints wait for every worker to finish its batch
+	for f.checkpointDue && f.busy > 0 && !f.stopped {
+		f.cond.Wait()
+	}
+	if f.checkpointDue && !f.stopped {
+		f.checkpointDue = false
+		f.onCheckpoint()
+		f.cond.Broadcast()
+	}
+
+	for len(f.nodes) == 0 && f.busy > 0 && !f.stopped {
+		f.cond.Wait()
+	}
+	if len(f.nodes) == 0 || f.stopped {
+		f.cond.Broadcast()
+		return nil, nil
+	}
+	if n > len(f.nodes) {
+		n = len(f.nodes)
+	}
+	batch := make([]*searchNode, n)
+	for i := range batch {
+		batch[i] = heap.Pop(&f.nodes).(*searchNode)
+	}
+	f.busy++
+	return batch, children[:0]
+}
+
+// finish ends a worker's batch without adding anything to the frontier
+func (f *parallelFrontier) finish() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.busy--
+	f.cond.Broadcast()
+}
+
+// size returns the number of states waiting in the frontier
+func (f *parallelFrontier) size() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return int64(len(f.nodes))
+}
+
+// push adds states to the frontier without finishing a batch
+func (f *parallelFrontier) push(nodes []*searchNode) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, node := range nodes {
+		heap.Push(&f.nodes, node)
+	}
+	f.cond.Broadcast()
+}
+
+// requestCheckpoint asks for onCheckpoint to be called, once every worker has
+// finished its batch
+func (f *parallelFrontier) requestCheckpoint() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checkpointDue = true
+}
+
+// stop ends the search. Workers finish the batch they are on
+func (f *parallelFrontier) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = true
+	f.cond.Broadcast()
+}
+
+// nodeHeap orders nodes by estimate, then depth
+type nodeHeap []*searchNode
+
+func (h nodeHeap) Len() int { return len(h) }
+func (h nodeHeap) Less(i, j int) bool {
+	if h[i].estimate != h[j].estimate {
+		return h[i].estimate < h[j].estimate
+	}
+	return h[i].depth < h[j].depth
+}
+func (h nodeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *nodeHeap) Push(x interface{}) { *h = append(*h, x.(*searchNode)) }
+func (h *nodeHeap) Pop() interface{} {
+	old := *h
+	node := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return node
+}
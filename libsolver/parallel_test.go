@@ -0,0 +1,165 @@
+package libsolver
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+func TestVisitedSetConcurrentAdds(t *testing.T) {
+	visited := NewVisitedSet(8)
+	var wg sync.WaitGroup
+	added := make([]int, 4)
+	for worker := range added {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			// every worker tries to add the same hashes
+			for i := uint64(0); i < 1000; i++ {
+				if visited.Add(i * 0x9E3779B97F4A7C15) {
+					added[worker]++
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, count := range added {
+		total += count
+	}
+	assert.Equal(t, 1000, total, "each hash is only new to one worker")
+	assert.Equal(t, 1000, visited.Len())
+	assert.True(t, visited.Contains(0x9E3779B97F4A7C15))
+	assert.False(t, visited.Contains(1))
+}
+
+func TestSolveParallel(t *testing.T) {
+	start := createNearlyWonGameState()
+	for _, workers := range []int{1, 4} {
+		result, err := SolveParallel(start, ParallelOptions{Workers: workers})
+		assert.Nil(t, err)
+		assertSolves(t, start, result)
+	}
+}
+
+func TestSolveParallelUnknownHeuristic(t *testing.T) {
+	_, err := SolveParallel(createNearlyWonGameState(), ParallelOptions{Heuristic: "not-a-heuristic"})
+	assert.Error(t, err)
+}
+
+func TestSolveParallelStopsAtMaxExpanded(t *testing.T) {
+	start := libgame.DealNewGame(libgame.Game{ID: 0})
+	result, err := SolveParallel(start, ParallelOptions{
+		SearchOptions: SearchOptions{MaxExpanded: 2000},
+		Workers:       4,
+	})
+	assert.Nil(t, err)
+	assert.False(t, result.Solved)
+	assert.EqualValues(t, 2000, result.Expanded)
+
+	best, err := ApplyMoves(start, result.BestPath)
+	assert.Nil(t, err)
+	assert.Equal(t, best.Score, result.BestState.Score)
+	assert.True(t, result.BestState.Score < start.Score)
+}
+
+func TestSolveParallelExhaustsSearch(t *testing.T) {
+	// every child of the lost state is pruned, so the workers run out of work
+	state := createLostGameState()
+	result, err := SolveParallel(state, ParallelOptions{
+		SearchOptions: SearchOptions{PruneLost: true},
+		Workers:       4,
+	})
+	assert.Nil(t, err)
+	assert.False(t, result.Solved)
+	assert.EqualValues(t, 1, result.Expanded)
+}
+
+// parallelSpeedupDeals are the PySolFC deals the parallel benchmarks search,
+// so that every worker count does the same work
+var parallelSpeedupDeals = []int64{1, 2, 3, 4}
+
+// solveParallelDeals expands up to maxExpanded states from each of the deals
+func solveParallelDeals(tb testing.TB, workers int, maxExpanded int64) {
+	pruner, err := NewPruner(DefaultPruningRules)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, dealNumber := range parallelSpeedupDeals {
+		start, err := libgame.DealPysolGame(libgame.Game{}, dealNumber)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		_, err = SolveParallel(start, ParallelOptions{
+			SearchOptions: SearchOptions{Pruner: pruner, MaxExpanded: maxExpanded},
+			Workers:       workers,
+		})
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSolveParallel expands a fixed number of states from a fixed set of
+// deals with more and more workers. Time per op should drop as workers are
+// added, up to the number of CPUs.
+func BenchmarkSolveParallel(b *testing.B) {
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				solveParallelDeals(b, workers, 20000)
+			}
+		})
+	}
+}
+
+// minParallelSpeedup is the fraction of a linear speedup that TestSolveParallelSpeedup
+// expects from each worker count that has a CPU for every worker
+const minParallelSpeedup = 0.6
+
+// TestSolveParallelSpeedup checks that more workers solve faster than a
+// single worker, on the same deals as BenchmarkSolveParallel. Run it with -v
+// to see the speedups. Only worker counts up to the number of CPUs are
+// expected to go any faster, so it needs at least 2 CPUs.
+func TestSolveParallelSpeedup(t *testing.T) {
+	if testing.Short() {
+		t.Skip("timing the solver is slow")
+	}
+	cpus := runtime.GOMAXPROCS(0)
+	if cpus < 2 {
+		t.Skip("a single CPU can't run workers in parallel")
+	}
+	var single time.Duration
+	for _, workers := range []int{1, 2, 4, 8} {
+		if workers > cpus {
+			break
+		}
+		// the fastest of a few runs, so that a busy machine doesn't fail us
+		var perOp time.Duration
+		for run := 0; run < 3; run++ {
+			result := testing.Benchmark(func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					solveParallelDeals(b, workers, 2000)
+				}
+			})
+			if run == 0 || time.Duration(result.NsPerOp()) < perOp {
+				perOp = time.Duration(result.NsPerOp())
+			}
+		}
+		if workers == 1 {
+			single = perOp
+			continue
+		}
+		speedup := float64(single) / float64(perOp)
+		t.Logf("%d workers on %d cpus: %v per op, %.2fx speedup",
+			workers, cpus, perOp, speedup)
+		assert.True(t, speedup >= minParallelSpeedup*float64(workers),
+			"%d workers only gave a %.2fx speedup", workers, speedup)
+	}
+}
@@ -0,0 +1,247 @@
+package libsolver
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// PlayoutPolicy picks the move to make at each step of a playout
+type PlayoutPolicy struct {
+	Name        string
+	Description string
+
+	// Choose returns the index of the move to make. moves is never empty, and
+	// may be reordered.
+	Choose func(state *libgame.GameState, moves []libgame.MoveRequest,
+		rng *rand.Rand, orderer *MoveOrderer) int
+}
+
+// playoutPolicies is the registry of all the policies playouts can use
+var playoutPolicies = []PlayoutPolicy{
+	{
+		Name:        "random",
+		Description: "any legal move, uniformly at random",
+		Choose: func(state *libgame.GameState, moves []libgame.MoveRequest,
+			rng *rand.Rand, orderer *MoveOrderer) int {
+			return rng.Intn(len(moves))
+		},
+	},
+	{
+		Name:        "foundation-first",
+		Description: "a random move onto a foundation if there is one, otherwise any random move",
+		Choose: func(state *libgame.GameState, moves []libgame.MoveRequest,
+			rng *rand.Rand, orderer *MoveOrderer) int {
+			toFoundation := 0
+			for i, move := range moves {
+				if move.ToPile == libgame.FOUNDATION && move.FromPile != libgame.FOUNDATION {
+					moves[i], moves[toFoundation] = moves[toFoundation], moves[i]
+					toFoundation++
+				}
+			}
+			if toFoundation > 0 {
+				return rng.Intn(toFoundation)
+			}
+			return rng.Intn(len(moves))
+		},
+	},
+	{
+		Name:        "greedy",
+		Description: "the highest priority move by the default move ordering, breaking ties at random",
+		Choose: func(state *libgame.GameState, moves []libgame.MoveRequest,
+			rng *rand.Rand, orderer *MoveOrderer) int {
+			orderer.Order(state, moves)
+			best := orderer.Priority(state, moves[0])
+			ties := 1
+			for ties < len(moves) && orderer.Priority(state, moves[ties]) == best {
+				ties++
+			}
+			return rng.Intn(ties)
+		},
+	},
+}
+
+// DefaultPlayoutPolicy is the policy used when none is given
+const DefaultPlayoutPolicy = "greedy"
+
+// PlayoutPolicies returns every registered policy, sorted by name
+func PlayoutPolicies() []PlayoutPolicy {
+	policies := make([]PlayoutPolicy, len(playoutPolicies))
+	copy(policies, playoutPolicies)
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies
+}
+
+// LookupPlayoutPolicy returns the registered policy with the given name. The
+// empty string means DefaultPlayoutPolicy
+func LookupPlayoutPolicy(name string) (PlayoutPolicy, error) {
+	if name == "" {
+		name = DefaultPlayoutPolicy
+	}
+	for _, policy := range playoutPolicies {
+		if policy.Name == name {
+			return policy, nil
+		}
+	}
+	return PlayoutPolicy{}, fmt.Errorf("Unknown playout policy '%s'", name)
+}
+
+// DeadEndCause is the reason a playout stopped without winning
+type DeadEndCause string
+
+const (
+	// DeadEndNoMoves means there were no legal moves left and the stock was empty
+	DeadEndNoMoves DeadEndCause = "no-moves"
+	// DeadEndOnlyRepeats means every legal move led back to a state the
+	// playout had already been in
+	DeadEndOnlyRepeats DeadEndCause = "only-repeats"
+	// DeadEndMoveLimit means the playout ran out of moves
+	DeadEndMoveLimit DeadEndCause = "move-limit"
+)
+
+// PlayoutOptions configures RunPlayouts
+type PlayoutOptions struct {
+	// Playouts is the number of games to play. Defaults to DefaultPlayouts
+	Playouts int
+
+	// Policy is the name of the policy used to pick moves. Defaults to
+	// DefaultPlayoutPolicy
+	Policy string
+
+	// Pruner skips moves before the policy sees them. nil to allow every legal move
+	Pruner *Pruner
+
+	// MaxMoves ends a playout after this many moves. Defaults to DefaultPlayoutMaxMoves
+	MaxMoves int
+
+	// Seed seeds the random choices, so that runs can be repeated
+	Seed int64
+}
+
+const (
+	// DefaultPlayouts is the number of playouts run when none is given
+	DefaultPlayouts = 1000
+	// DefaultPlayoutMaxMoves is the move limit used when none is given
+	DefaultPlayoutMaxMoves = 1000
+)
+
+// PlayoutResult summarizes a set of playouts
+type PlayoutResult struct {
+	Playouts     int
+	Wins         int
+	WinRate      float64
+	AverageScore float64 // average score of the final states, 0 for a win
+	AverageMoves float64 // average number of moves made in each playout
+	BestScore    int     // lowest final score of any playout
+
+	// DeadEnds counts the playouts that didn't win, by why they stopped
+	DeadEnds map[DeadEndCause]int
+}
+
+// RunPlayouts plays the game from the start state many times, choosing moves
+// with the policy until the game is won or reaches a dead end.
+//
+// A playout never returns to a state it has already been in. Returns error if
+// the policy doesn't exist.
+func RunPlayouts(start libgame.GameState, options PlayoutOptions) (PlayoutResult, error) {
+	policy, err := LookupPlayoutPolicy(options.Policy)
+	if err != nil {
+		return PlayoutResult{}, err
+	}
+	if options.Playouts <= 0 {
+		options.Playouts = DefaultPlayouts
+	}
+	if options.MaxMoves <= 0 {
+		options.MaxMoves = DefaultPlayoutMaxMoves
+	}
+
+	p := &playout{
+		policy:   policy,
+		options:  options,
+		expander: newExpander(SearchOptions{Pruner: options.Pruner}),
+		orderer:  NewMoveOrderer(DefaultMoveOrderingWeights),
+		rng:      rand.New(rand.NewSource(options.Seed)),
+		visited:  make(map[uint64]bool),
+	}
+	result := PlayoutResult{
+		Playouts:  options.Playouts,
+		BestScore: start.Score,
+		DeadEnds:  make(map[DeadEndCause]int),
+	}
+	totalScore, totalMoves := 0, 0
+	for i := 0; i < options.Playouts; i++ {
+		score, moves, cause := p.play(start)
+		totalScore += score
+		totalMoves += moves
+		if score < result.BestScore {
+			result.BestScore = score
+		}
+		if score == 0 {
+			result.Wins++
+		} else {
+			result.DeadEnds[cause]++
+		}
+	}
+	result.WinRate = float64(result.Wins) / float64(result.Playouts)
+	result.AverageScore = float64(totalScore) / float64(result.Playouts)
+	result.AverageMoves = float64(totalMoves) / float64(result.Playouts)
+	return result, nil
+}
+
+// playout holds the buffers reused between playouts
+type playout struct {
+	policy   PlayoutPolicy
+	options  PlayoutOptions
+	expander *expander
+	orderer  *MoveOrderer
+	rng      *rand.Rand
+
+	visited    map[uint64]bool
+	moves      []libgame.MoveRequest
+	candidates []libgame.MoveRequest
+}
+
+// play runs a single playout from the start state.
+//
+// Returns the final score, the number of moves made and, if the game wasn't
+// won, why the playout stopped.
+func (p *playout) play(start libgame.GameState) (int, int, DeadEndCause) {
+	s := newSearchState(start)
+	for hash := range p.visited {
+		delete(p.visited, hash)
+	}
+	p.visited[HashGameState(&s.state)] = true
+
+	var lastMove *libgame.MoveRequest
+	for numMoves := 0; ; numMoves++ {
+		if s.state.Score == 0 {
+			return 0, numMoves, ""
+		}
+		if numMoves >= p.options.MaxMoves {
+			return s.state.Score, numMoves, DeadEndMoveLimit
+		}
+
+		p.moves = p.expander.appendMoves(p.moves[:0], &s.state, lastMove)
+		if len(p.moves) == 0 {
+			return s.state.Score, numMoves, DeadEndNoMoves
+		}
+		p.candidates = p.candidates[:0]
+		for _, move := range p.moves {
+			s.do(move)
+			if !p.visited[HashGameState(&s.state)] {
+				p.candidates = append(p.candidates, move)
+			}
+			s.undo(move)
+		}
+		if len(p.candidates) == 0 {
+			return s.state.Score, numMoves, DeadEndOnlyRepeats
+		}
+
+		move := p.candidates[p.policy.Choose(&s.state, p.candidates, p.rng, p.orderer)]
+		s.do(move)
+		p.visited[HashGameState(&s.state)] = true
+		lastMove = &move
+	}
+}
@@ -0,0 +1,77 @@
+package libsolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+func TestPlayoutPoliciesAreSortedAndDocumented(t *testing.T) {
+	policies := PlayoutPolicies()
+	assert.Len(t, policies, len(playoutPolicies))
+	for i := range policies {
+		assert.NotEmpty(t, policies[i].Description)
+		if i > 0 {
+			assert.True(t, policies[i-1].Name < policies[i].Name)
+		}
+	}
+	_, err := LookupPlayoutPolicy(DefaultPlayoutPolicy)
+	assert.Nil(t, err)
+}
+
+func TestRunPlayoutsUnknownPolicy(t *testing.T) {
+	_, err := RunPlayouts(createNearlyWonGameState(), PlayoutOptions{Policy: "not-a-policy"})
+	assert.Error(t, err)
+}
+
+// assertPlayoutsAddUp checks that every playout was either won or a dead end
+func assertPlayoutsAddUp(t *testing.T, result PlayoutResult) {
+	deadEnds := 0
+	for _, count := range result.DeadEnds {
+		deadEnds += count
+	}
+	assert.Equal(t, result.Playouts, result.Wins+deadEnds)
+	assert.InDelta(t, float64(result.Wins)/float64(result.Playouts), result.WinRate, 1e-9)
+}
+
+func TestRunPlayoutsNearlyWon(t *testing.T) {
+	start := createNearlyWonGameState()
+	pruner := newPrunerForTest(t, DefaultPruningRules...)
+	result, err := RunPlayouts(start, PlayoutOptions{Playouts: 100, Pruner: pruner})
+	assert.Nil(t, err)
+	assertPlayoutsAddUp(t, result)
+	assert.Equal(t, 100, result.Wins, "greedy play can't go wrong this close to a win")
+	assert.Equal(t, 0.0, result.AverageScore)
+	assert.True(t, result.AverageMoves >= nearlyWonSolutionLength)
+	assert.Equal(t, 0, result.BestScore)
+}
+
+func TestRunPlayoutsEachPolicy(t *testing.T) {
+	start := libgame.DealNewGame(libgame.Game{ID: 0})
+	for _, policy := range PlayoutPolicies() {
+		result, err := RunPlayouts(start, PlayoutOptions{Playouts: 20, Policy: policy.Name})
+		assert.Nil(t, err)
+		assertPlayoutsAddUp(t, result)
+		assert.True(t, result.AverageScore <= float64(start.Score), policy.Name)
+		assert.True(t, result.BestScore <= start.Score, policy.Name)
+	}
+}
+
+func TestRunPlayoutsIsRepeatable(t *testing.T) {
+	start := libgame.DealNewGame(libgame.Game{ID: 0})
+	options := PlayoutOptions{Playouts: 20, Policy: "random", Seed: 7}
+	first, err := RunPlayouts(start, options)
+	assert.Nil(t, err)
+	second, err := RunPlayouts(start, options)
+	assert.Nil(t, err)
+	assert.Equal(t, first, second)
+}
+
+func TestRunPlayoutsMoveLimit(t *testing.T) {
+	start := libgame.DealNewGame(libgame.Game{ID: 0})
+	result, err := RunPlayouts(start, PlayoutOptions{Playouts: 10, MaxMoves: 5})
+	assert.Nil(t, err)
+	assert.Equal(t, map[DeadEndCause]int{DeadEndMoveLimit: 10}, result.DeadEnds)
+	assert.Equal(t, 5.0, result.AverageMoves)
+}
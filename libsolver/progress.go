@@ -0,0 +1,114 @@
+package libsolver
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// DefaultProgressEvery is how many states a search expands between progress
+// events, when not given
+const DefaultProgressEvery = 10000
+
+// Progress is a snapshot of a running search, passed to SearchOptions.OnProgress
+type Progress struct {
+	Expanded  int64
+	Generated int64
+	BestScore int   // lowest score reached so far
+	Depth     int   // moves from the start to the state just expanded
+	Frontier  int64 // states waiting to be expanded. Always 0 for IDA*, which keeps no frontier
+	Elapsed   time.Duration
+
+	// Done is set on the last event, once the search has stopped. Depth is
+	// then the number of moves to the best state, and Solution is set if the
+	// search was Solved
+	Done     bool
+	Solved   bool
+	Solution []libgame.MoveRequest
+}
+
+// StatesPerSecond is the average number of states expanded each second
+func (p Progress) StatesPerSecond() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Expanded) / p.Elapsed.Seconds()
+}
+
+// SendProgress returns an OnProgress callback that sends each event to ch.
+//
+// Events are dropped while ch is full, rather than slowing down the search,
+// but the last event is always sent.
+func SendProgress(ch chan<- Progress) func(Progress) {
+	return func(p Progress) {
+		if p.Done {
+			ch <- p
+			return
+		}
+		select {
+		case ch <- p:
+		default:
+		}
+	}
+}
+
+// progressReporter sends a search's progress events every so many expanded
+// states. Safe for concurrent use, so that parallel workers can share one
+type progressReporter struct {
+	onProgress func(Progress)
+	every      int64
+	start      time.Time
+
+	mu   sync.Mutex // held while calling onProgress, so events arrive in order
+	next int64      // updated atomically
+}
+
+func newProgressReporter(options SearchOptions) *progressReporter {
+	every := options.ProgressEvery
+	if every <= 0 {
+		every = DefaultProgressEvery
+	}
+	return &progressReporter{
+		onProgress: options.OnProgress,
+		every:      every,
+		start:      time.Now(),
+		next:       every,
+	}
+}
+
+// due returns true if the search has expanded enough states for an event.
+// It's cheap enough to call for every state
+func (r *progressReporter) due(expanded int64) bool {
+	return r.onProgress != nil && expanded >= atomic.LoadInt64(&r.next)
+}
+
+// report sends an event, unless another worker has already sent one for
+// these states
+func (r *progressReporter) report(p Progress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !p.Done && p.Expanded < atomic.LoadInt64(&r.next) {
+		return
+	}
+	atomic.StoreInt64(&r.next, (p.Expanded/r.every+1)*r.every)
+	p.Elapsed = time.Since(r.start)
+	r.onProgress(p)
+}
+
+// done sends the last event, for the finished result
+func (r *progressReporter) done(result *SearchResult) {
+	if r.onProgress == nil {
+		return
+	}
+	r.report(Progress{
+		Expanded:  result.Expanded,
+		Generated: result.Generated,
+		BestScore: result.BestState.Score,
+		Depth:     len(result.BestPath),
+		Done:      true,
+		Solved:    result.Solved,
+		Solution:  result.Solution,
+	})
+}
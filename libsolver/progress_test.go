@@ -0,0 +1,88 @@
+package libsolver
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// searches runs each search with the same options
+var searches = map[string]func(libgame.GameState, SearchOptions) (SearchResult, error){
+	"idastar": func(state libgame.GameState, options SearchOptions) (SearchResult, error) {
+		return SolveIDAStar(state, IDAStarOptions{SearchOptions: options})
+	},
+	"beam": func(state libgame.GameState, options SearchOptions) (SearchResult, error) {
+		return SolveBeam(state, BeamOptions{SearchOptions: options})
+	},
+	"parallel": func(state libgame.GameState, options SearchOptions) (SearchResult, error) {
+		return SolveParallel(state, ParallelOptions{SearchOptions: options, Workers: 4})
+	},
+	"disk": func(state libgame.GameState, options SearchOptions) (SearchResult, error) {
+		return SolveDisk(state, DiskOptions{SearchOptions: options})
+	},
+}
+
+func TestSearchesReportProgress(t *testing.T) {
+	start := createPysolGameState(t, 1)
+	for name, solve := range searches {
+		var mu sync.Mutex
+		var events []Progress
+		result, err := solve(start, SearchOptions{
+			MaxExpanded:   1000,
+			ProgressEvery: 100,
+			OnProgress: func(p Progress) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, p)
+			},
+		})
+		assert.Nil(t, err, name)
+
+		assert.True(t, len(events) >= 5, "%s sent %d events", name, len(events))
+		for i, p := range events[:len(events)-1] {
+			assert.False(t, p.Done, name)
+			assert.True(t, p.Expanded >= int64(100*(i+1)), "%s event %d", name, i)
+			assert.True(t, p.BestScore <= start.Score, name)
+			if i > 0 {
+				assert.True(t, p.Expanded > events[i-1].Expanded, name)
+			}
+		}
+		last := events[len(events)-1]
+		assert.True(t, last.Done, name)
+		assert.Equal(t, result.Expanded, last.Expanded, name)
+		assert.Equal(t, result.BestState.Score, last.BestScore, name)
+		assert.Equal(t, len(result.BestPath), last.Depth, name)
+		assert.False(t, last.Solved, name)
+	}
+}
+
+func TestSearchesReportSolution(t *testing.T) {
+	start := createNearlyWonGameState()
+	for name, solve := range searches {
+		var last Progress
+		result, err := solve(start, SearchOptions{OnProgress: func(p Progress) { last = p }})
+		assert.Nil(t, err, name)
+		assert.True(t, last.Done, name)
+		assert.True(t, last.Solved, name)
+		assert.Equal(t, result.Solution, last.Solution, name)
+		assert.Equal(t, 0, last.BestScore, name)
+	}
+}
+
+func TestSendProgress(t *testing.T) {
+	ch := make(chan Progress, 1)
+	send := SendProgress(ch)
+	send(Progress{Expanded: 1})
+	send(Progress{Expanded: 2}) // dropped, since the channel is full
+	assert.EqualValues(t, 1, (<-ch).Expanded)
+
+	go send(Progress{Expanded: 3, Done: true})
+	assert.True(t, (<-ch).Done)
+}
+
+func TestStatesPerSecond(t *testing.T) {
+	assert.Equal(t, 0.0, Progress{Expanded: 10}.StatesPerSecond())
+	assert.Equal(t, 5.0, Progress{Expanded: 10, Elapsed: 2e9}.StatesPerSecond())
+}
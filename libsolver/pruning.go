@@ -0,0 +1,184 @@
+package libsolver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// PruningRule decides whether a move should be skipped during search.
+//
+// Rules cull moves that are likely to result in "shifting" of cards but not
+// really going anywhere.
+type PruningRule struct {
+	Name        string
+	Description string
+
+	// ShouldPrune returns true if the move should be skipped. lastMove is the
+	// move that created state, or nil if it isn't known.
+	ShouldPrune func(state *libgame.GameState, move libgame.MoveRequest, lastMove *libgame.MoveRequest) bool
+}
+
+// pruningRules is the registry of all the rules a Pruner can use
+var pruningRules = []PruningRule{
+	{
+		Name:        "foundation-to-foundation",
+		Description: "don't keep just shifting cards between foundations",
+		ShouldPrune: func(state *libgame.GameState, move libgame.MoveRequest, lastMove *libgame.MoveRequest) bool {
+			return move.FromPile == libgame.FOUNDATION && move.ToPile == libgame.FOUNDATION
+		},
+	},
+	{
+		Name:        "foundation-down",
+		Description: "don't let any cards come down from foundations",
+		ShouldPrune: func(state *libgame.GameState, move libgame.MoveRequest, lastMove *libgame.MoveRequest) bool {
+			return move.FromPile == libgame.FOUNDATION
+		},
+	},
+	{
+		Name:        "reverse-last-move",
+		Description: "don't move a card straight back to where it came from",
+		ShouldPrune: func(state *libgame.GameState, move libgame.MoveRequest, lastMove *libgame.MoveRequest) bool {
+			return lastMove != nil &&
+				move.FromPile == lastMove.ToPile && move.FromIndex == lastMove.ToIndex &&
+				move.ToPile == lastMove.FromPile && move.ToIndex == lastMove.FromIndex
+		},
+	},
+	{
+		Name:        "lone-card-to-empty-tableau",
+		Description: "don't move a tableau's only card onto an empty tableau",
+		ShouldPrune: func(state *libgame.GameState, move libgame.MoveRequest, lastMove *libgame.MoveRequest) bool {
+			return move.FromPile == libgame.TABLEAU && move.ToPile == libgame.TABLEAU &&
+				len(state.Tableaus[move.FromIndex].Cards) == 1 &&
+				len(state.Tableaus[move.ToIndex].Cards) == 0
+		},
+	},
+	{
+		Name:        "ordered-pile-to-empty-tableau",
+		Description: "don't split a tableau that is already in order onto an empty tableau",
+		ShouldPrune: func(state *libgame.GameState, move libgame.MoveRequest, lastMove *libgame.MoveRequest) bool {
+			return move.FromPile == libgame.TABLEAU && move.ToPile == libgame.TABLEAU &&
+				len(state.Tableaus[move.ToIndex].Cards) == 0 &&
+				isOrderedPile(state.Tableaus[move.FromIndex].Cards)
+		},
+	},
+}
+
+// DefaultPruningRules are the rules the solver has always used
+var DefaultPruningRules = []string{"foundation-to-foundation", "foundation-down"}
+
+// PruningRules returns every registered rule, sorted by name
+func PruningRules() []PruningRule {
+	rules := make([]PruningRule, len(pruningRules))
+	copy(rules, pruningRules)
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// LookupPruningRule returns the registered rule with the given name
+func LookupPruningRule(name string) (PruningRule, error) {
+	for _, rule := range pruningRules {
+		if rule.Name == name {
+			return rule, nil
+		}
+	}
+	return PruningRule{}, fmt.Errorf("Unknown pruning rule '%s'", name)
+}
+
+// ParsePruningRuleNames splits a comma separated list of rule names, as given on
+// the command line. "none" and the empty string mean no rules.
+func ParsePruningRuleNames(list string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && name != "none" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Pruner applies a set of PruningRules and counts how many moves each one prunes.
+//
+// Safe for concurrent use, as long as OnPrune is.
+type Pruner struct {
+	rules  []PruningRule
+	counts []uint64
+
+	// OnPrune, if set, is called with the name of the rule each time a move is pruned
+	OnPrune func(ruleName string)
+}
+
+// NewPruner returns a Pruner using the named rules.
+//
+// Returns error if any of the rules don't exist.
+func NewPruner(ruleNames []string) (*Pruner, error) {
+	pruner := &Pruner{}
+	for _, name := range ruleNames {
+		rule, err := LookupPruningRule(name)
+		if err != nil {
+			return nil, err
+		}
+		pruner.rules = append(pruner.rules, rule)
+	}
+	pruner.counts = make([]uint64, len(pruner.rules))
+	return pruner, nil
+}
+
+// RuleNames returns the names of the rules in use
+func (p *Pruner) RuleNames() []string {
+	names := make([]string, len(p.rules))
+	for i, rule := range p.rules {
+		names[i] = rule.Name
+	}
+	return names
+}
+
+// ShouldPrune returns true if any rule prunes the move.
+//
+// Only the first rule that prunes the move is counted. lastMove may be nil if
+// the move that created state isn't known.
+func (p *Pruner) ShouldPrune(
+	state *libgame.GameState, move libgame.MoveRequest, lastMove *libgame.MoveRequest) bool {
+	for i, rule := range p.rules {
+		if rule.ShouldPrune(state, move, lastMove) {
+			atomic.AddUint64(&p.counts[i], 1)
+			if p.OnPrune != nil {
+				p.OnPrune(rule.Name)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// PrunedCounts returns the number of moves each rule has pruned, by rule name
+func (p *Pruner) PrunedCounts() map[string]uint64 {
+	counts := make(map[string]uint64, len(p.rules))
+	for i, rule := range p.rules {
+		counts[rule.Name] = atomic.LoadUint64(&p.counts[i])
+	}
+	return counts
+}
+
+// isOrderedPile returns true if the cards are a single suit, descending by one,
+// with at least two cards
+func isOrderedPile(cards []deck.Card) bool {
+	if len(cards) < 2 {
+		return false
+	}
+	for i := 1; i < len(cards); i++ {
+		if cards[i].Suit != cards[i-1].Suit {
+			return false
+		}
+		decremented, err := deck.Decrement(cards[i-1].Face)
+		if err != nil || decremented != cards[i].Face {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package libsolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+func newPrunerForTest(t *testing.T, ruleNames ...string) *Pruner {
+	pruner, err := NewPruner(ruleNames)
+	assert.Nil(t, err)
+	return pruner
+}
+
+func TestNewPrunerUnknownRule(t *testing.T) {
+	_, err := NewPruner([]string{"foundation-down", "not-a-rule"})
+	assert.Error(t, err)
+}
+
+func TestDefaultPruningRulesExist(t *testing.T) {
+	pruner := newPrunerForTest(t, DefaultPruningRules...)
+	assert.Equal(t, DefaultPruningRules, pruner.RuleNames())
+}
+
+func TestParsePruningRuleNames(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, ParsePruningRuleNames("a, b,"))
+	assert.Empty(t, ParsePruningRuleNames(""))
+	assert.Empty(t, ParsePruningRuleNames("none"))
+}
+
+func TestPruningRulesAreSortedAndDocumented(t *testing.T) {
+	rules := PruningRules()
+	assert.Len(t, rules, len(pruningRules))
+	for i := range rules {
+		assert.NotEmpty(t, rules[i].Description)
+		if i > 0 {
+			assert.True(t, rules[i-1].Name < rules[i].Name)
+		}
+	}
+}
+
+func TestDefaultPruningRulesKeepGoodMoves(t *testing.T) {
+	state := libgame.DealNewGame(libgame.Game{})
+	pruner := newPrunerForTest(t, DefaultPruningRules...)
+	for _, move := range []libgame.MoveRequest{
+		{libgame.TABLEAU, 0, libgame.TABLEAU, 0},
+		{libgame.TABLEAU, 0, libgame.FOUNDATION, 0},
+		{libgame.STOCK, 0, libgame.TABLEAU, 0},
+		{libgame.STOCK, 0, libgame.FOUNDATION, 0},
+		{libgame.STOCK, 0, libgame.WASTE, 0},
+	} {
+		assert.False(t, pruner.ShouldPrune(&state, move, nil), "%v", move)
+	}
+}
+
+func TestDefaultPruningRulesSkipBadMoves(t *testing.T) {
+	state := libgame.DealNewGame(libgame.Game{})
+	pruner := newPrunerForTest(t, DefaultPruningRules...)
+	for _, move := range []libgame.MoveRequest{
+		{libgame.FOUNDATION, 0, libgame.FOUNDATION, 0},
+		{libgame.FOUNDATION, 0, libgame.TABLEAU, 0},
+	} {
+		assert.True(t, pruner.ShouldPrune(&state, move, nil), "%v", move)
+	}
+}
+
+func TestPruneFoundationMoves(t *testing.T) {
+	state := createEmptyGameState()
+	toFoundation := libgame.MoveRequest{libgame.FOUNDATION, 0, libgame.FOUNDATION, 1}
+	toTableau := libgame.MoveRequest{libgame.FOUNDATION, 0, libgame.TABLEAU, 0}
+	upToFoundation := libgame.MoveRequest{libgame.TABLEAU, 0, libgame.FOUNDATION, 0}
+
+	pruner := newPrunerForTest(t, "foundation-to-foundation")
+	assert.True(t, pruner.ShouldPrune(&state, toFoundation, nil))
+	assert.False(t, pruner.ShouldPrune(&state, toTableau, nil))
+	assert.False(t, pruner.ShouldPrune(&state, upToFoundation, nil))
+
+	pruner = newPrunerForTest(t, "foundation-down")
+	assert.True(t, pruner.ShouldPrune(&state, toFoundation, nil))
+	assert.True(t, pruner.ShouldPrune(&state, toTableau, nil))
+	assert.False(t, pruner.ShouldPrune(&state, upToFoundation, nil))
+}
+
+func TestPruneReverseLastMove(t *testing.T) {
+	state := createEmptyGameState()
+	pruner := newPrunerForTest(t, "reverse-last-move")
+	lastMove := libgame.MoveRequest{libgame.TABLEAU, 2, libgame.TABLEAU, 5}
+
+	assert.True(t, pruner.ShouldPrune(
+		&state, libgame.MoveRequest{libgame.TABLEAU, 5, libgame.TABLEAU, 2}, &lastMove))
+	assert.False(t, pruner.ShouldPrune(
+		&state, libgame.MoveRequest{libgame.TABLEAU, 5, libgame.TABLEAU, 3}, &lastMove))
+	assert.False(t, pruner.ShouldPrune(
+		&state, libgame.MoveRequest{libgame.TABLEAU, 5, libgame.TABLEAU, 2}, nil),
+		"we can't prune without knowing the last move")
+}
+
+func TestPruneMovesToEmptyTableaus(t *testing.T) {
+	state := createEmptyGameState()
+	state.Tableaus[0].Cards = []deck.Card{deck.Card{Face: deck.FIVE, Suit: deck.CLUB}}
+	state.Tableaus[1].Cards = []deck.Card{
+		deck.Card{Face: deck.SIX, Suit: deck.CLUB},
+		deck.Card{Face: deck.FIVE, Suit: deck.CLUB}}
+	state.Tableaus[2].Cards = []deck.Card{
+		deck.Card{Face: deck.SIX, Suit: deck.HEART},
+		deck.Card{Face: deck.FIVE, Suit: deck.CLUB}}
+	loneCard := libgame.MoveRequest{libgame.TABLEAU, 0, libgame.TABLEAU, 9}
+	orderedPile := libgame.MoveRequest{libgame.TABLEAU, 1, libgame.TABLEAU, 9}
+	unorderedPile := libgame.MoveRequest{libgame.TABLEAU, 2, libgame.TABLEAU, 9}
+
+	pruner := newPrunerForTest(t, "lone-card-to-empty-tableau")
+	assert.True(t, pruner.ShouldPrune(&state, loneCard, nil))
+	assert.False(t, pruner.ShouldPrune(&state, orderedPile, nil))
+	assert.False(t, pruner.ShouldPrune(&state, unorderedPile, nil))
+
+	pruner = newPrunerForTest(t, "ordered-pile-to-empty-tableau")
+	assert.False(t, pruner.ShouldPrune(&state, loneCard, nil))
+	assert.True(t, pruner.ShouldPrune(&state, orderedPile, nil))
+	assert.False(t, pruner.ShouldPrune(&state, unorderedPile, nil))
+}
+
+func TestPrunerCountsFirstMatchingRule(t *testing.T) {
+	state := createEmptyGameState()
+	pruner := newPrunerForTest(t, "foundation-to-foundation", "foundation-down")
+	pruned := make([]string, 0)
+	pruner.OnPrune = func(ruleName string) {
+		pruned = append(pruned, ruleName)
+	}
+
+	pruner.ShouldPrune(&state, libgame.MoveRequest{libgame.FOUNDATION, 0, libgame.FOUNDATION, 1}, nil)
+	pruner.ShouldPrune(&state, libgame.MoveRequest{libgame.FOUNDATION, 0, libgame.TABLEAU, 1}, nil)
+	pruner.ShouldPrune(&state, libgame.MoveRequest{libgame.FOUNDATION, 0, libgame.TABLEAU, 2}, nil)
+	pruner.ShouldPrune(&state, libgame.MoveRequest{libgame.TABLEAU, 0, libgame.TABLEAU, 2}, nil)
+
+	assert.Equal(t, map[string]uint64{
+		"foundation-to-foundation": 1,
+		"foundation-down":          2,
+	}, pruner.PrunedCounts())
+	assert.Equal(t,
+		[]string{"foundation-to-foundation", "foundation-down", "foundation-down"}, pruned)
+}
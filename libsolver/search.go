@@ -0,0 +1,337 @@
+package libsolver
+
+import (
+	"fmt"
+
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// FlipStockMove is the move that flips a card from the stock to the waste.
+//
+// MoveCard doesn't accept it; use ApplyMove to apply moves from a solution.
+var FlipStockMove = libgame.MoveRequest{
+	FromPile:  libgame.STOCK,
+	FromIndex: 0,
+	ToPile:    libgame.WASTE,
+	ToIndex:   0,
+}
+
+// ApplyMove applies a move from a search to the state, flipping the stock if it
+// is FlipStockMove. Updates the game state (including score and IDs).
+func ApplyMove(state *libgame.GameState, move libgame.MoveRequest) error {
+	if move == FlipStockMove {
+		return state.FlipStock()
+	}
+	return state.MoveCard(move)
+}
+
+// ApplyMoves applies each of the moves in turn to a copy of the state.
+//
+// Returns the final state, or an error if any of the moves are illegal.
+func ApplyMoves(state libgame.GameState, moves []libgame.MoveRequest) (libgame.GameState, error) {
+	state = state.Copy()
+	for i, move := range moves {
+		if err := ApplyMove(&state, move); err != nil {
+			return state, fmt.Errorf("Error applying move %d (%v): %v", i, move, err)
+		}
+	}
+	return state, nil
+}
+
+// SearchOptions configures the in-memory searches
+type SearchOptions struct {
+	// Pruner skips moves during expansion. nil to expand every legal move
+	Pruner *Pruner
+
+	// MoveOrdering, if set, expands the most promising moves first
+	MoveOrdering *MoveOrderingWeights
+
+	// MaxExpanded stops the search after expanding this many states. 0 for no limit
+	MaxExpanded int64
+
+	// PruneLost skips states that ProvablyLost says can't be won
+	PruneLost bool
+
+	// OnProgress, if set, is called every ProgressEvery expanded states, and
+	// once more when the search stops. Searches with many workers call it from
+	// each of them, but never at the same time
+	OnProgress func(Progress)
+
+	// ProgressEvery defaults to DefaultProgressEvery
+	ProgressEvery int64
+
+	// Checkpoint, if set, is the file the search saves its progress to every
+	// CheckpointEvery expanded states and when it stops. Each search has a
+	// Resume function, like ResumeBeam for SolveBeam, that carries on from it
+	Checkpoint string
+
+	// CheckpointEvery defaults to DefaultCheckpointEvery
+	CheckpointEvery int64
+
+	// Cancel, if set, stops the search once it's closed, as if it had hit
+	// MaxExpanded
+	Cancel <-chan struct{}
+}
+
+// stopped returns true if a search that has expanded this many states should
+// stop, because it has hit MaxExpanded or been cancelled
+func (o *SearchOptions) stopped(expanded int64) bool {
+	if o.MaxExpanded > 0 && expanded >= o.MaxExpanded {
+		return true
+	}
+	return o.cancelled()
+}
+
+// cancelled returns true once Cancel has been closed
+func (o *SearchOptions) cancelled() bool {
+	select {
+	case <-o.Cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// SearchResult is the outcome of an in-memory search
+type SearchResult struct {
+	Solved   bool
+	Solution []libgame.MoveRequest // moves from the starting state to a win, if Solved
+
+	// BestState is the lowest scoring state reached, and BestPath the moves to it
+	BestState libgame.GameState
+	BestPath  []libgame.MoveRequest
+
+	Expanded  int64 // number of states whose children were generated
+	Generated int64 // number of children generated, before any were skipped
+}
+
+// BranchingFactor is the average number of children of each expanded state
+func (r *SearchResult) BranchingFactor() float64 {
+	if r.Expanded == 0 {
+		return 0
+	}
+	return float64(r.Generated) / float64(r.Expanded)
+}
+
+// finish fills in BestState by replaying BestPath from the starting state
+func (r *SearchResult) finish(start libgame.GameState) error {
+	bestState, err := ApplyMoves(start, r.BestPath)
+	if err != nil {
+		return err
+	}
+	r.BestState = bestState
+	return nil
+}
+
+// searchNode is a state in a search tree, linked back to the state it came from
+type searchNode struct {
+	state    libgame.GameState
+	parent   *searchNode
+	move     libgame.MoveRequest
+	depth    int
+	estimate int
+}
+
+// path returns the moves from the starting state to the node
+func (n *searchNode) path() []libgame.MoveRequest {
+	path := make([]libgame.MoveRequest, n.depth)
+	for node := n; node.parent != nil; node = node.parent {
+		path[node.depth-1] = node.move
+	}
+	return path
+}
+
+// FNV-1a parameters, for hashing game states without allocating
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// FindMove finds the move that takes the state to next, like a saved game
+// state and one of its children. Returns false if no single move does.
+func FindMove(state libgame.GameState, next libgame.GameState) (libgame.MoveRequest, bool) {
+	moves := GetPossibleMoves(&state)
+	if len(state.Stock.Cards) > 0 {
+		moves = append(moves, FlipStockMove)
+	}
+	nextHash := HashGameState(&next)
+	for _, move := range moves {
+		child := state.Copy()
+		if ApplyMove(&child, move) == nil && HashGameState(&child) == nextHash {
+			return move, true
+		}
+	}
+	return libgame.MoveRequest{}, false
+}
+
+// HashGameState returns a 64-bit FNV-1a hash of the cards in each pile of the state.
+//
+// Two states with the same cards in the same piles hash the same, regardless of
+// their IDs or move numbers.
+func HashGameState(state *libgame.GameState) uint64 {
+	hash := uint64(fnvOffset64)
+	hashDeck := func(d *deck.Deck) {
+		for _, card := range d.Cards {
+			hash ^= uint64(cardByte(card))
+			hash *= fnvPrime64
+		}
+		// pile separator
+		hash ^= 0xff
+		hash *= fnvPrime64
+	}
+	hashDeck(&state.Stock)
+	hashDeck(&state.Waste)
+	for i := range state.Foundations {
+		hashDeck(&state.Foundations[i])
+	}
+	for i := range state.Tableaus {
+		hashDeck(&state.Tableaus[i])
+	}
+	return hash
+}
+
+// cardByte packs a card's suit and rank into a byte
+func cardByte(card deck.Card) byte {
+	return byte(suitIndexes[card.Suit]<<4 | faceRanks[card.Face])
+}
+
+// heuristic is a lower bound on the number of moves left to win the game.
+//
+// Every card not on a foundation must move at least once, and stock cards must
+// also be flipped first.
+func heuristic(state *libgame.GameState) int {
+	return state.Score + len(state.Stock.Cards)
+}
+
+// searchState is a GameState that can make and unmake moves in place, for
+// searches that walk the tree depth first.
+//
+// Moves don't touch the state's IDs or move number.
+type searchState struct {
+	state libgame.GameState
+
+	// stock is the starting stock. Flips only ever take cards off the front of
+	// the stock, so undoing one re-slices it
+	stock []deck.Card
+}
+
+// newSearchState copies the state for searching
+func newSearchState(state libgame.GameState) *searchState {
+	s := &searchState{state: state.Copy()}
+	s.stock = s.state.Stock.Cards
+	return s
+}
+
+// pileFor returns the deck for a pile location
+func (s *searchState) pileFor(location libgame.PileLocation, index int) *deck.Deck {
+	switch location {
+	case libgame.TABLEAU:
+		return &s.state.Tableaus[index]
+	case libgame.FOUNDATION:
+		return &s.state.Foundations[index]
+	case libgame.WASTE:
+		return &s.state.Waste
+	default:
+		return &s.state.Stock
+	}
+}
+
+// do makes a move that is known to be legal
+func (s *searchState) do(move libgame.MoveRequest) {
+	if move == FlipStockMove {
+		stock := &s.state.Stock
+		s.state.Waste.Cards = append(s.state.Waste.Cards, stock.Cards[0])
+		stock.Cards = stock.Cards[1:]
+		return
+	}
+	s.moveTopCard(s.pileFor(move.FromPile, move.FromIndex), s.pileFor(move.ToPile, move.ToIndex))
+	s.updateScore(move, 1)
+}
+
+// undo reverses a move made by do
+func (s *searchState) undo(move libgame.MoveRequest) {
+	if move == FlipStockMove {
+		waste := &s.state.Waste
+		waste.Cards = waste.Cards[:len(waste.Cards)-1]
+		s.state.Stock.Cards = s.stock[len(s.stock)-len(s.state.Stock.Cards)-1:]
+		return
+	}
+	s.moveTopCard(s.pileFor(move.ToPile, move.ToIndex), s.pileFor(move.FromPile, move.FromIndex))
+	s.updateScore(move, -1)
+}
+
+func (s *searchState) moveTopCard(from *deck.Deck, to *deck.Deck) {
+	to.Cards = append(to.Cards, from.Cards[len(from.Cards)-1])
+	from.Cards = from.Cards[:len(from.Cards)-1]
+}
+
+// updateScore keeps the score in step with cards moving on and off foundations.
+// direction is 1 for do and -1 for undo
+func (s *searchState) updateScore(move libgame.MoveRequest, direction int) {
+	fromFoundation := move.FromPile == libgame.FOUNDATION
+	toFoundation := move.ToPile == libgame.FOUNDATION
+	if toFoundation && !fromFoundation {
+		s.state.Score -= direction
+	} else if fromFoundation && !toFoundation {
+		s.state.Score += direction
+	}
+}
+
+// expander generates the children of states for the searches.
+//
+// Not safe for concurrent use. Each worker should have its own.
+type expander struct {
+	generator *MoveGenerator
+	orderer   *MoveOrderer
+	pruner    *Pruner
+}
+
+func newExpander(options SearchOptions) *expander {
+	e := &expander{
+		generator: NewMoveGenerator(),
+		pruner:    options.Pruner,
+	}
+	if options.MoveOrdering != nil {
+		e.orderer = NewMoveOrderer(*options.MoveOrdering)
+	}
+	return e
+}
+
+// appendMoves appends the moves to expand from the state onto buf, including
+// a stock flip if possible. lastMove is the move that created the state, or nil
+func (e *expander) appendMoves(
+	buf []libgame.MoveRequest, state *libgame.GameState,
+	lastMove *libgame.MoveRequest) []libgame.MoveRequest {
+	start := len(buf)
+	firstEmpty := firstEmptyTableau(state)
+	for _, move := range e.generator.PossibleMoves(state) {
+		// every empty tableau is the same, so we only need to try one of them
+		if move.ToPile == libgame.TABLEAU && move.ToIndex != firstEmpty &&
+			len(state.Tableaus[move.ToIndex].Cards) == 0 {
+			continue
+		}
+		if e.pruner != nil && e.pruner.ShouldPrune(state, move, lastMove) {
+			continue
+		}
+		buf = append(buf, move)
+	}
+	if e.orderer != nil {
+		e.orderer.Order(state, buf[start:])
+	}
+	// flipping the stock goes last, once the visible cards have been tried
+	if len(state.Stock.Cards) > 0 {
+		buf = append(buf, FlipStockMove)
+	}
+	return buf
+}
+
+// firstEmptyTableau returns the index of the first empty tableau, or -1
+func firstEmptyTableau(state *libgame.GameState) int {
+	for i := range state.Tableaus {
+		if len(state.Tableaus[i].Cards) == 0 {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,175 @@
+package libsolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+var testSuits = []deck.Suit{deck.CLUB, deck.DIAMOND, deck.HEART, deck.SPADE}
+
+// createNearlyWonGameState returns a valid state with only four cards left to
+// play. The king of diamonds is in the stock, and both kings of clubs are on top
+// of the queen of clubs, so one of them has to be moved out of the way onto an
+// empty tableau first.
+func createNearlyWonGameState() libgame.GameState {
+	state := createEmptyGameState()
+	for i := range state.Foundations {
+		suit := testSuits[i%len(testSuits)]
+		top := deck.KING
+		switch i {
+		case 0:
+			top = deck.JACK
+		case 1, 4:
+			top = deck.QUEEN
+		}
+		face := deck.ACE
+		for {
+			state.Foundations[i].Cards = append(
+				state.Foundations[i].Cards, deck.Card{Face: face, Suit: suit})
+			if face == top {
+				break
+			}
+			face, _ = deck.Increment(face)
+		}
+	}
+	state.Tableaus[0].Cards = []deck.Card{
+		deck.Card{Face: deck.QUEEN, Suit: deck.CLUB},
+		deck.Card{Face: deck.KING, Suit: deck.CLUB},
+		deck.Card{Face: deck.KING, Suit: deck.CLUB}}
+	state.Stock.Cards = []deck.Card{deck.Card{Face: deck.KING, Suit: deck.DIAMOND}}
+	state.Score = 4
+	return state
+}
+
+// nearlyWonSolutionLength is the fewest moves that win createNearlyWonGameState
+const nearlyWonSolutionLength = 6
+
+func TestNearlyWonGameStateIsValid(t *testing.T) {
+	state := createNearlyWonGameState()
+	assert.Nil(t, state.Validate())
+}
+
+func TestApplyMoves(t *testing.T) {
+	state := createNearlyWonGameState()
+	moves := []libgame.MoveRequest{
+		FlipStockMove,
+		libgame.MoveRequest{libgame.WASTE, 0, libgame.FOUNDATION, 1},
+	}
+	newState, err := ApplyMoves(state, moves)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, newState.Score)
+	assert.Empty(t, newState.Stock.Cards)
+	assert.EqualValues(t, 2, newState.MoveNum)
+	assert.Equal(t, 4, state.Score, "the original state is untouched")
+
+	_, err = ApplyMoves(state, []libgame.MoveRequest{
+		libgame.MoveRequest{libgame.WASTE, 0, libgame.FOUNDATION, 0}})
+	assert.Error(t, err)
+}
+
+func TestHashGameState(t *testing.T) {
+	state := libgame.DealNewGame(libgame.Game{ID: 0})
+	copied := state.Copy()
+	copied.FlipStock()
+	assert.NotEqual(t, HashGameState(&state), HashGameState(&copied))
+
+	// IDs and move numbers don't change the hash
+	copied = state.Copy()
+	copied.MoveNum = 10
+	copied.GameID = 10
+	assert.Equal(t, HashGameState(&state), HashGameState(&copied))
+
+	// a card moving between piles does
+	copied.Tableaus[1].Cards = append(copied.Tableaus[1].Cards, copied.Tableaus[0].Cards[3])
+	copied.Tableaus[0].Cards = copied.Tableaus[0].Cards[:3]
+	assert.NotEqual(t, HashGameState(&state), HashGameState(&copied))
+}
+
+func TestFindMove(t *testing.T) {
+	state := createNearlyWonGameState()
+	for _, move := range []libgame.MoveRequest{
+		FlipStockMove,
+		libgame.MoveRequest{libgame.TABLEAU, 0, libgame.TABLEAU, 2},
+	} {
+		next, err := ApplyMoves(state, []libgame.MoveRequest{move})
+		assert.Nil(t, err)
+		found, ok := FindMove(state, next)
+		assert.True(t, ok)
+		assert.Equal(t, move, found)
+	}
+
+	// two moves away isn't a child
+	next, err := ApplyMoves(state, []libgame.MoveRequest{
+		FlipStockMove,
+		libgame.MoveRequest{libgame.WASTE, 0, libgame.FOUNDATION, 1},
+	})
+	assert.Nil(t, err)
+	_, ok := FindMove(state, next)
+	assert.False(t, ok)
+}
+
+func TestSearchStateDoAndUndo(t *testing.T) {
+	for _, start := range randomGameStates(5, 100) {
+		s := newSearchState(start)
+		moves := NewMoveGenerator().PossibleMoves(&s.state)
+		moves = append(moves, FlipStockMove)
+		for _, move := range moves {
+			if move == FlipStockMove && len(s.state.Stock.Cards) == 0 {
+				continue
+			}
+			expected, err := ApplyMoves(start, []libgame.MoveRequest{move})
+			assert.Nil(t, err)
+
+			s.do(move)
+			assert.Equal(t, HashGameState(&expected), HashGameState(&s.state))
+			assert.Equal(t, expected.Score, s.state.Score)
+			s.undo(move)
+			assert.Equal(t, HashGameState(&start), HashGameState(&s.state))
+			assert.Equal(t, start.Score, s.state.Score)
+		}
+	}
+}
+
+func TestExpanderTriesOneEmptyTableau(t *testing.T) {
+	state := createNearlyWonGameState()
+	moves := newExpander(SearchOptions{}).appendMoves(nil, &state, nil)
+	tableauMoves := make([]libgame.MoveRequest, 0)
+	for _, move := range moves {
+		if move.FromPile == libgame.TABLEAU && move.ToPile == libgame.TABLEAU {
+			tableauMoves = append(tableauMoves, move)
+		}
+	}
+	assert.Equal(t, []libgame.MoveRequest{
+		libgame.MoveRequest{libgame.TABLEAU, 0, libgame.TABLEAU, 1}}, tableauMoves)
+	assert.Equal(t, FlipStockMove, moves[len(moves)-1])
+}
+
+func TestSearchesStopWhenCancelled(t *testing.T) {
+	cancel := make(chan struct{})
+	close(cancel)
+	options := SearchOptions{Cancel: cancel}
+	start := createPysolGameState(t, 1)
+	searches := map[string]func() (SearchResult, error){
+		"idastar": func() (SearchResult, error) {
+			return SolveIDAStar(start, IDAStarOptions{SearchOptions: options})
+		},
+		"beam": func() (SearchResult, error) {
+			return SolveBeam(start, BeamOptions{SearchOptions: options})
+		},
+		"parallel": func() (SearchResult, error) {
+			return SolveParallel(start, ParallelOptions{SearchOptions: options})
+		},
+		"disk": func() (SearchResult, error) {
+			return SolveDisk(start, DiskOptions{SearchOptions: options})
+		},
+	}
+	for name, solve := range searches {
+		result, err := solve()
+		assert.Nil(t, err, name)
+		assert.False(t, result.Solved, name)
+		assert.EqualValues(t, 0, result.Expanded, name)
+	}
+}
@@ -0,0 +1,249 @@
+package libsolver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// searchCheckpointVersion changes whenever the in-memory searches' checkpoint
+// format does
+const searchCheckpointVersion = 1
+
+// searchCheckpoint is the start of an in-memory search's checkpoint file. It's
+// followed by the visited hashes, then the transposition table's entries.
+//
+// Each search fills in the parts it uses.
+type searchCheckpoint struct {
+	Version int
+	Search  string // the search that saved the checkpoint: idastar, beam or parallel
+	Start   libgame.GameState
+	checkpointRules
+
+	Expanded  int64
+	Generated int64
+	Done      bool // true if the search finished, instead of being stopped
+	Solved    bool
+
+	// Nodes are the beam and parallel searches' nodes that are still needed,
+	// parents first. The rest of the search refers to them by index
+	Nodes    []savedNode
+	Best     int
+	Frontier []int // the beam's nodes left in its layer, or the parallel search's heap
+	Children []int // the beam's children so far of its layer
+	Depth    int   // the beam's layer
+	Width    int   // the beam's width, which a resumed beam must match
+	// Batches are the parallel workers' batches that were stopped part way
+	Batches []savedBatch
+
+	// IDA* keeps its path, with where it was in the moves at each depth
+	TranspositionTableSize int
+	Iteration              int
+	Bound                  int
+	Path                   []libgame.MoveRequest
+	Frames                 []idaStarFrame
+	BestScore              int
+	BestPath               []libgame.MoveRequest
+
+	VisitedHashes int64
+	TableEntries  int64
+}
+
+// savedNode is a searchNode in a checkpoint. Parent is the index of its parent
+// in the checkpoint's Nodes, or -1 for the starting state
+type savedNode struct {
+	Parent int
+	Move   libgame.MoveRequest
+}
+
+// savedBatch is the part of a parallel worker's batch that it hadn't expanded
+// yet, and the children of the part it had
+type savedBatch struct {
+	Nodes    []int
+	Children []int
+}
+
+// nodeSaver flattens search nodes, and their ancestors, into savedNodes
+type nodeSaver struct {
+	nodes   []savedNode
+	indexes map[*searchNode]int
+}
+
+func newNodeSaver() *nodeSaver {
+	return &nodeSaver{nodes: []savedNode{}, indexes: make(map[*searchNode]int)}
+}
+
+// save returns the node's index, saving it and its ancestors if they aren't already
+func (s *nodeSaver) save(node *searchNode) int {
+	if index, ok := s.indexes[node]; ok {
+		return index
+	}
+	parent := -1
+	if node.parent != nil {
+		parent = s.save(node.parent)
+	}
+	s.nodes = append(s.nodes, savedNode{Parent: parent, Move: node.move})
+	s.indexes[node] = len(s.nodes) - 1
+	return len(s.nodes) - 1
+}
+
+// saveAll returns the indexes of each of the nodes
+func (s *nodeSaver) saveAll(nodes []*searchNode) []int {
+	indexes := make([]int, len(nodes))
+	for i, node := range nodes {
+		indexes[i] = s.save(node)
+	}
+	return indexes
+}
+
+// restoreNodes rebuilds saved nodes by replaying their moves from the start
+func restoreNodes(start libgame.GameState, saved []savedNode, h Heuristic) ([]*searchNode, error) {
+	nodes := make([]*searchNode, len(saved))
+	for i, s := range saved {
+		if s.Parent < 0 {
+			nodes[i] = &searchNode{state: start.Copy()}
+		} else {
+			if s.Parent >= i {
+				return nil, fmt.Errorf("Checkpoint node %d comes before its parent", i)
+			}
+			parent := nodes[s.Parent]
+			child := newSearchState(parent.state)
+			child.do(s.Move)
+			nodes[i] = &searchNode{
+				state:  child.state,
+				parent: parent,
+				move:   s.Move,
+				depth:  parent.depth + 1,
+			}
+		}
+		nodes[i].estimate = h.Estimate(&nodes[i].state)
+	}
+	return nodes, nil
+}
+
+// pickNodes returns the nodes at the indexes
+func pickNodes(nodes []*searchNode, indexes []int) ([]*searchNode, error) {
+	picked := make([]*searchNode, len(indexes))
+	for i, index := range indexes {
+		if index < 0 || index >= len(nodes) {
+			return nil, fmt.Errorf("Checkpoint has no node %d", index)
+		}
+		picked[i] = nodes[index]
+	}
+	return picked, nil
+}
+
+// checkpointer decides when an in-memory search is due a checkpoint
+type checkpointer struct {
+	path  string
+	every int64
+	last  int64 // states expanded at the last checkpoint
+}
+
+func newCheckpointer(options SearchOptions, expanded int64) checkpointer {
+	every := options.CheckpointEvery
+	if every <= 0 {
+		every = DefaultCheckpointEvery
+	}
+	return checkpointer{path: options.Checkpoint, every: every, last: expanded}
+}
+
+// due returns true if the search has expanded enough states since the last
+// checkpoint. It's cheap enough to call for every state
+func (c *checkpointer) due(expanded int64) bool {
+	return c.path != "" && expanded-c.last >= c.every
+}
+
+// write saves the checkpoint, with the hashes and the writeTable function's
+// table entries after it. Either may be nil
+func (c *checkpointer) write(
+	header *searchCheckpoint, hashes func(func(uint64)),
+	writeTable func(io.Writer) error) error {
+	c.last = header.Expanded
+	header.Version = searchCheckpointVersion
+	return writeCheckpointFile(c.path, func(w io.Writer) error {
+		if err := writeCheckpointHeader(w, header); err != nil {
+			return err
+		}
+		if hashes != nil {
+			var buf [8]byte
+			var err error
+			hashes(func(hash uint64) {
+				if err == nil {
+					binary.LittleEndian.PutUint64(buf[:], hash)
+					_, err = w.Write(buf[:])
+				}
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if writeTable != nil {
+			return writeTable(w)
+		}
+		return nil
+	})
+}
+
+// readSearchCheckpoint reads the header of the in-memory search's checkpoint
+// at path, and checks that it was saved by the search with the same rules.
+//
+// The hashes are passed to addHash, and the rest of the file is left for the
+// caller in the returned reader, which must be closed.
+func readSearchCheckpoint(
+	path string, search string, rules checkpointRules,
+	addHash func(uint64)) (*searchCheckpoint, *bufio.Reader, io.Closer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Error opening checkpoint: %v", err)
+	}
+	fail := func(err error) (*searchCheckpoint, *bufio.Reader, io.Closer, error) {
+		file.Close()
+		return nil, nil, nil, err
+	}
+	r := bufio.NewReader(file)
+
+	var header searchCheckpoint
+	if err := readCheckpointJSON(r, &header); err != nil {
+		return fail(err)
+	}
+	if header.Version != searchCheckpointVersion {
+		return fail(fmt.Errorf("Checkpoint is version %d, but we can only read version %d",
+			header.Version, searchCheckpointVersion))
+	}
+	if header.Search != search {
+		return fail(fmt.Errorf("Checkpoint was saved by the %s search, not %s", header.Search, search))
+	}
+	if err := header.check(rules); err != nil {
+		return fail(err)
+	}
+
+	var buf [8]byte
+	for i := int64(0); i < header.VisitedHashes; i++ {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return fail(fmt.Errorf("Error reading checkpoint: %v", err))
+		}
+		addHash(binary.LittleEndian.Uint64(buf[:]))
+	}
+	return &header, r, file, nil
+}
+
+// resultFromCheckpoint is the result of a search that had finished when it
+// saved the checkpoint
+func resultFromCheckpoint(header *searchCheckpoint, bestPath []libgame.MoveRequest) (SearchResult, error) {
+	result := SearchResult{
+		Solved:    header.Solved,
+		BestPath:  bestPath,
+		Expanded:  header.Expanded,
+		Generated: header.Generated,
+	}
+	if result.Solved {
+		result.Solution = result.BestPath
+	}
+	err := result.finish(header.Start)
+	return result, err
+}
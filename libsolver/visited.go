@@ -0,0 +1,87 @@
+package libsolver
+
+import (
+	"sync"
+)
+
+// DefaultVisitedShards is the number of shards used when none is given
+const DefaultVisitedShards = 64
+
+// VisitedSet is a set of state hashes that many workers can use at once.
+//
+// The set is split into shards, each with its own lock, so that workers only
+// wait on each other when they touch the same shard.
+type VisitedSet struct {
+	shards []visitedShard
+}
+
+type visitedShard struct {
+	sync.Mutex
+	hashes map[uint64]struct{}
+
+	// pad each shard out to a cache line, so that workers locking
+	// neighbouring shards don't slow each other down
+	_ [48]byte
+}
+
+// NewVisitedSet returns an empty set split into the given number of shards.
+// Defaults to DefaultVisitedShards if numShards isn't positive
+func NewVisitedSet(numShards int) *VisitedSet {
+	if numShards <= 0 {
+		numShards = DefaultVisitedShards
+	}
+	v := &VisitedSet{shards: make([]visitedShard, numShards)}
+	for i := range v.shards {
+		v.shards[i].hashes = make(map[uint64]struct{})
+	}
+	return v
+}
+
+// shard picks the shard for a hash. The low bits are used to pick the slot
+// in each shard's map, so we use the high bits here
+func (v *VisitedSet) shard(hash uint64) *visitedShard {
+	return &v.shards[(hash>>32)%uint64(len(v.shards))]
+}
+
+// Add adds the hash to the set. Returns true if it wasn't already there
+func (v *VisitedSet) Add(hash uint64) bool {
+	shard := v.shard(hash)
+	shard.Lock()
+	defer shard.Unlock()
+	if _, ok := shard.hashes[hash]; ok {
+		return false
+	}
+	shard.hashes[hash] = struct{}{}
+	return true
+}
+
+// Contains returns true if the hash is in the set
+func (v *VisitedSet) Contains(hash uint64) bool {
+	shard := v.shard(hash)
+	shard.Lock()
+	defer shard.Unlock()
+	_, ok := shard.hashes[hash]
+	return ok
+}
+
+// Len returns the number of hashes in the set
+func (v *VisitedSet) Len() int {
+	total := 0
+	for i := range v.shards {
+		v.shards[i].Lock()
+		total += len(v.shards[i].hashes)
+		v.shards[i].Unlock()
+	}
+	return total
+}
+
+// each calls f with every hash in the set, a shard at a time
+func (v *VisitedSet) each(f func(uint64)) {
+	for i := range v.shards {
+		v.shards[i].Lock()
+		for hash := range v.shards[i].hashes {
+			f(hash)
+		}
+		v.shards[i].Unlock()
+	}
+}
@@ -0,0 +1,3 @@
+ALTER TABLE game DROP COLUMN difficulty_details;
+ALTER TABLE game DROP COLUMN difficulty_rating;
+ALTER TABLE game DROP COLUMN difficulty;
@@ -0,0 +1,5 @@
+-- difficulty is only known once a game has been rated, so these stay NULL
+-- until then. the details hold the measurements the score was made from
+ALTER TABLE game ADD COLUMN difficulty DOUBLE PRECISION;
+ALTER TABLE game ADD COLUMN difficulty_rating TEXT;
+ALTER TABLE game ADD COLUMN difficulty_details JSONB;
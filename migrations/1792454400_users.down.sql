@@ -0,0 +1,3 @@
+ALTER TABLE game DROP COLUMN share_token;
+ALTER TABLE game DROP COLUMN user_id;
+DROP TABLE users;
@@ -0,0 +1,9 @@
+CREATE TABLE users (
+       id BIGSERIAL PRIMARY KEY NOT NULL,
+       email TEXT NOT NULL UNIQUE,
+       password TEXT NOT NULL
+);
+-- games dealt without logging in have no owner, and anyone can move in them.
+-- owned games can also be played by anyone with their share token
+ALTER TABLE game ADD COLUMN user_id BIGINT REFERENCES users ON DELETE CASCADE;
+ALTER TABLE game ADD COLUMN share_token TEXT UNIQUE;
@@ -0,0 +1,13 @@
+-- admins can use the solver-control routes. there's no route to make one:
+-- UPDATE users SET admin = true WHERE email = '...'
+ALTER TABLE users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT false;
+
+-- tokens are only shown once, when they're made. we keep a hash, so that a
+-- leaked database doesn't leak working tokens
+CREATE TABLE api_tokens (
+       id BIGSERIAL PRIMARY KEY NOT NULL,
+       user_id BIGINT NOT NULL REFERENCES users ON DELETE CASCADE,
+       name TEXT NOT NULL,
+       token_hash TEXT NOT NULL UNIQUE,
+       created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
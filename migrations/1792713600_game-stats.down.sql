@@ -0,0 +1,6 @@
+DROP INDEX game_user_id_idx;
+ALTER TABLE game DROP COLUMN undos;
+ALTER TABLE game DROP COLUMN hints;
+ALTER TABLE game DROP COLUMN won_moves;
+ALTER TABLE game DROP COLUMN won;
+ALTER TABLE game DROP COLUMN created;
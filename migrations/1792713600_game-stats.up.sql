@@ -0,0 +1,11 @@
+-- games from before this migration get its time as when they were dealt
+ALTER TABLE game ADD COLUMN created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+-- won and won_moves are set by the first game state that wins the game
+ALTER TABLE game ADD COLUMN won TIMESTAMP WITH TIME ZONE;
+ALTER TABLE game ADD COLUMN won_moves INTEGER;
+-- hints counts the hints asked for by players who can move in the game, and
+-- undos the moves made from game states that had already been moved from
+ALTER TABLE game ADD COLUMN hints INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE game ADD COLUMN undos INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX game_user_id_idx ON game (user_id);
@@ -0,0 +1,15 @@
+-- each user gets one attempt at each day's deal. the attempt is a game of
+-- their own, dealt from the day's seed. score and moves are set when they
+-- submit their result, from the game state they finished on
+CREATE TABLE daily_attempts (
+       id BIGSERIAL PRIMARY KEY NOT NULL,
+       date DATE NOT NULL,
+       user_id BIGINT NOT NULL REFERENCES users ON DELETE CASCADE,
+       game_id BIGINT NOT NULL REFERENCES game ON DELETE CASCADE,
+       first_game_state UUID NOT NULL,
+       started TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+       submitted TIMESTAMP WITH TIME ZONE,
+       score INTEGER,
+       moves INTEGER,
+       UNIQUE (date, user_id)
+);
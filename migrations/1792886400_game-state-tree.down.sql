@@ -0,0 +1 @@
+DROP INDEX game_state_previous_game_state_idx;
@@ -0,0 +1,2 @@
+-- game trees are walked from each game state to its children
+CREATE INDEX game_state_previous_game_state_idx ON game_state (game_id, previous_game_state);
@@ -0,0 +1,4 @@
+-- what other users see a user as. Until they choose one, they're shown by a
+-- handle made from their id, never their email
+ALTER TABLE users ADD COLUMN display_name TEXT;
+CREATE UNIQUE INDEX users_display_name_idx ON users (lower(display_name));
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/topher200/forty-thieves/libgame"
+	"github.com/topher200/forty-thieves/librender"
+	"github.com/topher200/forty-thieves/libsolver"
+)
+
+var (
+	searchPtr = flag.String(
+		"search",
+		"db",
+		"search strategy. 'db' (default) stores every state in postgres. 'idastar', "+
+			"'beam' and 'parallel' run in-memory searches over the -pysol-deals, 'disk' runs "+
+			"a search that spills to -disk-dir, and 'playouts' plays them out at random to "+
+			"estimate their win rates")
+	pysolDealsPtr = flag.String(
+		"pysol-deals",
+		"1",
+		"PySolFC deal numbers to solve with in-memory searches, as a number or range like '1-10'")
+	maxExpandedPtr = flag.Int64(
+		"max-expanded",
+		1000000,
+		"give up on a deal after expanding this many states, in in-memory searches and when rating deals. 0 for no limit")
+	transpositionTableSizePtr = flag.Int(
+		"transposition-table-size",
+		1<<20,
+		"number of states the IDA* search remembers between branches. 0 to disable")
+	beamWidthPtr = flag.Int(
+		"beam-width",
+		libsolver.DefaultBeamWidth,
+		"number of states the beam search keeps at each depth")
+	heuristicPtr = flag.String(
+		"heuristic",
+		libsolver.DefaultHeuristic,
+		"heuristic the beam, parallel and disk searches rank states with. see libsolver.Heuristics")
+	playoutsPtr = flag.Int(
+		"playouts",
+		libsolver.DefaultPlayouts,
+		"number of games to play out for each deal")
+	playoutPolicyPtr = flag.String(
+		"playout-policy",
+		libsolver.DefaultPlayoutPolicy,
+		"how playouts pick their moves. see libsolver.PlayoutPolicies")
+	workersPtr = flag.Int(
+		"workers",
+		runtime.NumCPU(),
+		"number of goroutines the parallel search expands states with")
+	diskDirPtr = flag.String(
+		"disk-dir",
+		"",
+		"directory the disk search keeps its files in. defaults to the system's temporary directory")
+	memoryStatesPtr = flag.Int(
+		"memory-states",
+		libsolver.DefaultDiskMemoryStates,
+		"number of frontier states the disk search keeps in memory")
+	memoryHashesPtr = flag.Int(
+		"memory-hashes",
+		libsolver.DefaultDiskMemoryHashes,
+		"number of visited states the disk search keeps in memory")
+	bloomBitsPerHashPtr = flag.Int(
+		"bloom-bits-per-hash",
+		libsolver.DefaultBloomBitsPerHash,
+		"bits the disk search's bloom filters of visited states use for each state")
+	checkpointDirPtr = flag.String(
+		"checkpoint-dir",
+		"",
+		"directory the idastar, beam, parallel and disk searches save a checkpoint of each deal to, "+
+			"so it can be resumed. empty to disable")
+	checkpointEveryPtr = flag.Int64(
+		"checkpoint-every",
+		libsolver.DefaultCheckpointEvery,
+		"number of states a search expands between checkpoints")
+	progressEveryPtr = flag.Int64(
+		"progress-every",
+		libsolver.DefaultProgressEvery,
+		"log the progress of in-memory searches every this many expanded states. 0 to disable")
+	resumePtr = flag.Bool(
+		"resume",
+		false,
+		"resume the search of each deal from its checkpoint in -checkpoint-dir, if it has one")
+	pictureDirPtr = flag.String(
+		"picture-dir",
+		"",
+		"directory to save a picture of the best state reached in each unsolved deal to. empty to disable")
+	pictureFormatPtr = flag.String(
+		"picture-format",
+		"png",
+		"format of the pictures saved to -picture-dir. 'png' or 'svg'")
+)
+
+// parseDealRange is a helper function for parsing a deal number or range of deal numbers
+func parseDealRange(dealRange string) (first int64, last int64, err error) {
+	parts := strings.SplitN(dealRange, "-", 2)
+	first, err = strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Error parsing first deal in '%s': %v", dealRange, err)
+	}
+	last = first
+	if len(parts) == 2 {
+		last, err = strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Error parsing last deal in '%s': %v", dealRange, err)
+		}
+	}
+	if last < first {
+		return 0, 0, fmt.Errorf("Deal range '%s' is backwards", dealRange)
+	}
+	return first, last, nil
+}
+
+// searchOptions is a helper function for building search options from the user's flags
+func searchOptions(pruner *libsolver.Pruner) libsolver.SearchOptions {
+	options := libsolver.SearchOptions{
+		Pruner:          pruner,
+		MaxExpanded:     *maxExpandedPtr,
+		PruneLost:       *pruneLostPtr,
+		CheckpointEvery: *checkpointEveryPtr,
+	}
+	if *orderMovesPtr {
+		weights := moveOrderingWeights()
+		options.MoveOrdering = &weights
+	}
+	if *progressEveryPtr > 0 {
+		options.ProgressEvery = *progressEveryPtr
+		options.OnProgress = logProgress
+	}
+	return options
+}
+
+// logProgress logs a search's progress. The final event is left to the caller
+func logProgress(p libsolver.Progress) {
+	if p.Done {
+		return
+	}
+	log.Printf("expanded %d states (%.0f/sec), best score %d, depth %d, frontier %d",
+		p.Expanded, p.StatesPerSecond(), p.BestScore, p.Depth, p.Frontier)
+}
+
+// runBatch solves each of the user's deals in memory, without touching the database
+//
+// Prints a line per deal and a summary at the end.
+func runBatch(pruner *libsolver.Pruner) {
+	first, last, err := parseDealRange(*pysolDealsPtr)
+	if err != nil {
+		panic(err)
+	}
+
+	if *searchPtr == "playouts" {
+		if *checkpointDirPtr != "" || *resumePtr {
+			panic(fmt.Errorf("Playouts can't be checkpointed or resumed."))
+		}
+		runPlayouts(first, last, pruner)
+		return
+	}
+
+	var solve func(int64, libgame.GameState) (libsolver.SearchResult, error)
+	switch *searchPtr {
+	case "idastar":
+		solve = func(dealNumber int64, state libgame.GameState) (libsolver.SearchResult, error) {
+			options := libsolver.IDAStarOptions{
+				SearchOptions:          searchOptions(pruner),
+				TranspositionTableSize: *transpositionTableSizePtr,
+			}
+			return solveCheckpointed(dealNumber, &options.SearchOptions,
+				func() (libsolver.SearchResult, error) { return libsolver.SolveIDAStar(state, options) },
+				func() (libsolver.SearchResult, error) { return libsolver.ResumeIDAStar(options) })
+		}
+	case "beam":
+		solve = func(dealNumber int64, state libgame.GameState) (libsolver.SearchResult, error) {
+			options := libsolver.BeamOptions{
+				SearchOptions: searchOptions(pruner),
+				Width:         *beamWidthPtr,
+				Heuristic:     *heuristicPtr,
+			}
+			return solveCheckpointed(dealNumber, &options.SearchOptions,
+				func() (libsolver.SearchResult, error) { return libsolver.SolveBeam(state, options) },
+				func() (libsolver.SearchResult, error) { return libsolver.ResumeBeam(options) })
+		}
+	case "parallel":
+		solve = func(dealNumber int64, state libgame.GameState) (libsolver.SearchResult, error) {
+			options := libsolver.ParallelOptions{
+				SearchOptions: searchOptions(pruner),
+				Workers:       *workersPtr,
+				Heuristic:     *heuristicPtr,
+			}
+			return solveCheckpointed(dealNumber, &options.SearchOptions,
+				func() (libsolver.SearchResult, error) { return libsolver.SolveParallel(state, options) },
+				func() (libsolver.SearchResult, error) { return libsolver.ResumeParallel(options) })
+		}
+	case "disk":
+		solve = func(dealNumber int64, state libgame.GameState) (libsolver.SearchResult, error) {
+			options := libsolver.DiskOptions{
+				SearchOptions:    searchOptions(pruner),
+				Heuristic:        *heuristicPtr,
+				Dir:              *diskDirPtr,
+				MemoryStates:     *memoryStatesPtr,
+				MemoryHashes:     *memoryHashesPtr,
+				BloomBitsPerHash: *bloomBitsPerHashPtr,
+			}
+			return solveCheckpointed(dealNumber, &options.SearchOptions,
+				func() (libsolver.SearchResult, error) { return libsolver.SolveDisk(state, options) },
+				func() (libsolver.SearchResult, error) { return libsolver.ResumeDisk(options) })
+		}
+	default:
+		panic(fmt.Errorf("Unknown search strategy '%s'.", *searchPtr))
+	}
+
+	solved := 0
+	for dealNumber := first; dealNumber <= last; dealNumber++ {
+		start := time.Now()
+		state, err := libgame.DealPysolGame(libgame.Game{}, dealNumber)
+		if err != nil {
+			panic(fmt.Errorf("Error dealing game %d: %v.", dealNumber, err))
+		}
+		result, err := solve(dealNumber, state)
+		if err != nil {
+			panic(fmt.Errorf("Error solving game %d: %v.", dealNumber, err))
+		}
+		if result.Solved {
+			solved++
+			fmt.Printf("deal %d: solved in %d moves, expanded %d states in %s\n",
+				dealNumber, len(result.Solution), result.Expanded, time.Since(start))
+		} else {
+			fmt.Printf("deal %d: not solved, best score %d after %d moves, expanded %d states in %s\n",
+				dealNumber, result.BestState.Score, len(result.BestPath), result.Expanded,
+				time.Since(start))
+			if *pictureDirPtr != "" {
+				filename, err := savePicture(*pictureDirPtr, *pictureFormatPtr, dealNumber, result.BestState)
+				if err != nil {
+					panic(fmt.Errorf("Error saving picture of game %d: %v.", dealNumber, err))
+				}
+				fmt.Printf("deal %d: saved its best state to %s\n", dealNumber, filename)
+			}
+		}
+	}
+	fmt.Printf("solved %d of %d deals\n", solved, last-first+1)
+}
+
+// savePicture saves a picture of the deal's state to the directory, as a png or
+// svg. Returns the picture's filename
+func savePicture(
+	dir string, format string, dealNumber int64, state libgame.GameState) (string, error) {
+	var render func(io.Writer, libgame.GameState) error
+	switch format {
+	case "png":
+		render = librender.WritePNG
+	case "svg":
+		render = librender.WriteSVG
+	default:
+		return "", fmt.Errorf("Unknown picture format '%s'", format)
+	}
+	filename := filepath.Join(dir, fmt.Sprintf("deal-%d.%s", dealNumber, format))
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	if err := render(file, state); err != nil {
+		file.Close()
+		return "", err
+	}
+	return filename, file.Close()
+}
+
+// runPlayouts plays out each of the user's deals and prints their win rates
+func runPlayouts(first int64, last int64, pruner *libsolver.Pruner) {
+	for dealNumber := first; dealNumber <= last; dealNumber++ {
+		start := time.Now()
+		state, err := libgame.DealPysolGame(libgame.Game{}, dealNumber)
+		if err != nil {
+			panic(fmt.Errorf("Error dealing game %d: %v.", dealNumber, err))
+		}
+		result, err := libsolver.RunPlayouts(state, libsolver.PlayoutOptions{
+			Playouts: *playoutsPtr,
+			Policy:   *playoutPolicyPtr,
+			Pruner:   pruner,
+			Seed:     dealNumber,
+		})
+		if err != nil {
+			panic(fmt.Errorf("Error playing out game %d: %v.", dealNumber, err))
+		}
+		fmt.Printf("deal %d: won %.1f%% of %d playouts, average score %.1f, best score %d, "+
+			"dead ends %v in %s\n",
+			dealNumber, 100*result.WinRate, result.Playouts, result.AverageScore,
+			result.BestScore, result.DeadEnds, time.Since(start))
+	}
+}
+
+// solveCheckpointed is a helper function for running a search on a deal,
+// checkpointing it and resuming it if the user asked to. options are the
+// search's options, which solve and resume share
+func solveCheckpointed(
+	dealNumber int64, options *libsolver.SearchOptions,
+	solve func() (libsolver.SearchResult, error),
+	resume func() (libsolver.SearchResult, error)) (libsolver.SearchResult, error) {
+	if *checkpointDirPtr == "" {
+		if *resumePtr {
+			return libsolver.SearchResult{}, fmt.Errorf("-resume needs a -checkpoint-dir")
+		}
+		return solve()
+	}
+
+	options.Checkpoint = filepath.Join(*checkpointDirPtr, fmt.Sprintf("deal-%d.checkpoint", dealNumber))
+	if *resumePtr {
+		if _, err := os.Stat(options.Checkpoint); err == nil {
+			fmt.Printf("deal %d: resuming from %s\n", dealNumber, options.Checkpoint)
+			return resume()
+		}
+	}
+	return solve()
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -24,6 +25,23 @@ var (
 		"new-game",
 		false,
 		"start a new game for analyzing. if false (default), uses latest game instead")
+	orderMovesPtr = flag.Bool(
+		"order-moves",
+		true,
+		"save the most promising moves of each state first. if false, uses move generation order")
+	moveOrderingWeightsPtr = flag.String(
+		"move-ordering-weights",
+		"",
+		"comma separated list of name=weight for -order-moves, like 'to-foundation=80,from-waste=5'. "+
+			"weights not given keep their defaults. see libsolver.ParseMoveOrderingWeights")
+	pruningRulesPtr = flag.String(
+		"pruning-rules",
+		strings.Join(libsolver.DefaultPruningRules, ","),
+		"comma separated list of rules for skipping moves, or 'none'. see libsolver.PruningRules")
+	pruneLostPtr = flag.Bool(
+		"prune-lost",
+		false,
+		"skip states that provably can't be won. see libsolver.ProvablyLost")
 )
 
 var (
@@ -41,21 +59,44 @@ var (
 			Name: "forty_thieves_new_saved_states_total",
 			Help: "Total number of new saved states",
 		}, labels)
+	prunedMovesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "forty_thieves_pruned_moves_total",
+			Help: "Total number of moves skipped, by pruning rule",
+		}, append(labels, "rule"))
 )
 
 func init() {
 	prometheus.MustRegister(processedStatesCounter)
 	prometheus.MustRegister(newSavedStatesCounter)
+	prometheus.MustRegister(prunedMovesCounter)
 }
 
 // main process to kick off workers and solve game states
 func main() {
+	flag.Parse()
 	defer timeTrack(time.Now(), "total time")
 
 	// host prometheus metrics
 	http.Handle("/metrics", promhttp.Handler())
 	go http.ListenAndServe(*addr, nil)
 
+	if flag.Arg(0) == "rate" {
+		runRate(flag.Args()[1:], createPruner())
+		return
+	}
+
+	// in-memory searches don't need the database
+	if *searchPtr != "db" {
+		pruner := createPruner()
+		runBatch(pruner)
+		fmt.Printf("moves pruned by rule: %v\n", pruner.PrunedCounts())
+		return
+	}
+	if *checkpointDirPtr != "" || *resumePtr {
+		panic(fmt.Errorf("The db search can't be checkpointed or resumed."))
+	}
+
 	// connect to database
 	db, err := connectToDatabase()
 	if err != nil {
@@ -64,13 +105,14 @@ func main() {
 	gameDB := libdb.NewGameDB(db)
 	gameStateDB := libdb.NewGameStateDB(db)
 	game := getOrCreateGame(gameDB, gameStateDB)
+	pruner := createPruner()
 
 	// fire off workers
 	shutdownNow := make(chan bool, 5)
 	done := make(chan bool, 3)
 	numWorkers := runtime.NumCPU()
 	for workerId := 0; workerId < numWorkers; workerId++ {
-		go doWorkerLoop(workerId, *game, shutdownNow, done)
+		go doWorkerLoop(workerId, *game, pruner, shutdownNow, done)
 	}
 	fmt.Println("Press <enter> to exit")
 	fmt.Scanln()
@@ -80,13 +122,16 @@ func main() {
 		<-done
 	}
 	fmt.Println("all workers are shut down")
+	fmt.Printf("moves pruned by rule: %v\n", pruner.PrunedCounts())
 }
 
 // doWorkerLoop is a helper func to pull a gameState off the queue and process it
 //
 // Runs until a message is seen on the 'shutdownNow' channel. Shuts itself down
 // and puts a message on the 'done' channel.
-func doWorkerLoop(workerId int, game libgame.Game, shutdownNow <-chan bool, done chan<- bool) {
+func doWorkerLoop(
+	workerId int, game libgame.Game, pruner *libsolver.Pruner,
+	shutdownNow <-chan bool, done chan<- bool) {
 	fmt.Printf("starting worker %d\n", workerId)
 
 	// connect to database
@@ -95,6 +140,15 @@ func doWorkerLoop(workerId int, game libgame.Game, shutdownNow <-chan bool, done
 		panic(fmt.Errorf("Failed to connect to database: %v.", err))
 	}
 	gameStateDB := libdb.NewGameStateDB(db)
+	moveGenerator := libsolver.NewMoveGenerator()
+	moveOrderer := libsolver.NewMoveOrderer(moveOrderingWeights())
+
+	// finding the last move costs a query, so only do it for the rule that
+	// needs it
+	needLastMove := false
+	for _, name := range pruner.RuleNames() {
+		needLastMove = needLastMove || name == "reverse-last-move"
+	}
 
 	for {
 		select {
@@ -128,8 +182,16 @@ func doWorkerLoop(workerId int, game libgame.Game, shutdownNow <-chan bool, done
 				}
 
 				// for each possible state we can move to, add them to the database
-				for _, move := range libsolver.GetPossibleMoves(gameState) {
-					if shouldSkipMove(move) {
+				moves := moveGenerator.PossibleMoves(gameState)
+				if *orderMovesPtr {
+					moveOrderer.Order(gameState, moves)
+				}
+				var lastMove *libgame.MoveRequest
+				if needLastMove {
+					lastMove = findLastMove(gameStateDB, *gameState)
+				}
+				for _, move := range moves {
+					if pruner.ShouldPrune(gameState, move, lastMove) {
 						continue
 					}
 
@@ -141,6 +203,11 @@ func doWorkerLoop(workerId int, game libgame.Game, shutdownNow <-chan bool, done
 					if err != nil {
 						panic(fmt.Errorf("Error making move: %v.", err))
 					}
+					if *pruneLostPtr {
+						if lost, _ := libsolver.ProvablyLost(&gameStateCopy); lost {
+							continue
+						}
+					}
 
 					// save the new game state to database
 					err = gameStateDB.SaveGameState(nil, gameStateCopy)
@@ -162,28 +229,54 @@ func doWorkerLoop(workerId int, game libgame.Game, shutdownNow <-chan bool, done
 	}
 }
 
-// shouldSkipMove determines whether or not we should skip a move due to business logic
+// findLastMove works out the move that created the game state from its parent,
+// since we don't store moves in the database.
 //
-// This function culls away moves that are likely to result in "shifting" of
-// cards but not really going anywhere.
-func shouldSkipMove(move libgame.MoveRequest) bool {
-	if move.FromPile == libgame.FOUNDATION && move.ToPile == libgame.FOUNDATION {
-		// don't keep just shifting around foundations
-		return true
+// Returns nil for a game's first state, or if the parent can't be loaded.
+func findLastMove(gameStateDB *libdb.GameStateDB, gameState libgame.GameState) *libgame.MoveRequest {
+	if !gameState.PreviousGameState.Valid {
+		return nil
 	}
+	parent, err := gameStateDB.GetGameStateById(gameState.PreviousGameState.UUID)
+	if err != nil {
+		fmt.Printf("can't load parent of %v: %v\n", gameState.GameStateID, err)
+		return nil
+	}
+	move, ok := libsolver.FindMove(*parent, gameState)
+	if !ok {
+		return nil
+	}
+	return &move
+}
 
-	if move.FromPile == libgame.FOUNDATION {
-		// for now, let's not let _any_ cards come down from
-		// foundations. this may be changed in the future
-		return true
+// createPruner is a helper function for creating the pruner from the user's choice of rules
+//
+// Expects flags to have been parsed already.
+func createPruner() *libsolver.Pruner {
+	pruner, err := libsolver.NewPruner(libsolver.ParsePruningRuleNames(*pruningRulesPtr))
+	if err != nil {
+		panic(fmt.Errorf("Error creating pruner: %v.", err))
 	}
+	pruner.OnPrune = func(ruleName string) {
+		prunedMovesCounter.WithLabelValues(appVersion, ruleName).Inc()
+	}
+	fmt.Printf("pruning moves with rules: %v\n", pruner.RuleNames())
+	return pruner
+}
 
-	return false // this move is fine
+// moveOrderingWeights is a helper function for parsing the user's move ordering weights
+//
+// Expects flags to have been parsed already.
+func moveOrderingWeights() libsolver.MoveOrderingWeights {
+	weights, err := libsolver.ParseMoveOrderingWeights(*moveOrderingWeightsPtr)
+	if err != nil {
+		panic(fmt.Errorf("Error parsing move ordering weights: %v.", err))
+	}
+	return weights
 }
 
 // getOrCreateGame is a helper function for getting/creating a game to process, based on user input
 func getOrCreateGame(gameDB *libdb.GameDB, gameStateDB *libdb.GameStateDB) *libgame.Game {
-	flag.Parse()
 	var game *libgame.Game
 	var err error
 	if *newGamePtr {
@@ -1,65 +1,48 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/topher200/forty-thieves/libgame"
 )
 
-// Test that we don't skip good move
-func TestShouldSkipMoveDoNotSkipGoodMoves(t *testing.T) {
-	assert.False(t, shouldSkipMove(
-		libgame.MoveRequest{
-			libgame.TABLEAU,
-			0,
-			libgame.TABLEAU,
-			0,
-		}))
-	assert.False(t, shouldSkipMove(
-		libgame.MoveRequest{
-			libgame.TABLEAU,
-			0,
-			libgame.FOUNDATION,
-			0,
-		}))
-	assert.False(t, shouldSkipMove(
-		libgame.MoveRequest{
-			libgame.STOCK,
-			0,
-			libgame.TABLEAU,
-			0,
-		}))
-	assert.False(t, shouldSkipMove(
-		libgame.MoveRequest{
-			libgame.STOCK,
-			0,
-			libgame.FOUNDATION,
-			0,
-		}))
-	assert.False(t, shouldSkipMove(
-		libgame.MoveRequest{
-			libgame.STOCK,
-			0,
-			libgame.WASTE,
-			0,
-		}))
+func TestParseDealRange(t *testing.T) {
+	first, last, err := parseDealRange("5")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 5, first)
+	assert.EqualValues(t, 5, last)
+
+	first, last, err = parseDealRange("1-10")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, first)
+	assert.EqualValues(t, 10, last)
+
+	_, _, err = parseDealRange("10-1")
+	assert.Error(t, err)
+	_, _, err = parseDealRange("one")
+	assert.Error(t, err)
 }
 
-// Test that we skip bad moves
-func TestShouldSkipMoveDoSkipBadMoves(t *testing.T) {
-	assert.True(t, shouldSkipMove(
-		libgame.MoveRequest{
-			libgame.FOUNDATION,
-			0,
-			libgame.FOUNDATION,
-			0,
-		}))
-	assert.True(t, shouldSkipMove(
-		libgame.MoveRequest{
-			libgame.FOUNDATION,
-			0,
-			libgame.TABLEAU,
-			0,
-		}))
+func TestSavePicture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pictures")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	state := libgame.DealNewGame(libgame.Game{})
+
+	filename, err := savePicture(dir, "svg", 7, state)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "deal-7.svg"), filename)
+	data, err := ioutil.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "<svg"))
+
+	_, err = savePicture(dir, "gif", 7, state)
+	assert.Error(t, err)
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/topher200/forty-thieves/libdb"
+	"github.com/topher200/forty-thieves/libgame"
+	"github.com/topher200/forty-thieves/libsolver"
+)
+
+// runRate is the 'rate' subcommand, which rates the difficulty of deals.
+//
+// 'rate pysol' rates the -pysol-deals in memory. Otherwise, the arguments are
+// the ids of games to rate and save to the database, defaulting to the latest
+// game.
+func runRate(args []string, pruner *libsolver.Pruner) {
+	options := libsolver.DifficultyOptions{
+		Search: libsolver.BeamOptions{
+			SearchOptions: searchOptions(pruner),
+			Width:         *beamWidthPtr,
+			Heuristic:     *heuristicPtr,
+		},
+		Playouts: libsolver.PlayoutOptions{
+			Playouts: *playoutsPtr,
+			Policy:   *playoutPolicyPtr,
+			Pruner:   pruner,
+		},
+	}
+
+	if len(args) == 1 && args[0] == "pysol" {
+		first, last, err := parseDealRange(*pysolDealsPtr)
+		if err != nil {
+			panic(err)
+		}
+		for dealNumber := first; dealNumber <= last; dealNumber++ {
+			state, err := libgame.DealPysolGame(libgame.Game{}, dealNumber)
+			if err != nil {
+				panic(fmt.Errorf("Error dealing game %d: %v.", dealNumber, err))
+			}
+			options.Playouts.Seed = dealNumber
+			rateAndPrint(fmt.Sprintf("deal %d", dealNumber), state, options)
+		}
+		return
+	}
+
+	db, err := connectToDatabase()
+	if err != nil {
+		panic(fmt.Errorf("Failed to connect to database: %v.", err))
+	}
+	gameDB := libdb.NewGameDB(db)
+	gameStateDB := libdb.NewGameStateDB(db)
+
+	games := make([]libgame.Game, 0)
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			panic(fmt.Errorf("Error parsing game id '%s': %v.", arg, err))
+		}
+		games = append(games, libgame.Game{ID: id})
+	}
+	if len(games) == 0 {
+		game, err := gameDB.GetLatestGame()
+		if err != nil {
+			panic(fmt.Errorf("Error getting game: %v.", err))
+		}
+		games = append(games, *game)
+	}
+
+	for _, game := range games {
+		state, err := gameStateDB.GetFirstGameState(game)
+		if err != nil {
+			panic(fmt.Errorf("Error getting first game state of game %d: %v.", game.ID, err))
+		}
+		options.Playouts.Seed = game.ID
+		difficulty := rateAndPrint(fmt.Sprintf("game %d", game.ID), *state, options)
+		details, err := json.Marshal(difficulty)
+		if err == nil {
+			err = gameDB.SaveDifficulty(nil, game, libdb.Difficulty{
+				Score:   difficulty.Score,
+				Rating:  string(difficulty.Rating),
+				Details: details,
+			})
+		}
+		if err != nil {
+			panic(fmt.Errorf("Error saving difficulty of game %d: %v.", game.ID, err))
+		}
+	}
+}
+
+// rateAndPrint is a helper function for rating a deal and printing the result
+func rateAndPrint(
+	name string, state libgame.GameState,
+	options libsolver.DifficultyOptions) libsolver.Difficulty {
+	start := time.Now()
+	difficulty, err := libsolver.RateDifficulty(state, options)
+	if err != nil {
+		panic(fmt.Errorf("Error rating %s: %v.", name, err))
+	}
+	fmt.Printf("%s: %s (%.1f). solved: %v in %d moves, best score %d, expanded %d, "+
+		"branching factor %.1f, playout win rate %.1f%%, in %s\n",
+		name, difficulty.Rating, difficulty.Score, difficulty.Solved,
+		difficulty.SolutionLength, difficulty.BestScore, difficulty.Expanded,
+		difficulty.BranchingFactor, 100*difficulty.PlayoutWinRate, time.Since(start))
+	return difficulty
+}
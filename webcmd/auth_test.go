@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/topher200/forty-thieves/libclient"
+	"github.com/topher200/forty-thieves/libdb"
+)
+
+// AuthTestSuite authenticates with Basic auth and API tokens
+type AuthTestSuite struct {
+	suite.Suite
+	server *httptest.Server
+}
+
+// newAdminForTesting creates an admin, returning their email, one of their API
+// tokens, and a func that deletes them
+func newAdminForTesting(t *testing.T) (string, string, func()) {
+	db := newApplicationForTesting(t).db
+	userDB := libdb.NewUserDB(db)
+	email := newEmail()
+	user, err := userDB.Signup(nil, email, "correct horse")
+	assert.Nil(t, err)
+	assert.Nil(t, userDB.SetAdmin(nil, user.ID, true))
+	token, _, err := libdb.NewAPITokenDB(db).CreateAPIToken(nil, user.ID, "tests")
+	assert.Nil(t, err)
+	return email, token, func() { userDB.DeleteUser(nil, user.ID) }
+}
+
+// basicAuth is the Authorization header for the email and password
+func basicAuth(email string, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(email+":"+password))
+}
+
+// solveStreamStatus requests /solve/stream, with the Authorization header if
+// it isn't empty, and returns the response's status
+func (testSuite *AuthTestSuite) solveStreamStatus(authorization string) int {
+	return testSuite.solveStreamStatusWith(http.DefaultClient, authorization)
+}
+
+// solveStreamStatusWith is solveStreamStatus, sending the client's cookies
+func (testSuite *AuthTestSuite) solveStreamStatusWith(client *http.Client, authorization string) int {
+	// without a gameStateID, admins get a 400
+	req, err := http.NewRequest("GET", testSuite.server.URL+"/solve/stream", nil)
+	assert.Nil(testSuite.T(), err)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := client.Do(req)
+	assert.Nil(testSuite.T(), err)
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		assert.NotEmpty(testSuite.T(), resp.Header.Get("WWW-Authenticate"))
+	}
+	return resp.StatusCode
+}
+
+// TestSolveNeedsAdmin checks that only admins can start solves
+func (testSuite *AuthTestSuite) TestSolveNeedsAdmin() {
+	t := testSuite.T()
+	adminEmail, adminToken, deleteAdmin := newAdminForTesting(t)
+	defer deleteAdmin()
+	user := libclient.NewClient(testSuite.server.URL)
+	userEmail := newEmail()
+	_, err := user.Signup(userEmail, "correct horse")
+	assert.Nil(t, err)
+
+	assert.Equal(t, 401, testSuite.solveStreamStatus(""))
+	assert.Equal(t, 401, testSuite.solveStreamStatus(basicAuth(adminEmail, "battery staple")))
+	assert.Equal(t, 401, testSuite.solveStreamStatus("Bearer not-a-token"))
+	assert.Equal(t, 401, testSuite.solveStreamStatus("Digest username=\"admin\""))
+	assert.Equal(t, 403, testSuite.solveStreamStatus(basicAuth(userEmail, "correct horse")))
+	assert.Equal(t, 400, testSuite.solveStreamStatus(basicAuth(adminEmail, "correct horse")))
+	assert.Equal(t, 400, testSuite.solveStreamStatus("Bearer "+adminToken))
+
+	// the web app's EventSource can only send the session cookie
+	admin := libclient.NewClient(testSuite.server.URL)
+	_, err = admin.Login(adminEmail, "correct horse")
+	assert.Nil(t, err)
+	assert.Equal(t, 400, testSuite.solveStreamStatusWith(admin.HTTPClient, ""))
+	assert.Equal(t, 403, testSuite.solveStreamStatusWith(user.HTTPClient, ""))
+}
+
+// TestSearchesAreRateLimited checks that each client only gets a burst of
+// hints, and then has to wait
+func (testSuite *AuthTestSuite) TestSearchesAreRateLimited() {
+	t := testSuite.T()
+	// without a gameStateID, allowed hints are a 400
+	hintStatus := func(client *http.Client) *http.Response {
+		resp, err := client.Get(testSuite.server.URL + "/hint")
+		assert.Nil(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	for i := 0; i < searchBurst; i++ {
+		assert.Equal(t, 400, hintStatus(http.DefaultClient).StatusCode)
+	}
+	resp := hintStatus(http.DefaultClient)
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	// logged in users have a limit of their own
+	user := libclient.NewClient(testSuite.server.URL)
+	_, err := user.Signup(newEmail(), "correct horse")
+	assert.Nil(t, err)
+	assert.Equal(t, 400, hintStatus(user.HTTPClient).StatusCode)
+}
+
+// TestAPITokens makes an API token and uses it instead of logging in
+func (testSuite *AuthTestSuite) TestAPITokens() {
+	t := testSuite.T()
+	loggedIn := libclient.NewClient(testSuite.server.URL)
+	_, err := loggedIn.CreateAPIToken("laptop")
+	checkClientError(t, err, 401, libclient.CodeUnauthorized)
+	user, err := loggedIn.Signup(newEmail(), "correct horse")
+	assert.Nil(t, err)
+	_, err = loggedIn.CreateAPIToken("")
+	checkClientError(t, err, 400, libclient.CodeInvalidRequest)
+	token, err := loggedIn.CreateAPIToken("laptop")
+	assert.Nil(t, err)
+	assert.Equal(t, "laptop", token.Name)
+	assert.NotEmpty(t, token.Token)
+
+	tokens, err := loggedIn.APITokens()
+	assert.Nil(t, err)
+	if assert.Len(t, tokens, 1) {
+		assert.Equal(t, token.ID, tokens[0].ID)
+		assert.Empty(t, tokens[0].Token)
+	}
+
+	withToken := libclient.NewClient(testSuite.server.URL)
+	withToken.APIToken = token.Token
+	me, err := withToken.Me()
+	assert.Nil(t, err)
+	assert.Equal(t, user, me)
+	// games dealt with a token belong to its user
+	gameState, err := withToken.NewGame()
+	assert.Nil(t, err)
+	_, err = loggedIn.Share(gameState.GameStateID)
+	assert.Nil(t, err)
+
+	wrongToken := libclient.NewClient(testSuite.server.URL)
+	wrongToken.APIToken = "not-a-token"
+	_, err = wrongToken.LatestState()
+	checkClientError(t, err, 401, libclient.CodeUnauthorized)
+
+	assert.Nil(t, loggedIn.DeleteAPIToken(token.ID))
+	_, err = withToken.Me()
+	checkClientError(t, err, 401, libclient.CodeUnauthorized)
+	err = loggedIn.DeleteAPIToken(token.ID)
+	checkClientError(t, err, 404, libclient.CodeNotFound)
+}
+
+func (testSuite *AuthTestSuite) SetupSuite() {
+	middle := newMiddlewareForTesting(testSuite.T())
+	testSuite.server = httptest.NewServer(middle)
+}
+
+func (testSuite *AuthTestSuite) TearDownSuite() {
+	testSuite.server.Close()
+}
+
+func TestAuthSuite(t *testing.T) {
+	suite.Run(t, new(AuthTestSuite))
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/topher200/forty-thieves/libclient"
+	"github.com/topher200/forty-thieves/webcmd/handlers"
+)
+
+// BoardTestSuite plays a game on the server rendered board, like a browser
+// without javascript would
+type BoardTestSuite struct {
+	suite.Suite
+	server    *httptest.Server
+	client    *http.Client
+	csrfToken string
+}
+
+// postBoardForm posts the form, with the session's CSRF token like the board's
+// forms, and follows the redirect. Returns the board's status, its game state
+// id and its html
+func (testSuite *BoardTestSuite) postBoardForm(path string, form url.Values) (int, uuid.UUID, string) {
+	t := testSuite.T()
+	withToken := url.Values{handlers.CSRFTokenField: {testSuite.csrfToken}}
+	for key, values := range form {
+		withToken[key] = values
+	}
+	resp, err := testSuite.client.PostForm(testSuite.server.URL+path, withToken)
+	if !assert.Nil(t, err) {
+		return 0, uuid.Nil, ""
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	gameStateID, _ := uuid.FromString(strings.TrimPrefix(resp.Request.URL.Path, "/board/"))
+	return resp.StatusCode, gameStateID, string(body)
+}
+
+// TestPlay deals a game, flips the stock and tries an illegal move
+func (testSuite *BoardTestSuite) TestPlay() {
+	t := testSuite.T()
+	status, gameStateID, body := testSuite.postBoardForm("/board/newgame", nil)
+	assert.Equal(t, 200, status)
+	assert.NotEqual(t, uuid.Nil, gameStateID)
+	assert.Contains(t, body, "Flip the stock")
+	assert.Contains(t, body, `id="tableau-9"`)
+
+	flip := url.Values{
+		"FromPile": {"stock"}, "FromIndex": {"0"}, "ToPile": {"waste"}, "ToIndex": {"0"},
+	}
+	status, flippedID, body := testSuite.postBoardForm("/board/"+gameStateID.String()+"/move", flip)
+	assert.Equal(t, 200, status)
+	assert.Contains(t, body, `name="csrf_token" value="`+testSuite.csrfToken+`"`)
+	assert.NotEqual(t, gameStateID, flippedID)
+	assert.Contains(t, body, "/board/"+gameStateID.String())
+
+	// the first state now links to the state after it
+	resp, err := http.Get(testSuite.server.URL + "/board/" + gameStateID.String())
+	if assert.Nil(t, err) {
+		defer resp.Body.Close()
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "text/html", resp.Header.Get("Content-Type"))
+		page, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		assert.Contains(t, string(page), "/board/"+flippedID.String())
+	}
+
+	// illegal moves show the board again, with the error
+	illegal := url.Values{
+		"FromPile": {"tableau"}, "FromIndex": {"0"}, "ToPile": {"stock"}, "ToIndex": {"0"},
+	}
+	status, sameID, body := testSuite.postBoardForm("/board/"+flippedID.String()+"/move", illegal)
+	assert.Equal(t, 422, status)
+	assert.Equal(t, flippedID, sameID)
+	assert.Contains(t, body, "destination &#39;stock&#39; illegal")
+
+	// forms posted from another site don't have the session's CSRF token
+	resp, err = testSuite.client.PostForm(
+		testSuite.server.URL+"/board/"+flippedID.String()+"/move", flip)
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, 403, resp.StatusCode)
+	}
+}
+
+// TestHint asks for a hint, which is counted once however often the board
+// showing it is loaded
+func (testSuite *BoardTestSuite) TestHint() {
+	t := testSuite.T()
+	session, csrfToken := newSessionForTesting(t, testSuite.server.URL)
+	user := libclient.NewClient(testSuite.server.URL)
+	user.HTTPClient = session
+	_, err := user.Signup(newEmail(), "correct horse")
+	assert.Nil(t, err)
+	gameState, err := user.NewGame()
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	hintURL := testSuite.server.URL + "/board/" + gameState.GameStateID.String() + "/hint"
+	resp, err := session.PostForm(hintURL, url.Values{handlers.CSRFTokenField: {csrfToken}})
+	if !assert.Nil(t, err) {
+		return
+	}
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	hinted := resp.Request.URL.String()
+	assert.Equal(t, "1", resp.Request.URL.Query().Get("hint"))
+	for i := 0; i < 2; i++ {
+		resp, err = session.Get(hinted)
+		if assert.Nil(t, err) {
+			page, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Nil(t, err)
+			assert.Contains(t, string(page), `class="board-hint"`)
+		}
+	}
+	stats, err := user.Stats()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, stats.Hints)
+
+	resp, err = session.PostForm(hintURL, nil)
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, 403, resp.StatusCode)
+	}
+}
+
+// TestNotFound checks that unknown game states aren't rendered, and that
+// malformed ids are invalid requests, like they are in the API
+func (testSuite *BoardTestSuite) TestNotFound() {
+	t := testSuite.T()
+	statuses := map[string]int{
+		"/board/not-a-uuid":               400,
+		"/board/" + uuid.NewV4().String(): 404,
+	}
+	for path, status := range statuses {
+		resp, err := http.Get(testSuite.server.URL + path)
+		if assert.Nil(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, status, resp.StatusCode, path)
+		}
+	}
+}
+
+// TestImages draws a game state as SVG and PNG
+func (testSuite *BoardTestSuite) TestImages() {
+	t := testSuite.T()
+	client := libclient.NewClient(testSuite.server.URL)
+	gameState, err := client.NewGame()
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	svg, err := client.BoardSVG(gameState.GameStateID)
+	assert.Nil(t, err)
+	assert.True(t, bytes.HasPrefix(svg, []byte("<svg")))
+	picture, err := client.BoardPNG(gameState.GameStateID)
+	assert.Nil(t, err)
+	_, err = png.Decode(bytes.NewReader(picture))
+	assert.Nil(t, err)
+
+	resp, err := http.Get(testSuite.server.URL + "/api/v1/states/" +
+		gameState.GameStateID.String() + "/board.png")
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	}
+
+	_, err = client.BoardSVG(uuid.NewV4())
+	checkClientError(t, err, 404, libclient.CodeNotFound)
+}
+
+func (testSuite *BoardTestSuite) SetupSuite() {
+	middle := newMiddlewareForTesting(testSuite.T())
+	testSuite.server = httptest.NewServer(middle)
+	testSuite.client, testSuite.csrfToken = newSessionForTesting(testSuite.T(), testSuite.server.URL)
+}
+
+func (testSuite *BoardTestSuite) TearDownSuite() {
+	testSuite.server.Close()
+}
+
+func TestBoardSuite(t *testing.T) {
+	suite.Run(t, new(BoardTestSuite))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/topher200/forty-thieves/libclient"
+	"github.com/topher200/forty-thieves/libsolver"
+)
+
+// DailyTestSuite plays today's deal as different users
+type DailyTestSuite struct {
+	suite.Suite
+	server *httptest.Server
+}
+
+// TestDaily has two users attempt today's deal and submit their results
+func (testSuite *DailyTestSuite) TestDaily() {
+	t := testSuite.T()
+	anonymous := libclient.NewClient(testSuite.server.URL)
+	_, err := anonymous.StartDaily()
+	checkClientError(t, err, 401, libclient.CodeUnauthorized)
+
+	alice := libclient.NewClient(testSuite.server.URL)
+	_, err = alice.Signup(newEmail(), "correct horse")
+	assert.Nil(t, err)
+	bob := libclient.NewClient(testSuite.server.URL)
+	_, err = bob.Signup(newEmail(), "correct horse")
+	assert.Nil(t, err)
+
+	// everyone gets the same cards, and one attempt
+	aliceStart, err := alice.StartDaily()
+	assert.Nil(t, err)
+	bobStart, err := bob.StartDaily()
+	assert.Nil(t, err)
+	assert.NotEqual(t, aliceStart.GameID, bobStart.GameID)
+	assert.Equal(t, aliceStart.Stock, bobStart.Stock)
+	assert.Equal(t, aliceStart.Tableaus, bobStart.Tableaus)
+	_, err = alice.StartDaily()
+	checkClientError(t, err, 409, libclient.CodeConflict)
+
+	history, err := alice.DailyHistory()
+	assert.Nil(t, err)
+	if assert.NotEmpty(t, history) {
+		assert.Equal(t, aliceStart.GameStateID, history[0].FirstGameStateID)
+		assert.False(t, history[0].Submitted)
+		assert.Nil(t, history[0].Rank)
+	}
+
+	// results can only come from your own attempt, once
+	_, err = alice.SubmitDaily("today", bobStart.GameStateID)
+	checkClientError(t, err, 400, libclient.CodeInvalidRequest)
+	flipped, err := alice.Move(aliceStart.GameStateID, libsolver.FlipStockMove)
+	assert.Nil(t, err)
+
+	// attempts are one line of play, without hints, until they're submitted
+	_, err = alice.Hint(flipped.GameStateID)
+	checkClientError(t, err, 403, libclient.CodeForbidden)
+	_, err = bob.Move(bobStart.GameStateID, libsolver.FlipStockMove)
+	assert.Nil(t, err)
+	_, err = bob.Move(bobStart.GameStateID, libsolver.FlipStockMove)
+	checkClientError(t, err, 422, libclient.CodeIllegalMove)
+	_, err = alice.SubmitDaily("today", aliceStart.GameStateID)
+	checkClientError(t, err, 400, libclient.CodeInvalidRequest)
+
+	attempt, err := alice.SubmitDaily("today", flipped.GameStateID)
+	assert.Nil(t, err)
+	assert.True(t, attempt.Submitted)
+	assert.EqualValues(t, 1, *attempt.Moves)
+	assert.EqualValues(t, flipped.Score, *attempt.Score)
+	_, err = alice.SubmitDaily("today", flipped.GameStateID)
+	checkClientError(t, err, 409, libclient.CodeConflict)
+	_, err = alice.Hint(flipped.GameStateID)
+	assert.Nil(t, err)
+
+	deal, err := anonymous.Daily("today")
+	assert.Nil(t, err)
+	assert.Equal(t, attempt.Date, deal.Date)
+	assert.NotEmpty(t, deal.Results)
+	_, err = anonymous.Daily("yesterday")
+	checkClientError(t, err, 400, libclient.CodeInvalidRequest)
+	// nobody gets to see tomorrow's deal early
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+	_, err = anonymous.Daily(tomorrow)
+	checkClientError(t, err, 404, libclient.CodeNotFound)
+	_, err = bob.SubmitDaily("2001-01-01", bobStart.GameStateID)
+	checkClientError(t, err, 404, libclient.CodeNotFound)
+}
+
+func (testSuite *DailyTestSuite) SetupSuite() {
+	middle := newMiddlewareForTesting(testSuite.T())
+	testSuite.server = httptest.NewServer(middle)
+}
+
+func (testSuite *DailyTestSuite) TearDownSuite() {
+	testSuite.server.Close()
+}
+
+func TestDailySuite(t *testing.T) {
+	suite.Run(t, new(DailyTestSuite))
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	gorilla_mux "github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// APIPrefix is the path all of the versioned API's routes are under
+const APIPrefix = "/api/v1"
+
+// APIError describes why an API request failed
+type APIError struct {
+	Code    string // machine-readable, one of the Code* constants
+	Message string
+}
+
+// APIErrorResponse is the body of every API response with an error status
+type APIErrorResponse struct {
+	Error APIError
+}
+
+// replyWithAPIError sends the error in an APIErrorResponse, with the status
+// and code for its kind
+func replyWithAPIError(w http.ResponseWriter, err error) {
+	e := asHandlerError(err)
+	if e.status >= http.StatusInternalServerError {
+		logrus.Errorf("Sending server error reply: %v", e.err)
+	}
+	writeJSON(w, e.status, &APIErrorResponse{APIError{e.code, e.err.Error()}})
+}
+
+// writeJSON sends the value as an application/json response with the status
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(&APIErrorResponse{APIError{CodeInternal, err.Error()}})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// apiGameState gets the game state named by the route's id
+func apiGameState(w http.ResponseWriter, r *http.Request) (*libgame.GameState, error) {
+	id := gorilla_mux.Vars(r)["id"]
+	gameStateID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, invalidRequest(fmt.Errorf("Invalid game state id '%s': %v", id, err))
+	}
+	return loadGameState(w, r, gameStateID)
+}
+
+// replyWithAPIGameState sends the game state as a GameStateWithChildren. New
+// game states are sent as 201 Created, with their location
+func replyWithAPIGameState(
+	w http.ResponseWriter, r *http.Request, gameState libgame.GameState, created bool) {
+	gs, err := gameStateWithChildren(w, r, gameState)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	if !created {
+		writeJSON(w, http.StatusOK, gs)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/states/%s", APIPrefix, gameState.GameStateID))
+	writeJSON(w, http.StatusCreated, gs)
+}
+
+// HandleAPIGetLatestState responds with the first game state of the latest game
+func HandleAPIGetLatestState(w http.ResponseWriter, r *http.Request) {
+	gameState, err := latestGameState(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	replyWithAPIGameState(w, r, *gameState, false)
+}
+
+// HandleAPIGetState responds with the game state
+func HandleAPIGetState(w http.ResponseWriter, r *http.Request) {
+	gameState, err := apiGameState(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	replyWithAPIGameState(w, r, *gameState, false)
+}
+
+// HandleAPINewGame deals a new game and responds with its first game state
+func HandleAPINewGame(w http.ResponseWriter, r *http.Request) {
+	gameState, err := newGame(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	replyWithAPIGameState(w, r, *gameState, true)
+}
+
+// HandleAPIMove makes a move from the game state and responds with the new
+// game state.
+//
+// The body is a JSON libgame.MoveRequest. The stock is flipped with
+// libsolver.FlipStockMove, so that moves from a hint can be sent as they are.
+// Moves that the game doesn't allow fail with CodeIllegalMove.
+func HandleAPIMove(w http.ResponseWriter, r *http.Request) {
+	gameState, err := apiGameState(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	var move libgame.MoveRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&move); err != nil {
+		replyWithAPIError(w, invalidRequest(fmt.Errorf("Invalid move request: %v", err)))
+		return
+	}
+
+	newGameState, err := makeMove(w, r, *gameState, move)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	replyWithAPIGameState(w, r, *newGameState, true)
+}
+
+// HandleAPIFoundationCard moves a card onto a foundation and responds with the
+// new game state
+func HandleAPIFoundationCard(w http.ResponseWriter, r *http.Request) {
+	gameState, err := apiGameState(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	newGameState, err := foundationCard(w, r, *gameState)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	replyWithAPIGameState(w, r, *newGameState, true)
+}
+
+// HandleAPIHint responds with a Hint for the game state
+func HandleAPIHint(w http.ResponseWriter, r *http.Request) {
+	gameState, err := apiGameState(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	hint, err := askForHint(w, r, *gameState)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hint)
+}
+
+// HandleAPIDifficulty responds with the saved libsolver.Difficulty of the game
+// state's game. Responds 404 if the game hasn't been rated yet
+func HandleAPIDifficulty(w http.ResponseWriter, r *http.Request) {
+	gameState, err := apiGameState(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	difficulty, err := gameDifficulty(w, r, *gameState)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, difficulty)
+}
+
+// HandleAPIRateDifficulty rates the game state's game, if it hasn't been rated
+// yet, and responds with its libsolver.Difficulty
+func HandleAPIRateDifficulty(w http.ResponseWriter, r *http.Request) {
+	gameState, err := apiGameState(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	difficulty, err := rateGameDifficulty(w, r, *gameState)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, difficulty)
+}
+
+// HandleAPIMethodNotAllowed is routed to for API paths that exist, after the
+// routes for the methods they allow
+func HandleAPIMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	replyWithAPIError(w, methodNotAllowed(
+		fmt.Errorf("Method %s isn't allowed for %s", r.Method, r.URL.Path)))
+}
+
+// HandleAPINotFound is routed to for API paths that don't exist
+func HandleAPINotFound(w http.ResponseWriter, r *http.Request) {
+	replyWithAPIError(w, notFound(fmt.Errorf("No API route for %s", r.URL.Path)))
+}
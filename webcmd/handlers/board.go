@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+	"github.com/topher200/deck"
+	"github.com/topher200/forty-thieves/libgame"
+	"github.com/topher200/forty-thieves/libhttp"
+	"github.com/topher200/forty-thieves/libsolver"
+)
+
+// BoardPrefix is where the server rendered board is served. It works without
+// javascript, so every game state can be played, or just linked to, from a
+// plain browser
+const BoardPrefix = "/board"
+
+// boardMove is a legal move from the board's game state, as a button
+type boardMove struct {
+	Move        libgame.MoveRequest
+	Description string
+	Hinted      bool // true if this is the move the hint suggests
+}
+
+// boardPage is what templates/board.html.tmpl renders
+type boardPage struct {
+	State     *GameStateWithChildren
+	Moves     []boardMove
+	HintAsked bool
+	Hint      *Hint
+	CanMove   bool
+	Error     string
+	CSRFToken string
+	share     string
+}
+
+// withShare adds the share token the board was opened with to the path, so
+// that someone a game was shared with can keep moving in it
+func (page *boardPage) withShare(path string) string {
+	if page.share == "" {
+		return path
+	}
+	return path + "?" + url.Values{"share": {page.share}}.Encode()
+}
+
+// StateURL links to the board for the game state
+func (page *boardPage) StateURL(gameStateID uuid.UUID) string {
+	return page.withShare(boardStatePath(gameStateID))
+}
+
+// HintURL is where the hint button posts to
+func (page *boardPage) HintURL() string {
+	return page.withShare(boardStatePath(page.State.GameStateID) + "/hint")
+}
+
+// hintURL links to the board for the game state with the hint shown. The hint
+// is in the query, so that showing it again doesn't search for it again
+func (page *boardPage) hintURL(gameStateID uuid.UUID, hint *Hint) string {
+	values := url.Values{"hint": {"1"}}
+	if hint.Move != nil {
+		values.Set("FromPile", string(hint.Move.FromPile))
+		values.Set("FromIndex", strconv.Itoa(hint.Move.FromIndex))
+		values.Set("ToPile", string(hint.Move.ToPile))
+		values.Set("ToIndex", strconv.Itoa(hint.Move.ToIndex))
+	}
+	if hint.Solved {
+		values.Set("solved", "1")
+	}
+	if page.share != "" {
+		values.Set("share", page.share)
+	}
+	return boardStatePath(gameStateID) + "?" + values.Encode()
+}
+
+// hintFromQuery reads the hint that hintURL put in the query, or returns nil
+// if there isn't one
+func hintFromQuery(query url.Values) *Hint {
+	if query.Get("hint") == "" {
+		return nil
+	}
+	hint := &Hint{Solved: query.Get("solved") != ""}
+	if query.Get("FromPile") == "" {
+		return hint
+	}
+	var move libgame.MoveRequest
+	moveValues := url.Values{
+		"FromPile": query["FromPile"], "FromIndex": query["FromIndex"],
+		"ToPile": query["ToPile"], "ToIndex": query["ToIndex"],
+	}
+	if decoder.Decode(&move, moveValues) == nil {
+		hint.Move = &move
+	}
+	return hint
+}
+
+// MoveURL is where the board's move buttons post to
+func (page *boardPage) MoveURL() string {
+	return page.withShare(boardStatePath(page.State.GameStateID) + "/move")
+}
+
+// NewGameURL is where the new game button posts to
+func (page *boardPage) NewGameURL() string {
+	return BoardPrefix + "/newgame"
+}
+
+// ImageURL links to the API's picture of the game state, as "svg" or "png"
+func (page *boardPage) ImageURL(extension string) string {
+	return APIPrefix + "/states/" + page.State.GameStateID.String() + "/board." + extension
+}
+
+// CardImage is the image for a face up card
+func (page *boardPage) CardImage(card deck.Card) string {
+	return fmt.Sprintf("/static/project/cards-png/%s-%s.png", card.Suit, card.Face)
+}
+
+// TopCard is the last card of the pile, the only one that can be moved
+func (page *boardPage) TopCard(pile deck.Deck) *deck.Card {
+	if len(pile.Cards) == 0 {
+		return nil
+	}
+	return &pile.Cards[len(pile.Cards)-1]
+}
+
+func boardStatePath(gameStateID uuid.UUID) string {
+	return BoardPrefix + "/" + gameStateID.String()
+}
+
+// describeMove says which card the move takes where, for the move's button
+func describeMove(gameState libgame.GameState, move libgame.MoveRequest) string {
+	if move == libsolver.FlipStockMove {
+		return "Flip the stock"
+	}
+	pileName := func(location libgame.PileLocation, index int) string {
+		switch location {
+		case libgame.TABLEAU, libgame.FOUNDATION:
+			return fmt.Sprintf("%s %d", location, index+1)
+		default:
+			return string(location)
+		}
+	}
+	var from deck.Deck
+	switch move.FromPile {
+	case libgame.TABLEAU:
+		from = gameState.Tableaus[move.FromIndex]
+	case libgame.WASTE:
+		from = gameState.Waste
+	}
+	card := ""
+	if len(from.Cards) > 0 {
+		card = from.Cards[len(from.Cards)-1].String() + " "
+	}
+	return fmt.Sprintf("Move %sfrom %s to %s", card,
+		pileName(move.FromPile, move.FromIndex), pileName(move.ToPile, move.ToIndex))
+}
+
+// renderBoard renders the game state's board with the given status. The
+// error, if any, is shown above the board
+func renderBoard(
+	w http.ResponseWriter, r *http.Request, gameState libgame.GameState,
+	status int, errMessage string) {
+	gs, err := gameStateWithChildren(w, r, gameState)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	token, err := csrfToken(w, r)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	page := &boardPage{
+		State:     gs,
+		Hint:      hintFromQuery(r.URL.Query()),
+		CanMove:   checkCanMove(w, r, gameState) == nil,
+		Error:     errMessage,
+		CSRFToken: token,
+		share:     r.URL.Query().Get("share"),
+	}
+	page.HintAsked = page.Hint != nil
+	if page.CanMove {
+		// GetPossibleMoves doesn't flip the stock, so we add it ourselves
+		moves := libsolver.GetPossibleMoves(&gameState)
+		if len(gameState.Stock.Cards) > 0 {
+			moves = append(moves, libsolver.FlipStockMove)
+		}
+		for _, move := range moves {
+			page.Moves = append(page.Moves, boardMove{
+				Move:        move,
+				Description: describeMove(gameState, move),
+				Hinted:      page.Hint != nil && page.Hint.Move != nil && *page.Hint.Move == move,
+			})
+		}
+	}
+
+	tmpl, err := template.ParseFiles("templates/dashboard.html.tmpl", "templates/board.html.tmpl")
+	if err != nil {
+		libhttp.HandleServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, page); err != nil {
+		// the status is already sent, so all we can do is log it
+		logrus.Warning("error rendering board: ", err)
+	}
+}
+
+// renderBoardError replies with the error as plain text, for errors that leave
+// us without a board to show
+func renderBoardError(w http.ResponseWriter, err error) {
+	e := asHandlerError(err)
+	if e.status >= http.StatusInternalServerError {
+		libhttp.HandleServerError(w, e.err)
+		return
+	}
+	http.Error(w, e.err.Error(), e.status)
+}
+
+// boardGameState loads the game state named in the board's path
+func boardGameState(w http.ResponseWriter, r *http.Request) (*libgame.GameState, error) {
+	idString := mux.Vars(r)["id"]
+	gameStateID, err := uuid.FromString(idString)
+	if err != nil {
+		return nil, invalidRequest(fmt.Errorf("Invalid game state id '%s': %v", idString, err))
+	}
+	return loadGameState(w, r, gameStateID)
+}
+
+// HandleBoardLatestRequest redirects to the board for the latest game's first
+// state
+func HandleBoardLatestRequest(w http.ResponseWriter, r *http.Request) {
+	gameState, err := latestGameState(w, r)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	http.Redirect(w, r, boardStatePath(gameState.GameStateID), http.StatusSeeOther)
+}
+
+// HandleBoardRequest renders the board for the game state in the path: its
+// piles, links to the states before and after it, and a button for each legal
+// move. With the "hint" query param set, the hint that HandleBoardHintRequest
+// found is shown, and its move highlighted
+func HandleBoardRequest(w http.ResponseWriter, r *http.Request) {
+	gameState, err := boardGameState(w, r)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	renderBoard(w, r, *gameState, http.StatusOK, "")
+}
+
+// HandleBoardMoveRequest makes the move posted by one of the board's buttons.
+//
+// Redirects to the new state's board. If the move can't be made, the board is
+// shown again with the error.
+func HandleBoardMoveRequest(w http.ResponseWriter, r *http.Request) {
+	if err := checkCSRFToken(r); err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	gameState, err := boardGameState(w, r)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+
+	var moveRequest libgame.MoveRequest
+	err = r.ParseForm()
+	if err == nil {
+		// the CSRF token has been checked, and isn't part of the move
+		r.PostForm.Del(CSRFTokenField)
+		err = decoder.Decode(&moveRequest, r.PostForm)
+	}
+	if err != nil {
+		renderBoard(w, r, *gameState, http.StatusBadRequest,
+			fmt.Sprintf("failure to decode move request: %v", err))
+		return
+	}
+
+	newGameState, err := makeMove(w, r, *gameState, moveRequest)
+	if err != nil {
+		e := asHandlerError(err)
+		if e.status >= http.StatusInternalServerError {
+			libhttp.HandleServerError(w, e.err)
+			return
+		}
+		renderBoard(w, r, *gameState, e.status, e.err.Error())
+		return
+	}
+	page := &boardPage{share: r.URL.Query().Get("share")}
+	http.Redirect(w, r, page.StateURL(newGameState.GameStateID), http.StatusSeeOther)
+}
+
+// HandleBoardHintRequest asks for a hint for the game state in the path, posted
+// by the board's hint button, so that it's counted once however often the
+// board is shown.
+//
+// Redirects to the board with the hint shown. If a hint isn't allowed, the
+// board is shown again with the error.
+func HandleBoardHintRequest(w http.ResponseWriter, r *http.Request) {
+	if err := checkCSRFToken(r); err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	gameState, err := boardGameState(w, r)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+
+	hint, err := askForHint(w, r, *gameState)
+	if err != nil {
+		e := asHandlerError(err)
+		if e.status >= http.StatusInternalServerError {
+			libhttp.HandleServerError(w, e.err)
+			return
+		}
+		renderBoard(w, r, *gameState, e.status, e.err.Error())
+		return
+	}
+	page := &boardPage{share: r.URL.Query().Get("share")}
+	http.Redirect(w, r, page.hintURL(gameState.GameStateID, hint), http.StatusSeeOther)
+}
+
+// HandleBoardNewGameRequest deals a new game and redirects to its board
+func HandleBoardNewGameRequest(w http.ResponseWriter, r *http.Request) {
+	if err := checkCSRFToken(r); err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	gameState, err := newGame(w, r)
+	if err != nil {
+		renderBoardError(w, err)
+		return
+	}
+	http.Redirect(w, r, boardStatePath(gameState.GameStateID), http.StatusSeeOther)
+}
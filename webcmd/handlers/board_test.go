@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+func TestBoardHintRoundTrips(t *testing.T) {
+	move := libgame.MoveRequest{
+		FromPile: libgame.TABLEAU, FromIndex: 3, ToPile: libgame.FOUNDATION, ToIndex: 5}
+	page := &boardPage{share: "token"}
+	for _, hint := range []*Hint{{Move: &move, Solved: true}, {}} {
+		hintURL, err := url.Parse(page.hintURL(uuid.NewV4(), hint))
+		assert.Nil(t, err)
+		assert.Equal(t, "token", hintURL.Query().Get("share"))
+		assert.Equal(t, hint, hintFromQuery(hintURL.Query()))
+	}
+	assert.Nil(t, hintFromQuery(url.Values{}))
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// sessionCSRFTokenKey is the session value with the session's CSRF token
+	sessionCSRFTokenKey = "csrfToken"
+	// CSRFTokenField is the form field that the board's forms send the CSRF
+	// token in
+	CSRFTokenField = "csrf_token"
+	// CSRFTokenHeader is the header that the javascript app sends the CSRF
+	// token in
+	CSRFTokenHeader = "X-CSRF-Token"
+)
+
+// csrfToken returns the session's CSRF token, for pages to send back with
+// their form posts. Starts a session with a new token if there isn't one
+func csrfToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	s, err := session(r)
+	if err != nil && s == nil {
+		return "", err
+	}
+	if token, ok := s.Values[sessionCSRFTokenKey].(string); ok {
+		return token, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Error creating CSRF token: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	s.Values[sessionCSRFTokenKey] = token
+	if err := s.Save(r, w); err != nil {
+		return "", fmt.Errorf("Error saving session: %v", err)
+	}
+	return token, nil
+}
+
+// checkCSRFToken makes sure that a request that changes something came from
+// one of our pages, and not from a form on another site riding on the user's
+// session cookie. The token must be in CSRFTokenHeader or CSRFTokenField, and
+// match the session's.
+//
+// Requests with an API token are let through, since browsers never send those
+// by themselves.
+func checkCSRFToken(r *http.Request) error {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return nil
+	}
+	given := r.Header.Get(CSRFTokenHeader)
+	if given == "" {
+		given = r.PostFormValue(CSRFTokenField)
+	}
+	if given == "" {
+		return forbidden(fmt.Errorf("Missing CSRF token"))
+	}
+	s, err := session(r)
+	if err != nil {
+		return forbidden(fmt.Errorf("Invalid session"))
+	}
+	token, ok := s.Values[sessionCSRFTokenKey].(string)
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(given)) != 1 {
+		return forbidden(fmt.Errorf("Wrong CSRF token"))
+	}
+	return nil
+}
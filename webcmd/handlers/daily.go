@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	gorilla_mux "github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	uuid "github.com/satori/go.uuid"
+	"github.com/topher200/forty-thieves/libdb"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+// dailyHistoryLimit is how many of a user's attempts their history has
+const dailyHistoryLimit = 30
+
+// DailyAttempt is a user's attempt at a day's deal. The result fields are null
+// until it's submitted
+type DailyAttempt struct {
+	Date             string // like "2006-01-02"
+	GameID           int64
+	FirstGameStateID uuid.UUID
+	Submitted        bool
+	Score            *int64
+	Moves            *int64
+	Seconds          *float64 // from the start of the attempt until it was submitted
+	Rank             *int64   // among the day's submitted results
+}
+
+// DailyResult is a submitted result, ranked among the day's others
+type DailyResult struct {
+	Rank    int64
+	Name    string
+	Score   int64
+	Moves   int64
+	Seconds float64
+}
+
+// DailyDeal is a day's deal, with its results so far
+type DailyDeal struct {
+	Date    string
+	Results []DailyResult // best first: the lowest score, then the fewest moves, then the quickest
+}
+
+// DailySubmission is the body of a request to submit a daily result
+type DailySubmission struct {
+	GameStateID uuid.UUID // the game state the attempt finished on
+}
+
+func dailyDB(r *http.Request) *libdb.DailyDB {
+	return libdb.NewDailyDB(r.Context().Value("db").(*sqlx.DB))
+}
+
+// today is the date of today's deal. Days start at midnight UTC
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+// dailySeed is what the date's deal is dealt from: an HMAC of the date, keyed
+// with the server's daily secret, so that nobody can deal a day's cards before
+// the day starts
+func dailySeed(r *http.Request, date time.Time) int64 {
+	mac := hmac.New(sha256.New, r.Context().Value("dailySecret").([]byte))
+	mac.Write([]byte(date.Format(libdb.DailyDateFormat)))
+	return int64(binary.BigEndian.Uint64(mac.Sum(nil)))
+}
+
+// dailyDate parses the route's date, which may also be "today"
+func dailyDate(r *http.Request) (time.Time, error) {
+	date := gorilla_mux.Vars(r)["date"]
+	if date == "today" {
+		return today(), nil
+	}
+	parsed, err := time.Parse(libdb.DailyDateFormat, date)
+	if err != nil {
+		return time.Time{}, invalidRequest(
+			fmt.Errorf("Invalid date '%s', it must be like %s", date, libdb.DailyDateFormat))
+	}
+	return parsed, nil
+}
+
+// startDailyAttempt deals today's deal in a new game for the user, and saves
+// it as their attempt. Returns a conflict error if they've already attempted it
+func startDailyAttempt(r *http.Request, userID int64) (*libgame.GameState, error) {
+	db := r.Context().Value("db").(*sqlx.DB)
+	date := today()
+	_, err := dailyDB(r).GetAttempt(date, userID)
+	if err == nil {
+		return nil, conflict(fmt.Errorf("You've already attempted today's deal"))
+	} else if _, ok := err.(libdb.NotFoundError); !ok {
+		return nil, err
+	}
+
+	// the game, its first state and the attempt are saved together, so that
+	// an attempt always has a game to play
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	game, err := libdb.NewGameDB(db).CreateOwnedGame(tx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating new game: %v.", err)
+	}
+	gameState := libgame.DealSeededGame(*game, dailySeed(r, date))
+	if err := libdb.NewGameStateDB(db).SaveGameState(tx, gameState); err != nil {
+		return nil, fmt.Errorf("error saving gamestate: %v", err)
+	}
+	_, err = dailyDB(r).StartAttempt(tx, date, userID, gameState)
+	if _, ok := err.(libdb.DuplicateDailyAttemptError); ok {
+		return nil, conflict(fmt.Errorf("You've already attempted today's deal"))
+	} else if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &gameState, nil
+}
+
+// HandleAPIStartDaily starts the user's attempt at today's deal, and responds
+// with its first game state. Every user gets one attempt at each day's deal
+func HandleAPIStartDaily(w http.ResponseWriter, r *http.Request) {
+	userID, err := requireUserID(r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	gameState, err := startDailyAttempt(r, userID)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	replyWithAPIGameState(w, r, *gameState, true)
+}
+
+// dailyAttempt makes the DailyAttempt the API sends from the row
+func dailyAttempt(row libdb.DailyHistoryRow) DailyAttempt {
+	attempt := DailyAttempt{
+		Date:             row.Date.Format(libdb.DailyDateFormat),
+		GameID:           row.GameID,
+		FirstGameStateID: row.FirstGameState,
+		Submitted:        row.Submitted.Valid,
+	}
+	if attempt.Submitted {
+		attempt.Score = &row.Score.Int64
+		attempt.Moves = &row.Moves.Int64
+		attempt.Seconds = &row.Seconds.Float64
+		attempt.Rank = &row.Rank.Int64
+	}
+	return attempt
+}
+
+// HandleAPISubmitDaily submits the result of the user's attempt at the date's
+// deal, and responds with the DailyAttempt.
+//
+// The body is a JSON DailySubmission, naming the last game state in the
+// attempt's game, that the result is taken from. Results can only be
+// submitted once.
+func HandleAPISubmitDaily(w http.ResponseWriter, r *http.Request) {
+	userID, err := requireUserID(r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	date, err := dailyDate(r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	var submission DailySubmission
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&submission); err != nil {
+		replyWithAPIError(w, invalidRequest(fmt.Errorf("Invalid submission: %v", err)))
+		return
+	}
+
+	attempt, err := dailyDB(r).GetAttempt(date, userID)
+	if _, ok := err.(libdb.NotFoundError); ok {
+		replyWithAPIError(w, notFound(fmt.Errorf(
+			"You haven't attempted the deal for %s", date.Format(libdb.DailyDateFormat))))
+		return
+	} else if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	gameState, err := loadGameState(w, r, submission.GameStateID)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	if gameState.GameID != attempt.GameID {
+		replyWithAPIError(w, invalidRequest(fmt.Errorf(
+			"Game state %v isn't from your attempt", submission.GameStateID)))
+		return
+	}
+	// attempts can't branch, so the last game state is the only one without
+	// children
+	_, gameStateDB, err := databaseParams(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	children, err := gameStateDB.GetChildGameStates(*gameState)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	if len(children) > 0 {
+		replyWithAPIError(w, invalidRequest(fmt.Errorf(
+			"Game state %v isn't the last one in your attempt", submission.GameStateID)))
+		return
+	}
+
+	err = dailyDB(r).SubmitResult(nil, *attempt, *gameState)
+	if _, ok := err.(libdb.AlreadySubmittedError); ok {
+		replyWithAPIError(w, conflict(fmt.Errorf("You've already submitted your result")))
+		return
+	} else if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	ranked, err := dailyDB(r).GetRankedAttempt(date, userID)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, dailyAttempt(*ranked))
+}
+
+// HandleAPIDailyHistory responds with the user's DailyAttempts, newest first
+func HandleAPIDailyHistory(w http.ResponseWriter, r *http.Request) {
+	userID, err := requireUserID(r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	rows, err := dailyDB(r).GetHistory(userID, dailyHistoryLimit)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	attempts := make([]DailyAttempt, 0, len(rows))
+	for _, row := range rows {
+		attempts = append(attempts, dailyAttempt(row))
+	}
+	writeJSON(w, http.StatusOK, attempts)
+}
+
+// HandleAPIDailyDeal responds with the DailyDeal for the date, which can't be
+// after today
+func HandleAPIDailyDeal(w http.ResponseWriter, r *http.Request) {
+	date, err := dailyDate(r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	if date.After(today()) {
+		replyWithAPIError(w, notFound(
+			fmt.Errorf("There's no deal for %s yet", date.Format(libdb.DailyDateFormat))))
+		return
+	}
+	rows, err := dailyDB(r).GetResults(date)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	deal := &DailyDeal{
+		Date:    date.Format(libdb.DailyDateFormat),
+		Results: make([]DailyResult, 0, len(rows)),
+	}
+	for _, row := range rows {
+		deal.Results = append(deal.Results, DailyResult{
+			Rank:    row.Rank,
+			Name:    publicName(row.UserID, row.DisplayName),
+			Score:   row.Score,
+			Moves:   row.Moves,
+			Seconds: row.Seconds,
+		})
+	}
+	writeJSON(w, http.StatusOK, deal)
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func requestWithDailySecret(t *testing.T, secret string) *http.Request {
+	r, err := http.NewRequest("GET", "/", nil)
+	assert.Nil(t, err)
+	return r.WithContext(context.WithValue(r.Context(), "dailySecret", []byte(secret)))
+}
+
+func TestDailySeedNeedsTheSecret(t *testing.T) {
+	date := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	r := requestWithDailySecret(t, "secret")
+	assert.Equal(t, dailySeed(r, date), dailySeed(requestWithDailySecret(t, "secret"), date))
+	assert.NotEqual(t, dailySeed(r, date), dailySeed(r, date.AddDate(0, 0, 1)))
+	assert.NotEqual(t, dailySeed(r, date), dailySeed(requestWithDailySecret(t, "other"), date))
+}
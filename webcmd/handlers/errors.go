@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/topher200/forty-thieves/libhttp"
+)
+
+// Error codes sent in APIError.Code, one for each kind of error
+const (
+	CodeNotFound         = "not_found"
+	CodeInvalidRequest   = "invalid_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeIllegalMove      = "illegal_move"
+	CodeConflict         = "conflict"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal"
+)
+
+// handlerError is an error with the kind of failure it was, which decides the
+// status we respond with and the code the API sends. Errors of any other type
+// are internal errors
+type handlerError struct {
+	status int
+	code   string
+	err    error
+}
+
+func (e *handlerError) Error() string {
+	return e.err.Error()
+}
+
+// notFound is for ids that don't name a game or game state
+func notFound(err error) error {
+	return &handlerError{http.StatusNotFound, CodeNotFound, err}
+}
+
+// invalidRequest is for requests that are missing something or can't be decoded
+func invalidRequest(err error) error {
+	return &handlerError{http.StatusBadRequest, CodeInvalidRequest, err}
+}
+
+// unauthorized is for requests that need a logged in user, or logins that fail
+func unauthorized(err error) error {
+	return &handlerError{http.StatusUnauthorized, CodeUnauthorized, err}
+}
+
+// forbidden is for requests from users that aren't allowed to make them
+func forbidden(err error) error {
+	return &handlerError{http.StatusForbidden, CodeForbidden, err}
+}
+
+// illegalMove is for moves that the rules of the game don't allow
+func illegalMove(err error) error {
+	return &handlerError{http.StatusUnprocessableEntity, CodeIllegalMove, err}
+}
+
+// conflict is for changes that clash with what's already saved, like a move to
+// a game state that the game has already reached
+func conflict(err error) error {
+	return &handlerError{http.StatusConflict, CodeConflict, err}
+}
+
+func methodNotAllowed(err error) error {
+	return &handlerError{http.StatusMethodNotAllowed, CodeMethodNotAllowed, err}
+}
+
+// unsupportedMediaType is for API requests that change something, but aren't
+// sent as JSON
+func unsupportedMediaType(err error) error {
+	return &handlerError{http.StatusUnsupportedMediaType, CodeUnsupportedMedia, err}
+}
+
+// tooManyRequests is for clients that have used up their share of something
+// expensive, like solver searches
+func tooManyRequests(err error) error {
+	return &handlerError{http.StatusTooManyRequests, CodeTooManyRequests, err}
+}
+
+// unavailable is for requests the server is too busy to take on right now
+func unavailable(err error) error {
+	return &handlerError{http.StatusServiceUnavailable, CodeUnavailable, err}
+}
+
+// asHandlerError returns the error as a handlerError, making errors of any
+// other type internal errors
+func asHandlerError(err error) *handlerError {
+	if e, ok := err.(*handlerError); ok {
+		return e
+	}
+	return &handlerError{http.StatusInternalServerError, CodeInternal, err}
+}
+
+// replyWithError sends the error the way the routes outside of the API always
+// have, as {"Error": message}, with the status for its kind
+func replyWithError(w http.ResponseWriter, err error) {
+	e := asHandlerError(err)
+	if e.status >= http.StatusInternalServerError {
+		libhttp.HandleServerError(w, e.err)
+		return
+	}
+	libhttp.HandleClientError(w, e.err, e.status)
+}
+
+// HandleUnsupportedMediaType refuses an API request that isn't sent as JSON
+func HandleUnsupportedMediaType(w http.ResponseWriter, r *http.Request, err error) {
+	replyWithAPIError(w, unsupportedMediaType(err))
+}
+
+// HandleTooManyRequests refuses a request from a client that has made too many
+// like it lately: with an APIErrorResponse for the API's routes, plain text
+// for the board's, and a JSON error for the others
+func HandleTooManyRequests(w http.ResponseWriter, r *http.Request, err error) {
+	if strings.HasPrefix(r.URL.Path, APIPrefix+"/") {
+		replyWithAPIError(w, tooManyRequests(err))
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, BoardPrefix+"/") {
+		renderBoardError(w, tooManyRequests(err))
+		return
+	}
+	replyWithError(w, tooManyRequests(err))
+}
+
+// HandleUnauthorized refuses a request whose credentials don't check out: with
+// an APIErrorResponse for the API's routes, and a Basic auth challenge for the
+// others
+func HandleUnauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	if strings.HasPrefix(r.URL.Path, APIPrefix+"/") {
+		replyWithAPIError(w, unauthorized(err))
+		return
+	}
+	libhttp.BasicAuthUnauthorized(w, err)
+}
@@ -30,18 +30,20 @@ func databaseParams(
 
 // parseGameStateIdFromQuery gets the game state id from the URL
 //
-// Returns error on unexpected error. Returns uuid.Nil if no UUID is found.
+// Returns an invalid request error if the id isn't a UUID. Returns uuid.Nil if
+// no UUID is found.
 func parseGameStateIdFromQuery(r *http.Request) (uuid.UUID, error) {
 	queryStringValues, err := url.ParseQuery(r.URL.RawQuery)
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, invalidRequest(fmt.Errorf("Invalid query: %v", err))
 	}
 
 	gameStateIDString := queryStringValues.Get("gameStateID")
 	if queryStringValues.Get("gameStateID") != "" {
 		gameStateID, err := uuid.FromString(gameStateIDString)
 		if err != nil {
-			return uuid.Nil, err
+			return uuid.Nil, invalidRequest(
+				fmt.Errorf("Invalid game state id '%s': %v", gameStateIDString, err))
 		}
 		return gameStateID, nil
 	} else {
@@ -51,6 +53,9 @@ func parseGameStateIdFromQuery(r *http.Request) (uuid.UUID, error) {
 }
 
 // parseGameStateFromQuery parses the gameStateID and returns the GameState
+//
+// Returns an invalid request error if the id is missing, and a not found error
+// if there's no game state with the id.
 func parseGameStateFromQuery(w http.ResponseWriter, r *http.Request) (*libgame.GameState, error) {
 	// check query param
 	gameStateID, err := parseGameStateIdFromQuery(r)
@@ -58,62 +63,75 @@ func parseGameStateFromQuery(w http.ResponseWriter, r *http.Request) (*libgame.G
 		return nil, err
 	}
 	if gameStateID == uuid.Nil {
-		return nil, fmt.Errorf("Game state id required in query param")
+		return nil, invalidRequest(fmt.Errorf("Game state id required in query param"))
 	}
+	return loadGameState(w, r, gameStateID)
+}
+
+// GameStateWithChildren is a game state as the API sends it: with the ids of
+// the states that have been reached from it, and whether it can still be won
+type GameStateWithChildren struct {
+	GameID            int64
+	GameStateID       uuid.UUID
+	PreviousGameState uuid.NullUUID
+	MoveNum           int64
+	Stock             deck.Deck
+	Foundations       []deck.Deck
+	Tableaus          []deck.Deck
+	Waste             deck.Deck
+	Score             int
+	ChildGameStates   []uuid.UUID
+	Status            libgame.GameStatus
+	Lost              bool   // true if the game provably can't be won from here
+	LostReason        string // why the game can't be won, if Lost
+}
 
-	// get the referenced game state
+// gameStateWithChildren looks up the game state's children and status
+func gameStateWithChildren(
+	w http.ResponseWriter, r *http.Request,
+	gameState libgame.GameState) (*GameStateWithChildren, error) {
 	_, gameStateDB, err := databaseParams(w, r)
 	if err != nil {
 		return nil, err
 	}
-	// NOTE: we currently don't do any checking to make sure game state id
-	// and user id match
-	gameState, err := gameStateDB.GetGameStateById(gameStateID)
+	childGameStates, err := gameStateDB.GetChildGameStates(gameState)
 	if err != nil {
-		return nil, fmt.Errorf("Game state id %v not found: %v", gameStateID, err)
+		return nil, err
 	}
-	return gameState, nil
+
+	gs := &GameStateWithChildren{
+		GameID:            gameState.GameID,
+		GameStateID:       gameState.GameStateID,
+		PreviousGameState: gameState.PreviousGameState,
+		MoveNum:           gameState.MoveNum,
+		Stock:             gameState.Stock,
+		Foundations:       gameState.Foundations,
+		Tableaus:          gameState.Tableaus,
+		Waste:             gameState.Waste,
+		Score:             gameState.Score,
+		ChildGameStates:   childGameStates,
+		Status:            gameState.Status(),
+	}
+	if lost, card := libsolver.ProvablyLost(&gameState); lost {
+		gs.Lost = true
+		gs.LostReason = libsolver.DescribeLostCard(card)
+	}
+	return gs, nil
 }
 
 // replyWithGameState sends a JSON reponse with the given game state
 func replyWithGameState(w http.ResponseWriter, r *http.Request, gameState libgame.GameState) {
-	type GameStateWithChildren struct {
-		GameID            int64
-		GameStateID       uuid.UUID
-		PreviousGameState uuid.NullUUID
-		MoveNum           int64
-		Stock             deck.Deck
-		Foundations       []deck.Deck
-		Tableaus          []deck.Deck
-		Waste             deck.Deck
-		Score             int
-		ChildGameStates   []uuid.UUID
-	}
-
-	// get children
-	_, gameStateDB, err := databaseParams(w, r)
-	childGameStates, err := gameStateDB.GetChildGameStates(gameState)
+	gs, err := gameStateWithChildren(w, r, gameState)
 	if err != nil {
-		libhttp.HandleServerError(w, err)
+		replyWithError(w, err)
 		return
 	}
+	replyWithJSON(w, gs)
+}
 
-	// make new struct with children
-	gs := GameStateWithChildren{
-		gameState.GameID,
-		gameState.GameStateID,
-		gameState.PreviousGameState,
-		gameState.MoveNum,
-		gameState.Stock,
-		gameState.Foundations,
-		gameState.Tableaus,
-		gameState.Waste,
-		gameState.Score,
-		childGameStates,
-	}
-
-	// convert to json and send
-	data, err := json.Marshal(&gs)
+// replyWithJSON sends the value as a JSON response
+func replyWithJSON(w http.ResponseWriter, value interface{}) {
+	data, err := json.Marshal(value)
 	if err != nil {
 		libhttp.HandleServerError(w, err)
 		return
@@ -126,79 +144,151 @@ func replyWithGameState(w http.ResponseWriter, r *http.Request, gameState libgam
 func HandleStateRequest(w http.ResponseWriter, r *http.Request) {
 	gameStateID, err := parseGameStateIdFromQuery(r)
 	if err != nil {
-		libhttp.HandleServerError(w, err)
+		replyWithError(w, err)
 		return
 	}
 
-	gameDB, gameStateDB, err := databaseParams(w, r)
-	if err != nil {
-		libhttp.HandleServerError(w, err)
-		return
-	}
 	// If the game state id for the request is empty, send the latest game
 	// state. Otherwise, send the one requested
 	var gameState *libgame.GameState
 	if gameStateID != uuid.Nil {
 		logrus.Infof("getting gamestate for gamestate id %v", gameStateID)
-		gameState, err = gameStateDB.GetGameStateById(gameStateID)
-		if err != nil {
-			libhttp.HandleClientError(w,
-				fmt.Errorf("Game state id %v not found: %v", gameStateID, err),
-				http.StatusBadRequest)
-			return
-		}
+		gameState, err = loadGameState(w, r, gameStateID)
 	} else {
 		logrus.Infof("no game state provided - finding latest game")
-		// request is empty, find the latest
-		game, err := gameDB.GetLatestGame()
-		if err != nil {
-			libhttp.HandleClientError(w, fmt.Errorf("No game found: %v", err), http.StatusBadRequest)
-			return
-		}
-		gameState, err = gameStateDB.GetFirstGameState(*game)
-		if err != nil {
-			libhttp.HandleServerError(w, err)
-			return
-		}
+		gameState, err = latestGameState(w, r)
+	}
+	if err != nil {
+		replyWithError(w, err)
+		return
 	}
 
 	replyWithGameState(w, r, *gameState)
 }
 
-// saveGameStateAndRespond saves GameState to the DB, replies with the new state.
+// loadGameState gets the game state with the given id
+func loadGameState(
+	w http.ResponseWriter, r *http.Request, gameStateID uuid.UUID) (*libgame.GameState, error) {
+	_, gameStateDB, err := databaseParams(w, r)
+	if err != nil {
+		return nil, err
+	}
+	// anyone can look at a game state. checkCanMove decides who can move
+	gameState, err := gameStateDB.GetGameStateById(gameStateID)
+	if _, ok := err.(libdb.NotFoundError); ok {
+		return nil, notFound(fmt.Errorf("Game state id %v not found", gameStateID))
+	} else if err != nil {
+		return nil, err
+	}
+	return gameState, nil
+}
+
+// latestGameState gets the first game state of the latest game
+func latestGameState(w http.ResponseWriter, r *http.Request) (*libgame.GameState, error) {
+	gameDB, gameStateDB, err := databaseParams(w, r)
+	if err != nil {
+		return nil, err
+	}
+	game, err := gameDB.GetLatestGame()
+	if _, ok := err.(libdb.NotFoundError); ok {
+		return nil, notFound(fmt.Errorf("No game found"))
+	} else if err != nil {
+		return nil, err
+	}
+	return gameStateDB.GetFirstGameState(*game)
+}
+
+// saveGameState saves a new game state to the DB
 //
-// Sends a json response with the new state using the /state route.
-func saveGameStateAndRespond(
-	w http.ResponseWriter, r *http.Request, gameState libgame.GameState) {
+// Returns a conflict error if the game has already reached the same state.
+func saveGameState(
+	w http.ResponseWriter, r *http.Request, tx *sqlx.Tx, gameState libgame.GameState) error {
 	_, gameStateDB, err := databaseParams(w, r)
 	if err != nil {
-		libhttp.HandleServerError(w, fmt.Errorf("Error getting database params: %v.", err))
-		return
+		return fmt.Errorf("Error getting database params: %v.", err)
 	}
-	err = gameStateDB.SaveGameState(nil, gameState)
+	err = gameStateDB.SaveGameState(tx, gameState)
+	if _, ok := err.(libdb.DuplicateGameStateError); ok {
+		return conflict(fmt.Errorf("The game has already reached this game state"))
+	} else if err != nil {
+		return fmt.Errorf("error saving gamestate: %v", err)
+	}
+	return nil
+}
+
+// newGame creates a new game and saves its first game state. Games dealt by a
+// logged in user belong to them
+func newGame(w http.ResponseWriter, r *http.Request) (*libgame.GameState, error) {
+	gameDB, _, err := databaseParams(w, r)
 	if err != nil {
-		libhttp.HandleServerError(w, fmt.Errorf("error saving gamestate: %v", err))
-		return
+		return nil, fmt.Errorf("Error getting database params: %v.", err)
+	}
+	var game *libgame.Game
+	if userID, ok := currentUserID(r); ok {
+		game, err = gameDB.CreateOwnedGame(nil, userID)
+	} else {
+		game, err = gameDB.CreateNewGame(nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error creating new game: %v.", err)
+	}
+	gameState := libgame.DealNewGame(*game)
+	if err := saveGameState(w, r, nil, gameState); err != nil {
+		return nil, err
 	}
-	replyWithGameState(w, r, gameState)
+	return &gameState, nil
 }
 
 // HandleNewGameRequest saves a new GameState to the DB
 //
 // We respond just like a /state request
 func HandleNewGameRequest(w http.ResponseWriter, r *http.Request) {
-	gameDB, _, err := databaseParams(w, r)
-	if err != nil {
-		libhttp.HandleServerError(w, fmt.Errorf("Error getting database params: %v.", err))
+	if err := checkCSRFToken(r); err != nil {
+		replyWithError(w, err)
 		return
 	}
-	game, err := gameDB.CreateNewGame(nil)
+	gameState, err := newGame(w, r)
 	if err != nil {
-		libhttp.HandleServerError(w, fmt.Errorf("Error creating new game: %v.", err))
+		replyWithError(w, err)
 		return
 	}
-	gameState := libgame.DealNewGame(*game)
-	saveGameStateAndRespond(w, r, gameState)
+	replyWithGameState(w, r, *gameState)
+}
+
+// makeMove makes the move from the game state and saves the new state. The
+// move may be libsolver.FlipStockMove
+func makeMove(
+	w http.ResponseWriter, r *http.Request, gameState libgame.GameState,
+	move libgame.MoveRequest) (*libgame.GameState, error) {
+	if err := checkCanMove(w, r, gameState); err != nil {
+		return nil, err
+	}
+	if err := libsolver.ApplyMove(&gameState, move); err != nil {
+		if move == libsolver.FlipStockMove {
+			return nil, illegalMove(fmt.Errorf("can't flip stock: %v", err))
+		}
+		return nil, illegalMove(fmt.Errorf("invalid move: %v", err))
+	}
+	if err := saveMove(w, r, gameState); err != nil {
+		return nil, err
+	}
+	return &gameState, nil
+}
+
+// foundationCard moves a card onto a foundation and saves the new state
+func foundationCard(
+	w http.ResponseWriter, r *http.Request,
+	gameState libgame.GameState) (*libgame.GameState, error) {
+	if err := checkCanMove(w, r, gameState); err != nil {
+		return nil, err
+	}
+	if err := libsolver.FoundationAvailableCard(&gameState); err != nil {
+		return nil, illegalMove(fmt.Errorf("can't foundation any cards: %v", err))
+	}
+	if err := saveMove(w, r, gameState); err != nil {
+		return nil, err
+	}
+	return &gameState, nil
 }
 
 // Although it's weird, the docs want our decoder to be a global
@@ -212,25 +302,28 @@ var decoder = schema.NewDecoder()
 // TODO(topher): change these to "respond like HandleMoveRequest"
 // We respond just like a /state request
 func HandleMoveRequest(w http.ResponseWriter, r *http.Request) {
+	if err := checkCSRFToken(r); err != nil {
+		replyWithError(w, err)
+		return
+	}
 	gameState, err := parseGameStateFromQuery(w, r)
 	if err != nil {
-		libhttp.HandleServerError(w, fmt.Errorf("failure to get game state: %v", err))
+		replyWithError(w, err)
 		return
 	}
 
 	// Parse the request from json
 	err = r.ParseForm()
 	if err != nil {
-		libhttp.HandleServerError(
-			w, fmt.Errorf("failure to decode move request: %v", err))
+		replyWithError(w, invalidRequest(fmt.Errorf("failure to decode move request: %v", err)))
 		return
 	}
 	var moveRequest libgame.MoveRequest
 	err = decoder.Decode(&moveRequest, r.PostForm)
 	if err != nil {
-		libhttp.HandleServerError(
-			w, fmt.Errorf("failure to decode move request: %v. form values: %v",
-				err, r.PostForm))
+		replyWithError(w, invalidRequest(
+			fmt.Errorf("failure to decode move request: %v. form values: %v",
+				err, r.PostForm)))
 		return
 	}
 	log.Printf("Handling move request from %s-%d to %s-%d\n",
@@ -238,45 +331,224 @@ func HandleMoveRequest(w http.ResponseWriter, r *http.Request) {
 		moveRequest.ToPile, moveRequest.ToIndex)
 
 	// Move the card
-	err = gameState.MoveCard(moveRequest)
+	newGameState, err := makeMove(w, r, *gameState, moveRequest)
 	if err != nil {
-		libhttp.HandleClientError(w, fmt.Errorf("invalid move: %v", err), http.StatusBadRequest)
+		replyWithError(w, err)
 		return
 	}
-
-	saveGameStateAndRespond(w, r, *gameState)
+	replyWithGameState(w, r, *newGameState)
 }
 
 func HandleFlipStockRequest(w http.ResponseWriter, r *http.Request) {
+	if err := checkCSRFToken(r); err != nil {
+		replyWithError(w, err)
+		return
+	}
 	gameState, err := parseGameStateFromQuery(w, r)
 	if err != nil {
-		libhttp.HandleServerError(w, fmt.Errorf("failure to get game state: %v", err))
+		replyWithError(w, err)
 		return
 	}
 
-	err = gameState.FlipStock()
+	newGameState, err := makeMove(w, r, *gameState, libsolver.FlipStockMove)
 	if err != nil {
-		libhttp.HandleClientError(w, fmt.Errorf("can't flip stock: %v", err),
-			http.StatusBadRequest)
+		replyWithError(w, err)
 		return
 	}
-
-	saveGameStateAndRespond(w, r, *gameState)
+	replyWithGameState(w, r, *newGameState)
 }
 
 func HandleFoundationAvailableCardRequest(w http.ResponseWriter, r *http.Request) {
+	if err := checkCSRFToken(r); err != nil {
+		replyWithError(w, err)
+		return
+	}
+	gameState, err := parseGameStateFromQuery(w, r)
+	if err != nil {
+		replyWithError(w, err)
+		return
+	}
+
+	newGameState, err := foundationCard(w, r, *gameState)
+	if err != nil {
+		replyWithError(w, err)
+		return
+	}
+	replyWithGameState(w, r, *newGameState)
+}
+
+// hintMaxExpanded keeps the search behind a /hint request quick
+const hintMaxExpanded = 20000
+
+// Hint is a suggested next move, from a short search
+type Hint struct {
+	Move      *libgame.MoveRequest // nil if the search found nothing better than the current state
+	Solved    bool                 // true if the search found a solution
+	Moves     []libgame.MoveRequest
+	BestScore int
+}
+
+// findHint runs a short beam search from the state
+func findHint(gameState libgame.GameState) (*Hint, error) {
+	pruner, err := libsolver.NewPruner(libsolver.DefaultPruningRules)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating pruner: %v.", err)
+	}
+	result, err := libsolver.SolveBeam(gameState, libsolver.BeamOptions{
+		SearchOptions: libsolver.SearchOptions{
+			Pruner:       pruner,
+			MoveOrdering: &libsolver.DefaultMoveOrderingWeights,
+			MaxExpanded:  hintMaxExpanded,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error searching for hint: %v.", err)
+	}
+
+	hint := &Hint{
+		Solved:    result.Solved,
+		Moves:     result.BestPath,
+		BestScore: result.BestState.Score,
+	}
+	if len(result.BestPath) > 0 {
+		hint.Move = &result.BestPath[0]
+	}
+	return hint, nil
+}
+
+// HandleHintRequest suggests the next move for the game state.
+//
+// Runs a short beam search from the state. Responds with a Hint: the suggested
+// Move, whether the search found a solution and the moves to the best state
+// it reached. The move may be libsolver.FlipStockMove, meaning the stock
+// should be flipped.
+func HandleHintRequest(w http.ResponseWriter, r *http.Request) {
+	gameState, err := parseGameStateFromQuery(w, r)
+	if err != nil {
+		replyWithError(w, err)
+		return
+	}
+
+	hint, err := askForHint(w, r, *gameState)
+	if err != nil {
+		replyWithError(w, err)
+		return
+	}
+	replyWithJSON(w, hint)
+}
+
+// gameDifficulty gets the saved difficulty of the game state's game.
+//
+// Returns a not found error if the game hasn't been rated yet.
+func gameDifficulty(
+	w http.ResponseWriter, r *http.Request,
+	gameState libgame.GameState) (*libsolver.Difficulty, error) {
+	gameDB, _, err := databaseParams(w, r)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting database params: %v.", err)
+	}
+	saved, err := gameDB.GetDifficulty(libgame.Game{ID: gameState.GameID})
+	if _, ok := err.(libdb.NotFoundError); ok {
+		return nil, notFound(fmt.Errorf("Game %d not found", gameState.GameID))
+	} else if err != nil {
+		return nil, fmt.Errorf("Error getting difficulty: %v.", err)
+	}
+	if saved == nil {
+		return nil, notFound(fmt.Errorf("Game %d hasn't been rated yet", gameState.GameID))
+	}
+
+	var difficulty libsolver.Difficulty
+	err = saved.Details.Unmarshal(&difficulty)
+	if err != nil {
+		return nil, fmt.Errorf("Error unmarshalling difficulty: %v.", err)
+	}
+	return &difficulty, nil
+}
+
+// rateGameDifficulty rates the game state's game from its first game state,
+// and saves the rating. Games that have already been rated keep their rating.
+func rateGameDifficulty(
+	w http.ResponseWriter, r *http.Request,
+	gameState libgame.GameState) (*libsolver.Difficulty, error) {
+	difficulty, err := gameDifficulty(w, r, gameState)
+	if err == nil || asHandlerError(err).status != http.StatusNotFound {
+		return difficulty, err
+	}
+
+	gameDB, gameStateDB, err := databaseParams(w, r)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting database params: %v.", err)
+	}
+	game := libgame.Game{ID: gameState.GameID}
+	firstGameState, err := gameStateDB.GetFirstGameState(game)
+	if err != nil {
+		return nil, err
+	}
+	pruner, err := libsolver.NewPruner(libsolver.DefaultPruningRules)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating pruner: %v.", err)
+	}
+	rated, err := libsolver.RateDifficulty(*firstGameState, libsolver.DifficultyOptions{
+		Search: libsolver.BeamOptions{
+			SearchOptions: libsolver.SearchOptions{Pruner: pruner},
+		},
+		Playouts: libsolver.PlayoutOptions{Pruner: pruner, Seed: game.ID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error rating difficulty: %v.", err)
+	}
+	details, err := json.Marshal(rated)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling difficulty: %v.", err)
+	}
+	err = gameDB.SaveDifficulty(nil, game, libdb.Difficulty{
+		Score:   rated.Score,
+		Rating:  string(rated.Rating),
+		Details: details,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rated, nil
+}
+
+// HandleDifficultyRequest responds with the saved difficulty of the game
+// state's game, as a libsolver.Difficulty. Games are rated by posting to the
+// same route
+func HandleDifficultyRequest(w http.ResponseWriter, r *http.Request) {
 	gameState, err := parseGameStateFromQuery(w, r)
 	if err != nil {
-		libhttp.HandleServerError(w, fmt.Errorf("failure to get game state: %v", err))
+		replyWithError(w, err)
+		return
+	}
+
+	difficulty, err := gameDifficulty(w, r, *gameState)
+	if err != nil {
+		replyWithError(w, err)
 		return
 	}
+	replyWithJSON(w, difficulty)
+}
 
-	err = libsolver.FoundationAvailableCard(gameState)
+// HandleRateDifficultyRequest rates the game state's game, if it hasn't been
+// rated yet, and responds with its libsolver.Difficulty.
+//
+// Rating runs a search, so it can take a few seconds.
+func HandleRateDifficultyRequest(w http.ResponseWriter, r *http.Request) {
+	if err := checkCSRFToken(r); err != nil {
+		replyWithError(w, err)
+		return
+	}
+	gameState, err := parseGameStateFromQuery(w, r)
 	if err != nil {
-		libhttp.HandleClientError(w, fmt.Errorf("can't foundation any cards: %v", err),
-			http.StatusBadRequest)
+		replyWithError(w, err)
 		return
 	}
 
-	saveGameStateAndRespond(w, r, *gameState)
+	difficulty, err := rateGameDifficulty(w, r, *gameState)
+	if err != nil {
+		replyWithError(w, err)
+		return
+	}
+	replyWithJSON(w, difficulty)
 }
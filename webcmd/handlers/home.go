@@ -10,7 +10,12 @@ import (
 func GetHome(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 
-	data := struct{}{}
+	token, err := csrfToken(w, r)
+	if err != nil {
+		libhttp.HandleServerError(w, err)
+		return
+	}
+	data := struct{ CSRFToken string }{token}
 
 	tmpl, err := template.ParseFiles("templates/dashboard.html.tmpl", "templates/home.html.tmpl")
 	if err != nil {
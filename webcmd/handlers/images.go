@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/topher200/forty-thieves/libgame"
+	"github.com/topher200/forty-thieves/librender"
+)
+
+// replyWithBoardImage draws the route's game state with the render function,
+// and sends the picture with the content type.
+//
+// Game states never change once they're saved, so their pictures can be
+// cached for as long as anyone likes.
+func replyWithBoardImage(
+	w http.ResponseWriter, r *http.Request, contentType string,
+	render func(io.Writer, libgame.GameState) error) {
+	gameState, err := apiGameState(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := render(&buf, *gameState); err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	buf.WriteTo(w)
+}
+
+// HandleAPIBoardSVG responds with an SVG picture of the game state's piles
+func HandleAPIBoardSVG(w http.ResponseWriter, r *http.Request) {
+	replyWithBoardImage(w, r, librender.SVGContentType, librender.WriteSVG)
+}
+
+// HandleAPIBoardPNG responds with a PNG picture of the game state's piles
+func HandleAPIBoardPNG(w http.ResponseWriter, r *http.Request) {
+	replyWithBoardImage(w, r, librender.PNGContentType, librender.WritePNG)
+}
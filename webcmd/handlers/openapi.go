@@ -0,0 +1,1145 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// HandleOpenAPIRequest responds with the OpenAPI document describing every
+// route of the web app
+func HandleOpenAPIRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(openAPISpec))
+}
+
+// openAPISpec describes the web app's routes and payloads. libclient is
+// written from it, and webcmd's tests check it against the router and the
+// types that handlers send.
+const openAPISpec = `{
+  "openapi": "3.0.0",
+  "info": {
+    "title": "forty-thieves",
+    "description": "Play and solve games of Forty Thieves solitaire. The routes under /api/v1 are the versioned JSON API; the others are kept for the web app. Any request may authenticate as a user with Basic auth (their email and password) or Bearer auth (one of their API tokens), instead of logging in. Credentials that don't check out fail with 401. API requests that change something must be sent as application/json, even without a body, and the others' posts must carry the session's CSRF token, in the X-CSRF-Token header or the csrf_token form field, unless they use Bearer auth.",
+    "version": "1.0.0"
+  },
+  "security": [{}, {"basicAuth": []}, {"bearerAuth": []}],
+  "paths": {
+    "/api/v1/games": {
+      "post": {
+        "operationId": "newGame",
+        "summary": "Deal a new game",
+        "responses": {
+          "201": {"$ref": "#/components/responses/CreatedGameState"},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/states/latest": {
+      "get": {
+        "operationId": "getLatestState",
+        "summary": "Get the first game state of the latest game",
+        "responses": {
+          "200": {"$ref": "#/components/responses/GameState"},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/states/{id}": {
+      "get": {
+        "operationId": "getState",
+        "summary": "Get a game state",
+        "parameters": [{"$ref": "#/components/parameters/GameStateIDPath"}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/GameState"},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/states/{id}/moves": {
+      "post": {
+        "operationId": "move",
+        "summary": "Make a move from a game state",
+        "description": "The stock is flipped with the move from stock 0 to waste 0, so that moves from a hint can be sent as they are. Moves the game doesn't allow fail with illegal_move, and moves to a game state the game has already reached fail with conflict. Daily attempts can't be undone, so moves from a game state in one that has already been moved from fail with illegal_move. Only the owner of an owned game, or someone with its share token, can move in it.",
+        "parameters": [
+          {"$ref": "#/components/parameters/GameStateIDPath"},
+          {"$ref": "#/components/parameters/ShareTokenQuery"}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/MoveRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/CreatedGameState"},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/states/{id}/foundationcard": {
+      "post": {
+        "operationId": "foundationCard",
+        "summary": "Move a card onto a foundation",
+        "parameters": [
+          {"$ref": "#/components/parameters/GameStateIDPath"},
+          {"$ref": "#/components/parameters/ShareTokenQuery"}
+        ],
+        "responses": {
+          "201": {"$ref": "#/components/responses/CreatedGameState"},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/states/{id}/hint": {
+      "get": {
+        "operationId": "getHint",
+        "summary": "Suggest the next move, from a short search",
+        "description": "Asking for a hint counts towards the owner's stats if you can move in the game. Hints in a daily attempt fail with forbidden until its result is submitted. Each user, or address if not logged in, gets a burst of 10 hints and ratings, then one more every 6 seconds; beyond that the request fails with 429 and a Retry-After header.",
+        "parameters": [
+          {"$ref": "#/components/parameters/GameStateIDPath"},
+          {"$ref": "#/components/parameters/ShareTokenQuery"}
+        ],
+        "responses": {
+          "200": {
+            "description": "The hint",
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/Hint"}}
+            }
+          },
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/states/{id}/difficulty": {
+      "get": {
+        "operationId": "getDifficulty",
+        "summary": "Get how hard the game state's game was rated",
+        "description": "Fails with not_found if the game hasn't been rated yet.",
+        "parameters": [{"$ref": "#/components/parameters/GameStateIDPath"}],
+        "responses": {
+          "200": {
+            "description": "The difficulty",
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/Difficulty"}}
+            }
+          },
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      },
+      "post": {
+        "operationId": "rateDifficulty",
+        "summary": "Rate how hard the game state's game is, from a short search",
+        "description": "Games that have already been rated keep their rating. Only admins can rate games, since each rating runs a search and playouts. Limited along with hints, failing with 429 and a Retry-After header.",
+        "security": [{"cookieAuth": []}, {"basicAuth": []}, {"bearerAuth": []}],
+        "parameters": [{"$ref": "#/components/parameters/GameStateIDPath"}],
+        "responses": {
+          "200": {
+            "description": "The difficulty",
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/Difficulty"}}
+            }
+          },
+          "401": {"description": "No credentials, or credentials that don't check out"},
+          "403": {"description": "The user isn't an admin"},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/states/{id}/share": {
+      "get": {
+        "operationId": "getShare",
+        "summary": "Get the token that lets others play the game state's game",
+        "description": "Only the game's owner can share it. Games without an owner fail with not_found, since anyone can already play them.",
+        "parameters": [{"$ref": "#/components/parameters/GameStateIDPath"}],
+        "responses": {
+          "200": {
+            "description": "The share token",
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/Share"}}
+            }
+          },
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/states/{id}/board.svg": {
+      "get": {
+        "operationId": "getBoardSVG",
+        "summary": "Draw the game state's piles as an SVG picture",
+        "description": "The foundations, the waste and how many cards are left in the stock along the top, and the tableaus below. Pictures never change, so they can be cached.",
+        "parameters": [{"$ref": "#/components/parameters/GameStateIDPath"}],
+        "responses": {
+          "200": {"description": "The picture", "content": {"image/svg+xml": {}}},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/states/{id}/board.png": {
+      "get": {
+        "operationId": "getBoardPNG",
+        "summary": "Draw the game state's piles as a PNG picture",
+        "description": "The same picture as board.svg.",
+        "parameters": [{"$ref": "#/components/parameters/GameStateIDPath"}],
+        "responses": {
+          "200": {"description": "The picture", "content": {"image/png": {}}},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/states/{id}/tree": {
+      "get": {
+        "operationId": "getStateTree",
+        "summary": "Get the tree of game states reached from the game state",
+        "description": "Each game state in the tree has its score, the move to it and the solver's status for it, with counts summing up it and its descendants. Trees that hit the limit keep the game states closest to the root. Leaves with more children than the tree has can be explored with their own trees.",
+        "parameters": [
+          {"$ref": "#/components/parameters/GameStateIDPath"},
+          {"$ref": "#/components/parameters/TreeDepthQuery"},
+          {"$ref": "#/components/parameters/TreeLimitQuery"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/GameTree"},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/games/{id}/tree": {
+      "get": {
+        "operationId": "getGameTree",
+        "summary": "Get the tree of game states reached from the game's first game state",
+        "parameters": [
+          {
+            "name": "id",
+            "in": "path",
+            "required": true,
+            "schema": {"type": "integer", "format": "int64"}
+          },
+          {"$ref": "#/components/parameters/TreeDepthQuery"},
+          {"$ref": "#/components/parameters/TreeLimitQuery"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/GameTree"},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/users": {
+      "post": {
+        "operationId": "signup",
+        "summary": "Create a user and log them in",
+        "description": "Emails must be unique, or the request fails with conflict. Passwords must be at least 8 characters. Games dealt while logged in belong to the user.",
+        "requestBody": {"$ref": "#/components/requestBodies/Credentials"},
+        "responses": {
+          "201": {"$ref": "#/components/responses/LoggedIn"},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/users/me": {
+      "get": {
+        "operationId": "getMe",
+        "summary": "Get the logged in user",
+        "responses": {
+          "200": {
+            "description": "The user",
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/User"}}
+            }
+          },
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/users/me/name": {
+      "put": {
+        "operationId": "setDisplayName",
+        "summary": "Change the name other users see the user as",
+        "description": "The leaderboard and the daily results show users by their display name, or until they choose one by a handle like \"player-12\". Display names are unique, ignoring case, or the request fails with conflict.",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/NewDisplayName"}}
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "The user",
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/User"}}
+            }
+          },
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/users/me/stats": {
+      "get": {
+        "operationId": "getStats",
+        "summary": "Sum up the games the user has dealt",
+        "responses": {
+          "200": {
+            "description": "The user's stats",
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/UserStats"}}
+            }
+          },
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/leaderboard": {
+      "get": {
+        "operationId": "getLeaderboard",
+        "summary": "List the users who have won the most games, best first",
+        "description": "Users who have won as many games are ranked by their fewest moves to win, then by their quickest win. Users who haven't won a game aren't listed.",
+        "parameters": [
+          {
+            "name": "limit",
+            "in": "query",
+            "description": "How many users to list",
+            "schema": {"type": "integer", "minimum": 1, "maximum": 100, "default": 10}
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The leaderboard",
+            "content": {
+              "application/json": {
+                "schema": {"type": "array", "items": {"$ref": "#/components/schemas/LeaderboardEntry"}}
+              }
+            }
+          },
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/daily/attempts": {
+      "post": {
+        "operationId": "startDaily",
+        "summary": "Start the user's attempt at today's deal",
+        "description": "Every user gets one attempt at each day's deal, so a second attempt fails with conflict. Everyone's attempt starts with the same cards. Days start at midnight UTC. An attempt is one line of play: moves in it can't be undone, and hints fail with forbidden until its result is submitted.",
+        "responses": {
+          "201": {"$ref": "#/components/responses/CreatedGameState"},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      },
+      "get": {
+        "operationId": "getDailyHistory",
+        "summary": "List the user's attempts at daily deals, newest first",
+        "responses": {
+          "200": {
+            "description": "The user's last 30 attempts",
+            "content": {
+              "application/json": {
+                "schema": {"type": "array", "items": {"$ref": "#/components/schemas/DailyAttempt"}}
+              }
+            }
+          },
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/daily/attempts/{date}/result": {
+      "post": {
+        "operationId": "submitDaily",
+        "summary": "Submit the result of the user's attempt at the date's deal",
+        "description": "The result is taken from the game state, which must be the last one in the attempt's game. Results can only be submitted once, or the request fails with conflict.",
+        "parameters": [{"$ref": "#/components/parameters/DailyDatePath"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/DailySubmission"}}
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "The attempt, with its result and rank",
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/DailyAttempt"}}
+            }
+          },
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/daily/{date}": {
+      "get": {
+        "operationId": "getDailyDeal",
+        "summary": "Get the date's deal, with its results so far",
+        "description": "Dates after today fail with not_found.",
+        "parameters": [{"$ref": "#/components/parameters/DailyDatePath"}],
+        "responses": {
+          "200": {
+            "description": "The deal",
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/DailyDeal"}}
+            }
+          },
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/login": {
+      "post": {
+        "operationId": "login",
+        "summary": "Log a user in",
+        "description": "A wrong email or password fails with unauthorized.",
+        "requestBody": {"$ref": "#/components/requestBodies/Credentials"},
+        "responses": {
+          "200": {"$ref": "#/components/responses/LoggedIn"},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/logout": {
+      "post": {
+        "operationId": "logout",
+        "summary": "Log the user out",
+        "responses": {
+          "204": {"description": "Logged out"},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/tokens": {
+      "post": {
+        "operationId": "createToken",
+        "summary": "Create an API token for the user",
+        "description": "The response is the only time the token is sent. Send it back as \"Authorization: Bearer <Token>\".",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/NewAPIToken"}}
+          }
+        },
+        "responses": {
+          "201": {
+            "description": "The new token",
+            "headers": {
+              "Location": {
+                "description": "The token's path",
+                "schema": {"type": "string"}
+              }
+            },
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/APIToken"}}
+            }
+          },
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      },
+      "get": {
+        "operationId": "getTokens",
+        "summary": "List the user's API tokens, without the tokens themselves",
+        "responses": {
+          "200": {
+            "description": "The tokens, oldest first",
+            "content": {
+              "application/json": {
+                "schema": {"type": "array", "items": {"$ref": "#/components/schemas/APIToken"}}
+              }
+            }
+          },
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/api/v1/tokens/{tokenID}": {
+      "delete": {
+        "operationId": "deleteToken",
+        "summary": "Delete one of the user's API tokens",
+        "parameters": [
+          {
+            "name": "tokenID",
+            "in": "path",
+            "required": true,
+            "schema": {"type": "integer", "format": "int64"}
+          }
+        ],
+        "responses": {
+          "204": {"description": "Deleted"},
+          "default": {"$ref": "#/components/responses/APIError"}
+        }
+      }
+    },
+    "/openapi.json": {
+      "get": {
+        "summary": "Get this document",
+        "responses": {
+          "200": {
+            "description": "The OpenAPI document",
+            "content": {"application/json": {"schema": {"type": "object"}}}
+          }
+        }
+      }
+    },
+    "/": {
+      "get": {
+        "summary": "The web app",
+        "responses": {
+          "200": {"description": "The page", "content": {"text/html": {}}}
+        }
+      }
+    },
+    "/state": {
+      "get": {
+        "summary": "Get a game state, or the latest game's first state if no id is given",
+        "parameters": [{"$ref": "#/components/parameters/OptionalGameStateIDQuery"}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/LegacyGameState"},
+          "default": {"$ref": "#/components/responses/LegacyError"}
+        }
+      }
+    },
+    "/newgame": {
+      "post": {
+        "summary": "Deal a new game",
+        "responses": {
+          "200": {"$ref": "#/components/responses/LegacyGameState"},
+          "default": {"$ref": "#/components/responses/LegacyError"}
+        }
+      }
+    },
+    "/move": {
+      "post": {
+        "summary": "Make a move from a game state",
+        "parameters": [
+          {"$ref": "#/components/parameters/GameStateIDQuery"},
+          {"$ref": "#/components/parameters/ShareTokenQuery"}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/MoveRequest"}}
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/LegacyGameState"},
+          "default": {"$ref": "#/components/responses/LegacyError"}
+        }
+      }
+    },
+    "/flipstock": {
+      "post": {
+        "summary": "Flip a card from the stock to the waste",
+        "parameters": [
+          {"$ref": "#/components/parameters/GameStateIDQuery"},
+          {"$ref": "#/components/parameters/ShareTokenQuery"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/LegacyGameState"},
+          "default": {"$ref": "#/components/responses/LegacyError"}
+        }
+      }
+    },
+    "/foundationcard": {
+      "post": {
+        "summary": "Move a card onto a foundation",
+        "parameters": [
+          {"$ref": "#/components/parameters/GameStateIDQuery"},
+          {"$ref": "#/components/parameters/ShareTokenQuery"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/LegacyGameState"},
+          "default": {"$ref": "#/components/responses/LegacyError"}
+        }
+      }
+    },
+    "/hint": {
+      "get": {
+        "summary": "Suggest the next move, from a short search",
+        "description": "Asking for a hint counts towards the owner's stats if you can move in the game. Hints in a daily attempt fail with forbidden until its result is submitted. Each user, or address if not logged in, gets a burst of 10 hints and ratings, then one more every 6 seconds; beyond that the request fails with 429 and a Retry-After header.",
+        "parameters": [
+          {"$ref": "#/components/parameters/GameStateIDQuery"},
+          {"$ref": "#/components/parameters/ShareTokenQuery"}
+        ],
+        "responses": {
+          "200": {
+            "description": "The hint",
+            "content": {"text/json": {"schema": {"$ref": "#/components/schemas/Hint"}}}
+          },
+          "default": {"$ref": "#/components/responses/LegacyError"}
+        }
+      }
+    },
+    "/difficulty": {
+      "get": {
+        "summary": "Get how hard the game state's game was rated",
+        "description": "Fails with 404 if the game hasn't been rated yet.",
+        "parameters": [{"$ref": "#/components/parameters/GameStateIDQuery"}],
+        "responses": {
+          "200": {
+            "description": "The difficulty",
+            "content": {"text/json": {"schema": {"$ref": "#/components/schemas/Difficulty"}}}
+          },
+          "default": {"$ref": "#/components/responses/LegacyError"}
+        }
+      },
+      "post": {
+        "summary": "Rate how hard the game state's game is, from a short search",
+        "description": "Games that have already been rated keep their rating. Only admins can rate games, since each rating runs a search and playouts. Limited along with hints, failing with 429 and a Retry-After header.",
+        "security": [{"cookieAuth": []}, {"basicAuth": []}, {"bearerAuth": []}],
+        "parameters": [{"$ref": "#/components/parameters/GameStateIDQuery"}],
+        "responses": {
+          "200": {
+            "description": "The difficulty",
+            "content": {"text/json": {"schema": {"$ref": "#/components/schemas/Difficulty"}}}
+          },
+          "401": {"description": "No credentials, or credentials that don't check out"},
+          "403": {"description": "The user isn't an admin"},
+          "default": {"$ref": "#/components/responses/LegacyError"}
+        }
+      }
+    },
+    "/solve/stream": {
+      "get": {
+        "summary": "Solve from a game state, streaming the solver's progress",
+        "description": "Server-Sent Events, each with a SolveEvent as its data. The events are named progress, apart from the last which is named done. Clients asking for the same game state and maxExpanded share a solve, which is cancelled once they have all disconnected. Only admins can start solves, whether they log in or send credentials.",
+        "security": [{"cookieAuth": []}, {"basicAuth": []}, {"bearerAuth": []}],
+        "parameters": [
+          {"$ref": "#/components/parameters/GameStateIDQuery"},
+          {
+            "name": "maxExpanded",
+            "in": "query",
+            "description": "Lowers the number of states the solve may expand",
+            "schema": {"type": "integer", "format": "int64", "minimum": 1}
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The stream of events",
+            "content": {"text/event-stream": {"schema": {"$ref": "#/components/schemas/SolveEvent"}}}
+          },
+          "401": {"description": "No credentials, or credentials that don't check out"},
+          "403": {"description": "The user isn't an admin"},
+          "default": {"$ref": "#/components/responses/LegacyError"}
+        }
+      }
+    },
+    "/board": {
+      "get": {
+        "summary": "Go to the board for the latest game's first state",
+        "responses": {
+          "303": {"description": "Redirects to the state's board"},
+          "default": {"description": "The error, as text", "content": {"text/plain": {}}}
+        }
+      }
+    },
+    "/board/newgame": {
+      "post": {
+        "summary": "Deal a new game from the board",
+        "responses": {
+          "303": {"description": "Redirects to the new game's board"},
+          "default": {"description": "The error, as text", "content": {"text/plain": {}}}
+        }
+      }
+    },
+    "/board/{id}": {
+      "get": {
+        "summary": "A game state's board, rendered on the server",
+        "description": "The piles, links to the states before and after it, and a button for each legal move. Works without javascript.",
+        "parameters": [
+          {"$ref": "#/components/parameters/GameStateIDPath"},
+          {"$ref": "#/components/parameters/ShareTokenQuery"},
+          {
+            "name": "hint",
+            "in": "query",
+            "description": "Set to show the hint that /board/{id}/hint found. Showing it doesn't search again",
+            "schema": {"type": "string"}
+          },
+          {"name": "FromPile", "in": "query", "description": "The hint's move", "schema": {"$ref": "#/components/schemas/PileLocation"}},
+          {"name": "FromIndex", "in": "query", "schema": {"type": "integer"}},
+          {"name": "ToPile", "in": "query", "schema": {"$ref": "#/components/schemas/PileLocation"}},
+          {"name": "ToIndex", "in": "query", "schema": {"type": "integer"}},
+          {
+            "name": "solved",
+            "in": "query",
+            "description": "Set if the hint's search found a solution",
+            "schema": {"type": "string"}
+          }
+        ],
+        "responses": {
+          "200": {"description": "The board", "content": {"text/html": {}}},
+          "default": {"description": "The error, as text", "content": {"text/plain": {}}}
+        }
+      }
+    },
+    "/board/{id}/move": {
+      "post": {
+        "summary": "Make a move from the board",
+        "parameters": [
+          {"$ref": "#/components/parameters/GameStateIDPath"},
+          {"$ref": "#/components/parameters/ShareTokenQuery"}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/MoveRequest"}}
+          }
+        },
+        "responses": {
+          "303": {"description": "Redirects to the new state's board"},
+          "default": {"description": "The board again, with the error", "content": {"text/html": {}}}
+        }
+      }
+    },
+    "/board/{id}/hint": {
+      "post": {
+        "summary": "Ask for a hint from the board",
+        "description": "Asking counts towards the owner's stats, like /api/v1/states/{id}/hint, and shares its rate limit.",
+        "parameters": [
+          {"$ref": "#/components/parameters/GameStateIDPath"},
+          {"$ref": "#/components/parameters/ShareTokenQuery"}
+        ],
+        "responses": {
+          "303": {"description": "Redirects to the state's board, with the hint shown"},
+          "default": {"description": "The board again, with the error", "content": {"text/html": {}}}
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "basicAuth": {"type": "http", "scheme": "basic", "description": "A user's email and password"},
+      "bearerAuth": {"type": "http", "scheme": "bearer", "description": "One of a user's API tokens"},
+      "cookieAuth": {"type": "apiKey", "in": "cookie", "name": "forty-thieves-session", "description": "The session of a user who logged in"}
+    },
+    "parameters": {
+      "GameStateIDPath": {
+        "name": "id",
+        "in": "path",
+        "required": true,
+        "schema": {"type": "string", "format": "uuid"}
+      },
+      "GameStateIDQuery": {
+        "name": "gameStateID",
+        "in": "query",
+        "required": true,
+        "schema": {"type": "string", "format": "uuid"}
+      },
+      "ShareTokenQuery": {
+        "name": "share",
+        "in": "query",
+        "description": "The game's share token, for moving in a game owned by someone else",
+        "schema": {"type": "string"}
+      },
+      "DailyDatePath": {
+        "name": "date",
+        "in": "path",
+        "required": true,
+        "description": "like 2006-01-02, or today",
+        "schema": {"type": "string"}
+      },
+      "TreeDepthQuery": {
+        "name": "depth",
+        "in": "query",
+        "description": "how many moves below the root the tree goes",
+        "schema": {"type": "integer", "minimum": 0, "maximum": 10, "default": 3}
+      },
+      "TreeLimitQuery": {
+        "name": "limit",
+        "in": "query",
+        "description": "the most game states the tree can have",
+        "schema": {"type": "integer", "minimum": 1, "maximum": 10000, "default": 1000}
+      },
+      "OptionalGameStateIDQuery": {
+        "name": "gameStateID",
+        "in": "query",
+        "schema": {"type": "string", "format": "uuid"}
+      }
+    },
+    "requestBodies": {
+      "Credentials": {
+        "required": true,
+        "content": {
+          "application/json": {"schema": {"$ref": "#/components/schemas/Credentials"}}
+        }
+      }
+    },
+    "responses": {
+      "LoggedIn": {
+        "description": "The user, who is now logged in",
+        "headers": {
+          "Set-Cookie": {
+            "description": "The session cookie",
+            "schema": {"type": "string"}
+          }
+        },
+        "content": {
+          "application/json": {"schema": {"$ref": "#/components/schemas/User"}}
+        }
+      },
+      "GameState": {
+        "description": "The game state",
+        "content": {
+          "application/json": {"schema": {"$ref": "#/components/schemas/GameStateWithChildren"}}
+        }
+      },
+      "GameTree": {
+        "description": "The tree",
+        "content": {
+          "application/json": {"schema": {"$ref": "#/components/schemas/GameTree"}}
+        }
+      },
+      "CreatedGameState": {
+        "description": "The new game state",
+        "headers": {
+          "Location": {
+            "description": "The new game state's path",
+            "schema": {"type": "string"}
+          }
+        },
+        "content": {
+          "application/json": {"schema": {"$ref": "#/components/schemas/GameStateWithChildren"}}
+        }
+      },
+      "LegacyGameState": {
+        "description": "The game state",
+        "content": {
+          "text/json": {"schema": {"$ref": "#/components/schemas/GameStateWithChildren"}}
+        }
+      },
+      "APIError": {
+        "description": "The request failed: 400 invalid_request, 401 unauthorized, 403 forbidden, 404 not_found, 405 method_not_allowed, 409 conflict, 415 unsupported_media_type, 422 illegal_move, 429 too_many_requests or 500 internal",
+        "content": {
+          "application/json": {"schema": {"$ref": "#/components/schemas/APIErrorResponse"}}
+        }
+      },
+      "LegacyError": {
+        "description": "The request failed: 400 for a missing or invalid gameStateID or form, 403 for a move in someone else's game or a missing CSRF token, 404 for an unknown game state, 409 for a move to a game state the game has already reached, 422 for an illegal move, 429 for too many hints or ratings, 500 for everything else",
+        "content": {
+          "text/plain": {"schema": {"$ref": "#/components/schemas/LegacyError"}}
+        }
+      }
+    },
+    "schemas": {
+      "Card": {
+        "type": "object",
+        "required": ["Face", "Suit"],
+        "properties": {
+          "Face": {"type": "string", "enum": ["A", "2", "3", "4", "5", "6", "7", "8", "9", "T", "J", "Q", "K"]},
+          "Suit": {"type": "string", "enum": ["clubs", "diamonds", "hearts", "spades"]}
+        }
+      },
+      "Deck": {
+        "type": "object",
+        "required": ["Cards"],
+        "properties": {
+          "Cards": {"type": "array", "nullable": true, "items": {"$ref": "#/components/schemas/Card"}}
+        }
+      },
+      "NullUUID": {
+        "type": "object",
+        "required": ["UUID", "Valid"],
+        "properties": {
+          "UUID": {"type": "string", "format": "uuid"},
+          "Valid": {"type": "boolean", "description": "false for the first state of a game"}
+        }
+      },
+      "GameStateWithChildren": {
+        "type": "object",
+        "required": [
+          "GameID", "GameStateID", "PreviousGameState", "MoveNum", "Stock", "Foundations",
+          "Tableaus", "Waste", "Score", "ChildGameStates", "Status", "Lost", "LostReason"
+        ],
+        "properties": {
+          "GameID": {"type": "integer", "format": "int64"},
+          "GameStateID": {"type": "string", "format": "uuid"},
+          "PreviousGameState": {"$ref": "#/components/schemas/NullUUID"},
+          "MoveNum": {"type": "integer", "format": "int64"},
+          "Stock": {"$ref": "#/components/schemas/Deck"},
+          "Foundations": {"type": "array", "items": {"$ref": "#/components/schemas/Deck"}},
+          "Tableaus": {"type": "array", "items": {"$ref": "#/components/schemas/Deck"}},
+          "Waste": {"$ref": "#/components/schemas/Deck"},
+          "Score": {"type": "integer", "description": "0 once the game is won"},
+          "ChildGameStates": {
+            "type": "array",
+            "nullable": true,
+            "description": "ids of the states that have been reached from this one",
+            "items": {"type": "string", "format": "uuid"}
+          },
+          "Status": {"type": "string", "enum": ["in-progress", "won", "stuck"]},
+          "Lost": {"type": "boolean", "description": "true if the game provably can't be won from here"},
+          "LostReason": {"type": "string", "description": "why the game can't be won, if Lost"}
+        }
+      },
+      "MoveRequest": {
+        "type": "object",
+        "required": ["FromPile", "FromIndex", "ToPile", "ToIndex"],
+        "properties": {
+          "FromPile": {"$ref": "#/components/schemas/PileLocation"},
+          "FromIndex": {"type": "integer", "description": "ignored for the stock and waste"},
+          "ToPile": {"$ref": "#/components/schemas/PileLocation"},
+          "ToIndex": {"type": "integer", "description": "ignored for the stock and waste"}
+        }
+      },
+      "PileLocation": {
+        "type": "string",
+        "enum": ["stock", "foundation", "tableau", "waste"]
+      },
+      "Hint": {
+        "type": "object",
+        "required": ["Move", "Solved", "Moves", "BestScore"],
+        "properties": {
+          "Move": {
+            "allOf": [{"$ref": "#/components/schemas/MoveRequest"}],
+            "nullable": true,
+            "description": "null if the search found nothing better than the current state"
+          },
+          "Solved": {"type": "boolean", "description": "true if the search found a solution"},
+          "Moves": {
+            "type": "array",
+            "nullable": true,
+            "description": "the moves to the best state the search reached",
+            "items": {"$ref": "#/components/schemas/MoveRequest"}
+          },
+          "BestScore": {"type": "integer"}
+        }
+      },
+      "Difficulty": {
+        "type": "object",
+        "required": [
+          "Score", "Rating", "Solved", "SolutionLength", "BestScore", "Expanded",
+          "BranchingFactor", "PlayoutWinRate"
+        ],
+        "properties": {
+          "Score": {"type": "number", "description": "from 0 for the easiest deals to 100 for the hardest"},
+          "Rating": {"type": "string", "enum": ["easy", "medium", "hard"]},
+          "Solved": {"type": "boolean"},
+          "SolutionLength": {"type": "integer", "description": "moves in the solution found, if Solved"},
+          "BestScore": {"type": "integer", "description": "lowest score the search reached"},
+          "Expanded": {"type": "integer", "format": "int64", "description": "states the search expanded"},
+          "BranchingFactor": {"type": "number", "description": "average children of each expanded state"},
+          "PlayoutWinRate": {"type": "number"}
+        }
+      },
+      "SolveEvent": {
+        "type": "object",
+        "required": [
+          "Expanded", "BestScore", "Depth", "StatesPerSecond", "Done", "Solved", "Solution"
+        ],
+        "properties": {
+          "Expanded": {"type": "integer", "format": "int64"},
+          "BestScore": {"type": "integer"},
+          "Depth": {"type": "integer"},
+          "StatesPerSecond": {"type": "number"},
+          "Done": {"type": "boolean", "description": "set on the last event"},
+          "Solved": {"type": "boolean"},
+          "Solution": {
+            "type": "array",
+            "nullable": true,
+            "description": "set on the last event if the solve was Solved",
+            "items": {"$ref": "#/components/schemas/MoveRequest"}
+          },
+          "Error": {"type": "string", "description": "set on the last event if the solve failed"}
+        }
+      },
+      "Credentials": {
+        "type": "object",
+        "required": ["Email", "Password"],
+        "properties": {
+          "Email": {"type": "string"},
+          "Password": {
+            "type": "string",
+            "minLength": 8,
+            "description": "At most 72 bytes, the most bcrypt can hash"
+          }
+        }
+      },
+      "User": {
+        "type": "object",
+        "required": ["ID", "Email", "DisplayName"],
+        "properties": {
+          "ID": {"type": "integer", "format": "int64"},
+          "Email": {"type": "string", "description": "only sent to the user themselves"},
+          "DisplayName": {"type": "string", "description": "what other users see them as"}
+        }
+      },
+      "NewDisplayName": {
+        "type": "object",
+        "required": ["DisplayName"],
+        "properties": {
+          "DisplayName": {
+            "type": "string",
+            "pattern": "^[A-Za-z0-9][A-Za-z0-9 _.-]{1,23}$",
+            "description": "can't look like the handle users have without one, like \"player-12\""
+          }
+        }
+      },
+      "GameTreeCounts": {
+        "type": "object",
+        "required": ["States", "Unprocessed", "Claimed", "Processed", "BestScore"],
+        "properties": {
+          "States": {"type": "integer", "format": "int64"},
+          "Unprocessed": {"type": "integer", "format": "int64"},
+          "Claimed": {"type": "integer", "format": "int64"},
+          "Processed": {"type": "integer", "format": "int64"},
+          "BestScore": {"type": "integer", "description": "the lowest score of any of the states"}
+        }
+      },
+      "GameTreeNode": {
+        "type": "object",
+        "required": [
+          "GameStateID", "MoveNum", "Depth", "Score", "Status", "Move", "ChildCount", "Counts", "Children"
+        ],
+        "properties": {
+          "GameStateID": {"type": "string", "format": "uuid"},
+          "MoveNum": {"type": "integer", "format": "int64"},
+          "Depth": {"type": "integer", "description": "moves below the tree's root"},
+          "Score": {"type": "integer"},
+          "Status": {"type": "string", "enum": ["UNPROCESSED", "CLAIMED", "PROCESSED"]},
+          "Move": {
+            "allOf": [{"$ref": "#/components/schemas/MoveRequest"}],
+            "nullable": true,
+            "description": "the move from the parent. null for the root, or if it's unknown"
+          },
+          "ChildCount": {
+            "type": "integer",
+            "format": "int64",
+            "description": "children of the game state, including any deeper than the tree goes"
+          },
+          "Counts": {"$ref": "#/components/schemas/GameTreeCounts"},
+          "Children": {"type": "array", "items": {"$ref": "#/components/schemas/GameTreeNode"}}
+        }
+      },
+      "GameTree": {
+        "type": "object",
+        "required": ["Root", "Depth", "Truncated"],
+        "properties": {
+          "Root": {"$ref": "#/components/schemas/GameTreeNode"},
+          "Depth": {"type": "integer"},
+          "Truncated": {"type": "boolean", "description": "true if the tree was cut short by the limit"}
+        }
+      },
+      "Share": {
+        "type": "object",
+        "required": ["ShareToken"],
+        "properties": {
+          "ShareToken": {"type": "string", "description": "passed as the share query param"}
+        }
+      },
+      "UserStats": {
+        "type": "object",
+        "required": [
+          "GamesPlayed", "GamesWon", "BestMovesToWin", "AverageMovesToWin", "BestSecondsToWin",
+          "AverageSecondsToWin", "Hints", "Undos"
+        ],
+        "properties": {
+          "GamesPlayed": {"type": "integer", "format": "int64"},
+          "GamesWon": {"type": "integer", "format": "int64"},
+          "BestMovesToWin": {"type": "integer", "format": "int64", "nullable": true, "description": "null until the user has won a game"},
+          "AverageMovesToWin": {"type": "number", "nullable": true},
+          "BestSecondsToWin": {"type": "number", "nullable": true, "description": "from when the game was dealt"},
+          "AverageSecondsToWin": {"type": "number", "nullable": true},
+          "Hints": {"type": "integer", "format": "int64", "description": "hints asked for in the user's games"},
+          "Undos": {"type": "integer", "format": "int64", "description": "moves made from a game state that had already been moved from"}
+        }
+      },
+      "LeaderboardEntry": {
+        "type": "object",
+        "required": [
+          "Rank", "Name", "GamesPlayed", "GamesWon", "BestMovesToWin", "BestSecondsToWin"
+        ],
+        "properties": {
+          "Rank": {"type": "integer", "minimum": 1},
+          "Name": {"type": "string", "description": "the user's display name"},
+          "GamesPlayed": {"type": "integer", "format": "int64"},
+          "GamesWon": {"type": "integer", "format": "int64"},
+          "BestMovesToWin": {"type": "integer", "format": "int64"},
+          "BestSecondsToWin": {"type": "number"}
+        }
+      },
+      "DailyAttempt": {
+        "type": "object",
+        "required": [
+          "Date", "GameID", "FirstGameStateID", "Submitted", "Score", "Moves", "Seconds", "Rank"
+        ],
+        "properties": {
+          "Date": {"type": "string", "format": "date"},
+          "GameID": {"type": "integer", "format": "int64"},
+          "FirstGameStateID": {"type": "string", "format": "uuid"},
+          "Submitted": {"type": "boolean"},
+          "Score": {"type": "integer", "format": "int64", "nullable": true, "description": "null until the result is submitted"},
+          "Moves": {"type": "integer", "format": "int64", "nullable": true},
+          "Seconds": {"type": "number", "nullable": true, "description": "from the start of the attempt until it was submitted"},
+          "Rank": {"type": "integer", "format": "int64", "nullable": true, "description": "among the day's submitted results"}
+        }
+      },
+      "DailySubmission": {
+        "type": "object",
+        "required": ["GameStateID"],
+        "properties": {
+          "GameStateID": {"type": "string", "format": "uuid", "description": "the game state the attempt finished on"}
+        }
+      },
+      "DailyResult": {
+        "type": "object",
+        "required": ["Rank", "Name", "Score", "Moves", "Seconds"],
+        "properties": {
+          "Rank": {"type": "integer", "format": "int64"},
+          "Name": {"type": "string", "description": "the user's display name"},
+          "Score": {"type": "integer", "format": "int64"},
+          "Moves": {"type": "integer", "format": "int64"},
+          "Seconds": {"type": "number"}
+        }
+      },
+      "DailyDeal": {
+        "type": "object",
+        "required": ["Date", "Results"],
+        "properties": {
+          "Date": {"type": "string", "format": "date"},
+          "Results": {
+            "type": "array",
+            "description": "best first: the lowest score, then the fewest moves, then the quickest",
+            "items": {"$ref": "#/components/schemas/DailyResult"}
+          }
+        }
+      },
+      "NewAPIToken": {
+        "type": "object",
+        "required": ["Name"],
+        "properties": {
+          "Name": {"type": "string", "minLength": 1, "description": "what the token is for"}
+        }
+      },
+      "APIToken": {
+        "type": "object",
+        "required": ["ID", "Name", "Created"],
+        "properties": {
+          "ID": {"type": "integer", "format": "int64"},
+          "Name": {"type": "string"},
+          "Token": {"type": "string", "description": "only sent when the token is created"},
+          "Created": {"type": "string", "format": "date-time"}
+        }
+      },
+      "APIError": {
+        "type": "object",
+        "required": ["Code", "Message"],
+        "properties": {
+          "Code": {
+            "type": "string",
+            "enum": [
+              "not_found", "invalid_request", "unauthorized", "forbidden", "illegal_move",
+              "conflict", "method_not_allowed", "unsupported_media_type", "too_many_requests",
+              "unavailable", "internal"
+            ]
+          },
+          "Message": {"type": "string"}
+        }
+      },
+      "APIErrorResponse": {
+        "type": "object",
+        "required": ["Error"],
+        "properties": {
+          "Error": {"$ref": "#/components/schemas/APIError"}
+        }
+      },
+      "LegacyError": {
+        "type": "object",
+        "required": ["Error"],
+        "properties": {
+          "Error": {"type": "string"}
+        }
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/topher200/forty-thieves/libgame"
+	"github.com/topher200/forty-thieves/libhttp"
+	"github.com/topher200/forty-thieves/libsolver"
+)
+
+const (
+	// solveMaxExpanded is the most states a solve started from the web app
+	// expands. Requests can ask for fewer
+	solveMaxExpanded = 1000000
+	// solveProgressEvery is how many states a solve expands between events
+	solveProgressEvery = 5000
+	// finishedSolveRetention is how long a finished solve's result is kept
+	// for clients that attach to it late
+	finishedSolveRetention = 10 * time.Minute
+	// maxRunningSolves is the most solves that may run at once
+	maxRunningSolves = 4
+)
+
+// SolveEvent is the data of each event sent by /solve/stream
+type SolveEvent struct {
+	Expanded        int64
+	BestScore       int
+	Depth           int
+	StatesPerSecond float64
+
+	// Done is set on the last event. Solution is set if the solve was Solved,
+	// and Error if it failed
+	Done     bool
+	Solved   bool
+	Solution []libgame.MoveRequest
+	Error    string `json:",omitempty"`
+}
+
+// liveSolve is a solve running in the background, which any number of
+// /solve/stream clients can watch. It's cancelled once they have all gone
+type liveSolve struct {
+	key    solveKey
+	cancel chan struct{}
+
+	mu          sync.Mutex
+	last        *SolveEvent
+	subscribers map[chan SolveEvent]bool
+}
+
+// solveKey is what a solve is shared by. Clients that ask for a different
+// maxExpanded get a solve of their own
+type solveKey struct {
+	gameStateID uuid.UUID
+	maxExpanded int64
+}
+
+// liveSolves are the running and recently finished solves, by the game state
+// they started from and their maxExpanded
+var liveSolves = struct {
+	sync.Mutex
+	byKey   map[solveKey]*liveSolve
+	running int
+}{byKey: make(map[solveKey]*liveSolve)}
+
+// attachSolve subscribes to the solve for the game state and maxExpanded,
+// starting one if there isn't one already. Returns the solve, with its events
+// and latest event like liveSolve.subscribe.
+//
+// Returns error if maxRunningSolves solves are already running.
+func attachSolve(
+	gameState libgame.GameState, maxExpanded int64) (*liveSolve, chan SolveEvent, *SolveEvent, error) {
+	liveSolves.Lock()
+	defer liveSolves.Unlock()
+	key := solveKey{gameState.GameStateID, maxExpanded}
+	if solve, ok := liveSolves.byKey[key]; ok {
+		events, last := solve.subscribe()
+		return solve, events, last, nil
+	}
+	if liveSolves.running >= maxRunningSolves {
+		return nil, nil, nil, unavailable(
+			fmt.Errorf("The server is already running %d solves. Try again later", liveSolves.running))
+	}
+
+	pruner, err := libsolver.NewPruner(libsolver.DefaultPruningRules)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Error creating pruner: %v.", err)
+	}
+	solve := &liveSolve{
+		key:         key,
+		cancel:      make(chan struct{}),
+		subscribers: make(map[chan SolveEvent]bool),
+	}
+	liveSolves.byKey[key] = solve
+	liveSolves.running++
+	events, last := solve.subscribe()
+
+	go func() {
+		// the disk search keeps memory use bounded, however long the solve runs
+		result, err := libsolver.SolveDisk(gameState, libsolver.DiskOptions{
+			SearchOptions: libsolver.SearchOptions{
+				Pruner:        pruner,
+				MoveOrdering:  &libsolver.DefaultMoveOrderingWeights,
+				MaxExpanded:   maxExpanded,
+				Cancel:        solve.cancel,
+				ProgressEvery: solveProgressEvery,
+				OnProgress: func(p libsolver.Progress) {
+					if !p.Done {
+						solve.publish(newSolveEvent(p))
+					}
+				},
+			},
+			MemoryStates: 1 << 16,
+			MemoryHashes: 1 << 18,
+		})
+		final := SolveEvent{
+			Expanded:  result.Expanded,
+			BestScore: result.BestState.Score,
+			Depth:     len(result.BestPath),
+			Done:      true,
+			Solved:    result.Solved,
+			Solution:  result.Solution,
+		}
+		if err != nil {
+			final.Error = err.Error()
+		}
+		solve.publish(final)
+
+		liveSolves.Lock()
+		liveSolves.running--
+		liveSolves.Unlock()
+		time.AfterFunc(finishedSolveRetention, solve.forget)
+	}()
+	return solve, events, last, nil
+}
+
+// forget removes the solve from liveSolves, so that the next client starts a
+// new one
+func (s *liveSolve) forget() {
+	liveSolves.Lock()
+	defer liveSolves.Unlock()
+	if liveSolves.byKey[s.key] == s {
+		delete(liveSolves.byKey, s.key)
+	}
+}
+
+func newSolveEvent(p libsolver.Progress) SolveEvent {
+	return SolveEvent{
+		Expanded:        p.Expanded,
+		BestScore:       p.BestScore,
+		Depth:           p.Depth,
+		StatesPerSecond: p.StatesPerSecond(),
+	}
+}
+
+// subscribe returns a channel of the solve's events and the latest event, if
+// there has been one. The channel is nil if the solve has already finished.
+func (s *liveSolve) subscribe() (chan SolveEvent, *SolveEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last != nil && s.last.Done {
+		return nil, s.last
+	}
+	events := make(chan SolveEvent, 16)
+	s.subscribers[events] = true
+	return events, s.last
+}
+
+// unsubscribe stops sending the solve's events to the channel. Once the last
+// subscriber has gone, a running solve is cancelled and forgotten, since
+// there's no one left to see its result
+func (s *liveSolve) unsubscribe(events chan SolveEvent) {
+	liveSolves.Lock()
+	defer liveSolves.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, events)
+	if len(s.subscribers) == 0 && (s.last == nil || !s.last.Done) {
+		close(s.cancel)
+		if liveSolves.byKey[s.key] == s {
+			delete(liveSolves.byKey, s.key)
+		}
+	}
+}
+
+// lastEvent returns the latest event
+func (s *liveSolve) lastEvent() *SolveEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// publish sends the event to every subscriber. Slow subscribers miss events
+// rather than hold up the solve. Once the solve is done, the subscribers'
+// channels are closed and they can find the final event with lastEvent
+func (s *liveSolve) publish(event SolveEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = &event
+	for events := range s.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+		if event.Done {
+			close(events)
+			delete(s.subscribers, events)
+		}
+	}
+}
+
+// HandleSolveStreamRequest solves from the game state, streaming the solver's
+// progress as Server-Sent Events.
+//
+// Starts a solve if there isn't one running for the game state and
+// maxExpanded already, and otherwise attaches to it. A solve is cancelled once
+// all of its clients have gone, and at most maxRunningSolves run at once. Each
+// event's data is a JSON SolveEvent. The events are named "progress", apart
+// from the last which is named "done" and includes the solution if one was
+// found. The optional maxExpanded query param lowers the number of states the
+// solve may expand.
+func HandleSolveStreamRequest(w http.ResponseWriter, r *http.Request) {
+	gameState, err := parseGameStateFromQuery(w, r)
+	if err != nil {
+		replyWithError(w, err)
+		return
+	}
+	maxExpanded := int64(solveMaxExpanded)
+	if param := r.URL.Query().Get("maxExpanded"); param != "" {
+		requested, err := strconv.ParseInt(param, 10, 64)
+		if err != nil || requested <= 0 {
+			replyWithError(w, invalidRequest(
+				fmt.Errorf("maxExpanded must be a positive number, not '%s'", param)))
+			return
+		}
+		if requested < maxExpanded {
+			maxExpanded = requested
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		libhttp.HandleServerError(w, fmt.Errorf("Streaming isn't supported"))
+		return
+	}
+
+	solve, events, last, err := attachSolve(*gameState, maxExpanded)
+	if err != nil {
+		replyWithError(w, err)
+		return
+	}
+	if events != nil {
+		defer solve.unsubscribe(events)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	send := func(event SolveEvent) {
+		name := "progress"
+		if event.Done {
+			name = "done"
+		}
+		data, _ := json.Marshal(&event)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+		flusher.Flush()
+	}
+
+	if last != nil {
+		send(*last)
+	}
+	if events == nil {
+		return
+	}
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				// we missed the final event while the channel was full
+				send(*solve.lastEvent())
+				return
+			}
+			send(event)
+			if event.Done {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
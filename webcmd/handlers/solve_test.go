@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+func dealForTesting(t *testing.T, dealNumber int64) libgame.GameState {
+	state, err := libgame.DealPysolGame(libgame.Game{}, dealNumber)
+	assert.Nil(t, err)
+	state.GameStateID = uuid.NewV4()
+	return state
+}
+
+func TestSolvesAreSharedByMaxExpanded(t *testing.T) {
+	state := dealForTesting(t, 1)
+	first, firstEvents, _, err := attachSolve(state, solveMaxExpanded)
+	assert.Nil(t, err)
+	same, sameEvents, _, err := attachSolve(state, solveMaxExpanded)
+	assert.Nil(t, err)
+	other, otherEvents, _, err := attachSolve(state, solveMaxExpanded-1)
+	assert.Nil(t, err)
+	assert.True(t, first == same)
+	assert.False(t, first == other)
+
+	first.unsubscribe(firstEvents)
+	same.unsubscribe(sameEvents)
+	other.unsubscribe(otherEvents)
+}
+
+func TestSolveIsCancelledWhenEveryoneLeaves(t *testing.T) {
+	state := dealForTesting(t, 2)
+	solve, events, _, err := attachSolve(state, solveMaxExpanded)
+	assert.Nil(t, err)
+	again, againEvents, _, err := attachSolve(state, solveMaxExpanded)
+	assert.Nil(t, err)
+
+	// the solve carries on while anyone is watching
+	solve.unsubscribe(events)
+	for event := range againEvents {
+		if !event.Done {
+			break
+		}
+	}
+	again.unsubscribe(againEvents)
+
+	<-solve.cancel
+	replacement, replacementEvents, _, err := attachSolve(state, solveMaxExpanded)
+	assert.Nil(t, err)
+	assert.False(t, solve == replacement)
+	replacement.unsubscribe(replacementEvents)
+}
+
+func TestRunningSolvesAreCapped(t *testing.T) {
+	var solves []*liveSolve
+	var subscriptions []chan SolveEvent
+	defer func() {
+		for i, solve := range solves {
+			solve.unsubscribe(subscriptions[i])
+		}
+	}()
+	for {
+		solve, events, _, err := attachSolve(dealForTesting(t, int64(10+len(solves))), solveMaxExpanded)
+		if err != nil {
+			assert.Equal(t, CodeUnavailable, asHandlerError(err).code)
+			break
+		}
+		solves = append(solves, solve)
+		subscriptions = append(subscriptions, events)
+		if !assert.True(t, len(solves) <= maxRunningSolves) {
+			return
+		}
+	}
+}
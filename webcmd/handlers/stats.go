@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/jmoiron/sqlx"
+	"github.com/topher200/forty-thieves/libdb"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+const (
+	// leaderboardDefaultLimit is how many users the leaderboard has, unless
+	// the request asks for a different number
+	leaderboardDefaultLimit = 10
+	// leaderboardMaxLimit is the most users the leaderboard can have
+	leaderboardMaxLimit = 100
+)
+
+// UserStats sums up the games a user has dealt. The *ToWin fields are null
+// until they've won a game
+type UserStats struct {
+	GamesPlayed         int64
+	GamesWon            int64
+	BestMovesToWin      *int64
+	AverageMovesToWin   *float64
+	BestSecondsToWin    *float64 // from when the game was dealt
+	AverageSecondsToWin *float64
+	Hints               int64 // hints asked for in the user's games
+	Undos               int64 // moves made from a game state that had already been moved from
+}
+
+// LeaderboardEntry is a user's place on the leaderboard
+type LeaderboardEntry struct {
+	Rank             int
+	Name             string // the user's public name
+	GamesPlayed      int64
+	GamesWon         int64
+	BestMovesToWin   int64
+	BestSecondsToWin float64
+}
+
+// publicName is what other users see a user as: the display name they chose,
+// or else a handle made from their id. Their email is private
+func publicName(userID int64, displayName sql.NullString) string {
+	if displayName.Valid {
+		return displayName.String
+	}
+	return fmt.Sprintf("player-%d", userID)
+}
+
+// saveMove saves a game state reached by a move, and counts the move towards
+// its game's stats.
+//
+// Daily attempts are one line of play, so that everyone gets one try at the
+// deal: moves in them can't be undone, and a move from a game state that has
+// already been moved from is an illegal move error.
+func saveMove(w http.ResponseWriter, r *http.Request, gameState libgame.GameState) error {
+	gameDB, gameStateDB, err := databaseParams(w, r)
+	if err != nil {
+		return fmt.Errorf("Error getting database params: %v.", err)
+	}
+	game := libgame.Game{ID: gameState.GameID}
+	tx, err := r.Context().Value("db").(*sqlx.DB).Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// locking the attempt stops two moves from the same state both being saved
+	_, err = dailyDB(r).LockAttemptForGame(tx, game)
+	daily := err == nil
+	if _, ok := err.(libdb.NotFoundError); !daily && !ok {
+		return err
+	}
+
+	previous := libgame.GameState{
+		GameID:      gameState.GameID,
+		GameStateID: gameState.PreviousGameState.UUID,
+	}
+	siblings, err := gameStateDB.GetChildGameStates(previous)
+	if err != nil {
+		return err
+	}
+	if daily && len(siblings) > 0 {
+		return illegalMove(fmt.Errorf("Moves in daily games can't be undone"))
+	}
+	if err := saveGameState(w, r, tx, gameState); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// the move is saved, so failing to count it shouldn't fail the request
+	if len(siblings) > 0 {
+		if err := gameDB.RecordUndo(nil, game); err != nil {
+			logrus.Warning("error counting undo: ", err)
+		}
+	}
+	if gameState.Status() == libgame.Won {
+		if err := gameDB.RecordWin(nil, game, gameState.MoveNum); err != nil {
+			logrus.Warning("error saving win: ", err)
+		}
+	}
+	return nil
+}
+
+// recordHint counts a hint asked for in the game state's game. Hints only count
+// if they're asked for by someone who can move in the game
+func recordHint(w http.ResponseWriter, r *http.Request, gameState libgame.GameState) {
+	if checkCanMove(w, r, gameState) != nil {
+		return
+	}
+	gameDB, _, err := databaseParams(w, r)
+	if err == nil {
+		err = gameDB.RecordHint(nil, libgame.Game{ID: gameState.GameID})
+	}
+	if err != nil {
+		logrus.Warning("error counting hint: ", err)
+	}
+}
+
+// askForHint finds a Hint for the game state, and counts it towards the game's
+// stats. Returns a forbidden error for daily attempts that haven't been
+// submitted yet, since everyone's result must be their own
+func askForHint(w http.ResponseWriter, r *http.Request, gameState libgame.GameState) (*Hint, error) {
+	attempt, err := dailyDB(r).GetAttemptForGame(libgame.Game{ID: gameState.GameID})
+	if err == nil && !attempt.Submitted.Valid {
+		return nil, forbidden(fmt.Errorf("Hints aren't allowed in daily games until they're submitted"))
+	} else if _, ok := err.(libdb.NotFoundError); err != nil && !ok {
+		return nil, err
+	}
+	recordHint(w, r, gameState)
+	return findHint(gameState)
+}
+
+// HandleAPIStats responds with the UserStats of the user making the request
+func HandleAPIStats(w http.ResponseWriter, r *http.Request) {
+	userID, err := requireUserID(r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	gameDB, _, err := databaseParams(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	stats, err := gameDB.GetUserStats(userID)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+
+	userStats := &UserStats{
+		GamesPlayed: stats.GamesPlayed,
+		GamesWon:    stats.GamesWon,
+		Hints:       stats.Hints,
+		Undos:       stats.Undos,
+	}
+	if stats.BestMovesToWin.Valid {
+		userStats.BestMovesToWin = &stats.BestMovesToWin.Int64
+		userStats.AverageMovesToWin = &stats.AverageMovesToWin.Float64
+		userStats.BestSecondsToWin = &stats.BestSecondsToWin.Float64
+		userStats.AverageSecondsToWin = &stats.AverageSecondsToWin.Float64
+	}
+	writeJSON(w, http.StatusOK, userStats)
+}
+
+// HandleAPILeaderboard responds with the users who have won the most games, as
+// LeaderboardEntries, best first.
+//
+// The "limit" query param sets how many users there are, up to
+// leaderboardMaxLimit.
+func HandleAPILeaderboard(w http.ResponseWriter, r *http.Request) {
+	limit := leaderboardDefaultLimit
+	if limitString := r.URL.Query().Get("limit"); limitString != "" {
+		var err error
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > leaderboardMaxLimit {
+			replyWithAPIError(w, invalidRequest(fmt.Errorf(
+				"limit must be a number from 1 to %d", leaderboardMaxLimit)))
+			return
+		}
+	}
+	gameDB, _, err := databaseParams(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	rows, err := gameDB.GetLeaderboard(limit)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(rows))
+	for i, row := range rows {
+		entries = append(entries, LeaderboardEntry{
+			Rank:             i + 1,
+			Name:             publicName(row.UserID, row.DisplayName),
+			GamesPlayed:      row.GamesPlayed,
+			GamesWon:         row.GamesWon,
+			BestMovesToWin:   row.BestMovesToWin,
+			BestSecondsToWin: row.BestSecondsToWin,
+		})
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	gorilla_mux "github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"github.com/topher200/forty-thieves/libdb"
+)
+
+// NewAPIToken is the body of a request for a new API token
+type NewAPIToken struct {
+	Name string // what the token is for, so that it can be told apart later
+}
+
+// APIToken is an API token as the API sends it. Its Token is only sent when it
+// is created, and should be sent back as "Authorization: Bearer <Token>"
+type APIToken struct {
+	ID      int64
+	Name    string
+	Token   string `json:",omitempty"`
+	Created time.Time
+}
+
+func apiTokenDB(r *http.Request) *libdb.APITokenDB {
+	return libdb.NewAPITokenDB(r.Context().Value("db").(*sqlx.DB))
+}
+
+// HandleAPICreateToken creates an API token for the user making the request.
+//
+// The body is a JSON NewAPIToken. Responds with the APIToken, the only time
+// that its Token is sent.
+func HandleAPICreateToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := requireUserID(r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	var newToken NewAPIToken
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&newToken); err != nil {
+		replyWithAPIError(w, invalidRequest(fmt.Errorf("Invalid token request: %v", err)))
+		return
+	}
+	if newToken.Name == "" {
+		replyWithAPIError(w, invalidRequest(fmt.Errorf("Tokens must have a Name")))
+		return
+	}
+
+	token, row, err := apiTokenDB(r).CreateAPIToken(nil, userID, newToken.Name)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/tokens/%d", APIPrefix, row.ID))
+	writeJSON(w, http.StatusCreated, &APIToken{row.ID, row.Name, token, row.Created})
+}
+
+// HandleAPIGetTokens responds with the API tokens of the user making the
+// request, without their Tokens
+func HandleAPIGetTokens(w http.ResponseWriter, r *http.Request) {
+	userID, err := requireUserID(r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	rows, err := apiTokenDB(r).GetAPITokens(userID)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	tokens := make([]APIToken, 0, len(rows))
+	for _, row := range rows {
+		tokens = append(tokens, APIToken{ID: row.ID, Name: row.Name, Created: row.Created})
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// HandleAPIDeleteToken deletes one of the API tokens of the user making the
+// request, so that it can't be used any more
+func HandleAPIDeleteToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := requireUserID(r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	id := gorilla_mux.Vars(r)["tokenID"]
+	tokenID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		replyWithAPIError(w, invalidRequest(fmt.Errorf("Invalid token id '%s': %v", id, err)))
+		return
+	}
+	err = apiTokenDB(r).DeleteAPIToken(nil, userID, tokenID)
+	if _, ok := err.(libdb.NotFoundError); ok {
+		replyWithAPIError(w, notFound(fmt.Errorf("You have no API token %d", tokenID)))
+		return
+	} else if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	gorilla_mux "github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+	"github.com/topher200/forty-thieves/libdb"
+	"github.com/topher200/forty-thieves/libgame"
+	"github.com/topher200/forty-thieves/libsolver"
+)
+
+const (
+	treeDefaultDepth = 3
+	treeMaxDepth     = 10
+	treeDefaultLimit = 1000
+	treeMaxLimit     = 10000
+)
+
+// GameTreeCounts sums up a game state and its descendants in a GameTree
+type GameTreeCounts struct {
+	States      int64
+	Unprocessed int64
+	Claimed     int64
+	Processed   int64
+	BestScore   int // the lowest score of any of the states
+}
+
+// add counts the other states in with ours
+func (c *GameTreeCounts) add(other GameTreeCounts) {
+	c.States += other.States
+	c.Unprocessed += other.Unprocessed
+	c.Claimed += other.Claimed
+	c.Processed += other.Processed
+	if other.BestScore < c.BestScore {
+		c.BestScore = other.BestScore
+	}
+}
+
+// GameTreeNode is a game state in a GameTree, with its children in the tree,
+// lowest score first
+type GameTreeNode struct {
+	GameStateID uuid.UUID
+	MoveNum     int64
+	Depth       int // moves below the tree's root
+	Score       int
+	Status      string               // UNPROCESSED, CLAIMED or PROCESSED, as the solver left it
+	Move        *libgame.MoveRequest // the move from the parent. nil for the root, or if it's unknown
+	ChildCount  int64                // children of the game state, including any deeper than the tree goes
+	Counts      GameTreeCounts       // the game state and its descendants in the tree
+	Children    []*GameTreeNode
+}
+
+// GameTree is the subtree of game states reached from its root
+type GameTree struct {
+	Root      *GameTreeNode
+	Depth     int  // how many moves below the root the tree goes
+	Truncated bool // true if the tree was cut short by the limit
+}
+
+// queryInt parses the query param as a number from min to max. Returns def if
+// the param isn't set
+func queryInt(r *http.Request, name string, def int, min int, max int) (int, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return def, nil
+	}
+	value, err := strconv.Atoi(param)
+	if err != nil || value < min || value > max {
+		return 0, invalidRequest(fmt.Errorf("%s must be a number from %d to %d", name, min, max))
+	}
+	return value, nil
+}
+
+// gameTree builds the tree under the root game state, as deep and as big as
+// the request's depth and limit query params ask for
+func gameTree(
+	w http.ResponseWriter, r *http.Request, root libgame.GameState) (*GameTree, error) {
+	depth, err := queryInt(r, "depth", treeDefaultDepth, 0, treeMaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt(r, "limit", treeDefaultLimit, 1, treeMaxLimit)
+	if err != nil {
+		return nil, err
+	}
+	_, gameStateDB, err := databaseParams(w, r)
+	if err != nil {
+		return nil, err
+	}
+	rows, truncated, err := gameStateDB.GetGameTree(root, depth, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, notFound(fmt.Errorf("Game state id %v not found", root.GameStateID))
+	}
+
+	// parents come before their children, so each child's parent should
+	// already be in the tree. a child whose parent isn't is left out
+	nodes := make(map[uuid.UUID]*GameTreeNode, len(rows))
+	states := make(map[uuid.UUID]*libgame.GameState, len(rows))
+	for _, row := range rows {
+		state, err := libdb.UnmarshalGameState(row.GameStateRow)
+		if err != nil {
+			return nil, fmt.Errorf("Error unmarshalling gameState: %v", err)
+		}
+		node := &GameTreeNode{
+			GameStateID: row.GameStateID,
+			MoveNum:     row.MoveNum,
+			Depth:       row.Depth,
+			Score:       row.Score,
+			Status:      row.Status,
+			ChildCount:  row.ChildCount,
+			Children:    []*GameTreeNode{},
+		}
+		if row.Depth == 0 {
+			nodes[row.GameStateID] = node
+			states[row.GameStateID] = state
+			continue
+		}
+		parent, ok := nodes[row.PreviousGameState.UUID]
+		if !ok {
+			logrus.Warning("game state came before its parent in the tree: ", row.GameStateID)
+			continue
+		}
+		nodes[row.GameStateID] = node
+		states[row.GameStateID] = state
+		if move, ok := libsolver.FindMove(*states[parent.GameStateID], *state); ok {
+			node.Move = &move
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	rootNode, ok := nodes[root.GameStateID]
+	if !ok {
+		return nil, fmt.Errorf("Game tree of %v is missing its root", root.GameStateID)
+	}
+	tree := &GameTree{Root: rootNode, Depth: depth, Truncated: truncated}
+	countGameTree(tree.Root)
+	return tree, nil
+}
+
+// countGameTree fills in the Counts of the node and its descendants, and sorts
+// each node's children
+func countGameTree(node *GameTreeNode) {
+	node.Counts = GameTreeCounts{States: 1, BestScore: node.Score}
+	switch node.Status {
+	case libdb.StatusUnprocessed:
+		node.Counts.Unprocessed = 1
+	case libdb.StatusClaimed:
+		node.Counts.Claimed = 1
+	case libdb.StatusProcessed:
+		node.Counts.Processed = 1
+	}
+	for _, child := range node.Children {
+		countGameTree(child)
+		node.Counts.add(child.Counts)
+	}
+	sort.Slice(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.Score != b.Score {
+			return a.Score < b.Score
+		}
+		return a.GameStateID.String() < b.GameStateID.String()
+	})
+}
+
+// HandleAPIStateTree responds with the GameTree under the route's game state.
+//
+// The "depth" query param sets how many moves below the game state the tree
+// goes, up to treeMaxDepth, and "limit" how many game states it can have, up
+// to treeMaxLimit. Trees that hit the limit keep the game states closest to
+// the root, and are marked Truncated. Leaves whose ChildCount is more than
+// their children can be explored with their own trees.
+func HandleAPIStateTree(w http.ResponseWriter, r *http.Request) {
+	gameState, err := apiGameState(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	tree, err := gameTree(w, r, *gameState)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tree)
+}
+
+// HandleAPIGameTree responds with the GameTree under the route's game's first
+// game state. Takes the same query params as HandleAPIStateTree
+func HandleAPIGameTree(w http.ResponseWriter, r *http.Request) {
+	id := gorilla_mux.Vars(r)["id"]
+	gameID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		replyWithAPIError(w, invalidRequest(fmt.Errorf("Invalid game id '%s': %v", id, err)))
+		return
+	}
+	_, gameStateDB, err := databaseParams(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	gameState, err := gameStateDB.GetFirstGameState(libgame.Game{ID: gameID})
+	if _, ok := err.(libdb.NotFoundError); ok {
+		replyWithAPIError(w, notFound(fmt.Errorf("Game %d not found", gameID)))
+		return
+	} else if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	tree, err := gameTree(w, r, *gameState)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tree)
+}
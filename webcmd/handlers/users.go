@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"github.com/topher200/forty-thieves/libdb"
+	"github.com/topher200/forty-thieves/libgame"
+)
+
+const (
+	// sessionName is the name of the cookie holding the session
+	sessionName = "forty-thieves-session"
+	// sessionUserIDKey is the session value with the logged in user's id
+	sessionUserIDKey = "userID"
+	// minPasswordLength is the shortest password we accept at sign up
+	minPasswordLength = 8
+	// maxPasswordBytes is the longest password we accept at sign up. bcrypt
+	// refuses to hash anything longer
+	maxPasswordBytes = 72
+)
+
+var (
+	// displayNameRegexp is the display names users can choose: 2 to 24
+	// letters, numbers, spaces, "_", "." or "-", starting with a letter or
+	// number. Without an "@", nobody can be shown by their email
+	displayNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 _.-]{1,23}$`)
+	// handleRegexp matches the handles publicName gives users without a
+	// display name, which nobody can choose
+	handleRegexp = regexp.MustCompile(`(?i)^player-[0-9]+$`)
+)
+
+// Credentials are what a user signs up and logs in with
+type Credentials struct {
+	Email    string
+	Password string
+}
+
+// User is a user as the API sends it
+type User struct {
+	ID          int64
+	Email       string
+	DisplayName string // what other users see them as
+}
+
+// NewDisplayName is the body of a request to change the user's display name
+type NewDisplayName struct {
+	DisplayName string
+}
+
+func newUser(user *libdb.UserRow) *User {
+	return &User{user.ID, user.Email, publicName(user.ID, user.DisplayName)}
+}
+
+// Share is what lets someone besides a game's owner play it. Requests that
+// move in the game pass the token as the "share" query param
+type Share struct {
+	ShareToken string
+}
+
+func userDB(r *http.Request) *libdb.UserDB {
+	return libdb.NewUserDB(r.Context().Value("db").(*sqlx.DB))
+}
+
+func session(r *http.Request) (*sessions.Session, error) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+	return sessionStore.Get(r, sessionName)
+}
+
+// sessionUserID returns the id of the logged in user, if there is one
+func sessionUserID(r *http.Request) (int64, bool) {
+	s, err := session(r)
+	if err != nil {
+		// a cookie we can't decode is the same as no cookie
+		return 0, false
+	}
+	userID, ok := s.Values[sessionUserIDKey].(int64)
+	return userID, ok
+}
+
+// currentUserID returns the id of the user making the request: the one whose
+// credentials middlewares.Authenticate checked, or else the logged in user
+func currentUserID(r *http.Request) (int64, bool) {
+	if user, ok := r.Context().Value("user").(*libdb.UserRow); ok {
+		return user.ID, true
+	}
+	return sessionUserID(r)
+}
+
+// CurrentUserID is currentUserID, for the middlewares that need to know who's
+// making the request
+func CurrentUserID(r *http.Request) (int64, bool) {
+	return currentUserID(r)
+}
+
+// requireUserID returns the id of the user making the request, or an
+// unauthorized error if there isn't one
+func requireUserID(r *http.Request) (int64, error) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		return 0, unauthorized(fmt.Errorf("Not logged in"))
+	}
+	return userID, nil
+}
+
+// setSessionUser logs the user in, or logs out if userID is 0
+func setSessionUser(w http.ResponseWriter, r *http.Request, userID int64) error {
+	s, err := session(r)
+	if err != nil && s == nil {
+		return err
+	}
+	if userID == 0 {
+		delete(s.Values, sessionUserIDKey)
+		s.Options.MaxAge = -1
+	} else {
+		s.Values[sessionUserIDKey] = userID
+	}
+	if err := s.Save(r, w); err != nil {
+		return fmt.Errorf("Error saving session: %v", err)
+	}
+	return nil
+}
+
+// decodeCredentials reads the JSON Credentials in the request's body
+func decodeCredentials(r *http.Request) (*Credentials, error) {
+	var credentials Credentials
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&credentials); err != nil {
+		return nil, invalidRequest(fmt.Errorf("Invalid credentials: %v", err))
+	}
+	return &credentials, nil
+}
+
+// HandleAPISignup creates a user and logs them in.
+//
+// The body is JSON Credentials. Responds with the new User, an invalid request
+// error if the password is too short or too long, or a conflict error if the
+// email is taken.
+func HandleAPISignup(w http.ResponseWriter, r *http.Request) {
+	credentials, err := decodeCredentials(r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	if !strings.Contains(credentials.Email, "@") {
+		replyWithAPIError(w, invalidRequest(fmt.Errorf("Email must be an email address")))
+		return
+	}
+	if len(credentials.Password) < minPasswordLength {
+		replyWithAPIError(w, invalidRequest(
+			fmt.Errorf("Password must be at least %d characters", minPasswordLength)))
+		return
+	}
+	if len(credentials.Password) > maxPasswordBytes {
+		replyWithAPIError(w, invalidRequest(
+			fmt.Errorf("Password must be at most %d bytes", maxPasswordBytes)))
+		return
+	}
+
+	user, err := userDB(r).Signup(nil, credentials.Email, credentials.Password)
+	if _, ok := err.(libdb.DuplicateUserError); ok {
+		replyWithAPIError(w, conflict(fmt.Errorf("There's already a user with that email")))
+		return
+	} else if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	if err := setSessionUser(w, r, user.ID); err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	w.Header().Set("Location", APIPrefix+"/users/me")
+	writeJSON(w, http.StatusCreated, newUser(user))
+}
+
+// HandleAPILogin logs a user in.
+//
+// The body is JSON Credentials. Responds with the User, or an unauthorized
+// error if the email or password is wrong.
+func HandleAPILogin(w http.ResponseWriter, r *http.Request) {
+	credentials, err := decodeCredentials(r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	user, err := userDB(r).GetUserByEmailAndPassword(credentials.Email, credentials.Password)
+	if _, ok := err.(libdb.NotFoundError); ok || err == libdb.ErrWrongPassword {
+		// we don't say which, so that emails can't be checked for accounts
+		replyWithAPIError(w, unauthorized(fmt.Errorf("Wrong email or password")))
+		return
+	} else if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	if err := setSessionUser(w, r, user.ID); err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newUser(user))
+}
+
+// HandleAPILogout logs the user out
+func HandleAPILogout(w http.ResponseWriter, r *http.Request) {
+	if err := setSessionUser(w, r, 0); err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleAPIMe responds with the User making the request, or an unauthorized
+// error if nobody is logged in
+func HandleAPIMe(w http.ResponseWriter, r *http.Request) {
+	user, err := requireUser(r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newUser(user))
+}
+
+// requireUser returns the user making the request, or an unauthorized error if
+// nobody is logged in
+func requireUser(r *http.Request) (*libdb.UserRow, error) {
+	userID, err := requireUserID(r)
+	if err != nil {
+		return nil, err
+	}
+	user, err := userDB(r).GetUserById(userID)
+	if _, ok := err.(libdb.NotFoundError); ok {
+		// the user was deleted while logged in
+		return nil, unauthorized(fmt.Errorf("Not logged in"))
+	}
+	return user, err
+}
+
+// HandleAPISetDisplayName changes the name that other users see the user
+// making the request as, on the leaderboard and in the daily results.
+//
+// The body is a JSON NewDisplayName. Responds with the User, or a conflict
+// error if another user has the name.
+func HandleAPISetDisplayName(w http.ResponseWriter, r *http.Request) {
+	user, err := requireUser(r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	var newName NewDisplayName
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&newName); err != nil {
+		replyWithAPIError(w, invalidRequest(fmt.Errorf("Invalid display name request: %v", err)))
+		return
+	}
+	name := strings.TrimSpace(newName.DisplayName)
+	if !displayNameRegexp.MatchString(name) {
+		replyWithAPIError(w, invalidRequest(fmt.Errorf(
+			"Display names must be 2 to 24 letters, numbers, spaces, '_', '.' or '-'")))
+		return
+	}
+	if handleRegexp.MatchString(name) {
+		replyWithAPIError(w, invalidRequest(fmt.Errorf("Display names can't look like '%s'",
+			publicName(user.ID, sql.NullString{}))))
+		return
+	}
+
+	err = userDB(r).SetDisplayName(nil, user.ID, name)
+	if _, ok := err.(libdb.DuplicateDisplayNameError); ok {
+		replyWithAPIError(w, conflict(fmt.Errorf("There's already a user called that")))
+		return
+	} else if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	user.DisplayName = sql.NullString{String: name, Valid: true}
+	writeJSON(w, http.StatusOK, newUser(user))
+}
+
+// gameOwner returns the owner of the game state's game, or nil if it has none
+func gameOwner(w http.ResponseWriter, r *http.Request, gameState libgame.GameState) (*libdb.GameOwner, error) {
+	gameDB, _, err := databaseParams(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return gameDB.GetOwner(libgame.Game{ID: gameState.GameID})
+}
+
+// checkCanMove returns a forbidden error unless the request may move in the
+// game state's game: games without an owner are open to everyone, and owned
+// games to their owner and anyone with the game's share token.
+func checkCanMove(w http.ResponseWriter, r *http.Request, gameState libgame.GameState) error {
+	owner, err := gameOwner(w, r, gameState)
+	if err != nil || owner == nil {
+		return err
+	}
+	if userID, ok := currentUserID(r); ok && userID == owner.UserID {
+		return nil
+	}
+	token := r.URL.Query().Get("share")
+	if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(owner.ShareToken)) == 1 {
+		return nil
+	}
+	return forbidden(fmt.Errorf(
+		"Only the game's owner, or someone they've shared it with, can move in it"))
+}
+
+// HandleAPIShare responds with the Share for the game state's game. Only the
+// game's owner can share it
+func HandleAPIShare(w http.ResponseWriter, r *http.Request) {
+	gameState, err := apiGameState(w, r)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	owner, err := gameOwner(w, r, *gameState)
+	if err != nil {
+		replyWithAPIError(w, err)
+		return
+	}
+	if owner == nil {
+		replyWithAPIError(w, notFound(
+			fmt.Errorf("The game has no owner, so anyone can already play it")))
+		return
+	}
+	if userID, ok := currentUserID(r); !ok || userID != owner.UserID {
+		replyWithAPIError(w, forbidden(fmt.Errorf("Only the game's owner can share it")))
+		return
+	}
+	writeJSON(w, http.StatusOK, &Share{owner.ShareToken})
+}
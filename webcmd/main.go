@@ -19,6 +19,13 @@ import (
 	"github.com/tylerb/graceful"
 )
 
+const (
+	// searchBurst is how many hints and ratings a client may ask for at once
+	searchBurst = 10
+	// searchEvery is how often a client gets to ask for another, after that
+	searchEvery = 6 * time.Second
+)
+
 // NewApplication is the constructor for Application struct.
 //
 // If testing is true, connects to the "test" database.
@@ -44,10 +51,21 @@ func NewApplication(testing bool) (*Application, error) {
 
 	cookieStoreSecret := libenv.EnvWithDefault("COOKIE_SECRET", "ittwiP92o0oi6P4i")
 
+	// every server has to deal the same daily deal, even across restarts, so
+	// the secret can't be generated here. Tests use a fixed one
+	dailySecret := []byte(libenv.EnvWithDefault("DAILY_SECRET", ""))
+	if len(dailySecret) == 0 {
+		if !testing {
+			return nil, fmt.Errorf("DAILY_SECRET must be set to deal the daily games")
+		}
+		dailySecret = []byte("forty-thieves-test-daily-secret")
+	}
+
 	app := &Application{}
 	app.dsn = dsn
 	app.db = db
 	app.sessionStore = sessions.NewCookieStore([]byte(cookieStoreSecret))
+	app.dailySecret = dailySecret
 
 	return app, err
 }
@@ -57,12 +75,16 @@ type Application struct {
 	dsn          string
 	db           *sqlx.DB
 	sessionStore sessions.Store
+	dailySecret  []byte
 }
 
 func (app *Application) middlewareStruct(logWriter io.Writer) (*interpose.Middleware, error) {
 	middle := interpose.New()
 	middle.Use(middlewares.SetDB(app.db))
 	middle.Use(middlewares.SetSessionStore(app.sessionStore))
+	middle.Use(middlewares.SetDailySecret(app.dailySecret))
+	middle.Use(middlewares.Authenticate(app.db, handlers.HandleUnauthorized))
+	middle.Use(middlewares.RequireJSON(handlers.APIPrefix, handlers.HandleUnsupportedMediaType))
 	middle.Use(middlewares.SetupLogger(logWriter))
 
 	middle.UseHandler(app.mux())
@@ -74,12 +96,77 @@ func (app *Application) mux() *gorilla_mux.Router {
 	router := gorilla_mux.NewRouter()
 	router.KeepContext = true
 
+	// hints and ratings run solver searches, so each client only gets a few
+	searchLimiter := middlewares.NewRateLimiter(searchBurst, searchEvery)
+	limitSearches := func(handler http.HandlerFunc) http.Handler {
+		return middlewares.RateLimit(
+			searchLimiter, handlers.CurrentUserID, handlers.HandleTooManyRequests)(handler)
+	}
+	// solves and ratings run long searches, so only admins can start them
+	requireAdmin := middlewares.RequireAdmin(app.db, handlers.CurrentUserID)
+
 	router.HandleFunc("/", handlers.GetHome).Methods("GET").Name("/")
-	router.HandleFunc("/state", handlers.HandleStateRequest)
-	router.HandleFunc("/newgame", handlers.HandleNewGameRequest)
-	router.HandleFunc("/move", handlers.HandleMoveRequest)
-	router.HandleFunc("/flipstock", handlers.HandleFlipStockRequest)
-	router.HandleFunc("/foundationcard", handlers.HandleFoundationAvailableCardRequest)
+	router.HandleFunc("/openapi.json", handlers.HandleOpenAPIRequest).Methods("GET")
+	router.HandleFunc("/state", handlers.HandleStateRequest).Methods("GET")
+	router.HandleFunc("/newgame", handlers.HandleNewGameRequest).Methods("POST")
+	router.HandleFunc("/move", handlers.HandleMoveRequest).Methods("POST")
+	router.HandleFunc("/flipstock", handlers.HandleFlipStockRequest).Methods("POST")
+	router.HandleFunc("/foundationcard", handlers.HandleFoundationAvailableCardRequest).Methods("POST")
+	router.Handle("/hint", limitSearches(handlers.HandleHintRequest)).Methods("GET")
+	router.HandleFunc("/difficulty", handlers.HandleDifficultyRequest).Methods("GET")
+	router.Handle("/difficulty", requireAdmin(limitSearches(handlers.HandleRateDifficultyRequest))).
+		Methods("POST")
+	router.HandleFunc(handlers.BoardPrefix, handlers.HandleBoardLatestRequest).Methods("GET")
+	router.HandleFunc(handlers.BoardPrefix+"/newgame", handlers.HandleBoardNewGameRequest).Methods("POST")
+	router.HandleFunc(handlers.BoardPrefix+"/{id}", handlers.HandleBoardRequest).Methods("GET")
+	router.HandleFunc(handlers.BoardPrefix+"/{id}/move", handlers.HandleBoardMoveRequest).Methods("POST")
+	router.Handle(handlers.BoardPrefix+"/{id}/hint", limitSearches(handlers.HandleBoardHintRequest)).
+		Methods("POST")
+	router.Handle("/solve/stream", requireAdmin(http.HandlerFunc(handlers.HandleSolveStreamRequest))).
+		Methods("GET")
+
+	api := router.PathPrefix(handlers.APIPrefix).Subrouter()
+	api.HandleFunc("/games", handlers.HandleAPINewGame).Methods("POST")
+	api.HandleFunc("/states/latest", handlers.HandleAPIGetLatestState).Methods("GET")
+	api.HandleFunc("/states/{id}", handlers.HandleAPIGetState).Methods("GET")
+	api.HandleFunc("/states/{id}/moves", handlers.HandleAPIMove).Methods("POST")
+	api.HandleFunc("/states/{id}/foundationcard", handlers.HandleAPIFoundationCard).Methods("POST")
+	api.Handle("/states/{id}/hint", limitSearches(handlers.HandleAPIHint)).Methods("GET")
+	api.HandleFunc("/states/{id}/difficulty", handlers.HandleAPIDifficulty).Methods("GET")
+	api.Handle("/states/{id}/difficulty", requireAdmin(limitSearches(handlers.HandleAPIRateDifficulty))).
+		Methods("POST")
+	api.HandleFunc("/states/{id}/share", handlers.HandleAPIShare).Methods("GET")
+	api.HandleFunc("/states/{id}/board.svg", handlers.HandleAPIBoardSVG).Methods("GET")
+	api.HandleFunc("/states/{id}/board.png", handlers.HandleAPIBoardPNG).Methods("GET")
+	api.HandleFunc("/states/{id}/tree", handlers.HandleAPIStateTree).Methods("GET")
+	api.HandleFunc("/games/{id}/tree", handlers.HandleAPIGameTree).Methods("GET")
+	api.HandleFunc("/users", handlers.HandleAPISignup).Methods("POST")
+	api.HandleFunc("/users/me", handlers.HandleAPIMe).Methods("GET")
+	api.HandleFunc("/users/me/name", handlers.HandleAPISetDisplayName).Methods("PUT")
+	api.HandleFunc("/users/me/stats", handlers.HandleAPIStats).Methods("GET")
+	api.HandleFunc("/leaderboard", handlers.HandleAPILeaderboard).Methods("GET")
+	api.HandleFunc("/daily/attempts", handlers.HandleAPIStartDaily).Methods("POST")
+	api.HandleFunc("/daily/attempts", handlers.HandleAPIDailyHistory).Methods("GET")
+	api.HandleFunc("/daily/attempts/{date}/result", handlers.HandleAPISubmitDaily).Methods("POST")
+	api.HandleFunc("/daily/{date}", handlers.HandleAPIDailyDeal).Methods("GET")
+	api.HandleFunc("/login", handlers.HandleAPILogin).Methods("POST")
+	api.HandleFunc("/logout", handlers.HandleAPILogout).Methods("POST")
+	api.HandleFunc("/tokens", handlers.HandleAPICreateToken).Methods("POST")
+	api.HandleFunc("/tokens", handlers.HandleAPIGetTokens).Methods("GET")
+	api.HandleFunc("/tokens/{tokenID}", handlers.HandleAPIDeleteToken).Methods("DELETE")
+	// routes are matched in order, so these only match the methods not allowed above
+	for _, path := range []string{
+		"/games", "/states/latest", "/states/{id}", "/states/{id}/moves",
+		"/states/{id}/foundationcard", "/states/{id}/hint", "/states/{id}/difficulty",
+		"/states/{id}/share", "/states/{id}/board.svg", "/states/{id}/board.png",
+		"/states/{id}/tree", "/games/{id}/tree",
+		"/users", "/users/me", "/users/me/name", "/users/me/stats", "/leaderboard",
+		"/daily/attempts", "/daily/attempts/{date}/result", "/daily/{date}", "/login", "/logout",
+		"/tokens", "/tokens/{tokenID}",
+	} {
+		api.HandleFunc(path, handlers.HandleAPIMethodNotAllowed)
+	}
+	api.PathPrefix("/").HandlerFunc(handlers.HandleAPINotFound)
 
 	router.PathPrefix("/bower_components").
 		Handler(http.StripPrefix("/bower_components/", http.FileServer(http.Dir("bower_components")))).
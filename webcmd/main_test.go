@@ -3,11 +3,13 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -17,12 +19,15 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"github.com/topher200/forty-thieves/libgame"
+	"github.com/topher200/forty-thieves/webcmd/handlers"
 )
 
 type MainTestSuite struct {
 	suite.Suite
-	server *httptest.Server
-	client *http.Client
+	server      *httptest.Server
+	client      *http.Client // an anonymous browser
+	adminToken  string
+	deleteAdmin func()
 }
 
 // TestUserStory simulates a user performing the following actions:
@@ -31,6 +36,10 @@ type MainTestSuite struct {
 //  - gets a json /state message
 //  - posts to flip the stock
 //  - gets a json /state message
+//  - gets a json /hint message
+//  - posts to rate the game as an admin, then gets a json /difficulty message
+//  - streams a short solve from /solve/stream, as an admin
+//  - does the same through the /api/v1 JSON API, and checks its errors
 //
 // TODO: We do this in one function (as opposed to separate Test* functions)
 // since some tests require setup (like a game to be created).
@@ -41,6 +50,15 @@ func (testSuite *MainTestSuite) TestUserStory() {
 	testSuite.flipStockPost(gameStateID)
 	testSuite.stateGet(gameStateID)
 	testSuite.movePost(gameStateID)
+	testSuite.hintGet(gameStateID)
+	testSuite.difficultyPostAndGet(gameStateID)
+	testSuite.solveStreamGet(gameStateID)
+
+	apiGameStateID := testSuite.apiNewGamePost()
+	testSuite.apiStateGet(apiGameStateID)
+	apiGameStateID = testSuite.apiMovePost(apiGameStateID)
+	testSuite.apiStateGet(apiGameStateID)
+	testSuite.apiErrors(apiGameStateID)
 }
 
 // checkResponse asserts that we didn't err and that our response looks good
@@ -105,11 +123,11 @@ func (testSuite *MainTestSuite) movePost(gameStateID uuid.UUID) {
 	defer resp.Body.Close()
 
 	// we're not guaranteed to have a move available. we just check that
-	// either the request completed or that we threw a validation error
+	// either the request completed or that the move was refused as illegal
 	if resp.StatusCode == 200 {
 		checkResponse(testSuite.T(), resp, err)
 	} else {
-		assert.Equal(testSuite.T(), 400, resp.StatusCode)
+		assert.Equal(testSuite.T(), 422, resp.StatusCode)
 	}
 }
 
@@ -118,6 +136,345 @@ func (testSuite *MainTestSuite) stateGet(gameStateID uuid.UUID) {
 		addGameStateIdToURL("/state", gameStateID)))
 	// Check that our response contains one of the card pile names we expect
 	assert.True(testSuite.T(), strings.Contains(bodyText, "Stock"))
+	assert.True(testSuite.T(), strings.Contains(bodyText, `"Status":"in-progress"`))
+}
+
+// hintGet tests that we get a move suggested for the game state
+func (testSuite *MainTestSuite) hintGet(gameStateID uuid.UUID) {
+	body := testSuite.makeGetRequest(addGameStateIdToURL("/hint", gameStateID))
+	type Response struct {
+		Move  *libgame.MoveRequest
+		Moves []libgame.MoveRequest
+	}
+	var response Response
+	err := json.Unmarshal(body, &response)
+	assert.Nil(testSuite.T(), err)
+	assert.NotNil(testSuite.T(), response.Move)
+	assert.NotEmpty(testSuite.T(), response.Moves)
+}
+
+// difficultyPostAndGet tests that the game gets rated, and that the rating is
+// saved. Only admins can rate, so the rating is made with the admin's token
+func (testSuite *MainTestSuite) difficultyPostAndGet(gameStateID uuid.UUID) {
+	testSuite.checkError("GET", addGameStateIdToURL("/difficulty", gameStateID), nil, 404)
+
+	req, err := http.NewRequest(
+		"POST", addGameStateIdToURL(testSuite.server.URL+"/difficulty", gameStateID), nil)
+	assert.Nil(testSuite.T(), err)
+	req.Header.Set("Authorization", "Bearer "+testSuite.adminToken)
+	resp, err := testSuite.client.Do(req)
+	if !assert.Nil(testSuite.T(), err) {
+		return
+	}
+	defer resp.Body.Close()
+	checkResponse(testSuite.T(), resp, err)
+	rated, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(testSuite.T(), err)
+
+	body := testSuite.makeGetRequest(addGameStateIdToURL("/difficulty", gameStateID))
+	assert.JSONEq(testSuite.T(), string(rated), string(body))
+	type Response struct {
+		Score  float64
+		Rating string
+	}
+	var response Response
+	err = json.Unmarshal(body, &response)
+	assert.Nil(testSuite.T(), err)
+	assert.Contains(testSuite.T(), []string{"easy", "medium", "hard"}, response.Rating)
+}
+
+// solveStreamGet tests that a solve streams its progress until it's done. Only
+// admins can solve, so this request is made with the admin's token
+func (testSuite *MainTestSuite) solveStreamGet(gameStateID uuid.UUID) {
+	req, err := http.NewRequest("GET", testSuite.server.URL+
+		addGameStateIdToURL("/solve/stream", gameStateID)+"&maxExpanded=20000", nil)
+	assert.Nil(testSuite.T(), err)
+	req.Header.Set("Authorization", "Bearer "+testSuite.adminToken)
+	resp, err := testSuite.client.Do(req)
+	if !assert.Nil(testSuite.T(), err) {
+		return
+	}
+	defer resp.Body.Close()
+	checkResponse(testSuite.T(), resp, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(testSuite.T(), err)
+	events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+	assert.True(testSuite.T(), len(events) > 1, "expected progress events before the end")
+
+	last := events[len(events)-1]
+	assert.True(testSuite.T(), strings.HasPrefix(last, "event: done\ndata: "))
+	type Response struct {
+		Expanded int64
+		Done     bool
+	}
+	var response Response
+	err = json.Unmarshal([]byte(strings.TrimPrefix(last, "event: done\ndata: ")), &response)
+	assert.Nil(testSuite.T(), err)
+	assert.True(testSuite.T(), response.Done)
+	assert.True(testSuite.T(), response.Expanded > 0)
+}
+
+// TestErrors checks that each kind of error gets its own status: 400 for
+// invalid requests, 404 for unknown game states, 409 for conflicts and 422 for
+// illegal moves
+func (testSuite *MainTestSuite) TestErrors() {
+	gameStateID := testSuite.newgamePost()
+	unknownID := uuid.NewV4()
+	illegalMove := url.Values{
+		"FromPile":  {libgame.FOUNDATION},
+		"FromIndex": {"0"},
+		"ToPile":    {libgame.TABLEAU},
+		"ToIndex":   {"0"},
+	}
+	tests := []struct {
+		method string
+		route  string
+		form   url.Values
+		status int
+	}{
+		{"GET", "/hint", nil, 400},
+		{"POST", "/flipstock", nil, 400},
+		{"GET", "/state?gameStateID=not-a-uuid", nil, 400},
+		{"POST", addGameStateIdToURL("/move", gameStateID), url.Values{"FromIndex": {"x"}}, 400},
+		{"GET", addGameStateIdToURL("/state", unknownID), nil, 404},
+		{"GET", addGameStateIdToURL("/difficulty", unknownID), nil, 404},
+		{"POST", addGameStateIdToURL("/flipstock", unknownID), nil, 404},
+		{"POST", addGameStateIdToURL("/move", gameStateID), illegalMove, 422},
+	}
+	for _, test := range tests {
+		testSuite.checkError(test.method, test.route, test.form, test.status)
+	}
+
+	// rating needs an admin
+	testSuite.checkStatus("POST", addGameStateIdToURL("/difficulty", unknownID), 401)
+
+	// the old routes only take the method they were made for
+	testSuite.checkStatus("POST", addGameStateIdToURL("/state", gameStateID), 405)
+	for _, route := range []string{"/newgame", "/move", "/flipstock", "/foundationcard"} {
+		testSuite.checkStatus("GET", addGameStateIdToURL(route, gameStateID), 405)
+	}
+
+	// solving needs an admin, and a sensible maxExpanded
+	solveRoute := addGameStateIdToURL("/solve/stream", gameStateID)
+	resp, err := testSuite.client.Get(testSuite.server.URL + solveRoute)
+	if assert.Nil(testSuite.T(), err) {
+		resp.Body.Close()
+		assert.Equal(testSuite.T(), 401, resp.StatusCode)
+	}
+	req, err := http.NewRequest("GET", testSuite.server.URL+solveRoute+"&maxExpanded=0", nil)
+	assert.Nil(testSuite.T(), err)
+	req.Header.Set("Authorization", "Bearer "+testSuite.adminToken)
+	resp, err = testSuite.client.Do(req)
+	if assert.Nil(testSuite.T(), err) {
+		resp.Body.Close()
+		assert.Equal(testSuite.T(), 400, resp.StatusCode)
+	}
+
+	// admins rating an unknown game state get a 404
+	req, err = http.NewRequest("POST",
+		testSuite.server.URL+addGameStateIdToURL("/difficulty", unknownID), nil)
+	assert.Nil(testSuite.T(), err)
+	req.Header.Set("Authorization", "Bearer "+testSuite.adminToken)
+	resp, err = testSuite.client.Do(req)
+	if assert.Nil(testSuite.T(), err) {
+		resp.Body.Close()
+		assert.Equal(testSuite.T(), 404, resp.StatusCode)
+	}
+
+	// flipping the stock again from the same state would reach a game state
+	// that the game already has
+	testSuite.flipStockPost(gameStateID)
+	testSuite.checkError("POST", addGameStateIdToURL("/flipstock", gameStateID), nil, 409)
+	resp, body := testSuite.apiRequest("POST", "/states/"+gameStateID.String()+"/moves",
+		`{"FromPile":"stock","FromIndex":0,"ToPile":"waste","ToIndex":0}`)
+	assert.Equal(testSuite.T(), 409, resp.StatusCode)
+	assert.Equal(testSuite.T(), "conflict", testSuite.apiErrorCode(body))
+}
+
+// checkError makes the request, with the form if it isn't nil, and checks that
+// it fails with the status and a JSON error
+func (testSuite *MainTestSuite) checkError(
+	method string, route string, form url.Values, status int) {
+	var resp *http.Response
+	var err error
+	if form != nil {
+		resp, err = testSuite.client.PostForm(testSuite.server.URL+route, form)
+	} else {
+		var req *http.Request
+		req, err = http.NewRequest(method, testSuite.server.URL+route, nil)
+		assert.Nil(testSuite.T(), err)
+		resp, err = testSuite.client.Do(req)
+	}
+	assert.Nil(testSuite.T(), err)
+	defer resp.Body.Close()
+	assert.Equal(testSuite.T(), status, resp.StatusCode, "%s %s", method, route)
+
+	type Response struct {
+		Error string
+	}
+	var response Response
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	assert.Nil(testSuite.T(), err)
+	assert.NotEmpty(testSuite.T(), response.Error, "%s %s", method, route)
+}
+
+// checkStatus makes the request and checks only its status, for the replies
+// that don't come from our handlers
+func (testSuite *MainTestSuite) checkStatus(method string, route string, status int) {
+	req, err := http.NewRequest(method, testSuite.server.URL+route, nil)
+	assert.Nil(testSuite.T(), err)
+	resp, err := testSuite.client.Do(req)
+	if assert.Nil(testSuite.T(), err) {
+		resp.Body.Close()
+		assert.Equal(testSuite.T(), status, resp.StatusCode, "%s %s", method, route)
+	}
+}
+
+// apiRequest makes a request to the JSON API, returning the response and its body
+func (testSuite *MainTestSuite) apiRequest(
+	method string, route string, body string) (*http.Response, []byte) {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, testSuite.server.URL+"/api/v1"+route, reader)
+	assert.Nil(testSuite.T(), err)
+	if method != "GET" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := testSuite.client.Do(req)
+	assert.Nil(testSuite.T(), err)
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(testSuite.T(), err)
+	assert.Equal(testSuite.T(), "application/json", resp.Header.Get("Content-Type"))
+	return resp, respBody
+}
+
+// apiGameStateResponse checks the response is a game state and returns its id
+func (testSuite *MainTestSuite) apiGameStateResponse(body []byte) uuid.UUID {
+	type Response struct {
+		GameStateID uuid.UUID
+		Stock       []interface{}
+	}
+	var response Response
+	err := json.Unmarshal(body, &response)
+	assert.Nil(testSuite.T(), err)
+	assert.NotEqual(testSuite.T(), uuid.Nil, response.GameStateID)
+	assert.NotNil(testSuite.T(), response.Stock)
+	return response.GameStateID
+}
+
+// apiErrorCode checks the response is an error envelope and returns its code
+func (testSuite *MainTestSuite) apiErrorCode(body []byte) string {
+	type Response struct {
+		Error struct {
+			Code    string
+			Message string
+		}
+	}
+	var response Response
+	err := json.Unmarshal(body, &response)
+	assert.Nil(testSuite.T(), err)
+	assert.NotEmpty(testSuite.T(), response.Error.Message)
+	return response.Error.Code
+}
+
+// apiNewGamePost tests that we can create a game through the API
+func (testSuite *MainTestSuite) apiNewGamePost() uuid.UUID {
+	resp, body := testSuite.apiRequest("POST", "/games", "")
+	assert.Equal(testSuite.T(), 201, resp.StatusCode)
+	gameStateID := testSuite.apiGameStateResponse(body)
+	assert.Equal(testSuite.T(), "/api/v1/states/"+gameStateID.String(),
+		resp.Header.Get("Location"))
+	return gameStateID
+}
+
+func (testSuite *MainTestSuite) apiStateGet(gameStateID uuid.UUID) {
+	resp, body := testSuite.apiRequest("GET", "/states/"+gameStateID.String(), "")
+	assert.Equal(testSuite.T(), 200, resp.StatusCode)
+	assert.Equal(testSuite.T(), gameStateID, testSuite.apiGameStateResponse(body))
+}
+
+// apiMovePost tests that we can flip the stock with a JSON move, returning the
+// new game state's id
+func (testSuite *MainTestSuite) apiMovePost(gameStateID uuid.UUID) uuid.UUID {
+	resp, body := testSuite.apiRequest("POST", "/states/"+gameStateID.String()+"/moves",
+		`{"FromPile":"stock","FromIndex":0,"ToPile":"waste","ToIndex":0}`)
+	assert.Equal(testSuite.T(), 201, resp.StatusCode)
+	newGameStateID := testSuite.apiGameStateResponse(body)
+	assert.NotEqual(testSuite.T(), gameStateID, newGameStateID)
+	return newGameStateID
+}
+
+// apiErrors tests that the API's errors have the right statuses and codes
+func (testSuite *MainTestSuite) apiErrors(gameStateID uuid.UUID) {
+	statePath := "/states/" + gameStateID.String()
+	tests := []struct {
+		method string
+		route  string
+		body   string
+		status int
+		code   string
+	}{
+		{"GET", "/states/" + uuid.NewV4().String(), "", 404, "not_found"},
+		{"GET", "/states/not-a-uuid", "", 400, "invalid_request"},
+		{"GET", "/nothing/here", "", 404, "not_found"},
+		{"DELETE", statePath, "", 405, "method_not_allowed"},
+		{"GET", statePath + "/moves", "", 405, "method_not_allowed"},
+		{"POST", statePath + "/moves", `{"FromPile":`, 400, "invalid_request"},
+		{"POST", statePath + "/moves", `{"Pile":"stock"}`, 400, "invalid_request"},
+		{"POST", statePath + "/moves",
+			`{"FromPile":"foundation","FromIndex":0,"ToPile":"tableau","ToIndex":0}`,
+			422, "illegal_move"},
+	}
+	for _, test := range tests {
+		resp, body := testSuite.apiRequest(test.method, test.route, test.body)
+		assert.Equal(testSuite.T(), test.status, resp.StatusCode, "%s %s", test.method, test.route)
+		assert.Equal(testSuite.T(), test.code, testSuite.apiErrorCode(body),
+			"%s %s", test.method, test.route)
+	}
+
+	// changes must be sent as JSON, so that forms on other sites can't make them
+	for _, contentType := range []string{"", "application/x-www-form-urlencoded", "text/plain"} {
+		req, err := http.NewRequest("POST", testSuite.server.URL+"/api/v1/games", nil)
+		assert.Nil(testSuite.T(), err)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := testSuite.client.Do(req)
+		if !assert.Nil(testSuite.T(), err) {
+			continue
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Nil(testSuite.T(), err)
+		assert.Equal(testSuite.T(), 415, resp.StatusCode, contentType)
+		assert.Equal(testSuite.T(), "unsupported_media_type", testSuite.apiErrorCode(body), contentType)
+	}
+}
+
+// TestCSRF checks that the web app's posts need the session's CSRF token
+func (testSuite *MainTestSuite) TestCSRF() {
+	t := testSuite.T()
+	client, token := newSessionForTesting(t, testSuite.server.URL)
+	for _, given := range []string{"", "not-the-token", token} {
+		req, err := http.NewRequest("POST", testSuite.server.URL+"/newgame", nil)
+		assert.Nil(t, err)
+		if given != "" {
+			req.Header.Set(handlers.CSRFTokenHeader, given)
+		}
+		resp, err := client.Do(req)
+		if !assert.Nil(t, err) {
+			continue
+		}
+		resp.Body.Close()
+		if given == token {
+			assert.Equal(t, 200, resp.StatusCode)
+		} else {
+			assert.Equal(t, 403, resp.StatusCode, given)
+		}
+	}
 }
 
 func newApplicationForTesting(t *testing.T) *Application {
@@ -135,16 +492,58 @@ func newMiddlewareForTesting(t *testing.T) *interpose.Middleware {
 	return middle
 }
 
+// newSessionForTesting returns a client with a session on the server, like a
+// browser that has opened the home page, and the session's CSRF token
+func newSessionForTesting(t *testing.T, serverURL string) (*http.Client, string) {
+	jar, err := cookiejar.New(nil)
+	assert.Nil(t, err)
+	client := &http.Client{Jar: jar}
+	resp, err := client.Get(serverURL + "/")
+	if !assert.Nil(t, err) {
+		return client, ""
+	}
+	defer resp.Body.Close()
+	page, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	match := csrfMetaRegexp.FindSubmatch(page)
+	if !assert.NotNil(t, match, "the home page has no CSRF token") {
+		return client, ""
+	}
+	return client, string(match[1])
+}
+
+var csrfMetaRegexp = regexp.MustCompile(`<meta name="csrf-token" content="([^"]+)">`)
+
+// csrfTransport sends every request with the session's CSRF token, like the
+// web app's javascript does
+type csrfTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (c *csrfTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	withToken := *req
+	withToken.Header = make(http.Header)
+	for key, values := range req.Header {
+		withToken.Header[key] = values
+	}
+	withToken.Header.Set(handlers.CSRFTokenHeader, c.token)
+	return c.next.RoundTrip(&withToken)
+}
+
 func (testSuite *MainTestSuite) SetupSuite() {
 	middle := newMiddlewareForTesting(testSuite.T())
 	testSuite.server = httptest.NewServer(middle)
-	jar, err := cookiejar.New(nil)
-	assert.Nil(testSuite.T(), err)
-	testSuite.client = &http.Client{Jar: jar}
+	client, csrfToken := newSessionForTesting(testSuite.T(), testSuite.server.URL)
+	client.Transport = &csrfTransport{csrfToken, http.DefaultTransport}
+	testSuite.client = client
+	// solving from /solve/stream and rating from /difficulty need an admin
+	_, testSuite.adminToken, testSuite.deleteAdmin = newAdminForTesting(testSuite.T())
 }
 
 func (testSuite *MainTestSuite) TearDownSuite() {
 	testSuite.server.Close()
+	testSuite.deleteAdmin()
 }
 
 func TestMainSuite(t *testing.T) {
@@ -0,0 +1,106 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/topher200/forty-thieves/libdb"
+	"github.com/topher200/forty-thieves/libhttp"
+)
+
+// Authenticate checks the credentials in each request's Authorization header
+// and puts the user they belong to in the request's context, as "user". Basic
+// auth takes a user's email and password, and Bearer auth one of their API
+// tokens.
+//
+// Requests without credentials are passed on as they are. Requests with
+// credentials that don't check out are refused with unauthorized, so that a
+// mistyped token isn't mistaken for no token.
+func Authenticate(
+	db *sqlx.DB, unauthorized func(http.ResponseWriter, *http.Request, error),
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			auth := req.Header.Get("Authorization")
+			if auth == "" {
+				next.ServeHTTP(res, req)
+				return
+			}
+			user, err := authenticatedUser(db, auth)
+			if err == errWrongCredentials || err == errUnknownScheme {
+				unauthorized(res, req, err)
+				return
+			} else if err != nil {
+				libhttp.HandleServerError(res, err)
+				return
+			}
+			req = req.WithContext(context.WithValue(req.Context(), "user", user))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+var (
+	errWrongCredentials = errors.New("Wrong credentials")
+	errUnknownScheme    = errors.New("Authorization must be Basic or Bearer")
+)
+
+// authenticatedUser returns the user whose credentials are in the
+// Authorization header
+func authenticatedUser(db *sqlx.DB, auth string) (*libdb.UserRow, error) {
+	var user *libdb.UserRow
+	var err error
+	if strings.HasPrefix(auth, "Bearer ") {
+		token := strings.TrimPrefix(auth, "Bearer ")
+		user, err = libdb.NewAPITokenDB(db).GetUserByAPIToken(token)
+	} else if email, password, ok := libhttp.ParseBasicAuth(auth); ok {
+		user, err = libdb.NewUserDB(db).GetUserByEmailAndPassword(email, password)
+	} else {
+		return nil, errUnknownScheme
+	}
+	if _, ok := err.(libdb.NotFoundError); ok || err == libdb.ErrWrongPassword {
+		return nil, errWrongCredentials
+	}
+	return user, err
+}
+
+// RequireAdmin only passes on requests from admins. The user is the one
+// currentUserID finds, like handlers.CurrentUserID, so that admins can log in
+// with their credentials or their session. Everyone else is asked for
+// credentials, or refused if they've given them.
+func RequireAdmin(
+	db *sqlx.DB, currentUserID func(*http.Request) (int64, bool),
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			user, ok := req.Context().Value("user").(*libdb.UserRow)
+			if !ok {
+				userID, loggedIn := currentUserID(req)
+				if !loggedIn {
+					libhttp.BasicAuthUnauthorized(res, nil)
+					return
+				}
+				var err error
+				user, err = libdb.NewUserDB(db).GetUserById(userID)
+				if _, ok := err.(libdb.NotFoundError); ok {
+					// the user was deleted since they logged in
+					libhttp.BasicAuthUnauthorized(res, nil)
+					return
+				} else if err != nil {
+					libhttp.HandleServerError(res, err)
+					return
+				}
+			}
+			if !user.Admin {
+				libhttp.HandleClientError(res, errors.New("Only admins can do that"), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
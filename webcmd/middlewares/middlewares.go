@@ -2,8 +2,11 @@
 package middlewares
 
 import (
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strings"
 
 	"context"
 
@@ -32,8 +35,50 @@ func SetSessionStore(sessionStore sessions.Store) func(http.Handler) http.Handle
 	}
 }
 
+// SetDailySecret puts the secret that daily deals are dealt with in the
+// request's context
+func SetDailySecret(secret []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(context.WithValue(req.Context(), "dailySecret", secret))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
 func SetupLogger(logWriter io.Writer) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return handlers.LoggingHandler(logWriter, next)
 	}
 }
+
+// RequireJSON refuses requests under the prefix that change something, like
+// POST and DELETE, unless they're sent as application/json, even if they have
+// no body. Browsers only send that to another site after asking it with a
+// CORS preflight, which we never allow, so a form or script on another site
+// can't use the user's session cookie to call the API.
+func RequireJSON(
+	prefix string, unsupported func(http.ResponseWriter, *http.Request, error),
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			switch req.Method {
+			case "GET", "HEAD", "OPTIONS":
+				next.ServeHTTP(res, req)
+				return
+			}
+			if !strings.HasPrefix(req.URL.Path, prefix+"/") {
+				next.ServeHTTP(res, req)
+				return
+			}
+			mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				unsupported(res, req, fmt.Errorf("%s %s must be sent as application/json", req.Method, req.URL.Path))
+				return
+			}
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
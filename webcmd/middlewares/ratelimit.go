@@ -0,0 +1,102 @@
+package middlewares
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRateLimitClients is how many clients a RateLimiter keeps track of before
+// it forgets the ones that are back to a full burst
+const maxRateLimitClients = 10000
+
+// RateLimiter lets each client make a burst of requests, and then one more
+// every so often. Clients are the logged in user, or else the remote address.
+type RateLimiter struct {
+	burst int
+	every time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*rateLimitBucket
+}
+
+type rateLimitBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter returns a limiter that allows bursts of burst requests, and
+// one more each every
+func NewRateLimiter(burst int, every time.Duration) *RateLimiter {
+	return &RateLimiter{burst: burst, every: every, clients: make(map[string]*rateLimitBucket)}
+}
+
+// allow takes one of the client's requests. Returns how long until the client
+// may make another, or 0 if they may make this one
+func (l *RateLimiter) allow(client string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.clients[client]
+	if !ok {
+		if len(l.clients) >= maxRateLimitClients {
+			l.forgetFull(now)
+		}
+		bucket = &rateLimitBucket{tokens: float64(l.burst), updated: now}
+		l.clients[client] = bucket
+	}
+	bucket.tokens += float64(now.Sub(bucket.updated)) / float64(l.every)
+	if bucket.tokens > float64(l.burst) {
+		bucket.tokens = float64(l.burst)
+	}
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) * float64(l.every))
+	}
+	bucket.tokens--
+	return 0
+}
+
+// forgetFull forgets the clients that have got back to a full burst, since
+// they're no different to clients we've never seen
+func (l *RateLimiter) forgetFull(now time.Time) {
+	for client, bucket := range l.clients {
+		full := bucket.tokens + float64(now.Sub(bucket.updated))/float64(l.every)
+		if full >= float64(l.burst) {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// RateLimit passes on each client's requests while the limiter allows them.
+// The rest are refused with tooMany, with a Retry-After header.
+//
+// currentUserID finds the logged in user, like handlers.CurrentUserID, so
+// that users are limited wherever they make their requests from.
+func RateLimit(
+	limiter *RateLimiter, currentUserID func(*http.Request) (int64, bool),
+	tooMany func(http.ResponseWriter, *http.Request, error),
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			var client string
+			if userID, ok := currentUserID(req); ok {
+				client = "user " + strconv.FormatInt(userID, 10)
+			} else if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+				client = "address " + host
+			} else {
+				client = "address " + req.RemoteAddr
+			}
+			if wait := limiter.allow(client, time.Now()); wait > 0 {
+				seconds := int64(wait/time.Second) + 1
+				res.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+				tooMany(res, req, fmt.Errorf("Too many requests. Try again in %d seconds", seconds))
+				return
+			}
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	gorilla_mux "github.com/gorilla/mux"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/topher200/forty-thieves/libclient"
+	"github.com/topher200/forty-thieves/libgame"
+	"github.com/topher200/forty-thieves/libsolver"
+	"github.com/topher200/forty-thieves/webcmd/handlers"
+)
+
+// openAPISpec is the parts of the OpenAPI document that we check
+type openAPISpec struct {
+	Paths      map[string]map[string]interface{}
+	Components struct {
+		Schemas map[string]struct {
+			Required   []string
+			Properties map[string]interface{}
+		}
+	}
+}
+
+// getOpenAPISpec gets the document from the router, which doesn't need a
+// database to serve it
+func getOpenAPISpec(t *testing.T) openAPISpec {
+	w := httptest.NewRecorder()
+	(&Application{}).mux().ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var spec openAPISpec
+	err := json.Unmarshal(w.Body.Bytes(), &spec)
+	assert.Nil(t, err)
+	return spec
+}
+
+// TestOpenAPIDescribesEveryRoute checks that the document and the router have
+// the same paths, and that the document has every method that's routed
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	spec := getOpenAPISpec(t)
+
+	// the API's subrouter and catch-all, and the file servers
+	skipped := map[string]bool{
+		"/api/v1": true, "/api/v1/": true, "/bower_components": true, "/static": true,
+	}
+	routed := make(map[string]bool)
+	err := (&Application{}).mux().Walk(
+		func(route *gorilla_mux.Route, router *gorilla_mux.Router, ancestors []*gorilla_mux.Route) error {
+			path, err := route.GetPathTemplate()
+			if err != nil || skipped[path] {
+				return nil
+			}
+			routed[path] = true
+			_, ok := spec.Paths[path]
+			assert.True(t, ok, "%s isn't in the document", path)
+			methods, err := route.GetMethods()
+			if err != nil {
+				// routes without methods catch the methods that aren't allowed
+				return nil
+			}
+			for _, method := range methods {
+				assert.Contains(t, spec.Paths[path], strings.ToLower(method), path)
+			}
+			return nil
+		})
+	assert.Nil(t, err)
+	for path := range spec.Paths {
+		assert.True(t, routed[path], "%s isn't routed", path)
+	}
+}
+
+// TestOpenAPISchemasMatchTypes checks that the types handlers send, and that
+// libclient decodes, have the properties their schemas describe
+func TestOpenAPISchemasMatchTypes(t *testing.T) {
+	spec := getOpenAPISpec(t)
+
+	types := []struct {
+		schema string
+		value  interface{}
+	}{
+		{"GameStateWithChildren", handlers.GameStateWithChildren{}},
+		{"GameStateWithChildren", libclient.GameState{}},
+		{"MoveRequest", libgame.MoveRequest{}},
+		{"Hint", handlers.Hint{}},
+		{"Hint", libclient.Hint{}},
+		{"Difficulty", libsolver.Difficulty{}},
+		{"SolveEvent", handlers.SolveEvent{}},
+		{"Credentials", handlers.Credentials{}},
+		{"User", handlers.User{}},
+		{"User", libclient.User{}},
+		{"NewDisplayName", handlers.NewDisplayName{}},
+		{"Share", handlers.Share{}},
+		{"UserStats", handlers.UserStats{}},
+		{"UserStats", libclient.UserStats{}},
+		{"LeaderboardEntry", handlers.LeaderboardEntry{}},
+		{"LeaderboardEntry", libclient.LeaderboardEntry{}},
+		{"DailyAttempt", handlers.DailyAttempt{}},
+		{"DailyAttempt", libclient.DailyAttempt{}},
+		{"DailySubmission", handlers.DailySubmission{}},
+		{"DailyResult", handlers.DailyResult{}},
+		{"DailyDeal", handlers.DailyDeal{}},
+		{"DailyDeal", libclient.DailyDeal{}},
+		{"GameTree", handlers.GameTree{}},
+		{"GameTree", libclient.GameTree{}},
+		{"GameTreeNode", handlers.GameTreeNode{}},
+		{"GameTreeNode", libclient.GameTreeNode{}},
+		{"GameTreeCounts", handlers.GameTreeCounts{}},
+		{"GameTreeCounts", libclient.GameTreeCounts{}},
+		{"NewAPIToken", handlers.NewAPIToken{}},
+		{"APIToken", handlers.APIToken{}},
+		{"APIToken", libclient.APIToken{}},
+		{"APIErrorResponse", handlers.APIErrorResponse{}},
+		{"APIError", handlers.APIError{}},
+	}
+	for _, test := range types {
+		schema, ok := spec.Components.Schemas[test.schema]
+		assert.True(t, ok, test.schema)
+
+		data, err := json.Marshal(test.value)
+		assert.Nil(t, err)
+		var fields map[string]interface{}
+		err = json.Unmarshal(data, &fields)
+		assert.Nil(t, err)
+
+		var names, properties []string
+		for name := range fields {
+			names = append(names, name)
+		}
+		for property := range schema.Properties {
+			properties = append(properties, property)
+		}
+		sort.Strings(names)
+		sort.Strings(properties)
+		// fields left out when empty aren't required
+		for _, required := range schema.Required {
+			assert.Contains(t, names, required, "%s %T", test.schema, test.value)
+		}
+		assert.Subset(t, properties, names, "%s %T", test.schema, test.value)
+	}
+}
+
+// ContractTestSuite runs libclient against the web app
+type ContractTestSuite struct {
+	suite.Suite
+	server      *httptest.Server
+	client      *libclient.Client
+	admin       *libclient.Client
+	deleteAdmin func()
+}
+
+// TestClient plays a game through the client, and checks that its errors are
+// decoded
+func (testSuite *ContractTestSuite) TestClient() {
+	t := testSuite.T()
+	client := testSuite.client
+
+	gameState, err := client.NewGame()
+	assert.Nil(t, err)
+	assert.Equal(t, libgame.InProgress, gameState.Status)
+	assert.False(t, gameState.PreviousGameState.Valid)
+
+	latest, err := client.LatestState()
+	assert.Nil(t, err)
+	assert.Equal(t, gameState.GameStateID, latest.GameStateID)
+
+	flipped, err := client.Move(gameState.GameStateID, libsolver.FlipStockMove)
+	assert.Nil(t, err)
+	assert.Equal(t, gameState.GameStateID, flipped.PreviousGameState.UUID)
+	assert.Equal(t, len(gameState.Stock.Cards)-1, len(flipped.Stock.Cards))
+
+	parent, err := client.State(gameState.GameStateID)
+	assert.Nil(t, err)
+	assert.Contains(t, parent.ChildGameStates, flipped.GameStateID)
+
+	hint, err := client.Hint(flipped.GameStateID)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, hint.Moves)
+
+	_, err = client.Difficulty(flipped.GameStateID)
+	checkClientError(t, err, 404, libclient.CodeNotFound)
+	// only admins can rate games
+	_, err = client.RateDifficulty(flipped.GameStateID)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "401")
+	}
+	difficulty, err := testSuite.admin.RateDifficulty(flipped.GameStateID)
+	assert.Nil(t, err)
+	assert.Contains(t, []libsolver.DifficultyRating{
+		libsolver.Easy, libsolver.Medium, libsolver.Hard}, difficulty.Rating)
+	saved, err := client.Difficulty(flipped.GameStateID)
+	assert.Nil(t, err)
+	assert.Equal(t, difficulty, saved)
+
+	// we're not guaranteed to have a card to foundation
+	_, err = client.FoundationCard(flipped.GameStateID)
+	if err != nil {
+		checkClientError(t, err, 422, libclient.CodeIllegalMove)
+	}
+
+	_, err = client.Move(flipped.GameStateID, libgame.MoveRequest{
+		FromPile: libgame.FOUNDATION, FromIndex: 0, ToPile: libgame.TABLEAU, ToIndex: 0})
+	checkClientError(t, err, 422, libclient.CodeIllegalMove)
+
+	_, err = client.State(uuid.NewV4())
+	checkClientError(t, err, 404, libclient.CodeNotFound)
+}
+
+func (testSuite *ContractTestSuite) SetupSuite() {
+	middle := newMiddlewareForTesting(testSuite.T())
+	testSuite.server = httptest.NewServer(middle)
+	testSuite.client = libclient.NewClient(testSuite.server.URL)
+	// rating games needs an admin
+	var adminToken string
+	_, adminToken, testSuite.deleteAdmin = newAdminForTesting(testSuite.T())
+	testSuite.admin = libclient.NewClient(testSuite.server.URL)
+	testSuite.admin.APIToken = adminToken
+}
+
+func (testSuite *ContractTestSuite) TearDownSuite() {
+	testSuite.server.Close()
+	testSuite.deleteAdmin()
+}
+
+func TestContractSuite(t *testing.T) {
+	suite.Run(t, new(ContractTestSuite))
+}
@@ -5,9 +5,19 @@ function CardGameViewModel()  {
     self.tableaus = ko.observableArray();
     self.waste = ko.observableArray();
     self.score = ko.observable();
+    self.status = ko.observable();
+    self.lostReason = ko.observable();
     self.gameStateID = ko.observable();
     self.parentGameStateId = ko.observable();
     self.childGameStateIds = ko.observable();
+    self.solveProgress = ko.observable();
+    self.solveSolution = ko.observable();
+
+    // send the page's CSRF token with every post, so the server knows they
+    // came from us
+    $.ajaxSetup({
+        headers: {"X-CSRF-Token": $('meta[name="csrf-token"]').attr("content")}
+    });
 
     // set our query param, if we have it, before we make any json requests
     var pageUrl = new URL(window.location.href);
@@ -68,6 +78,49 @@ function CardGameViewModel()  {
         $.post(addGameStateIdToPath("/foundationcard"), {}, self.updateGamestate, "json");
     };
 
+    // Stream a solve from the current state, showing the solver's progress
+    self.solveStream = function() {
+        if (self.solveEvents) {
+            self.solveEvents.close();
+        }
+        self.solveSolution("");
+        self.solveProgress("Starting the solver...");
+        var events = new EventSource(addGameStateIdToPath("/solve/stream"));
+        self.solveEvents = events;
+        events.onerror = function() {
+            // the server refused the stream, like when it's running too many solves
+            if (events.readyState === EventSource.CLOSED) {
+                self.solveProgress("The solver couldn't be started. Try again later.");
+            }
+        };
+        events.addEventListener("progress", function(event) {
+            var progress = JSON.parse(event.data);
+            self.solveProgress(
+                "Expanded " + progress.Expanded + " states (" +
+                Math.round(progress.StatesPerSecond) + "/sec). Best score " +
+                progress.BestScore + ".");
+        });
+        events.addEventListener("done", function(event) {
+            var result = JSON.parse(event.data);
+            events.close();
+            if (result.Error) {
+                self.solveProgress("The solver failed: " + result.Error);
+            } else if (result.Solved) {
+                self.solveProgress(
+                    "Solved in " + result.Solution.length + " moves, after expanding " +
+                    result.Expanded + " states.");
+                self.solveSolution(result.Solution.map(function(move) {
+                    return move.FromPile + " " + move.FromIndex + " to " +
+                        move.ToPile + " " + move.ToIndex;
+                }).join(", "));
+            } else {
+                self.solveProgress(
+                    "No solution found after expanding " + result.Expanded +
+                    " states. Best score " + result.BestScore + ".");
+            }
+        });
+    };
+
     self.goToState = function(gameStateId) {
         $.getJSON("/state?gameStateID=" + gameStateId, self.updateGamestate);
     };
@@ -82,6 +135,8 @@ function CardGameViewModel()  {
         self.tableaus(gamestate.Tableaus);
         self.waste(gamestate.Waste.Cards);
         self.score(gamestate.Score);
+        self.status(gamestate.Status);
+        self.lostReason(gamestate.Lost ? gamestate.LostReason : "");
         self.gameStateID(gamestate.GameStateID);
         self.parentGameStateId(gamestate.PreviousGameState.UUID);
         self.childGameStateIds(gamestate.ChildGameStates);
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/topher200/forty-thieves/libclient"
+	"github.com/topher200/forty-thieves/libsolver"
+)
+
+// TreeTestSuite explores the game states reached in a game
+type TreeTestSuite struct {
+	suite.Suite
+	server *httptest.Server
+}
+
+// TestTree flips the stock twice and explores the three game states
+func (testSuite *TreeTestSuite) TestTree() {
+	t := testSuite.T()
+	client := libclient.NewClient(testSuite.server.URL)
+	root, err := client.NewGame()
+	if !assert.Nil(t, err) {
+		return
+	}
+	child, err := client.Move(root.GameStateID, libsolver.FlipStockMove)
+	assert.Nil(t, err)
+	grandchild, err := client.Move(child.GameStateID, libsolver.FlipStockMove)
+	assert.Nil(t, err)
+
+	tree, err := client.StateTree(root.GameStateID, 5, 0)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.False(t, tree.Truncated)
+	assert.Equal(t, 5, tree.Depth)
+	assert.Equal(t, root.GameStateID, tree.Root.GameStateID)
+	assert.Nil(t, tree.Root.Move)
+	assert.Equal(t, libclient.GameTreeCounts{States: 3, Unprocessed: 3, BestScore: root.Score},
+		tree.Root.Counts)
+	if assert.Len(t, tree.Root.Children, 1) {
+		node := tree.Root.Children[0]
+		assert.Equal(t, child.GameStateID, node.GameStateID)
+		assert.Equal(t, 1, node.Depth)
+		assert.Equal(t, "UNPROCESSED", node.Status)
+		assert.Equal(t, &libsolver.FlipStockMove, node.Move)
+		if assert.Len(t, node.Children, 1) {
+			assert.Equal(t, grandchild.GameStateID, node.Children[0].GameStateID)
+			assert.Empty(t, node.Children[0].Children)
+		}
+	}
+
+	// leaves still count their children
+	tree, err = client.StateTree(child.GameStateID, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, child.GameStateID, tree.Root.GameStateID)
+	assert.EqualValues(t, 1, tree.Root.ChildCount)
+	assert.Empty(t, tree.Root.Children)
+
+	tree, err = client.StateTree(root.GameStateID, 5, 2)
+	assert.Nil(t, err)
+	assert.True(t, tree.Truncated)
+	assert.EqualValues(t, 2, tree.Root.Counts.States)
+
+	tree, err = client.GameTree(root.GameID, 1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, root.GameStateID, tree.Root.GameStateID)
+	assert.EqualValues(t, 2, tree.Root.Counts.States)
+
+	_, err = client.StateTree(root.GameStateID, 11, 0)
+	checkClientError(t, err, 400, libclient.CodeInvalidRequest)
+	_, err = client.StateTree(uuid.NewV4(), 1, 0)
+	checkClientError(t, err, 404, libclient.CodeNotFound)
+	_, err = client.GameTree(-1, 1, 0)
+	checkClientError(t, err, 404, libclient.CodeNotFound)
+}
+
+func (testSuite *TreeTestSuite) SetupSuite() {
+	middle := newMiddlewareForTesting(testSuite.T())
+	testSuite.server = httptest.NewServer(middle)
+}
+
+func (testSuite *TreeTestSuite) TearDownSuite() {
+	testSuite.server.Close()
+}
+
+func TestTreeSuite(t *testing.T) {
+	suite.Run(t, new(TreeTestSuite))
+}
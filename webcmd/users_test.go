@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/topher200/forty-thieves/libclient"
+	"github.com/topher200/forty-thieves/libsolver"
+	"github.com/topher200/forty-thieves/webcmd/handlers"
+)
+
+// UsersTestSuite plays games as different users
+type UsersTestSuite struct {
+	suite.Suite
+	server *httptest.Server
+}
+
+// newEmail makes an email that no other test run has used
+func newEmail() string {
+	return uuid.NewV4().String() + "@example.com"
+}
+
+// checkClientError asserts that the client returned an API error with the status and code
+func checkClientError(t *testing.T, err error, status int, code string) {
+	apiErr, ok := err.(*libclient.Error)
+	if assert.True(t, ok, "expected a *libclient.Error, got %v", err) {
+		assert.Equal(t, status, apiErr.StatusCode)
+		assert.Equal(t, code, apiErr.Code)
+	}
+}
+
+// TestAccounts signs up, logs out and logs back in
+func (testSuite *UsersTestSuite) TestAccounts() {
+	t := testSuite.T()
+	client := libclient.NewClient(testSuite.server.URL)
+	email := newEmail()
+
+	_, err := client.Me()
+	checkClientError(t, err, 401, libclient.CodeUnauthorized)
+	_, err = client.Signup(email, "short")
+	checkClientError(t, err, 400, libclient.CodeInvalidRequest)
+	_, err = client.Signup(email, strings.Repeat("correct horse ", 6))
+	checkClientError(t, err, 400, libclient.CodeInvalidRequest)
+	_, err = client.Signup("not an email", "correct horse")
+	checkClientError(t, err, 400, libclient.CodeInvalidRequest)
+
+	user, err := client.Signup(email, "correct horse")
+	assert.Nil(t, err)
+	assert.Equal(t, email, user.Email)
+	me, err := client.Me()
+	assert.Nil(t, err)
+	assert.Equal(t, user, me)
+	_, err = client.Signup(email, "battery staple")
+	checkClientError(t, err, 409, libclient.CodeConflict)
+
+	assert.Nil(t, client.Logout())
+	_, err = client.Me()
+	checkClientError(t, err, 401, libclient.CodeUnauthorized)
+
+	_, err = client.Login(email, "battery staple")
+	checkClientError(t, err, 401, libclient.CodeUnauthorized)
+	_, err = client.Login(newEmail(), "correct horse")
+	checkClientError(t, err, 401, libclient.CodeUnauthorized)
+	loggedIn, err := client.Login(email, "correct horse")
+	assert.Nil(t, err)
+	assert.Equal(t, user, loggedIn)
+}
+
+// TestOwnership checks that only a game's owner, and whoever they share it
+// with, can move in it
+func (testSuite *UsersTestSuite) TestOwnership() {
+	t := testSuite.T()
+	owner := libclient.NewClient(testSuite.server.URL)
+	_, err := owner.Signup(newEmail(), "correct horse")
+	assert.Nil(t, err)
+	gameState, err := owner.NewGame()
+	assert.Nil(t, err)
+
+	// anyone can look, but not move
+	other := libclient.NewClient(testSuite.server.URL)
+	_, err = other.Signup(newEmail(), "correct horse")
+	assert.Nil(t, err)
+	anonymous := libclient.NewClient(testSuite.server.URL)
+	for _, client := range []*libclient.Client{other, anonymous} {
+		_, err = client.State(gameState.GameStateID)
+		assert.Nil(t, err)
+		_, err = client.Move(gameState.GameStateID, libsolver.FlipStockMove)
+		checkClientError(t, err, 403, libclient.CodeForbidden)
+		_, err = client.Share(gameState.GameStateID)
+		checkClientError(t, err, 403, libclient.CodeForbidden)
+	}
+	browser, csrfToken := newSessionForTesting(t, testSuite.server.URL)
+	req, err := http.NewRequest("POST", addGameStateIdToURL(testSuite.server.URL+"/flipstock",
+		gameState.GameStateID), nil)
+	assert.Nil(t, err)
+	req.Header.Set(handlers.CSRFTokenHeader, csrfToken)
+	resp, err := browser.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 403, resp.StatusCode)
+
+	// until the owner shares it
+	anonymous.ShareToken, err = owner.Share(gameState.GameStateID)
+	assert.Nil(t, err)
+	flipped, err := anonymous.Move(gameState.GameStateID, libsolver.FlipStockMove)
+	assert.Nil(t, err)
+	anonymous.ShareToken = "not the token"
+	_, err = anonymous.Move(flipped.GameStateID, libsolver.FlipStockMove)
+	checkClientError(t, err, 403, libclient.CodeForbidden)
+
+	_, err = owner.Move(flipped.GameStateID, libsolver.FlipStockMove)
+	assert.Nil(t, err)
+
+	// games dealt without logging in are open to everyone
+	unowned, err := anonymous.NewGame()
+	assert.Nil(t, err)
+	_, err = other.Move(unowned.GameStateID, libsolver.FlipStockMove)
+	assert.Nil(t, err)
+	_, err = other.Share(unowned.GameStateID)
+	checkClientError(t, err, 404, libclient.CodeNotFound)
+}
+
+// TestStats checks that the user's games are summed up
+func (testSuite *UsersTestSuite) TestStats() {
+	t := testSuite.T()
+	client := libclient.NewClient(testSuite.server.URL)
+	_, err := client.Stats()
+	checkClientError(t, err, 401, libclient.CodeUnauthorized)
+	_, err = client.Signup(newEmail(), "correct horse")
+	assert.Nil(t, err)
+
+	gameState, err := client.NewGame()
+	assert.Nil(t, err)
+	_, err = client.Hint(gameState.GameStateID)
+	assert.Nil(t, err)
+	// hints asked for by someone who can't move in the game don't count
+	_, err = libclient.NewClient(testSuite.server.URL).Hint(gameState.GameStateID)
+	assert.Nil(t, err)
+	_, err = client.Move(gameState.GameStateID, libsolver.FlipStockMove)
+	assert.Nil(t, err)
+	// we're not guaranteed to have a card to foundation. if we do, moving
+	// again from the first state is an undo
+	undos := int64(0)
+	if _, err = client.FoundationCard(gameState.GameStateID); err == nil {
+		undos = 1
+	}
+
+	stats, err := client.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, libclient.UserStats{GamesPlayed: 1, Hints: 1, Undos: undos}, *stats)
+}
+
+// TestDisplayName checks that users are shown by a handle until they choose a
+// display name, and that nobody can choose a taken name or an email
+func (testSuite *UsersTestSuite) TestDisplayName() {
+	t := testSuite.T()
+	client := libclient.NewClient(testSuite.server.URL)
+	_, err := client.SetDisplayName("Ali Baba")
+	checkClientError(t, err, 401, libclient.CodeUnauthorized)
+	user, err := client.Signup(newEmail(), "correct horse")
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("player-%d", user.ID), user.DisplayName)
+
+	for _, name := range []string{"", "a", "someone@example.com", " spaced", "Player-1", strings.Repeat("a", 25)} {
+		_, err = client.SetDisplayName(name)
+		checkClientError(t, err, 400, libclient.CodeInvalidRequest)
+	}
+	name := "Thief " + uuid.NewV4().String()[:8]
+	renamed, err := client.SetDisplayName(name)
+	assert.Nil(t, err)
+	assert.Equal(t, name, renamed.DisplayName)
+	me, err := client.Me()
+	assert.Nil(t, err)
+	assert.Equal(t, renamed, me)
+
+	other := libclient.NewClient(testSuite.server.URL)
+	_, err = other.Signup(newEmail(), "correct horse")
+	assert.Nil(t, err)
+	_, err = other.SetDisplayName(strings.ToLower(name))
+	checkClientError(t, err, 409, libclient.CodeConflict)
+}
+
+// TestLeaderboard checks the leaderboard's limit
+func (testSuite *UsersTestSuite) TestLeaderboard() {
+	t := testSuite.T()
+	client := libclient.NewClient(testSuite.server.URL)
+	entries, err := client.Leaderboard(0)
+	assert.Nil(t, err)
+	assert.True(t, len(entries) <= 10)
+	for i, entry := range entries {
+		assert.Equal(t, i+1, entry.Rank)
+		assert.NotContains(t, entry.Name, "@")
+	}
+	_, err = client.Leaderboard(101)
+	checkClientError(t, err, 400, libclient.CodeInvalidRequest)
+}
+
+func (testSuite *UsersTestSuite) SetupSuite() {
+	middle := newMiddlewareForTesting(testSuite.T())
+	testSuite.server = httptest.NewServer(middle)
+}
+
+func (testSuite *UsersTestSuite) TearDownSuite() {
+	testSuite.server.Close()
+}
+
+func TestUsersSuite(t *testing.T) {
+	suite.Run(t, new(UsersTestSuite))
+}